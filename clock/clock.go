@@ -0,0 +1,21 @@
+// Package clock abstracts the current time, so that time dependent behaviour (campaign dates, expiry, validity
+// periods) can be tested without sleeping. See the clocktest package for a fake clock.
+package clock
+
+import "time"
+
+// Clock returns the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+// Real returns the clock of the system
+func Real() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,996 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	go_referral "github.com/PayRam/go-referral"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var commands = map[string]*command{
+	"events create":         {help: "Create an event", run: createEvent},
+	"events list":           {help: "List events", run: listEvents},
+	"campaigns create":      {help: "Create a campaign", run: createCampaign},
+	"campaigns list":        {help: "List campaigns", run: listCampaigns},
+	"campaigns set-default": {help: "Make a campaign the default of the project", run: setDefaultCampaign},
+	"campaigns pause":       {help: "Pause a campaign", run: campaignStatus("paused")},
+	"campaigns resume":      {help: "Resume a paused campaign", run: campaignStatus("active")},
+	"campaigns archive":     {help: "Archive a campaign", run: campaignStatus("archived")},
+	"members create":        {help: "Create a member", run: createMember},
+	"members list":          {help: "List members", run: listMembers},
+	"members attach":        {help: "Attach a referrer to a member who signed up without one", run: attachReferrer},
+	"members status":        {help: "Activate, deactivate, suspend or ban a member", run: changeMemberStatus},
+	"members forget":        {help: "Erase the personal data of a member", run: forgetMember},
+	"members export":        {help: "Print every record tied to a member as JSON", run: exportMemberData},
+	"audit list":            {help: "List the audit log of the changes made to members", run: listAuditLogs},
+	"enrollments add":       {help: "Enroll a member in a campaign", run: enrollMember},
+	"enrollments remove":    {help: "End the enrollment of a member in a campaign", run: unenrollMember},
+	"enrollments bulk":      {help: "Enroll the members matching filters in a campaign", run: enrollMembers},
+	"enrollments list":      {help: "List the enrollments of members in campaigns, ended ones included", run: listEnrollments},
+	"codes create":          {help: "Add a referral code to a member", run: createReferralCode},
+	"codes list":            {help: "List referral codes", run: listReferralCodes},
+	"clicks record":         {help: "Record a click on a referral link", run: recordClick},
+	"clicks list":           {help: "List clicks on referral links", run: listClicks},
+	"event-logs create":     {help: "Record an event triggered by a member", run: createEventLog},
+	"event-logs list":       {help: "List event logs", run: listEventLogs},
+	"worker run":            {help: "Process the pending event logs once", run: runWorker},
+	"worker simulate":       {help: "Print what a pass over a campaign and past event logs would reward", run: simulateWorker},
+	"rewards list":          {help: "List rewards", run: listRewards},
+	"stats referrers":       {help: "Print the referees and rewards of each referrer", run: referrerStats},
+	"stats rewards":         {help: "Print the rewards per day", run: rewardStats},
+	"stats codes":           {help: "Print the clicks, signups and conversions of each referral code", run: codeStats},
+	"migrate up":            {help: "Apply the pending migrations", run: migrateUp, noSvc: true},
+	"migrate status":        {help: "List the migrations and whether they were applied", run: migrateStatus, noSvc: true},
+	"encryption reencrypt":  {help: "Encrypt the personal data with the current key, e.g. after a rotation", run: reencryptPII, noSvc: true},
+	"migrate rollback":      {help: "Roll back the migrations applied after -to", run: migrateRollback, noSvc: true},
+}
+
+// parse parses the flags of a command, which takes no positional arguments
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+func (a *app) requireProject() error {
+	if a.project == "" {
+		return fmt.Errorf("no project given: set -project or GO_REFERRAL_PROJECT")
+	}
+	return nil
+}
+
+// projects filters the lists by the project, if one is given
+func (a *app) projects() []string {
+	if a.project == "" {
+		return nil
+	}
+	return []string{a.project}
+}
+
+func pagination(limit int) request.PaginationConditions {
+	return request.PaginationConditions{Limit: &limit}
+}
+
+func id(n uint) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
+
+// Events
+
+var eventHeaders = []string{"ID", "KEY", "NAME", "TYPE"}
+
+func eventRow(e models.Event) []string {
+	return []string{id(e.ID), e.Key, e.Name, e.EventType}
+}
+
+func createEvent(a *app, args []string) error {
+	fs := newFlagSet("events create")
+	var req request.CreateEventRequest
+	var description stringFlag
+	fs.StringVar(&req.Key, "key", "", "Key the event logs refer to (required)")
+	fs.StringVar(&req.Name, "name", "", "Name (required)")
+	fs.StringVar(&req.EventType, "type", "simple", "Type: simple or payment")
+	fs.Var(&description, "description", "Description")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+	req.Description = description.value
+
+	event, err := a.service.Events.CreateEvent(a.project, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *event, eventHeaders, eventRow)
+}
+
+func listEvents(a *app, args []string) error {
+	fs := newFlagSet("events list")
+	limit := fs.Int("limit", 100, "Maximum number of events")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	events, _, err := a.service.Events.GetEvents(request.GetEventsRequest{
+		Projects:             a.projects(),
+		PaginationConditions: pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, events, eventHeaders, eventRow)
+}
+
+// Campaigns
+
+var campaignHeaders = []string{"ID", "NAME", "STATUS", "DEFAULT", "TYPE", "CURRENCY", "REWARD", "BUDGET", "START", "END", "EVENTS"}
+
+func campaignRow(c models.Campaign) []string {
+	reward := "-"
+	if c.RewardType != nil {
+		reward = *c.RewardType + " " + formatDecimal(c.RewardValue)
+	}
+	keys := make([]string, len(c.Events))
+	for i, event := range c.Events {
+		keys[i] = event.Key
+	}
+	return []string{
+		id(c.ID), c.Name, c.Status, strconv.FormatBool(c.IsDefault), c.CampaignTypePerCustomer, c.CurrencyCode,
+		reward, formatDecimal(c.Budget), formatTime(c.StartDate), formatTime(c.EndDate), strings.Join(keys, ","),
+	}
+}
+
+func createCampaign(a *app, args []string) error {
+	fs := newFlagSet("campaigns create")
+	var req request.CreateCampaignRequest
+	var rewardType, inviteeRewardType, description, inactiveReferrerPolicy stringFlag
+	var rewardValue, rewardCap, inviteeRewardValue, inviteeRewardCap, budget, rewardCapPerCustomer decimalFlag
+	var startDate, endDate timeFlag
+	var events listFlag
+	fs.StringVar(&req.Name, "name", "", "Name (required)")
+	fs.StringVar(&req.CurrencyCode, "currency", "USD", "Currency of the rewards")
+	fs.Var(&rewardType, "reward-type", "Referrer reward type: flat_fee or percentage")
+	fs.Var(&rewardValue, "reward-value", "Referrer reward, a flat fee or a percentage of the event amount")
+	fs.Var(&rewardCap, "reward-cap", "Cap of each percentage referrer reward")
+	fs.Var(&inviteeRewardType, "invitee-reward-type", "Invitee reward type: flat_fee or percentage")
+	fs.Var(&inviteeRewardValue, "invitee-reward-value", "Invitee reward")
+	fs.Var(&inviteeRewardCap, "invitee-reward-cap", "Cap of each percentage invitee reward")
+	fs.Var(&budget, "budget", "Budget, after which the campaign is paused")
+	fs.Var(&description, "description", "Description")
+	fs.Var(&startDate, "start", "Start date (RFC 3339 or YYYY-MM-DD)")
+	fs.Var(&endDate, "end", "End date (RFC 3339 or YYYY-MM-DD)")
+	fs.BoolVar(&req.IsDefault, "default", false, "Make it the default campaign of the project")
+	fs.StringVar(&req.CampaignTypePerCustomer, "type", "forever", "Rewards per referee: one_time, forever, months_per_customer or count_per_customer")
+	validityMonths := fs.Int("validity-months", 0, "Months a referee is rewarded for, with months_per_customer")
+	maxOccurrences := fs.Int64("max-occurrences", 0, "Rewarded events per referee, with count_per_customer")
+	fs.Var(&rewardCapPerCustomer, "reward-cap-per-customer", "Total reward cap per referee")
+	fs.Var(&inactiveReferrerPolicy, "inactive-referrer-policy", "Rewards of inactive referrers: forfeit, or hold (the default)")
+	holdDays := fs.Int("inactive-referrer-hold-days", 0, "Days inactive referrers have to be reactivated in, with hold")
+	fs.Var(&events, "events", "Comma separated keys of the events that trigger rewards")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	req.RewardType = rewardType.value
+	req.RewardValue = rewardValue.value
+	req.RewardCap = rewardCap.value
+	req.InviteeRewardType = inviteeRewardType.value
+	req.InviteeRewardValue = inviteeRewardValue.value
+	req.InviteeRewardCap = inviteeRewardCap.value
+	req.Budget = budget.value
+	req.Description = description.value
+	req.StartDate = startDate.value
+	req.EndDate = endDate.value
+	req.RewardCapPerCustomer = rewardCapPerCustomer.value
+	req.EventKeys = events.values
+	if isSet(fs, "validity-months") {
+		req.ValidityMonthsPerCustomer = validityMonths
+	}
+	if isSet(fs, "max-occurrences") {
+		req.MaxOccurrencesPerCustomer = maxOccurrences
+	}
+	req.InactiveReferrerPolicy = inactiveReferrerPolicy.value
+	if isSet(fs, "inactive-referrer-hold-days") {
+		req.InactiveReferrerHoldDays = holdDays
+	}
+
+	campaign, err := a.service.Campaigns.CreateCampaign(a.project, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *campaign, campaignHeaders, campaignRow)
+}
+
+func listCampaigns(a *app, args []string) error {
+	fs := newFlagSet("campaigns list")
+	var status stringFlag
+	fs.Var(&status, "status", "Only campaigns with this status: active, paused or archived")
+	limit := fs.Int("limit", 100, "Maximum number of campaigns")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	campaigns, _, err := a.service.Campaigns.GetCampaigns(request.GetCampaignsRequest{
+		Projects:             a.projects(),
+		Status:               status.value,
+		PaginationConditions: pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, campaigns, campaignHeaders, campaignRow)
+}
+
+func setDefaultCampaign(a *app, args []string) error {
+	fs := newFlagSet("campaigns set-default")
+	campaignID := fs.Uint("id", 0, "Campaign ID (required)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	campaign, err := a.service.Campaigns.SetDefaultCampaign(a.project, *campaignID)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *campaign, campaignHeaders, campaignRow)
+}
+
+// campaignStatus returns the command moving a campaign to status
+func campaignStatus(status string) func(a *app, args []string) error {
+	return func(a *app, args []string) error {
+		fs := newFlagSet("campaigns " + status)
+		campaignID := fs.Uint("id", 0, "Campaign ID (required)")
+		if err := parse(fs, args); err != nil {
+			return err
+		}
+		if err := a.requireProject(); err != nil {
+			return err
+		}
+
+		campaign, err := a.service.Campaigns.UpdateCampaignStatus(a.project, *campaignID, status)
+		if err != nil {
+			return err
+		}
+		return printOne(a.out, *campaign, campaignHeaders, campaignRow)
+	}
+}
+
+// Members
+
+var memberHeaders = []string{"ID", "REFERENCE_ID", "CODE", "STATUS", "EMAIL", "REFERRED_BY"}
+
+func memberRow(m models.Member) []string {
+	return []string{id(m.ID), m.ReferenceID, m.Code, m.Status, formatString(m.Email), formatString(m.ReferredByMemberReferenceID)}
+}
+
+func createMember(a *app, args []string) error {
+	fs := newFlagSet("members create")
+	var req request.CreateMemberRequest
+	var referrerCode, preferredCode, email, visitorID stringFlag
+	var campaigns listFlag
+	var attributes attributeFlag
+	fs.StringVar(&req.ReferenceID, "reference-id", "", "ID of the member in the calling system (required)")
+	fs.Var(&referrerCode, "referrer-code", "Referral code of the member's referrer")
+	fs.Var(&preferredCode, "code", "Referral code of the member, generated if not given")
+	fs.Var(&email, "email", "Email")
+	fs.Var(&visitorID, "visitor-id", "Visitor ID of the clicks of the member, attributing them without -referrer-code")
+	fs.Var(&campaigns, "campaigns", "Comma separated IDs of the campaigns the member refers for")
+	fs.Var(&attributes, "attr", "Custom attribute as key=value, e.g. country=FR or kyc_level=2 (repeatable)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	campaignIDs, err := campaigns.uints()
+	if err != nil {
+		return err
+	}
+	req.ReferrerCode = referrerCode.value
+	req.PreferredCode = preferredCode.value
+	req.Email = email.value
+	req.VisitorID = visitorID.value
+	req.CampaignIDs = campaignIDs
+	req.Attributes = attributes.attributes()
+
+	member, err := a.service.Members.CreateMember(a.project, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *member, memberHeaders, memberRow)
+}
+
+func listMembers(a *app, args []string) error {
+	fs := newFlagSet("members list")
+	var referredBy stringFlag
+	var attributes attributeFlag
+	fs.Var(&referredBy, "referred-by", "Only the members referred by the member with this reference ID")
+	fs.Var(&attributes, "attr", "Only the members with this custom attribute, as key=value (repeatable)")
+	limit := fs.Int("limit", 100, "Maximum number of members")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	members, _, err := a.service.Members.GetMembers(request.GetMemberRequest{
+		Projects:                    a.projects(),
+		ReferredByMemberReferenceID: referredBy.value,
+		Attributes:                  attributes.values,
+		PaginationConditions:        pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, members, memberHeaders, memberRow)
+}
+
+func attachReferrer(a *app, args []string) error {
+	fs := newFlagSet("members attach")
+	var req request.AttachReferrerRequest
+	var actor, reason stringFlag
+	referenceID := fs.String("reference-id", "", "Reference ID of the member (required)")
+	fs.StringVar(&req.ReferrerCode, "referrer-code", "", "Referral code of the referrer (required)")
+	eventsAfter := fs.Bool("events-after", false, "Only reward the events triggered from now on, instead of the late referral policy")
+	fs.Var(&actor, "actor", "Who attaches the referrer, for the audit log")
+	fs.Var(&reason, "reason", "Why the referrer is attached, for the audit log")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	req.Actor = actor.value
+	req.Reason = reason.value
+	if isSet(fs, "events-after") {
+		req.EventsAfterAttachment = eventsAfter
+	}
+
+	member, err := a.service.Members.AttachReferrer(a.project, *referenceID, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *member, memberHeaders, memberRow)
+}
+
+func changeMemberStatus(a *app, args []string) error {
+	fs := newFlagSet("members status")
+	var req request.UpdateMemberStatusRequest
+	var actor, reason stringFlag
+	referenceID := fs.String("reference-id", "", "Reference ID of the member (required)")
+	fs.StringVar(&req.Status, "status", "", "New status: active, inactive, suspended or banned (required)")
+	fs.Var(&actor, "actor", "Who changes the status, for the audit log")
+	fs.Var(&reason, "reason", "Why the status changes, for the audit log")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	req.Actor = actor.value
+	req.Reason = reason.value
+
+	member, err := a.service.Members.ChangeMemberStatus(a.project, *referenceID, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *member, memberHeaders, memberRow)
+}
+
+func forgetMember(a *app, args []string) error {
+	fs := newFlagSet("members forget")
+	var req request.ForgetMemberRequest
+	var actor, reason stringFlag
+	referenceID := fs.String("reference-id", "", "Reference ID of the member (required)")
+	fs.Var(&actor, "actor", "Who erases the member, for the audit log")
+	fs.Var(&reason, "reason", "Why the member is erased, for the audit log")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	req.Actor = actor.value
+	req.Reason = reason.value
+
+	member, err := a.service.Members.ForgetMember(a.project, *referenceID, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *member, memberHeaders, memberRow)
+}
+
+func exportMemberData(a *app, args []string) error {
+	fs := newFlagSet("members export")
+	referenceID := fs.String("reference-id", "", "Reference ID of the member (required)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+	// The export is a JSON document whatever the output format
+	return a.service.Members.ExportMemberData(a.out.w, a.project, *referenceID)
+}
+
+var auditLogHeaders = []string{"ID", "MEMBER", "ACTION", "ACTOR", "REASON", "DATA", "CREATED_AT"}
+
+func auditLogRow(l models.AuditLog) []string {
+	return []string{
+		id(l.ID), l.MemberReferenceID, l.Action, formatString(l.Actor), formatString(l.Reason), formatString(l.Data),
+		formatTime(&l.CreatedAt),
+	}
+}
+
+func listAuditLogs(a *app, args []string) error {
+	fs := newFlagSet("audit list")
+	var member stringFlag
+	var actions listFlag
+	fs.Var(&member, "member", "Only the changes to the member with this reference ID")
+	fs.Var(&actions, "actions", "Comma separated actions, e.g. attach_referrer")
+	limit := fs.Int("limit", 100, "Maximum number of entries")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	entries, _, err := a.service.Members.GetAuditLogs(request.GetAuditLogsRequest{
+		Projects:             a.projects(),
+		MemberReferenceID:    member.value,
+		Actions:              actions.values,
+		PaginationConditions: pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, entries, auditLogHeaders, auditLogRow)
+}
+
+// Enrollments
+
+var enrollmentHeaders = []string{"ID", "MEMBER", "CAMPAIGN", "STARTED_AT", "ENDED_AT"}
+
+func enrollmentRow(e models.Enrollment) []string {
+	return []string{id(e.ID), e.MemberReferenceID, id(e.CampaignID), formatTime(&e.StartedAt), formatTime(e.EndedAt)}
+}
+
+func enrollMember(a *app, args []string) error {
+	fs := newFlagSet("enrollments add")
+	referenceID := fs.String("reference-id", "", "Reference ID of the member (required)")
+	campaignID := fs.Uint("campaign", 0, "Campaign ID (required)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	enrollment, err := a.service.Members.EnrollMember(a.project, *referenceID, *campaignID)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *enrollment, enrollmentHeaders, enrollmentRow)
+}
+
+func unenrollMember(a *app, args []string) error {
+	fs := newFlagSet("enrollments remove")
+	referenceID := fs.String("reference-id", "", "Reference ID of the member (required)")
+	campaignID := fs.Uint("campaign", 0, "Campaign ID (required)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	enrollment, err := a.service.Members.UnenrollMember(a.project, *referenceID, *campaignID)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *enrollment, enrollmentHeaders, enrollmentRow)
+}
+
+var enrollmentResultHeaders = []string{"CAMPAIGN", "MATCHED", "ENROLLED", "ALREADY_ENROLLED"}
+
+func enrollmentResultRow(r response.EnrollmentResult) []string {
+	return []string{id(r.CampaignID), strconv.Itoa(r.Matched), strconv.Itoa(r.Enrolled), strconv.Itoa(r.AlreadyEnrolled)}
+}
+
+func enrollMembers(a *app, args []string) error {
+	fs := newFlagSet("enrollments bulk")
+	var referredBy stringFlag
+	var attributes attributeFlag
+	campaignID := fs.Uint("campaign", 0, "Campaign ID (required)")
+	fs.Var(&referredBy, "referred-by", "Only the members referred by the member with this reference ID")
+	fs.Var(&attributes, "attr", "Only the members with this custom attribute, as key=value (repeatable)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	result, err := a.service.Members.EnrollMembers(a.project, *campaignID, request.GetMemberRequest{
+		ReferredByMemberReferenceID: referredBy.value,
+		Attributes:                  attributes.values,
+	})
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *result, enrollmentResultHeaders, enrollmentResultRow)
+}
+
+func listEnrollments(a *app, args []string) error {
+	fs := newFlagSet("enrollments list")
+	var member stringFlag
+	var campaignIDs listFlag
+	fs.Var(&member, "member", "Only the enrollments of the member with this reference ID")
+	fs.Var(&campaignIDs, "campaigns", "Comma separated campaign IDs")
+	active := fs.Bool("active", false, "Only the enrollments that have not ended, or with -active=false those that have")
+	limit := fs.Int("limit", 100, "Maximum number of enrollments")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	req := request.GetEnrollmentsRequest{
+		Projects:             a.projects(),
+		MemberReferenceID:    member.value,
+		PaginationConditions: pagination(*limit),
+	}
+	var err error
+	if req.CampaignIDs, err = campaignIDs.uints(); err != nil {
+		return err
+	}
+	if isSet(fs, "active") {
+		req.IsActive = active
+	}
+
+	enrollments, _, err := a.service.Members.GetEnrollments(req)
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, enrollments, enrollmentHeaders, enrollmentRow)
+}
+
+// Referral codes
+
+var referralCodeHeaders = []string{"ID", "CODE", "MEMBER", "PRIMARY", "CHANNEL", "CAMPAIGN", "USAGE", "EXPIRES_AT"}
+
+func referralCodeRow(c models.ReferralCode) []string {
+	campaign, usage := "-", strconv.FormatInt(c.UsageCount, 10)
+	if c.CampaignID != nil {
+		campaign = id(*c.CampaignID)
+	}
+	if c.UsageLimit != nil {
+		usage += "/" + strconv.FormatInt(*c.UsageLimit, 10)
+	}
+	return []string{
+		id(c.ID), c.Code, c.MemberReferenceID, strconv.FormatBool(c.IsPrimary), formatString(c.Channel), campaign, usage,
+		formatTime(c.ExpiresAt),
+	}
+}
+
+func createReferralCode(a *app, args []string) error {
+	fs := newFlagSet("codes create")
+	var req request.CreateReferralCodeRequest
+	var code, channel stringFlag
+	var expiresAt timeFlag
+	referenceID := fs.String("member", "", "Reference ID of the member the code refers for (required)")
+	fs.Var(&code, "code", "The code, generated if not given")
+	fs.Var(&channel, "channel", "Channel the code is shared on, e.g. twitter")
+	campaignID := fs.Uint("campaign", 0, "ID of the only campaign rewarding the referrals of the code")
+	usageLimit := fs.Int64("usage-limit", 0, "Maximum number of members referred with the code")
+	fs.Var(&expiresAt, "expires-at", "When the code stops being accepted")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	req.Code = code.value
+	req.Channel = channel.value
+	req.ExpiresAt = expiresAt.value
+	if isSet(fs, "campaign") {
+		req.CampaignID = campaignID
+	}
+	if isSet(fs, "usage-limit") {
+		req.UsageLimit = usageLimit
+	}
+
+	referralCode, err := a.service.Codes.CreateReferralCode(a.project, *referenceID, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *referralCode, referralCodeHeaders, referralCodeRow)
+}
+
+func listReferralCodes(a *app, args []string) error {
+	fs := newFlagSet("codes list")
+	var member, channel stringFlag
+	fs.Var(&member, "member", "Only the codes of the member with this reference ID")
+	fs.Var(&channel, "channel", "Only the codes of this channel")
+	limit := fs.Int("limit", 100, "Maximum number of codes")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	codes, _, err := a.service.Codes.GetReferralCodes(request.GetReferralCodesRequest{
+		Projects:             a.projects(),
+		MemberReferenceID:    member.value,
+		Channel:              channel.value,
+		PaginationConditions: pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, codes, referralCodeHeaders, referralCodeRow)
+}
+
+// Clicks
+
+var clickHeaders = []string{"ID", "CODE", "VISITOR", "CHANNEL", "CLICKED_AT", "SIGNUP"}
+
+func clickRow(c models.Click) []string {
+	return []string{id(c.ID), c.Code, c.VisitorID, formatString(c.Channel), formatTime(&c.ClickedAt), formatString(c.SignupMemberReferenceID)}
+}
+
+func recordClick(a *app, args []string) error {
+	fs := newFlagSet("clicks record")
+	var req request.CreateClickRequest
+	var channel stringFlag
+	var clickedAt timeFlag
+	fs.StringVar(&req.Code, "code", "", "Referral code of the link (required)")
+	fs.StringVar(&req.VisitorID, "visitor-id", "", "Anonymous ID of the visitor (required)")
+	fs.Var(&channel, "channel", "Channel of the link, defaults to the channel of the code")
+	fs.Var(&clickedAt, "clicked-at", "When the link was clicked, defaults to now")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+
+	req.Channel = channel.value
+	req.ClickedAt = clickedAt.value
+
+	click, err := a.service.Codes.RecordClick(a.project, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *click, clickHeaders, clickRow)
+}
+
+func listClicks(a *app, args []string) error {
+	fs := newFlagSet("clicks list")
+	var code, visitorID stringFlag
+	fs.Var(&code, "code", "Only the clicks of this referral code")
+	fs.Var(&visitorID, "visitor-id", "Only the clicks of this visitor")
+	limit := fs.Int("limit", 100, "Maximum number of clicks")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	clicks, _, err := a.service.Codes.GetClicks(request.GetClicksRequest{
+		Projects:             a.projects(),
+		Code:                 code.value,
+		VisitorID:            visitorID.value,
+		PaginationConditions: pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, clicks, clickHeaders, clickRow)
+}
+
+// Event logs
+
+var eventLogHeaders = []string{"ID", "EVENT", "MEMBER", "AMOUNT", "STATUS", "TRIGGERED_AT", "FAILURE_REASON"}
+
+func eventLogRow(l models.EventLog) []string {
+	return []string{
+		id(l.ID), l.EventKey, l.MemberReferenceID, formatDecimal(l.Amount), l.Status, formatTime(&l.TriggeredAt),
+		formatString(l.FailureReason),
+	}
+}
+
+func createEventLog(a *app, args []string) error {
+	fs := newFlagSet("event-logs create")
+	var req request.CreateEventLogRequest
+	var amount decimalFlag
+	var data stringFlag
+	fs.StringVar(&req.EventKey, "event", "", "Key of the event (required)")
+	fs.StringVar(&req.ReferenceID, "member", "", "Reference ID of the member who triggered the event (required)")
+	fs.Var(&amount, "amount", "Amount, e.g. of a payment")
+	fs.Var(&data, "data", "JSON data of the event")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+	req.Amount = amount.value
+	req.Data = data.value
+
+	eventLog, err := a.service.EventLogs.CreateEventLog(a.project, req)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *eventLog, eventLogHeaders, eventLogRow)
+}
+
+func listEventLogs(a *app, args []string) error {
+	fs := newFlagSet("event-logs list")
+	var status, member stringFlag
+	fs.Var(&status, "status", "Only event logs with this status: pending, success or failed")
+	fs.Var(&member, "member", "Only the event logs of the member with this reference ID")
+	limit := fs.Int("limit", 100, "Maximum number of event logs")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	eventLogs, _, err := a.service.EventLogs.GetEventLogs(request.GetEventLogRequest{
+		Projects:             a.projects(),
+		Status:               status.value,
+		MemberReferenceID:    member.value,
+		PaginationConditions: pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, eventLogs, eventLogHeaders, eventLogRow)
+}
+
+// Worker and rewards
+
+func runWorker(a *app, args []string) error {
+	if err := parse(newFlagSet("worker run"), args); err != nil {
+		return err
+	}
+	if err := a.service.Worker.ProcessPendingEvents(); err != nil {
+		return err
+	}
+	return a.out.printMessage("processed the pending event logs")
+}
+
+func simulateWorker(a *app, args []string) error {
+	fs := newFlagSet("worker simulate")
+	var from, to timeFlag
+	campaignID := fs.Uint("campaign", 0, "Campaign ID (required)")
+	fs.Var(&from, "from", "Event logs triggered at or after (required)")
+	fs.Var(&to, "to", "Event logs triggered before (required)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := a.requireProject(); err != nil {
+		return err
+	}
+	if from.value == nil || to.value == nil {
+		return fmt.Errorf("-from and -to are required")
+	}
+
+	simulation, err := a.service.Worker.Simulate(a.project, request.SimulateRequest{
+		CampaignID: campaignID,
+		From:       *from.value,
+		To:         *to.value,
+	})
+	if err != nil {
+		return err
+	}
+	if a.out.json {
+		return a.out.writeJSON(simulation)
+	}
+
+	if err := printTable(a.out, simulation.Rewards, rewardHeaders, rewardRow); err != nil {
+		return err
+	}
+	reasons := make([]string, 0, len(simulation.Rejections))
+	for reason, count := range simulation.Rejections {
+		reasons = append(reasons, fmt.Sprintf("%s=%d", reason, count))
+	}
+	sort.Strings(reasons)
+	fmt.Fprintf(a.out.w, "\nevent logs: %d\ntotal rewards: %s\nremaining budget: %s\nbudget exhausted: %t\nrejections: %s\n",
+		simulation.EventLogs, simulation.TotalRewards, formatDecimal(simulation.RemainingBudget),
+		simulation.BudgetExhausted, strings.Join(reasons, " "))
+	return nil
+}
+
+var rewardHeaders = []string{"ID", "CAMPAIGN", "REWARDED", "RELATED", "TYPE", "AMOUNT", "CURRENCY", "STATUS", "CREATED_AT"}
+
+func rewardRow(r models.Reward) []string {
+	return []string{
+		id(r.ID), id(r.CampaignID), r.RewardedMemberReferenceID, r.RelatedMemberReferenceID, r.MemberType,
+		r.Amount.String(), r.CurrencyCode, r.Status, formatTime(&r.CreatedAt),
+	}
+}
+
+func listRewards(a *app, args []string) error {
+	fs := newFlagSet("rewards list")
+	var status, member stringFlag
+	var campaigns listFlag
+	fs.Var(&status, "status", "Only rewards with this status")
+	fs.Var(&member, "member", "Only the rewards of the member with this reference ID")
+	fs.Var(&campaigns, "campaigns", "Comma separated IDs of the campaigns of the rewards")
+	limit := fs.Int("limit", 100, "Maximum number of rewards")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	campaignIDs, err := campaigns.uints()
+	if err != nil {
+		return err
+	}
+	rewards, _, err := a.service.Reward.GetRewards(request.GetRewardRequest{
+		Projects:                  a.projects(),
+		Status:                    status.value,
+		RewardedMemberReferenceID: member.value,
+		CampaignIDs:               campaignIDs,
+		PaginationConditions:      pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, rewards, rewardHeaders, rewardRow)
+}
+
+// Stats
+
+func referrerStats(a *app, args []string) error {
+	fs := newFlagSet("stats referrers")
+	var attributes attributeFlag
+	fs.Var(&attributes, "attr", "Only the referrers with this custom attribute, as key=value (repeatable)")
+	limit := fs.Int("limit", 100, "Maximum number of referrers")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	stats, _, err := a.service.AggregatorService.GetReferrerMembersStats(request.GetMemberRequest{
+		Projects:             a.projects(),
+		Attributes:           attributes.values,
+		PaginationConditions: pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, stats, []string{"REFERENCE_ID", "CODE", "REFEREES", "TOTAL_REWARDS"},
+		func(s response.ReferrerStats) []string {
+			return []string{s.ReferenceID, s.Code, strconv.FormatInt(s.RefereeCount, 10), s.TotalRewards.String()}
+		})
+}
+
+func codeStats(a *app, args []string) error {
+	fs := newFlagSet("stats codes")
+	var member stringFlag
+	fs.Var(&member, "member", "Only the codes of the member with this reference ID")
+	limit := fs.Int("limit", 100, "Maximum number of codes")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	stats, _, err := a.service.Codes.GetCodeStats(request.GetReferralCodesRequest{
+		Projects:             a.projects(),
+		MemberReferenceID:    member.value,
+		PaginationConditions: pagination(*limit),
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, stats, []string{"CODE", "MEMBER", "CHANNEL", "CLICKS", "VISITORS", "SIGNUPS", "CONVERSIONS"},
+		func(s response.CodeStats) []string {
+			return []string{
+				s.Code, s.MemberReferenceID, formatString(s.Channel), strconv.FormatInt(s.Clicks, 10),
+				strconv.FormatInt(s.Visitors, 10), strconv.FormatInt(s.Signups, 10), strconv.FormatInt(s.Conversions, 10),
+			}
+		})
+}
+
+func rewardStats(a *app, args []string) error {
+	fs := newFlagSet("stats rewards")
+	var startDate, endDate timeFlag
+	var campaigns listFlag
+	fs.Var(&startDate, "start", "First day (RFC 3339 or YYYY-MM-DD)")
+	fs.Var(&endDate, "end", "Last day (RFC 3339 or YYYY-MM-DD)")
+	fs.Var(&campaigns, "campaigns", "Comma separated IDs of the campaigns of the rewards")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	campaignIDs, err := campaigns.uints()
+	if err != nil {
+		return err
+	}
+	stats, err := a.service.AggregatorService.GetRewardsStats(request.GetRewardRequest{
+		Projects:    a.projects(),
+		CampaignIDs: campaignIDs,
+		PaginationConditions: request.PaginationConditions{
+			StartDate: startDate.value,
+			EndDate:   endDate.value,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, stats, []string{"DATE", "TOTAL_REWARDS", "UNIQUE_REFERRERS"},
+		func(s response.RewardStats) []string {
+			return []string{s.Date, s.TotalRewards.String(), strconv.FormatInt(s.UniqueReferrers, 10)}
+		})
+}
+
+// Migrations
+
+func migrateUp(a *app, args []string) error {
+	if err := parse(newFlagSet("migrate up"), args); err != nil {
+		return err
+	}
+	if err := go_referral.Migrate(a.db, a.options...); err != nil {
+		return err
+	}
+	return a.out.printMessage("migrations are up to date")
+}
+
+var reencryptionHeaders = []string{"MEMBERS", "EVENT_LOGS"}
+
+func reencryptionRow(r response.ReencryptionResult) []string {
+	return []string{strconv.FormatInt(r.Members, 10), strconv.FormatInt(r.EventLogs, 10)}
+}
+
+func reencryptPII(a *app, args []string) error {
+	if err := parse(newFlagSet("encryption reencrypt"), args); err != nil {
+		return err
+	}
+	result, err := go_referral.ReencryptPII(a.db, a.options...)
+	if err != nil {
+		return err
+	}
+	return printOne(a.out, *result, reencryptionHeaders, reencryptionRow)
+}
+
+var migrationHeaders = []string{"ID", "APPLIED", "UNKNOWN"}
+
+func migrationRow(m response.MigrationStatus) []string {
+	return []string{m.ID, strconv.FormatBool(m.Applied), strconv.FormatBool(m.Unknown)}
+}
+
+func migrateStatus(a *app, args []string) error {
+	if err := parse(newFlagSet("migrate status"), args); err != nil {
+		return err
+	}
+	status, err := go_referral.MigrationStatus(a.db, a.options...)
+	if err != nil {
+		return err
+	}
+	return printTable(a.out, status, migrationHeaders, migrationRow)
+}
+
+func migrateRollback(a *app, args []string) error {
+	fs := newFlagSet("migrate rollback")
+	to := fs.String("to", "", "ID of the last migration to keep (required)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("-to is required")
+	}
+	if err := go_referral.Rollback(a.db, *to, a.options...); err != nil {
+		return err
+	}
+	return a.out.printMessage("rolled back to " + *to)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/PayRam/go-referral/models"
+	"github.com/shopspring/decimal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Flag values for the optional fields of the requests: they stay nil unless the flag is given
+
+type stringFlag struct{ value *string }
+
+func (f *stringFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f *stringFlag) Set(s string) error {
+	f.value = &s
+	return nil
+}
+
+type decimalFlag struct{ value *decimal.Decimal }
+
+func (f *decimalFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return f.value.String()
+}
+
+func (f *decimalFlag) Set(s string) error {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return fmt.Errorf("invalid decimal: %w", err)
+	}
+	f.value = &d
+	return nil
+}
+
+// timeFlag accepts RFC 3339 timestamps or dates, read as midnight UTC
+type timeFlag struct{ value *time.Time }
+
+func (f *timeFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return f.value.Format(time.RFC3339)
+}
+
+func (f *timeFlag) Set(s string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			f.value = &t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time %q: use RFC 3339 or YYYY-MM-DD", s)
+}
+
+// listFlag is a comma separated list
+type listFlag struct{ values []string }
+
+func (f *listFlag) String() string {
+	return strings.Join(f.values, ",")
+}
+
+func (f *listFlag) Set(s string) error {
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			f.values = append(f.values, value)
+		}
+	}
+	return nil
+}
+
+func (f *listFlag) uints() ([]uint, error) {
+	ids := make([]uint, len(f.values))
+	for i, value := range f.values {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", value)
+		}
+		ids[i] = uint(id)
+	}
+	return ids, nil
+}
+
+// newFlagSet returns the flag set of a command, which reports errors instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
+
+// isSet reports whether the flag called name was given
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// attributeFlag collects repeated key=value custom attributes
+type attributeFlag struct{ values map[string]string }
+
+func (f *attributeFlag) String() string {
+	pairs := make([]string, 0, len(f.values))
+	for key, value := range f.values {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *attributeFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid attribute %q: use key=value", s)
+	}
+	if f.values == nil {
+		f.values = map[string]string{}
+	}
+	f.values[key] = value
+	return nil
+}
+
+// attributes types the values: JSON numbers and booleans are read as such, e.g. 2 or true, anything else as a
+// string. A JSON string, e.g. "2", keeps a number-like value a string.
+func (f *attributeFlag) attributes() models.Attributes {
+	if f.values == nil {
+		return nil
+	}
+	attributes := models.Attributes{}
+	for key, value := range f.values {
+		var typed interface{}
+		if err := json.Unmarshal([]byte(value), &typed); err == nil {
+			switch typed.(type) {
+			case float64, bool, string:
+				attributes[key] = typed
+				continue
+			}
+		}
+		attributes[key] = value
+	}
+	return attributes
+}
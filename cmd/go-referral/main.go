@@ -0,0 +1,205 @@
+// Command go-referral administers a referral database through ReferralService: events, campaigns, members, event
+// logs, rewards, the worker and the migrations.
+//
+// Usage:
+//
+//	go-referral [global flags] <command> [<subcommand>] [flags]
+//
+// The database is a SQLite file or a Postgres DSN, given with -db or the GO_REFERRAL_DB environment variable.
+// Commands other than migrate refuse to run against a database whose migrations are not up to date; run
+// "go-referral migrate up" first.
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	go_referral "github.com/PayRam/go-referral"
+	"github.com/PayRam/go-referral/encryption"
+	"github.com/PayRam/go-referral/errors"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// app is the state shared by the commands
+type app struct {
+	db      *gorm.DB
+	service *go_referral.ReferralService
+	project string
+	out     *printer
+	options []go_referral.Option
+}
+
+// command is a subcommand, e.g. "campaigns list"
+type command struct {
+	help  string
+	run   func(a *app, args []string) error
+	noSvc bool // The command manages the schema itself, so the services are not created
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		// -h printed the usage, as asked
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "go-referral:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	global := flag.NewFlagSet("go-referral", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	dsn := global.String("db", os.Getenv("GO_REFERRAL_DB"), "SQLite file or Postgres DSN (postgres://... or host=...)")
+	project := global.String("project", os.Getenv("GO_REFERRAL_PROJECT"), "Project of the records to create or list")
+	output := global.String("output", "table", "Output format: table or json")
+	prefix := global.String("table-prefix", "", "Table prefix, if not the default referral_")
+	schema := global.String("schema", "", "Schema of the tables")
+	verbose := global.Bool("verbose", false, "Log the library's info messages and the SQL statements")
+	global.Usage = func() { printUsage(global, stderr) }
+
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return fmt.Errorf("no command given")
+	}
+
+	name, cmd, rest := findCommand(global.Args())
+	if cmd == nil {
+		global.Usage()
+		return fmt.Errorf("unknown command %q", strings.Join(global.Args(), " "))
+	}
+
+	out, err := newPrinter(stdout, *output)
+	if err != nil {
+		return err
+	}
+
+	if *dsn == "" {
+		return fmt.Errorf("no database given: set -db or GO_REFERRAL_DB")
+	}
+	db, err := openDB(*dsn, *verbose)
+	if err != nil {
+		return err
+	}
+
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelInfo
+	}
+	options := []go_referral.Option{
+		go_referral.WithLogger(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))),
+	}
+	if *prefix != "" {
+		options = append(options, go_referral.WithTablePrefix(*prefix))
+	}
+	if *schema != "" {
+		options = append(options, go_referral.WithSchema(*schema))
+	}
+
+	if keys := os.Getenv("GO_REFERRAL_ENCRYPTION_KEYS"); keys != "" {
+		provider, err := keyProvider(keys, os.Getenv("GO_REFERRAL_ENCRYPTION_KEY"), os.Getenv("GO_REFERRAL_INDEX_KEY"))
+		if err != nil {
+			return err
+		}
+		options = append(options, go_referral.WithKeyProvider(provider))
+	}
+
+	a := &app{db: db, project: *project, out: out, options: options}
+	if !cmd.noSvc {
+		a.service, err = go_referral.NewReferralService(db, append(options, go_referral.WithSkipMigrations())...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := cmd.run(a, rest); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// findCommand matches the longest command name at the start of args
+func findCommand(args []string) (string, *command, []string) {
+	if len(args) >= 2 {
+		name := args[0] + " " + args[1]
+		if cmd, ok := commands[name]; ok {
+			return name, cmd, args[2:]
+		}
+	}
+	if cmd, ok := commands[args[0]]; ok {
+		return args[0], cmd, args[1:]
+	}
+	return "", nil, nil
+}
+
+func openDB(dsn string, verbose bool) (*gorm.DB, error) {
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	if verbose {
+		config.Logger = logger.Default.LogMode(logger.Info)
+	}
+
+	var dialector gorm.Dialector
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") || strings.Contains(dsn, "host=") {
+		dialector = postgres.Open(dsn)
+	} else {
+		dialector = sqlite.Open(dsn)
+	}
+
+	db, err := gorm.Open(dialector, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+func printUsage(global *flag.FlagSet, w io.Writer) {
+	fmt.Fprintln(w, "Usage: go-referral [global flags] <command> [flags]")
+	fmt.Fprintln(w, "\nGlobal flags:")
+	global.PrintDefaults()
+	fmt.Fprintln(w, "\nCommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-22s %s\n", name, commands[name].help)
+	}
+	fmt.Fprintln(w, "\nRun a command with -h for its flags.")
+	fmt.Fprintln(w, "\nEmails and event log data are encrypted with GO_REFERRAL_ENCRYPTION_KEYS, comma separated id=key pairs,")
+	fmt.Fprintln(w, "the current one named by GO_REFERRAL_ENCRYPTION_KEY, and indexed with GO_REFERRAL_INDEX_KEY. Keys are")
+	fmt.Fprintln(w, "32 bytes in base64.")
+}
+
+// keyProvider reads the keys of the environment: keys is comma separated id=key pairs, and the keys are base64
+func keyProvider(keys, current, indexKey string) (*encryption.StaticKeyProvider, error) {
+	secrets := map[string][]byte{}
+	for _, pair := range strings.Split(keys, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid GO_REFERRAL_ENCRYPTION_KEYS: use id=key pairs")
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", id, err)
+		}
+		secrets[id] = secret
+	}
+	index, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GO_REFERRAL_INDEX_KEY: %w", err)
+	}
+	return encryption.NewStaticKeyProvider(current, secrets, index)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/response"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+)
+
+// memoryDB returns the DSN of an in-memory SQLite database of the test, kept open until the test ends as each run
+// opens its own connections
+func memoryDB(t *testing.T) string {
+	dsn := "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", dsn, err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", dsn, err)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		t.Fatalf("failed to open %s: %v", dsn, err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return dsn
+}
+
+// runJSON runs the command with the JSON output and decodes what it prints into v
+func runJSON(t *testing.T, dsn string, v any, args ...string) {
+	var stdout, stderr bytes.Buffer
+	err := run(append([]string{"-db", dsn, "-project", "cli", "-output", "json"}, args...), &stdout, &stderr)
+	if !assert.NoError(t, err, stderr.String()) {
+		t.FailNow()
+	}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), v), stdout.String())
+}
+
+func TestHelp(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-h"}, &stdout, &stderr)
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+	assert.Contains(t, stderr.String(), "Usage: go-referral")
+
+	err = run([]string{"-db", memoryDB(t), "migrate", "up", "-h"}, &stdout, &stderr)
+	assert.True(t, errors.Is(err, flag.ErrHelp))
+
+	err = run([]string{"unknown"}, &stdout, &stderr)
+	assert.False(t, errors.Is(err, flag.ErrHelp))
+}
+
+func TestMigrate(t *testing.T) {
+	dsn := memoryDB(t)
+
+	// The other commands refuse to run until the migrations are applied
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-db", dsn, "events", "list"}, &stdout, &stderr)
+	assert.True(t, errors.Is(err, errors.ErrSchemaVersion))
+
+	var status []response.MigrationStatus
+	runJSON(t, dsn, &status, "migrate", "status")
+	if assert.NotEmpty(t, status) {
+		assert.False(t, status[0].Applied)
+	}
+
+	var message map[string]string
+	runJSON(t, dsn, &message, "migrate", "up")
+	assert.Equal(t, "migrations are up to date", message["message"])
+
+	runJSON(t, dsn, &status, "migrate", "status")
+	for _, migration := range status {
+		assert.True(t, migration.Applied, migration.ID)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	dsn := memoryDB(t)
+	var message map[string]string
+	runJSON(t, dsn, &message, "migrate", "up")
+
+	var event models.Event
+	runJSON(t, dsn, &event, "events", "create", "-key", "signup", "-name", "Signup")
+	assert.Equal(t, "cli", event.Project)
+	assert.Equal(t, "signup", event.Key)
+	assert.Equal(t, "simple", event.EventType)
+
+	var events []models.Event
+	runJSON(t, dsn, &events, "events", "list")
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, event.ID, events[0].ID)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := run([]string{"-db", dsn, "-project", "cli", "events", "create", "-key", "signup", "-name", "Signup"}, &stdout, &stderr)
+	assert.True(t, errors.Is(err, errors.ErrConflict))
+}
+
+func TestMembers(t *testing.T) {
+	dsn := memoryDB(t)
+	var message map[string]string
+	runJSON(t, dsn, &message, "migrate", "up")
+
+	var referrer, referee models.Member
+	runJSON(t, dsn, &referrer, "members", "create", "-reference-id", "alice", "-attr", "country=FR")
+	runJSON(t, dsn, &referee, "members", "create", "-reference-id", "bob", "-referrer-code", referrer.Code)
+	if assert.NotNil(t, referee.ReferredByMemberID) {
+		assert.Equal(t, referrer.ID, *referee.ReferredByMemberID)
+	}
+
+	var members []models.Member
+	runJSON(t, dsn, &members, "members", "list", "-referred-by", "alice")
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, "bob", members[0].ReferenceID)
+	}
+	runJSON(t, dsn, &members, "members", "list", "-attr", "country=FR")
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, "alice", members[0].ReferenceID)
+	}
+
+	var suspended models.Member
+	runJSON(t, dsn, &suspended, "members", "status", "-reference-id", "bob", "-status", models.MemberStatusSuspended)
+	assert.Equal(t, models.MemberStatusSuspended, suspended.Status)
+
+	// The table output lists the members, one per line under the headers
+	var stdout, stderr bytes.Buffer
+	assert.NoError(t, run([]string{"-db", dsn, "-project", "cli", "members", "list"}, &stdout, &stderr))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.True(t, strings.HasPrefix(lines[0], "ID"))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// printer writes command results as aligned tables for people or as JSON for scripts
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{w: w, json: true}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format '%s': must be 'table' or 'json'", format)
+	}
+}
+
+// printTable writes items as JSON, or as a table with headers and a row built by row for each item
+func printTable[T any](p *printer, items []T, headers []string, row func(T) []string) error {
+	if p.json {
+		if items == nil {
+			items = []T{}
+		}
+		return p.writeJSON(items)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, item := range items {
+		fmt.Fprintln(tw, strings.Join(row(item), "\t"))
+	}
+	return tw.Flush()
+}
+
+// printOne writes a single item, e.g. a created record
+func printOne[T any](p *printer, item T, headers []string, row func(T) []string) error {
+	if p.json {
+		return p.writeJSON(item)
+	}
+	return printTable(p, []T{item}, headers, row)
+}
+
+// printMessage writes the outcome of a command without a result
+func (p *printer) printMessage(message string) error {
+	if p.json {
+		return p.writeJSON(map[string]string{"message": message})
+	}
+	_, err := fmt.Fprintln(p.w, message)
+	return err
+}
+
+func (p *printer) writeJSON(v any) error {
+	encoder := json.NewEncoder(p.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// Formatting of optional values in table cells
+
+func formatString(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return *s
+}
+
+func formatDecimal(d *decimal.Decimal) string {
+	if d == nil {
+		return "-"
+	}
+	return d.String()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
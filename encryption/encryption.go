@@ -0,0 +1,166 @@
+// Package encryption encrypts personal data at rest, e.g. the emails of members, with keys from a KeyProvider. Each
+// value is encrypted with AES-256-GCM and stored with the ID of its key, so that keys can be rotated: values are
+// decrypted with the key they were encrypted with, and go_referral.ReencryptPII re-encrypts them with the current one.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of the keys, in bytes
+const KeySize = 32
+
+// prefix starts every encrypted value, followed by the key ID, ':' and the nonce and ciphertext in base64
+const prefix = "enc:v1:"
+
+// ErrUnknownKey is returned when a value was encrypted with a key the KeyProvider does not have
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Key is a key of a KeyProvider
+type Key struct {
+	ID     string // Stored with the values the key encrypts. Must not contain ':'.
+	Secret []byte // KeySize bytes
+}
+
+// KeyProvider provides the keys personal data is encrypted with, e.g. from a KMS. Keys are rotated by making another
+// key current while still providing the former ones, which decrypt the values not yet re-encrypted.
+type KeyProvider interface {
+	// CurrentKey returns the key new values are encrypted with
+	CurrentKey() (Key, error)
+	// Key returns the key with id, or an error wrapping ErrUnknownKey
+	Key(id string) (Key, error)
+	// IndexKey returns the key of the blind indexes. Unlike the other keys it cannot be rotated without recomputing
+	// every index, which go_referral.ReencryptPII does.
+	IndexKey() ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider of keys held in memory, e.g. read from the environment
+type StaticKeyProvider struct {
+	current  string
+	keys     map[string]Key
+	indexKey []byte
+}
+
+// NewStaticKeyProvider returns a provider of keys, by ID, encrypting with the key current and computing blind
+// indexes with indexKey. Keys are KeySize bytes long.
+func NewStaticKeyProvider(current string, keys map[string][]byte, indexKey []byte) (*StaticKeyProvider, error) {
+	p := &StaticKeyProvider{current: current, keys: map[string]Key{}, indexKey: indexKey}
+	for id, secret := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key ID %q: must be non-empty, without ':'", id)
+		}
+		if len(secret) != KeySize {
+			return nil, fmt.Errorf("key %s must be %d bytes long, not %d", id, KeySize, len(secret))
+		}
+		p.keys[id] = Key{ID: id, Secret: secret}
+	}
+	if _, ok := p.keys[current]; !ok {
+		return nil, fmt.Errorf("current key %s: %w", current, ErrUnknownKey)
+	}
+	if len(indexKey) != KeySize {
+		return nil, fmt.Errorf("index key must be %d bytes long, not %d", KeySize, len(indexKey))
+	}
+	return p, nil
+}
+
+func (p *StaticKeyProvider) CurrentKey() (Key, error) {
+	return p.keys[p.current], nil
+}
+
+func (p *StaticKeyProvider) Key(id string) (Key, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return Key{}, fmt.Errorf("key %s: %w", id, ErrUnknownKey)
+	}
+	return key, nil
+}
+
+func (p *StaticKeyProvider) IndexKey() ([]byte, error) {
+	return p.indexKey, nil
+}
+
+// Encrypt encrypts plaintext with the current key of p
+func Encrypt(p KeyProvider, plaintext string) (string, error) {
+	key, err := p.CurrentKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the current key: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + key.ID + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt with any key of p. Values that are not encrypted, e.g. stored before
+// encryption was enabled, are returned as they are.
+func Decrypt(p KeyProvider, value string) (string, error) {
+	id, encoded, ok := parse(value)
+	if !ok {
+		return value, nil
+	}
+	key, err := p.Key(id)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value with key %s: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// KeyID returns the ID of the key value was encrypted with, and false if value is not encrypted
+func KeyID(value string) (string, bool) {
+	id, _, ok := parse(value)
+	return id, ok
+}
+
+// BlindIndex returns a keyed hash of value, equal for equal values, so that encrypted values can be looked up
+func BlindIndex(p KeyProvider, value string) (string, error) {
+	key, err := p.IndexKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the index key: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func parse(value string) (id, encoded string, ok bool) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
+
+func newAEAD(key Key) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key %s: %w", key.ID, err)
+	}
+	return cipher.NewGCM(block)
+}
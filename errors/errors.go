@@ -0,0 +1,243 @@
+// Package errors defines the errors returned by the referral services. Every service method wraps its
+// failures in one of the types below, so that callers can map them (e.g. to HTTP status codes) with Is and As
+// instead of matching messages. It re-exports the helpers of the standard errors package, so it can be
+// imported in its place.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"strings"
+)
+
+var (
+	ErrNotFound               = errors.New("not found")
+	ErrConflict               = errors.New("conflict")
+	ErrValidation             = errors.New("validation failed")
+	ErrBudgetExceeded         = errors.New("budget exceeded")
+	ErrCapExceeded            = errors.New("cap exceeded")
+	ErrInvalidStateTransition = errors.New("invalid state transition")
+	ErrFraudSuspected         = errors.New("fraud suspected")
+	ErrSchemaVersion          = errors.New("schema version mismatch")
+)
+
+// Codes of FieldError
+const (
+	CodeRequired   = "required"     // The field is missing or empty
+	CodeInvalid    = "invalid"      // The value is malformed or not one of the accepted values
+	CodeOutOfRange = "out_of_range" // The value is outside its bounds, e.g. a percentage above 100
+	CodeNotAllowed = "not_allowed"  // The field must not be set, e.g. a cap on a flat fee reward
+	CodeNotFound   = "not_found"    // The value references something that does not exist
+)
+
+func New(text string) error {
+	return errors.New(text)
+}
+
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
+
+func Unwrap(err error) error {
+	return errors.Unwrap(err)
+}
+
+func Join(errs ...error) error {
+	return errors.Join(errs...)
+}
+
+// NotFoundError is returned when the record a request refers to does not exist
+type NotFoundError struct {
+	Resource string // e.g. "campaign"
+	Key      string // How the record was looked up, e.g. "project=p and id=1"
+}
+
+func NotFound(resource, keyFormat string, args ...interface{}) error {
+	return &NotFoundError{Resource: resource, Key: fmt.Sprintf(keyFormat, args...)}
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Key == "" {
+		return e.Resource + " not found"
+	}
+	return fmt.Sprintf("%s not found for %s", e.Resource, e.Key)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ConflictError is returned when a request clashes with existing data, e.g. a duplicate key
+type ConflictError struct {
+	Resource string
+	Message  string
+}
+
+func Conflict(resource, format string, args ...interface{}) error {
+	return &ConflictError{Resource: resource, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// FieldError is one problem with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a request is invalid, with the problem of each offending field
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+// Invalid returns a ValidationError for a single field
+func Invalid(field, code, message string) error {
+	return &ValidationError{Fields: []FieldError{{Field: field, Code: code, Message: message}}}
+}
+
+// Add records a problem with field. Validators add every problem they find, so that a caller can fix them all at
+// once instead of one per round trip.
+func (e *ValidationError) Add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Has reports whether a problem was recorded for field
+func (e *ValidationError) Has(field string) bool {
+	for _, f := range e.Fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns e if any problem was recorded, nil otherwise
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// BudgetExceededError is returned when a reward would take a campaign over its budget
+type BudgetExceededError struct {
+	CampaignID uint
+	Budget     decimal.Decimal
+	Total      decimal.Decimal // Total rewards including the one that was refused
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("campaign %d exceeds budget: total rewards %s, budget %s", e.CampaignID, e.Total, e.Budget)
+}
+
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// Limits of CapExceededError
+const (
+	CapRewardPerCustomer      = "reward cap per customer"
+	CapValidityPeriod         = "validity period"
+	CapMaxOccurrencesCustomer = "max occurrences per customer"
+)
+
+// CapExceededError is returned when a reward would exceed one of the per customer limits of a campaign
+type CapExceededError struct {
+	CampaignID        uint
+	MemberReferenceID string
+	Cap               string // One of the Cap constants
+}
+
+func (e *CapExceededError) Error() string {
+	return fmt.Sprintf("member %s exceeds %s of campaign %d", e.MemberReferenceID, e.Cap, e.CampaignID)
+}
+
+func (e *CapExceededError) Is(target error) bool {
+	return target == ErrCapExceeded
+}
+
+// InvalidStateTransitionError is returned when a record cannot move from its current status to the requested one
+type InvalidStateTransitionError struct {
+	Resource string
+	From     string
+	To       string
+	Reason   string // Optional explanation, e.g. "campaign has ended"
+}
+
+func (e *InvalidStateTransitionError) Error() string {
+	if e.From == e.To {
+		return fmt.Sprintf("%s is already %s", e.Resource, e.To)
+	}
+	message := fmt.Sprintf("cannot change %s status from '%s' to '%s'", e.Resource, e.From, e.To)
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	return message
+}
+
+func (e *InvalidStateTransitionError) Is(target error) bool {
+	return target == ErrInvalidStateTransition
+}
+
+// FraudSuspectedError is returned when a fraud check refuses a referral or a reward
+type FraudSuspectedError struct {
+	Err error // The error returned by the check
+}
+
+func (e *FraudSuspectedError) Error() string {
+	return "fraud suspected: " + e.Err.Error()
+}
+
+func (e *FraudSuspectedError) Is(target error) bool {
+	return target == ErrFraudSuspected
+}
+
+func (e *FraudSuspectedError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaVersionError is returned at start up when the database schema does not match the code: migrations are
+// pending (the schema is behind) or migrations the code does not know were applied (the schema is ahead)
+type SchemaVersionError struct {
+	Pending []string
+	Unknown []string
+}
+
+func (e *SchemaVersionError) Error() string {
+	var problems []string
+	if len(e.Pending) > 0 {
+		problems = append(problems, "pending migrations "+strings.Join(e.Pending, ", "))
+	}
+	if len(e.Unknown) > 0 {
+		problems = append(problems, "unknown migrations "+strings.Join(e.Unknown, ", "))
+	}
+	return "database schema does not match the code: " + strings.Join(problems, "; ")
+}
+
+func (e *SchemaVersionError) Is(target error) bool {
+	return target == ErrSchemaVersion
+}
@@ -1,16 +1,24 @@
 package go_referral
 
 import (
+	"fmt"
+	"github.com/PayRam/go-referral/clock"
 	db2 "github.com/PayRam/go-referral/internal/db"
 	"github.com/PayRam/go-referral/internal/serviceimpl"
+	"github.com/PayRam/go-referral/internal/telemetry"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
 	"github.com/PayRam/go-referral/service"
+	"go.opentelemetry.io/otel"
 	"gorm.io/gorm"
+	"time"
 )
 
 type ReferralService struct {
 	Events            service.EventService
 	Campaigns         service.CampaignService
 	Members           service.MemberService
+	Codes             service.ReferralCodeService
 	EventLogs         service.EventLogService
 	CampaignEventLog  service.CampaignEventLogService
 	Reward            service.RewardService
@@ -18,16 +26,109 @@ type ReferralService struct {
 	Worker            service.Worker
 }
 
-func NewReferralService(db *gorm.DB) *ReferralService {
-	db2.Migrate(db)
-	return &ReferralService{
-		Events:            serviceimpl.NewEventService(db),
-		Campaigns:         serviceimpl.NewCampaignService(db),
-		Members:           serviceimpl.NewReferrerService(db),
-		EventLogs:         serviceimpl.NewEventLogService(db),
-		CampaignEventLog:  serviceimpl.NewCampaignEventLogService(db),
-		Reward:            serviceimpl.NewRewardService(db),
-		AggregatorService: serviceimpl.NewAggregatorService(db),
-		Worker:            serviceimpl.NewWorkerService(db),
+// NewReferralService runs the pending migrations and returns the services configured with opts. With
+// WithSkipMigrations it instead checks that the migrations were applied, and returns a SchemaVersionError if not.
+func NewReferralService(db *gorm.DB, opts ...Option) (*ReferralService, error) {
+	c := newConfig(opts)
+	logger := c.logger
+	db, err := c.namedDB(db)
+	if err != nil {
+		return nil, err
+	}
+
+	clk := c.clock
+	if clk == nil {
+		clk = clock.Real()
+	}
+	// Stamp CreatedAt and UpdatedAt with the clock as well, so that they agree with the dates the services compare
+	db = db.Session(&gorm.Session{NowFunc: func() time.Time {
+		return clk.Now().Local()
+	}})
+
+	meterProvider := c.meterProvider
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+	tracerProvider := c.tracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	for project, policy := range c.codePolicies {
+		if err := serviceimpl.ValidateCodePolicy(policy); err != nil {
+			return nil, fmt.Errorf("invalid code policy for project %q: %w", project, err)
+		}
+	}
+	for project, policy := range c.attribution {
+		if err := serviceimpl.ValidateAttributionPolicy(policy); err != nil {
+			return nil, fmt.Errorf("invalid attribution policy for project %q: %w", project, err)
+		}
+	}
+	for project, policy := range c.lateReferral {
+		if err := serviceimpl.ValidateLateReferralPolicy(policy); err != nil {
+			return nil, fmt.Errorf("invalid late referral policy for project %q: %w", project, err)
+		}
+	}
+	for project, schema := range c.attributes {
+		if err := serviceimpl.ValidateAttributeSchema(schema); err != nil {
+			return nil, fmt.Errorf("invalid attribute schema for project %q: %w", project, err)
+		}
+	}
+	cursorKey := c.cursorSigningKey
+	if cursorKey == nil {
+		key, err := request.NewCursorKey()
+		if err != nil {
+			return nil, err
+		}
+		cursorKey = key
 	}
+	if c.keyProvider != nil {
+		db = models.WithKeyProvider(db, c.keyProvider)
+	}
+
+	tel, err := telemetry.New(meterProvider, tracerProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.skipMigrations {
+		// Refuse to start on a schema the services would fail on
+		if err := db2.SetupJoinTables(db); err != nil {
+			return nil, err
+		}
+		if err := db2.CheckSchema(db); err != nil {
+			return nil, err
+		}
+	} else if err := db2.Migrate(db, logger); err != nil {
+		return nil, err
+	}
+
+	cfg := &serviceimpl.Config{
+		DB:            db,
+		Logger:        logger,
+		Clock:         clk,
+		Telemetry:     tel,
+		CodeGenerator: c.codeGenerator,
+		CodePolicies:  c.codePolicies,
+		Attribution:   c.attribution,
+		LateReferral:  c.lateReferral,
+		Attributes:    c.attributes,
+		FraudChecks:   c.fraudChecks,
+		Hooks:         c.hooks,
+		CursorKey:     cursorKey,
+		Naming:        models.NamingOf(db),
+		KeyProvider:   c.keyProvider,
+	}
+
+	return &ReferralService{
+		Events:            telemetry.TraceEventService(serviceimpl.NewEventService(cfg), tel),
+		Campaigns:         telemetry.TraceCampaignService(serviceimpl.NewCampaignService(cfg), tel),
+		Members:           telemetry.TraceMemberService(serviceimpl.NewReferrerService(cfg), tel),
+		Codes:             telemetry.TraceReferralCodeService(serviceimpl.NewReferralCodeService(cfg), tel),
+		EventLogs:         telemetry.TraceEventLogService(serviceimpl.NewEventLogService(cfg), tel),
+		CampaignEventLog:  telemetry.TraceCampaignEventLogService(serviceimpl.NewCampaignEventLogService(cfg), tel),
+		Reward:            telemetry.TraceRewardService(serviceimpl.NewRewardService(cfg), tel),
+		AggregatorService: telemetry.TraceAggregatorService(serviceimpl.NewAggregatorService(cfg), tel),
+		Worker:            telemetry.TraceWorker(serviceimpl.NewWorkerService(cfg), tel),
+	}, nil
 }
+
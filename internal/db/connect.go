@@ -1,45 +1,191 @@
 package db
 
 import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
 	"github.com/PayRam/go-referral/internal/migration"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/response"
 	"github.com/go-gormigrate/gormigrate/v2"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"log"
+	"log/slog"
+	"sort"
 )
 
 // InitDB initializes and returns the database connection
-func InitDB(dbFilePath string) *gorm.DB {
+func InitDB(dbFilePath string, logger *slog.Logger) (*gorm.DB, error) {
 	db, err := gorm.Open(sqlite.Open(dbFilePath), &gorm.Config{})
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	db = Migrate(db)
+	if err := Migrate(db, logger); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// SetupJoinTables registers the models of the join tables of the many2many associations, so that the associations
+// use their table names, which follow the naming of db, rather than the names in the struct tags
+func SetupJoinTables(db *gorm.DB) error {
+	if err := db.SetupJoinTable(&models.Campaign{}, "Events", &models.CampaignEvent{}); err != nil {
+		return fmt.Errorf("failed to set up campaign events join table: %w", err)
+	}
+	if err := db.SetupJoinTable(&models.Member{}, "Campaigns", &models.MemberCampaign{}); err != nil {
+		return fmt.Errorf("failed to set up member campaigns join table: %w", err)
+	}
+	return nil
+}
+
+// Migrate applies the pending migrations. It refuses to run when the database has migrations this version of the
+// library does not know, i.e. when the schema is ahead of the code.
+func Migrate(db *gorm.DB, logger *slog.Logger) error {
+	if err := SetupJoinTables(db); err != nil {
+		return err
+	}
+
+	status, err := Status(db)
+	if err != nil {
+		return err
+	}
+	pending, unknown := splitStatus(status)
+	if len(unknown) > 0 {
+		return &errors.SchemaVersionError{Unknown: unknown}
+	}
+
+	// Create the schema of the tables, which Postgres does not do implicitly
+	if schema := models.NamingOf(db).Schema; schema != "" && db.Dialector.Name() == "postgres" {
+		if err := db.Exec("CREATE SCHEMA IF NOT EXISTS " + db.Statement.Quote(schema)).Error; err != nil {
+			return fmt.Errorf("failed to create schema %s: %w", schema, err)
+		}
+	}
+
+	m, _, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	if err := m.Migrate(); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	logger.Info("database initialised and migrations run successfully", "applied", pending)
+	return nil
+}
+
+// Rollback rolls back the migrations applied after the migration with id to, newest first
+func Rollback(db *gorm.DB, to string, logger *slog.Logger) error {
+	if err := SetupJoinTables(db); err != nil {
+		return err
+	}
+
+	status, err := Status(db)
+	if err != nil {
+		return err
+	}
+	if _, unknown := splitStatus(status); len(unknown) > 0 {
+		return &errors.SchemaVersionError{Unknown: unknown}
+	}
+
+	m, all, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	known := false
+	for _, mig := range all {
+		known = known || mig.ID == to
+	}
+	if !known {
+		return errors.NotFound("migration", "id=%s", to)
+	}
+
+	if err := m.RollbackTo(to); err != nil {
+		return fmt.Errorf("rollback failed: %w", err)
+	}
+
+	logger.Info("migrations rolled back", "to", to)
+	return nil
+}
+
+// Status returns every migration of the code with whether it was applied, followed by the migrations applied to the
+// database that the code does not know
+func Status(db *gorm.DB) ([]response.MigrationStatus, error) {
+	all, err := migrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	table := models.NamingOf(db).MigrationsTable()
+	if db.Migrator().HasTable(table) {
+		if err := db.Table(table).Pluck("id", &applied).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch applied migrations: %w", err)
+		}
+	}
+	isApplied := map[string]bool{}
+	for _, id := range applied {
+		isApplied[id] = true
+	}
 
-	return db
+	status := make([]response.MigrationStatus, 0, len(all))
+	for _, mig := range all {
+		status = append(status, response.MigrationStatus{ID: mig.ID, Applied: isApplied[mig.ID]})
+		delete(isApplied, mig.ID)
+	}
+	var unknown []string
+	for id := range isApplied {
+		unknown = append(unknown, id)
+	}
+	sort.Strings(unknown)
+	for _, id := range unknown {
+		status = append(status, response.MigrationStatus{ID: id, Applied: true, Unknown: true})
+	}
+	return status, nil
+}
+
+// CheckSchema returns a SchemaVersionError unless every migration of the code, and only those, were applied
+func CheckSchema(db *gorm.DB) error {
+	status, err := Status(db)
+	if err != nil {
+		return err
+	}
+	if pending, unknown := splitStatus(status); len(pending) > 0 || len(unknown) > 0 {
+		return &errors.SchemaVersionError{Pending: pending, Unknown: unknown}
+	}
+	return nil
 }
 
-func Migrate(db *gorm.DB) *gorm.DB {
-	// Run migrations
-	if err := migrate(db); err != nil {
-		log.Fatalf("Migration failed: %v", err)
+func splitStatus(status []response.MigrationStatus) (pending, unknown []string) {
+	for _, s := range status {
+		switch {
+		case s.Unknown:
+			unknown = append(unknown, s.ID)
+		case !s.Applied:
+			pending = append(pending, s.ID)
+		}
 	}
+	return pending, unknown
+}
 
-	// Log or handle successful database setup as needed
-	log.Printf("**** Database initialised and migrations run successfully ****")
-	return db
+// migrations returns the migrations of the dialect of db in order: the initial schema, created from snapshots of the
+// models, then the incremental SQL migrations
+func migrations(db *gorm.DB) ([]*gormigrate.Migration, error) {
+	incremental, err := migration.SQL(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return append([]*gormigrate.Migration{migration.Initialise}, incremental...), nil
 }
 
-func migrate(db *gorm.DB) error {
-	// Define migrations
-	m := gormigrate.New(db, gormigrate.DefaultOptions, []*gormigrate.Migration{
-		{ // Integrate the CreateUserTable migration
-			ID:       migration.Initialise.ID,
-			Migrate:  migration.Initialise.Migrate,
-			Rollback: migration.Initialise.Rollback,
-		},
-	})
+func newMigrator(db *gorm.DB) (*gormigrate.Gormigrate, []*gormigrate.Migration, error) {
+	all, err := migrations(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := *gormigrate.DefaultOptions
+	options.TableName = models.NamingOf(db).MigrationsTable()
 
-	return m.Migrate()
+	return gormigrate.New(db, &options, all), all, nil
 }
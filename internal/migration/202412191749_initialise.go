@@ -3,33 +3,201 @@ package migration
 import (
 	"github.com/PayRam/go-referral/models"
 	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"time"
 )
 
+// Initialise creates the initial schema. It migrates the snapshots below of the models as they were then rather than
+// the models, so that it creates the same schema whatever the models became: every later change is an incremental
+// migration.
 var Initialise = &gormigrate.Migration{
 	ID: "202412191749-gr-473842",
 	Migrate: func(db *gorm.DB) error {
 		return db.AutoMigrate(
-			&models.Event{},
-			&models.Campaign{},
-			&models.CampaignEvent{},
-			&models.Member{},
-			&models.MemberCampaign{},
-			&models.EventLog{},
-			&models.CampaignEventLog{},
-			&models.Reward{},
+			&initialEvent{},
+			&initialCampaign{},
+			&initialCampaignEvent{},
+			&initialMember{},
+			&initialMemberCampaign{},
+			&initialEventLog{},
+			&initialCampaignEventLog{},
+			&initialReward{},
 		)
 	},
 	Rollback: func(db *gorm.DB) error {
 		return db.Migrator().DropTable(
-			&models.Event{},
-			&models.Campaign{},
-			&models.CampaignEvent{},
-			&models.Member{},
-			&models.MemberCampaign{},
-			&models.EventLog{},
-			&models.CampaignEventLog{},
-			&models.Reward{},
+			&initialEvent{},
+			&initialCampaign{},
+			&initialCampaignEvent{},
+			&initialMember{},
+			&initialMemberCampaign{},
+			&initialEventLog{},
+			&initialCampaignEventLog{},
+			&initialReward{},
 		)
 	},
 }
+
+// The snapshots of the models of the initial schema. Do not change them: change the schema with a migration.
+// Their composite indexes are named after the table, like the other indexes, so that the tables of several prefixes
+// can share a schema; the databases created before keep the names fixed then, e.g. idx_event_project_key.
+// The many2many associations are left out, their join tables being migrated as the join models, and the base model is
+// embedded through a field as GORM skips the unexported embedded structs.
+
+type initialBaseModel struct {
+	ID        uint           `gorm:"primaryKey"`
+	CreatedAt time.Time      `gorm:"index"`
+	UpdatedAt time.Time      `gorm:"index"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+type initialCampaign struct {
+	BaseModel          initialBaseModel `gorm:"embedded"`
+	Project            string           `gorm:"size:100;not null;index"`
+	Name               string           `gorm:"size:255;not null;index"`
+	RewardType         *string          `gorm:"size:50"`
+	RewardValue        *decimal.Decimal `gorm:"type:decimal(38,18)"`
+	CurrencyCode       string           `gorm:"type:varchar(20);default:'USD';index"`
+	RewardCap          *decimal.Decimal `gorm:"type:decimal(38,18)"`
+	InviteeRewardType  *string          `gorm:"size:50"`
+	InviteeRewardValue *decimal.Decimal `gorm:"type:decimal(38,18)"`
+	InviteeRewardCap   *decimal.Decimal `gorm:"type:decimal(38,18)"`
+	Budget             *decimal.Decimal `gorm:"type:decimal(38,18)"`
+	Description        *string          `gorm:"type:text"`
+	StartDate          *time.Time       `gorm:"not null;index"`
+	EndDate            *time.Time       `gorm:"not null;index"`
+	Status             string           `gorm:"size:50;default:'active';index"`
+	IsDefault          bool             `gorm:"default:false;index"`
+
+	CampaignTypePerCustomer   string           `gorm:"size:50;not null;index"`
+	MaxOccurrencesPerCustomer *int64           `gorm:""`
+	ValidityMonthsPerCustomer *int             `gorm:""`
+	RewardCapPerCustomer      *decimal.Decimal `gorm:"type:decimal(38,18)"`
+
+	ConsiderEventsFrom time.Time `gorm:"not null;index"`
+}
+
+func (initialCampaign) TableName(namer schema.Namer) string {
+	return models.TableName(namer, "campaigns")
+}
+
+type initialEvent struct {
+	BaseModel   initialBaseModel `gorm:"embedded"`
+	Project     string           `gorm:"size:100;not null;uniqueIndex:,composite:project_key"`
+	Key         string           `gorm:"size:100;not null;uniqueIndex:,composite:project_key"`
+	Name        string           `gorm:"size:255;not null;index"`
+	EventType   string           `gorm:"size:100;not null;index"`
+	Description *string          `gorm:"type:text"`
+}
+
+func (initialEvent) TableName(namer schema.Namer) string {
+	return models.TableName(namer, "events")
+}
+
+type initialCampaignEvent struct {
+	Project    string          `gorm:"not null;size:100;index"`
+	CampaignID uint            `gorm:"not null;uniqueIndex:,composite:campaign_event"`
+	EventID    uint            `gorm:"not null;uniqueIndex:,composite:campaign_event"`
+	EventKey   string          `gorm:"not null;size:100;index"`
+	Campaign   initialCampaign `gorm:"foreignKey:CampaignID;references:ID"`
+	Event      initialEvent    `gorm:"foreignKey:EventID;references:ID"`
+}
+
+func (initialCampaignEvent) TableName(namer schema.Namer) string {
+	return models.TableName(namer, "campaign_events")
+}
+
+type initialMember struct {
+	BaseModel   initialBaseModel `gorm:"embedded"`
+	Project     string           `gorm:"size:100;not null;uniqueIndex:,composite:project_reference_id"`
+	ReferenceID string           `gorm:"size:100;not null;uniqueIndex:,composite:project_reference_id"`
+	Email       *string          `gorm:"size:100;"`
+	Code        string           `gorm:"size:50;uniqueIndex;not null"`
+	Status      string           `gorm:"size:50;default:'active';index"`
+
+	ReferredByMemberID          *uint          `gorm:"index"`
+	ReferredByMemberReferenceID *string        `gorm:"index"`
+	ReferredByMember            *initialMember `gorm:"foreignKey:ReferredByMemberID"`
+}
+
+func (initialMember) TableName(namer schema.Namer) string {
+	return models.TableName(namer, "members")
+}
+
+type initialMemberCampaign struct {
+	Project    string          `gorm:"not null;size:100;"`
+	MemberID   uint            `gorm:"not null;uniqueIndex:,composite:member_campaign"`
+	CampaignID uint            `gorm:"not null;uniqueIndex:,composite:member_campaign"`
+	Campaign   initialCampaign `gorm:"foreignKey:CampaignID;references:ID"`
+	Member     initialMember   `gorm:"foreignKey:MemberID;references:ID"`
+}
+
+func (initialMemberCampaign) TableName(namer schema.Namer) string {
+	return models.TableName(namer, "member_campaigns")
+}
+
+type initialEventLog struct {
+	BaseModel         initialBaseModel `gorm:"embedded"`
+	Project           string           `gorm:"size:100;not null;index"`
+	EventKey          string           `gorm:"size:100;not null;index"`
+	MemberID          uint             `gorm:"not null:index"`
+	MemberReferenceID string           `gorm:"size:100;not null;index"`
+	Amount            *decimal.Decimal `gorm:"type:decimal(38,18);index"`
+	TriggeredAt       time.Time        `gorm:"not null;index"`
+	Data              *string          `gorm:"type:json;"`
+	Status            string           `gorm:"size:50;default:'pending';not null;index"`
+	FailureReason     *string          `gorm:"type:text"`
+
+	Member *initialMember `gorm:"foreignKey:MemberID;references:ID"`
+}
+
+func (initialEventLog) TableName(namer schema.Namer) string {
+	return models.TableName(namer, "event_logs")
+}
+
+type initialCampaignEventLog struct {
+	BaseModel         initialBaseModel `gorm:"embedded"`
+	Project           string           `gorm:"size:100;not null;index"`
+	CampaignID        uint             `gorm:"not null;index"`
+	EventID           uint             `gorm:"not null;index"`
+	MemberID          uint             `gorm:"not null;index"`
+	MemberReferenceID string           `gorm:"size:100;not null;index"`
+	Status            string           `gorm:"size:50;default:'pending';not null;index"`
+	EventLogID        uint             `gorm:"not null;index"`
+	ReferredRewardID  *uint            `gorm:"index"`
+	RefereeRewardID   *uint            `gorm:"index"`
+
+	Campaign       *initialCampaign `gorm:"foreignKey:CampaignID"`
+	Event          *initialEvent    `gorm:"foreignKey:EventID"`
+	Member         *initialMember   `gorm:"foreignKey:MemberID"`
+	ReferredReward *initialReward   `gorm:"foreignKey:ReferredRewardID"`
+	RefereeReward  *initialReward   `gorm:"foreignKey:RefereeRewardID"`
+}
+
+func (initialCampaignEventLog) TableName(namer schema.Namer) string {
+	return models.TableName(namer, "campaign_event_logs")
+}
+
+type initialReward struct {
+	BaseModel                 initialBaseModel `gorm:"embedded"`
+	Project                   string           `gorm:"size:100;not null;index"`
+	CampaignID                uint             `gorm:"not null;index"`
+	CurrencyCode              string           `gorm:"type:varchar(20);not null;index"`
+	RewardedMemberID          uint             `gorm:"not null;index"`
+	RewardedMemberReferenceID string           `gorm:"size:100;not null;index"`
+	RelatedMemberID           uint             `gorm:"not null;index"`
+	RelatedMemberReferenceID  string           `gorm:"size:100;not null;index"`
+	MemberType                string           `gorm:"size:50;not null;index"`
+	Amount                    decimal.Decimal  `gorm:"type:decimal(38,18);not null;index"`
+	Status                    string           `gorm:"size:50;default:'pending';not null;index"`
+	Reason                    *string          `gorm:"type:text"`
+
+	RewardedMember *initialMember `gorm:"foreignKey:RewardedMemberID;references:ID"`
+	RelatedMember  *initialMember `gorm:"foreignKey:RelatedMemberID;references:ID"`
+}
+
+func (initialReward) TableName(namer schema.Namer) string {
+	return models.TableName(namer, "rewards")
+}
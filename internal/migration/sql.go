@@ -0,0 +1,137 @@
+package migration
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"github.com/PayRam/go-referral/models"
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// The incremental migrations, one directory per dialect. Each migration is a pair of files
+// <id>.up.sql and <id>.down.sql, applied in the order of their ids, which start with a timestamp. Table and index
+// names are written as template actions so that they follow the naming of the DB (see models.Naming):
+//
+//	{{table "rewards"}}             qualified table name, e.g. referral.rewards
+//	{{tableName "rewards"}}         table name without the schema
+//	{{index "rewards_member"}}      index name without the schema, e.g. idx_referral_rewards_member
+//	{{qualifiedIndex "rewards_member"}} index name with the schema
+//	{{modelIndex "members" "code"}} name GORM gives the index of a struct tag, e.g. idx_referral_members_code
+//	{{modelIndex "events" "project_key"}} likewise for an index tagged composite:project_key
+//	{{modelForeignKey "codes" "member"}} name GORM gives the foreign key of an association, e.g. fk_referral_codes_member
+//	{{qualify "name"}}              name with the schema
+//
+//go:embed sql
+var sqlFiles embed.FS
+
+// sqlFuncs returns the template functions naming the tables and indexes with naming
+func sqlFuncs(naming models.Naming) template.FuncMap {
+	index := func(name string) string {
+		return "idx_" + naming.Prefix + name
+	}
+	return template.FuncMap{
+		"table":     naming.Table,
+		"tableName": func(name string) string { return naming.Prefix + name },
+		"index":     index,
+		"qualifiedIndex": func(name string) string {
+			return naming.Qualify(index(name))
+		},
+		// GORM names the indexes of the struct tags after the qualified table, with the dots replaced
+		"modelIndex": func(table, column string) string {
+			return naming.IndexName(naming.Table(table), column)
+		},
+		// and the foreign keys of the associations likewise
+		"modelForeignKey": func(table, association string) string {
+			return naming.RelationshipFKName(schema.Relationship{Name: association, Schema: &schema.Schema{Table: naming.Table(table)}})
+		},
+		"qualify": naming.Qualify,
+	}
+}
+
+// SQL returns the incremental migrations of dialect, in the order they must run
+func SQL(dialect string) ([]*gormigrate.Migration, error) {
+	dir := path.Join("sql", dialect)
+	entries, err := fs.ReadDir(sqlFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for dialect %s: %w", dialect, err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".up.sql"); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	migrations := make([]*gormigrate.Migration, len(ids))
+	for i, id := range ids {
+		up, err := fs.ReadFile(sqlFiles, path.Join(dir, id+".up.sql"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", id, err)
+		}
+		down, err := fs.ReadFile(sqlFiles, path.Join(dir, id+".down.sql"))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no down migration: %w", id, err)
+		}
+		migrations[i] = &gormigrate.Migration{
+			ID: id,
+			Migrate: func(tx *gorm.DB) error {
+				return execSQL(tx, id+".up.sql", string(up))
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return execSQL(tx, id+".down.sql", string(down))
+			},
+		}
+	}
+	return migrations, nil
+}
+
+// execSQL renders the template of a migration file and runs its statements one by one, as not every driver accepts
+// several statements in one call
+func execSQL(tx *gorm.DB, name, text string) error {
+	tmpl, err := template.New(name).Funcs(sqlFuncs(models.NamingOf(tx))).Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, nil); err != nil {
+		return fmt.Errorf("failed to render %s: %w", name, err)
+	}
+
+	for _, statement := range splitStatements(rendered.String()) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to run %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a migration file on the semicolons ending its lines, dropping comment lines
+func splitStatements(text string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
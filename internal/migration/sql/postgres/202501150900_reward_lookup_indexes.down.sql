@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS {{qualifiedIndex "event_logs_pending"}};
+DROP INDEX IF EXISTS {{qualifiedIndex "rewards_campaign_member"}};
@@ -0,0 +1,3 @@
+-- Indexes for the lookups of the worker: the rewards of a member in a campaign, and the pending event logs of a project
+CREATE INDEX IF NOT EXISTS {{index "rewards_campaign_member"}} ON {{table "rewards"}} (project, campaign_id, rewarded_member_reference_id);
+CREATE INDEX IF NOT EXISTS {{index "event_logs_pending"}} ON {{table "event_logs"}} (project, status, event_key);
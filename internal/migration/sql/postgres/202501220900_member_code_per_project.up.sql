@@ -0,0 +1,3 @@
+-- Referral codes are unique per project rather than globally, the initial schema having a unique index on the code alone
+DROP INDEX IF EXISTS {{qualify (modelIndex "members" "code")}};
+CREATE UNIQUE INDEX IF NOT EXISTS {{index "members_project_code"}} ON {{table "members"}} (project, code);
@@ -0,0 +1,39 @@
+-- Referral codes, a member having several. Every member gets a primary code, its member code, counting the members it
+-- referred so far, and the referred members the code they signed up with.
+CREATE TABLE {{table "codes"}} (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    project varchar(100) NOT NULL,
+    code varchar(50) NOT NULL,
+    member_id bigint NOT NULL,
+    member_reference_id varchar(100) NOT NULL,
+    is_primary boolean NOT NULL DEFAULT false,
+    channel varchar(100),
+    campaign_id bigint,
+    usage_limit bigint,
+    usage_count bigint NOT NULL DEFAULT 0,
+    expires_at timestamptz,
+    CONSTRAINT {{modelForeignKey "codes" "member"}} FOREIGN KEY (member_id) REFERENCES {{table "members"}} (id)
+);
+CREATE INDEX IF NOT EXISTS {{modelIndex "codes" "created_at"}} ON {{table "codes"}} (created_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "codes" "updated_at"}} ON {{table "codes"}} (updated_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "codes" "deleted_at"}} ON {{table "codes"}} (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS {{modelIndex "codes" "project_code"}} ON {{table "codes"}} (project, code);
+CREATE INDEX IF NOT EXISTS {{modelIndex "codes" "member_id"}} ON {{table "codes"}} (member_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "codes" "member_reference_id"}} ON {{table "codes"}} (member_reference_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "codes" "channel"}} ON {{table "codes"}} (channel);
+CREATE INDEX IF NOT EXISTS {{modelIndex "codes" "campaign_id"}} ON {{table "codes"}} (campaign_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "codes" "expires_at"}} ON {{table "codes"}} (expires_at);
+ALTER TABLE {{table "members"}} ADD COLUMN referred_by_code_id bigint;
+CREATE INDEX IF NOT EXISTS {{modelIndex "members" "referred_by_code_id"}} ON {{table "members"}} (referred_by_code_id);
+INSERT INTO {{table "codes"}}
+    (created_at, updated_at, deleted_at, project, code, member_id, member_reference_id, is_primary, usage_count)
+SELECT m.created_at, m.updated_at, m.deleted_at, m.project, m.code, m.id, m.reference_id, true,
+    (SELECT COUNT(*) FROM {{table "members"}} r WHERE r.referred_by_member_id = m.id)
+FROM {{table "members"}} m;
+UPDATE {{table "members"}} SET referred_by_code_id = (
+    SELECT c.id FROM {{table "codes"}} c WHERE c.member_id = {{table "members"}}.referred_by_member_id AND c.is_primary
+)
+WHERE referred_by_member_id IS NOT NULL;
@@ -0,0 +1,24 @@
+-- Clicks on the referral links, attributed to the members who sign up after
+CREATE TABLE {{table "clicks"}} (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    project varchar(100) NOT NULL,
+    visitor_id varchar(100) NOT NULL,
+    referral_code_id bigint NOT NULL,
+    code varchar(50) NOT NULL,
+    channel varchar(100),
+    clicked_at timestamptz NOT NULL,
+    signup_member_id bigint,
+    signup_member_reference_id varchar(100)
+);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "created_at"}} ON {{table "clicks"}} (created_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "updated_at"}} ON {{table "clicks"}} (updated_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "deleted_at"}} ON {{table "clicks"}} (deleted_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "project_visitor"}} ON {{table "clicks"}} (project, visitor_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "referral_code_id"}} ON {{table "clicks"}} (referral_code_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "channel"}} ON {{table "clicks"}} (channel);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "clicked_at"}} ON {{table "clicks"}} (clicked_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "signup_member_id"}} ON {{table "clicks"}} (signup_member_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "clicks" "signup_member_reference_id"}} ON {{table "clicks"}} (signup_member_reference_id);
@@ -0,0 +1,3 @@
+ALTER TABLE {{table "members"}} DROP COLUMN reward_events_from;
+ALTER TABLE {{table "members"}} DROP COLUMN referrer_attached_at;
+DROP TABLE IF EXISTS {{table "audit_logs"}};
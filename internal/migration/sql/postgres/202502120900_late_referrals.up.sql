@@ -0,0 +1,24 @@
+-- The audit log of the changes made to members, and when the referrer of a member was attached after signup
+CREATE TABLE {{table "audit_logs"}} (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    project varchar(100) NOT NULL,
+    member_id bigint NOT NULL,
+    member_reference_id varchar(100) NOT NULL,
+    action varchar(50) NOT NULL,
+    actor varchar(100),
+    reason text,
+    data json
+);
+CREATE INDEX IF NOT EXISTS {{modelIndex "audit_logs" "created_at"}} ON {{table "audit_logs"}} (created_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "audit_logs" "updated_at"}} ON {{table "audit_logs"}} (updated_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "audit_logs" "deleted_at"}} ON {{table "audit_logs"}} (deleted_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "audit_logs" "project"}} ON {{table "audit_logs"}} (project);
+CREATE INDEX IF NOT EXISTS {{modelIndex "audit_logs" "member_id"}} ON {{table "audit_logs"}} (member_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "audit_logs" "member_reference_id"}} ON {{table "audit_logs"}} (member_reference_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "audit_logs" "action"}} ON {{table "audit_logs"}} (action);
+CREATE INDEX IF NOT EXISTS {{modelIndex "audit_logs" "actor"}} ON {{table "audit_logs"}} (actor);
+ALTER TABLE {{table "members"}} ADD COLUMN referrer_attached_at timestamptz;
+ALTER TABLE {{table "members"}} ADD COLUMN reward_events_from timestamptz;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS {{qualify (modelIndex "rewards" "hold_expires_at")}};
+ALTER TABLE {{table "rewards"}} DROP COLUMN hold_expires_at;
+ALTER TABLE {{table "campaigns"}} DROP COLUMN inactive_referrer_hold_days;
+ALTER TABLE {{table "campaigns"}} DROP COLUMN inactive_referrer_policy;
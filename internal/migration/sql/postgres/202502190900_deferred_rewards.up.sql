@@ -0,0 +1,6 @@
+-- The policy of campaigns for the rewards of inactive referrers, and the expiry of held rewards. Existing campaigns
+-- hold the rewards, for the default hold days.
+ALTER TABLE {{table "campaigns"}} ADD COLUMN inactive_referrer_policy varchar(50) NOT NULL DEFAULT 'hold';
+ALTER TABLE {{table "campaigns"}} ADD COLUMN inactive_referrer_hold_days bigint;
+ALTER TABLE {{table "rewards"}} ADD COLUMN hold_expires_at timestamptz;
+CREATE INDEX IF NOT EXISTS {{modelIndex "rewards" "hold_expires_at"}} ON {{table "rewards"}} (hold_expires_at);
@@ -0,0 +1,12 @@
+-- The custom attributes of members, and the table indexing them for the filters
+CREATE TABLE {{table "member_attributes"}} (
+    id bigserial PRIMARY KEY,
+    project varchar(100) NOT NULL,
+    member_id bigint NOT NULL,
+    "key" varchar(100) NOT NULL,
+    "value" varchar(255) NOT NULL,
+    type varchar(20) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS {{modelIndex "member_attributes" "member_key"}} ON {{table "member_attributes"}} (member_id, "key");
+CREATE INDEX IF NOT EXISTS {{modelIndex "member_attributes" "lookup"}} ON {{table "member_attributes"}} (project, "key", "value");
+ALTER TABLE {{table "members"}} ADD COLUMN attributes json;
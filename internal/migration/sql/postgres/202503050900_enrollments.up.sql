@@ -0,0 +1,27 @@
+-- The history of the enrollments of members in campaigns. The current enrollments start it, from the signup of their
+-- member, the earliest they can have started.
+CREATE TABLE {{table "enrollments"}} (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    project varchar(100) NOT NULL,
+    member_id bigint NOT NULL,
+    member_reference_id varchar(100) NOT NULL,
+    campaign_id bigint NOT NULL,
+    started_at timestamptz NOT NULL,
+    ended_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "created_at"}} ON {{table "enrollments"}} (created_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "updated_at"}} ON {{table "enrollments"}} (updated_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "deleted_at"}} ON {{table "enrollments"}} (deleted_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "project"}} ON {{table "enrollments"}} (project);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "member_campaign"}} ON {{table "enrollments"}} (member_id, campaign_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "member_reference_id"}} ON {{table "enrollments"}} (member_reference_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "campaign_id"}} ON {{table "enrollments"}} (campaign_id);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "started_at"}} ON {{table "enrollments"}} (started_at);
+CREATE INDEX IF NOT EXISTS {{modelIndex "enrollments" "ended_at"}} ON {{table "enrollments"}} (ended_at);
+INSERT INTO {{table "enrollments"}}
+    (created_at, updated_at, project, member_id, member_reference_id, campaign_id, started_at)
+SELECT m.created_at, m.created_at, mc.project, mc.member_id, m.reference_id, mc.campaign_id, m.created_at
+FROM {{table "member_campaigns"}} mc JOIN {{table "members"}} m ON m.id = mc.member_id;
@@ -0,0 +1,3 @@
+-- The columns stay wide, as they may hold ciphertexts
+DROP INDEX IF EXISTS {{qualify (modelIndex "members" "email_index")}};
+ALTER TABLE {{table "members"}} DROP COLUMN email_index;
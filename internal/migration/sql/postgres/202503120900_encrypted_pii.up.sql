@@ -0,0 +1,7 @@
+-- The blind index of the emails of members, and the email and event log data columns widened to hold ciphertexts,
+-- which are longer and are not JSON. The values are encrypted once a key provider is set, by the services as they
+-- write and by ReencryptPII for the rest.
+ALTER TABLE {{table "members"}} ADD COLUMN email_index varchar(64);
+CREATE INDEX IF NOT EXISTS {{modelIndex "members" "email_index"}} ON {{table "members"}} (email_index);
+ALTER TABLE {{table "members"}} ALTER COLUMN email TYPE varchar(512);
+ALTER TABLE {{table "event_logs"}} ALTER COLUMN data TYPE text USING data::text;
@@ -0,0 +1,4 @@
+-- Indexes for the lookups of the worker: the rewards of a member in a campaign, and the pending event logs of a project
+-- SQLite qualifies the index rather than the table with the schema
+CREATE INDEX IF NOT EXISTS {{qualifiedIndex "rewards_campaign_member"}} ON {{tableName "rewards"}} (project, campaign_id, rewarded_member_reference_id);
+CREATE INDEX IF NOT EXISTS {{qualifiedIndex "event_logs_pending"}} ON {{tableName "event_logs"}} (project, status, event_key);
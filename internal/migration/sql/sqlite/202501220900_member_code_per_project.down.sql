@@ -0,0 +1,3 @@
+-- Fails if two projects share a code
+DROP INDEX IF EXISTS {{qualifiedIndex "members_project_code"}};
+CREATE UNIQUE INDEX IF NOT EXISTS {{qualify (modelIndex "members" "code")}} ON {{tableName "members"}} (code);
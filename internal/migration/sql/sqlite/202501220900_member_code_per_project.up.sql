@@ -0,0 +1,4 @@
+-- Referral codes are unique per project rather than globally, the initial schema having a unique index on the code alone
+-- SQLite qualifies the index rather than the table with the schema
+DROP INDEX IF EXISTS {{qualify (modelIndex "members" "code")}};
+CREATE UNIQUE INDEX IF NOT EXISTS {{qualifiedIndex "members_project_code"}} ON {{tableName "members"}} (project, code);
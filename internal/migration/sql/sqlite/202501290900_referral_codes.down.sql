@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS {{qualify (modelIndex "members" "referred_by_code_id")}};
+ALTER TABLE {{table "members"}} DROP COLUMN referred_by_code_id;
+DROP TABLE IF EXISTS {{table "codes"}};
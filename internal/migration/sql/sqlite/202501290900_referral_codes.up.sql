@@ -0,0 +1,40 @@
+-- Referral codes, a member having several. Every member gets a primary code, its member code, counting the members it
+-- referred so far, and the referred members the code they signed up with.
+-- SQLite qualifies the index rather than the table with the schema
+CREATE TABLE {{table "codes"}} (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    project text NOT NULL,
+    code text NOT NULL,
+    member_id integer NOT NULL,
+    member_reference_id text NOT NULL,
+    is_primary numeric NOT NULL DEFAULT false,
+    channel text,
+    campaign_id integer,
+    usage_limit integer,
+    usage_count integer NOT NULL DEFAULT 0,
+    expires_at datetime,
+    CONSTRAINT {{modelForeignKey "codes" "member"}} FOREIGN KEY (member_id) REFERENCES {{tableName "members"}} (id)
+);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "created_at")}} ON {{tableName "codes"}} (created_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "updated_at")}} ON {{tableName "codes"}} (updated_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "deleted_at")}} ON {{tableName "codes"}} (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "project_code")}} ON {{tableName "codes"}} (project, code);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "member_id")}} ON {{tableName "codes"}} (member_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "member_reference_id")}} ON {{tableName "codes"}} (member_reference_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "channel")}} ON {{tableName "codes"}} (channel);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "campaign_id")}} ON {{tableName "codes"}} (campaign_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "codes" "expires_at")}} ON {{tableName "codes"}} (expires_at);
+ALTER TABLE {{table "members"}} ADD COLUMN referred_by_code_id integer;
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "members" "referred_by_code_id")}} ON {{tableName "members"}} (referred_by_code_id);
+INSERT INTO {{table "codes"}}
+    (created_at, updated_at, deleted_at, project, code, member_id, member_reference_id, is_primary, usage_count)
+SELECT m.created_at, m.updated_at, m.deleted_at, m.project, m.code, m.id, m.reference_id, true,
+    (SELECT COUNT(*) FROM {{table "members"}} r WHERE r.referred_by_member_id = m.id)
+FROM {{table "members"}} m;
+UPDATE {{table "members"}} SET referred_by_code_id = (
+    SELECT c.id FROM {{table "codes"}} c WHERE c.member_id = {{table "members"}}.referred_by_member_id AND c.is_primary
+)
+WHERE referred_by_member_id IS NOT NULL;
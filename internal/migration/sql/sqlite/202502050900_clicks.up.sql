@@ -0,0 +1,25 @@
+-- Clicks on the referral links, attributed to the members who sign up after
+-- SQLite qualifies the index rather than the table with the schema
+CREATE TABLE {{table "clicks"}} (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    project text NOT NULL,
+    visitor_id text NOT NULL,
+    referral_code_id integer NOT NULL,
+    code text NOT NULL,
+    channel text,
+    clicked_at datetime NOT NULL,
+    signup_member_id integer,
+    signup_member_reference_id text
+);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "created_at")}} ON {{tableName "clicks"}} (created_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "updated_at")}} ON {{tableName "clicks"}} (updated_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "deleted_at")}} ON {{tableName "clicks"}} (deleted_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "project_visitor")}} ON {{tableName "clicks"}} (project, visitor_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "referral_code_id")}} ON {{tableName "clicks"}} (referral_code_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "channel")}} ON {{tableName "clicks"}} (channel);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "clicked_at")}} ON {{tableName "clicks"}} (clicked_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "signup_member_id")}} ON {{tableName "clicks"}} (signup_member_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "clicks" "signup_member_reference_id")}} ON {{tableName "clicks"}} (signup_member_reference_id);
@@ -0,0 +1,25 @@
+-- The audit log of the changes made to members, and when the referrer of a member was attached after signup
+-- SQLite qualifies the index rather than the table with the schema
+CREATE TABLE {{table "audit_logs"}} (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    project text NOT NULL,
+    member_id integer NOT NULL,
+    member_reference_id text NOT NULL,
+    action text NOT NULL,
+    actor text,
+    reason text,
+    data json
+);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "audit_logs" "created_at")}} ON {{tableName "audit_logs"}} (created_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "audit_logs" "updated_at")}} ON {{tableName "audit_logs"}} (updated_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "audit_logs" "deleted_at")}} ON {{tableName "audit_logs"}} (deleted_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "audit_logs" "project")}} ON {{tableName "audit_logs"}} (project);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "audit_logs" "member_id")}} ON {{tableName "audit_logs"}} (member_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "audit_logs" "member_reference_id")}} ON {{tableName "audit_logs"}} (member_reference_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "audit_logs" "action")}} ON {{tableName "audit_logs"}} (action);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "audit_logs" "actor")}} ON {{tableName "audit_logs"}} (actor);
+ALTER TABLE {{table "members"}} ADD COLUMN referrer_attached_at datetime;
+ALTER TABLE {{table "members"}} ADD COLUMN reward_events_from datetime;
@@ -0,0 +1,7 @@
+-- The policy of campaigns for the rewards of inactive referrers, and the expiry of held rewards. Existing campaigns
+-- hold the rewards, for the default hold days.
+-- SQLite qualifies the index rather than the table with the schema
+ALTER TABLE {{table "campaigns"}} ADD COLUMN inactive_referrer_policy text NOT NULL DEFAULT 'hold';
+ALTER TABLE {{table "campaigns"}} ADD COLUMN inactive_referrer_hold_days integer;
+ALTER TABLE {{table "rewards"}} ADD COLUMN hold_expires_at datetime;
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "rewards" "hold_expires_at")}} ON {{tableName "rewards"}} (hold_expires_at);
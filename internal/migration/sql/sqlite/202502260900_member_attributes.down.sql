@@ -0,0 +1,2 @@
+ALTER TABLE {{table "members"}} DROP COLUMN attributes;
+DROP TABLE IF EXISTS {{table "member_attributes"}};
@@ -0,0 +1,13 @@
+-- The custom attributes of members, and the table indexing them for the filters
+-- SQLite qualifies the index rather than the table with the schema
+CREATE TABLE {{table "member_attributes"}} (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    project text NOT NULL,
+    member_id integer NOT NULL,
+    "key" text NOT NULL,
+    "value" text NOT NULL,
+    type text NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS {{qualify (modelIndex "member_attributes" "member_key")}} ON {{tableName "member_attributes"}} (member_id, "key");
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "member_attributes" "lookup")}} ON {{tableName "member_attributes"}} (project, "key", "value");
+ALTER TABLE {{table "members"}} ADD COLUMN attributes json;
@@ -0,0 +1,28 @@
+-- The history of the enrollments of members in campaigns. The current enrollments start it, from the signup of their
+-- member, the earliest they can have started.
+-- SQLite qualifies the index rather than the table with the schema
+CREATE TABLE {{table "enrollments"}} (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    project text NOT NULL,
+    member_id integer NOT NULL,
+    member_reference_id text NOT NULL,
+    campaign_id integer NOT NULL,
+    started_at datetime NOT NULL,
+    ended_at datetime
+);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "created_at")}} ON {{tableName "enrollments"}} (created_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "updated_at")}} ON {{tableName "enrollments"}} (updated_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "deleted_at")}} ON {{tableName "enrollments"}} (deleted_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "project")}} ON {{tableName "enrollments"}} (project);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "member_campaign")}} ON {{tableName "enrollments"}} (member_id, campaign_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "member_reference_id")}} ON {{tableName "enrollments"}} (member_reference_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "campaign_id")}} ON {{tableName "enrollments"}} (campaign_id);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "started_at")}} ON {{tableName "enrollments"}} (started_at);
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "enrollments" "ended_at")}} ON {{tableName "enrollments"}} (ended_at);
+INSERT INTO {{table "enrollments"}}
+    (created_at, updated_at, project, member_id, member_reference_id, campaign_id, started_at)
+SELECT m.created_at, m.created_at, mc.project, mc.member_id, m.reference_id, mc.campaign_id, m.created_at
+FROM {{table "member_campaigns"}} mc JOIN {{table "members"}} m ON m.id = mc.member_id;
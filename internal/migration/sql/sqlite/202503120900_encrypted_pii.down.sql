@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS {{qualify (modelIndex "members" "email_index")}};
+ALTER TABLE {{table "members"}} DROP COLUMN email_index;
@@ -0,0 +1,6 @@
+-- The blind index of the emails of members. SQLite does not enforce the declared types, so the email and event log
+-- data columns hold the ciphertexts as they are. The values are encrypted once a key provider is set, by the services
+-- as they write and by ReencryptPII for the rest.
+-- SQLite qualifies the index rather than the table with the schema
+ALTER TABLE {{table "members"}} ADD COLUMN email_index text;
+CREATE INDEX IF NOT EXISTS {{qualify (modelIndex "members" "email_index")}} ON {{tableName "members"}} (email_index);
@@ -3,83 +3,79 @@ package serviceimpl
 import (
 	"database/sql"
 	"fmt"
+	"github.com/PayRam/go-referral/models"
 	"github.com/PayRam/go-referral/request"
 	"github.com/PayRam/go-referral/response"
 	"github.com/shopspring/decimal"
-	"gorm.io/gorm"
 	"strings"
 	"time"
 )
 
 type aggregatorService struct {
-	DB *gorm.DB
+	*Config
 }
 
 // var _ service.aggregatorService = &aggregatorService{}
 
-func NewAggregatorService(db *gorm.DB) *aggregatorService {
-	return &aggregatorService{DB: db}
+func NewAggregatorService(cfg *Config) *aggregatorService {
+	return &aggregatorService{Config: cfg}
 }
 
-func (s *aggregatorService) GetReferrerMembersStats(req request.GetMemberRequest) ([]response.ReferrerStats, int64, error) {
+func (s *aggregatorService) GetReferrerMembersStats(req request.GetMemberRequest) ([]response.ReferrerStats, response.PageInfo, error) {
 	var result []response.ReferrerStats
 	var totalCount int64
 
 	// Build base query for referrers
-	query := s.DB.Table("referral_members").
-		Select(`
-			referral_members.id AS id,
-			referral_members.project AS project,
-			referral_members.email AS email,
-			referral_members.reference_id AS reference_id,
-			referral_members.code AS code,
+	members := s.Naming.Table("members")
+	query := s.DB.Table(members).
+		Select(fmt.Sprintf(`
+			%[1]s.id AS id,
+			%[1]s.project AS project,
+			%[1]s.email AS email,
+			%[1]s.reference_id AS reference_id,
+			%[1]s.code AS code,
+			%[1]s.attributes AS attributes,
 			COUNT(DISTINCT rr.id) AS referee_count,
 			COALESCE(CAST(SUM(re.amount) AS TEXT), '0') AS total_rewards,
 			CASE 
-				WHEN referral_members.referred_by_member_id IS NOT NULL AND referral_members.referred_by_member_id > 0 
+				WHEN %[1]s.referred_by_member_id IS NOT NULL AND %[1]s.referred_by_member_id > 0 
 				THEN TRUE 
 				ELSE FALSE 
 			END AS is_referred,
-			referral_members.created_at AS created_at,
-			referral_members.updated_at AS updated_at,
-			COALESCE(CAST(referral_members.deleted_at AS TEXT), '') AS deleted_at 
-		`).
-		Joins(`
-			LEFT JOIN referral_members rr ON referral_members.id = rr.referred_by_member_id AND referral_members.project = rr.project
-		`).
-		Joins(`
-			LEFT JOIN referral_rewards re ON referral_members.id = re.rewarded_member_id AND referral_members.project = re.project
-		`)
-
-	// Apply campaign IDs filter if provided
-	if req.CampaignIDs != nil && len(req.CampaignIDs) > 0 {
-		query = query.Joins(`
-			JOIN referral_members_campaigns rc ON rc.member_id = referral_members.id AND rc.project = referral_members.project
-		`).Where("rc.campaign_id IN (?)", req.CampaignIDs)
-	}
+			%[1]s.created_at AS created_at,
+			%[1]s.updated_at AS updated_at,
+			COALESCE(CAST(%[1]s.deleted_at AS TEXT), '') AS deleted_at 
+		`, members)).
+		Joins(fmt.Sprintf(`
+			LEFT JOIN %[1]s rr ON %[1]s.id = rr.referred_by_member_id AND %[1]s.project = rr.project
+		`, members)).
+		Joins(fmt.Sprintf(`
+			LEFT JOIN %[2]s re ON %[1]s.id = re.rewarded_member_id AND %[1]s.project = re.project
+		`, members, s.Naming.Table("rewards")))
 
 	// **Fix Grouping Issues**
-	query = query.Group(`
-		referral_members.id, referral_members.project, referral_members.email, referral_members.reference_id,
-		referral_members.code, referral_members.created_at, referral_members.updated_at, referral_members.deleted_at
-	`)
+	query = query.Group(fmt.Sprintf(`
+		%[1]s.id, %[1]s.project, %[1]s.email, %[1]s.reference_id,
+		%[1]s.code, %[1]s.created_at, %[1]s.updated_at, %[1]s.deleted_at
+	`, members))
 
-	// Apply filters
+	// Apply filters, including the campaign IDs
 	query = request.ApplyGetMemberRequest(req, query)
 
 	// **Fix Count Query to Avoid Pagination**
 	countQuery := s.DB.Raw("SELECT COUNT(*) FROM (?) AS sub", query)
 	if err := countQuery.Count(&totalCount).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count referrer stats: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count referrer stats: %w", err)
 	}
 
-	// Apply pagination after counting
-	query = request.ApplyPaginationConditions(query, req.PaginationConditions)
+	// Apply pagination after counting, on the aggregated rows so that sorting and cursors can use the stats columns
+	statsQuery := s.DB.Table("(?) AS stats", query)
+	statsQuery = request.ApplyPaginationConditions(statsQuery, req.PaginationConditions, request.ReferrerStatsFields, s.CursorKey)
 
 	// Execute the query and scan results
-	rows, err := query.Rows()
+	rows, err := statsQuery.Rows()
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch referrers with stats: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch referrers with stats: %w", err)
 	}
 	defer rows.Close()
 
@@ -90,17 +86,21 @@ func (s *aggregatorService) GetReferrerMembersStats(req request.GetMemberRequest
 		var deletedAt sql.NullString // ✅ Handling possible NULLs
 
 		err := rows.Scan(
-			&referrer.ID, &referrer.Project, &email, &referrer.ReferenceID, &referrer.Code,
+			&referrer.ID, &referrer.Project, &email, &referrer.ReferenceID, &referrer.Code, &referrer.Attributes,
 			&referrer.RefereeCount, &totalRewardsStr, &referrer.IsReferred,
 			&referrer.CreatedAt, &referrer.UpdatedAt, &deletedAt, // ✅ Added deletedAt
 		)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan referrer stats: %w", err)
+			return nil, response.PageInfo{}, fmt.Errorf("failed to scan referrer stats: %w", err)
 		}
 
-		// Convert email NULL handling
+		// Convert email NULL handling, decrypting it as the rows are scanned without the models
 		if email.Valid {
-			referrer.Email = &email.String
+			plaintext, err := models.DecryptString(s.KeyProvider, email.String)
+			if err != nil {
+				return nil, response.PageInfo{}, fmt.Errorf("failed to decrypt email: %w", err)
+			}
+			referrer.Email = &plaintext
 		} else {
 			referrer.Email = nil
 		}
@@ -108,14 +108,19 @@ func (s *aggregatorService) GetReferrerMembersStats(req request.GetMemberRequest
 		// Convert total_rewards from string to decimal.Decimal
 		totalRewards, convErr := decimal.NewFromString(totalRewardsStr)
 		if convErr != nil {
-			return nil, 0, fmt.Errorf("failed to parse total_rewards: %w", convErr)
+			return nil, response.PageInfo{}, fmt.Errorf("failed to parse total_rewards: %w", convErr)
 		}
 
 		referrer.TotalRewards = totalRewards
 		result = append(result, referrer)
 	}
 
-	return result, totalCount, nil
+	page, err := request.BuildPageInfo(s.DB, &result, totalCount, req.PaginationConditions, request.ReferrerStatsFields, s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate referrer stats: %w", err)
+	}
+
+	return result, page, nil
 }
 
 func (s *aggregatorService) GetRewardsStats(req request.GetRewardRequest) ([]response.RewardStats, error) {
@@ -139,13 +144,13 @@ func (s *aggregatorService) GetRewardsStats(req request.GetRewardRequest) ([]res
 	if req.PaginationConditions.StartDate == nil || req.PaginationConditions.EndDate == nil {
 		var dateRangeStartStr, dateRangeEndStr string
 
-		if err := s.DB.Table("referral_rewards").
+		if err := s.DB.Table(s.Naming.Table("rewards")).
 			Select(`COALESCE(TO_CHAR(MIN(created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"'), '')`).
 			Row().Scan(&dateRangeStartStr); err != nil {
 			return nil, fmt.Errorf("failed to fetch earliest created_at date: %w", err)
 		}
 
-		if err := s.DB.Table("referral_rewards").
+		if err := s.DB.Table(s.Naming.Table("rewards")).
 			Select(`COALESCE(TO_CHAR(MAX(created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"HH24:MI:SS.MS"Z"'), '')`).
 			Row().Scan(&dateRangeEndStr); err != nil {
 			return nil, fmt.Errorf("failed to fetch latest created_at date: %w", err)
@@ -186,16 +191,16 @@ func (s *aggregatorService) GetRewardsStats(req request.GetRewardRequest) ([]res
 
 	rawSQL := fmt.Sprintf(`
 		SELECT
-			%s AS date,
+			%[1]s AS date,
 			SUM(amount) AS total_rewards,
 			COUNT(DISTINCT rewarded_member_reference_id) AS unique_referrers
-		FROM referral_rewards
+		FROM %[2]s
 		WHERE created_at BETWEEN
-			COALESCE($2, (SELECT MIN(created_at) FROM referral_rewards)) AND
-			COALESCE($3, (SELECT MAX(created_at) FROM referral_rewards))
-		GROUP BY %s
+			COALESCE($2, (SELECT MIN(created_at) FROM %[2]s)) AND
+			COALESCE($3, (SELECT MAX(created_at) FROM %[2]s))
+		GROUP BY %[1]s
 		ORDER BY MIN(created_at)
-	`, dateCaseExpr, dateCaseExpr)
+	`, dateCaseExpr, s.Naming.Table("rewards"))
 
 	if err := s.DB.Raw(rawSQL, days, req.PaginationConditions.StartDate, req.PaginationConditions.EndDate).
 		Scan(&results).Error; err != nil {
@@ -0,0 +1,146 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/service"
+	"gorm.io/gorm"
+	"sort"
+)
+
+const (
+	maxAttributeKeyLength   = 100
+	maxAttributeValueLength = 255
+)
+
+// ValidateAttributeSchema reports the keys and types of schema that are not valid
+func ValidateAttributeSchema(schema service.AttributeSchema) error {
+	v := &errors.ValidationError{}
+	for _, key := range sortedAttributeKeys(schema) {
+		validateAttributeKey(v, key)
+		switch schema[key] {
+		case models.AttributeTypeString, models.AttributeTypeNumber, models.AttributeTypeBool:
+		default:
+			v.Add(key, errors.CodeInvalid, fmt.Sprintf("type of %s must be 'string', 'number' or 'bool'", key))
+		}
+	}
+	return v.Err()
+}
+
+// attributeSchema returns the attribute schema of project, falling back to the schema of every project. It is nil
+// when members may have any attributes.
+func (c *Config) attributeSchema(project string) service.AttributeSchema {
+	if schema, ok := c.Attributes[project]; ok {
+		return schema
+	}
+	return c.Attributes[""]
+}
+
+// validateAttributes checks the custom attributes of a member against schema, when the project has one. With
+// removable, nil values are allowed, removing the attribute.
+func validateAttributes(v *errors.ValidationError, attributes models.Attributes, schema service.AttributeSchema, removable bool) {
+	for _, key := range sortedAttributeKeys(attributes) {
+		field := "attributes." + key
+		validateAttributeKey(v, key)
+
+		value := attributes[key]
+		if value == nil {
+			if !removable {
+				v.Add(field, errors.CodeRequired, fmt.Sprintf("attribute %s cannot be null", key))
+			}
+			continue
+		}
+		attributeType, ok := models.AttributeType(value)
+		if !ok {
+			v.Add(field, errors.CodeInvalid, fmt.Sprintf("attribute %s must be a string, a number or a boolean", key))
+			continue
+		}
+		if len(models.AttributeText(value)) > maxAttributeValueLength {
+			v.Add(field, errors.CodeOutOfRange, fmt.Sprintf("attribute %s cannot be longer than %d characters", key, maxAttributeValueLength))
+		}
+
+		if schema == nil {
+			continue
+		}
+		declared, ok := schema[key]
+		if !ok {
+			v.Add(field, errors.CodeNotAllowed, fmt.Sprintf("attribute %s is not declared in the attribute schema", key))
+		} else if declared != attributeType {
+			v.Add(field, errors.CodeInvalid, fmt.Sprintf("attribute %s must be of type %s", key, declared))
+		}
+	}
+}
+
+func validateAttributeKey(v *errors.ValidationError, key string) {
+	if key == "" || len(key) > maxAttributeKeyLength {
+		v.Add("attributes", errors.CodeInvalid, fmt.Sprintf("attribute keys must be between 1 and %d characters long", maxAttributeKeyLength))
+		return
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			v.Add("attributes."+key, errors.CodeInvalid, "attribute keys may only contain letters, digits, '_', '-' and '.'")
+			return
+		}
+	}
+}
+
+// mergeAttributes applies updates to the attributes of a member, nil values removing attributes
+func mergeAttributes(attributes, updates models.Attributes) models.Attributes {
+	merged := models.Attributes{}
+	for key, value := range attributes {
+		merged[key] = value
+	}
+	for key, value := range updates {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// memberAttributeRows returns the index rows of the attributes of member
+func memberAttributeRows(member *models.Member) []models.MemberAttribute {
+	rows := make([]models.MemberAttribute, 0, len(member.Attributes))
+	for _, key := range sortedAttributeKeys(member.Attributes) {
+		value := member.Attributes[key]
+		attributeType, _ := models.AttributeType(value)
+		rows = append(rows, models.MemberAttribute{
+			Project:  member.Project,
+			MemberID: member.ID,
+			Key:      key,
+			Value:    models.AttributeText(value),
+			Type:     attributeType,
+		})
+	}
+	return rows
+}
+
+// indexAttributes replaces the index rows of the attributes of member
+func indexAttributes(tx *gorm.DB, member *models.Member) error {
+	if err := tx.Where("member_id = ?", member.ID).Delete(&models.MemberAttribute{}).Error; err != nil {
+		return fmt.Errorf("failed to remove attribute index of member %s: %w", member.ReferenceID, err)
+	}
+	rows := memberAttributeRows(member)
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := tx.CreateInBatches(rows, 100).Error; err != nil {
+		return fmt.Errorf("failed to index attributes of member %s: %w", member.ReferenceID, err)
+	}
+	return nil
+}
+
+func sortedAttributeKeys[V any](attributes map[string]V) []string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
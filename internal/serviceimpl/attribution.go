@@ -0,0 +1,86 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/service"
+	"gorm.io/gorm"
+	"time"
+)
+
+const defaultAttributionWindow = 30 * 24 * time.Hour
+
+// ValidateAttributionPolicy reports the fields of policy that are not valid
+func ValidateAttributionPolicy(policy service.AttributionPolicy) error {
+	v := &errors.ValidationError{}
+	policy = withAttributionDefaults(policy)
+
+	if policy.Model != service.FirstTouch && policy.Model != service.LastTouch {
+		v.Add("model", errors.CodeInvalid, fmt.Sprintf("model must be '%s' or '%s'", service.FirstTouch, service.LastTouch))
+	}
+	if policy.Window < 0 {
+		v.Add("window", errors.CodeInvalid, "window cannot be negative")
+	}
+
+	return v.Err()
+}
+
+func withAttributionDefaults(policy service.AttributionPolicy) service.AttributionPolicy {
+	if policy.Model == "" {
+		policy.Model = service.LastTouch
+	}
+	if policy.Window == 0 {
+		policy.Window = defaultAttributionWindow
+	}
+	return policy
+}
+
+// attributionPolicy returns the attribution policy of project, falling back to the policy of every project
+func (c *Config) attributionPolicy(project string) service.AttributionPolicy {
+	policy, ok := c.Attribution[project]
+	if !ok {
+		policy = c.Attribution[""]
+	}
+	return withAttributionDefaults(policy)
+}
+
+// attributedClick returns the click of visitorID that refers a member signing up now, and its referral code, following
+// the attribution policy of project. Clicks already attributed, and clicks of codes that can no longer be used, e.g.
+// expired, are passed over. Both are nil when no click qualifies.
+func (c *Config) attributedClick(db *gorm.DB, project, visitorID string) (*models.Click, *models.ReferralCode, error) {
+	policy := c.attributionPolicy(project)
+	now := c.Clock.Now()
+
+	order := "clicked_at DESC, id DESC"
+	if policy.Model == service.FirstTouch {
+		order = "clicked_at ASC, id ASC"
+	}
+
+	var clicks []models.Click
+	if err := db.Where("project = ? AND visitor_id = ? AND signup_member_id IS NULL", project, visitorID).
+		Where("clicked_at > ? AND clicked_at <= ?", now.Add(-policy.Window), now).
+		Order(order).
+		Find(&clicks).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch clicks: %w", err)
+	}
+
+	unusable := map[uint]bool{}
+	for i := range clicks {
+		click := &clicks[i]
+		if unusable[click.ReferralCodeID] {
+			continue
+		}
+		// The code must still be usable, as if the member had given it
+		code, err := resolveReferrerCode(db, project, click.Code, now, &errors.ValidationError{})
+		if err != nil {
+			return nil, nil, err
+		}
+		if code == nil || code.ID != click.ReferralCodeID {
+			unusable[click.ReferralCodeID] = true
+			continue
+		}
+		return click, code, nil
+	}
+	return nil, nil, nil
+}
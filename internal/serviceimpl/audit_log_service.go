@@ -0,0 +1,62 @@
+package serviceimpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"gorm.io/gorm"
+)
+
+// recordAudit records action on member in the audit log, with data as its details
+func recordAudit(tx *gorm.DB, member *models.Member, action string, actor, reason *string, data map[string]interface{}) error {
+	entry := &models.AuditLog{
+		Project:           member.Project,
+		MemberID:          member.ID,
+		MemberReferenceID: member.ReferenceID,
+		Action:            action,
+		Actor:             actor,
+		Reason:            reason,
+	}
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit log data: %w", err)
+		}
+		details := string(encoded)
+		entry.Data = &details
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record audit log: %w", err)
+	}
+	return nil
+}
+
+func (s *referrerService) GetAuditLogs(req request.GetAuditLogsRequest) ([]models.AuditLog, response.PageInfo, error) {
+	var entries []models.AuditLog
+	var count int64
+
+	query := s.DB.Model(&models.AuditLog{})
+	query = request.ApplyGetAuditLogsRequest(req, query)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
+
+	// Calculate total count before applying pagination
+	countQuery := query
+	if err := countQuery.Count(&count).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count audit logs: %w", err)
+	}
+
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch audit logs: %w", err)
+	}
+
+	page, err := request.BuildPageInfo(query, &entries, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate audit logs: %w", err)
+	}
+
+	return entries, page, nil
+}
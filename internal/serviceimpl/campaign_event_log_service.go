@@ -4,22 +4,22 @@ import (
 	"fmt"
 	"github.com/PayRam/go-referral/models"
 	"github.com/PayRam/go-referral/request"
-	"gorm.io/gorm"
+	"github.com/PayRam/go-referral/response"
 )
 
 type campaignEventLogService struct {
-	DB *gorm.DB
+	*Config
 }
 
 //var _ service.campaignEventLogService = &campaignEventLogService{}
 
 // NewCampaignEventLogService initializes the EventLog service
-func NewCampaignEventLogService(db *gorm.DB) *campaignEventLogService {
-	return &campaignEventLogService{DB: db}
+func NewCampaignEventLogService(cfg *Config) *campaignEventLogService {
+	return &campaignEventLogService{Config: cfg}
 }
 
 // GetCampaignEventLogs retrieves event logs based on dynamic conditions
-func (s *campaignEventLogService) GetCampaignEventLogs(req request.GetCampaignEventLogRequest) ([]models.CampaignEventLog, int64, error) {
+func (s *campaignEventLogService) GetCampaignEventLogs(req request.GetCampaignEventLogRequest) ([]models.CampaignEventLog, response.PageInfo, error) {
 	var campaignEventLogs []models.CampaignEventLog
 	var count int64
 
@@ -29,24 +29,29 @@ func (s *campaignEventLogService) GetCampaignEventLogs(req request.GetCampaignEv
 	query = request.ApplyGetCampaignEventLogRequest(req, query)
 
 	// Apply Select Fields
-	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Calculate total count before applying pagination
 	countQuery := query
 	if err := countQuery.Count(&count).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count campaignEventLogs: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count campaignEventLogs: %w", err)
 	}
 
 	// Apply pagination conditions
-	query = request.ApplyPaginationConditions(query, req.PaginationConditions)
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
 
 	// Fetch records with pagination
 	if err := query.Preload("Campaign").Preload("Event").Preload("Member").Preload("ReferredReward").Preload("RefereeReward").Find(&campaignEventLogs).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch campaignEventLogs: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch campaignEventLogs: %w", err)
 	}
 
-	return campaignEventLogs, count, nil
+	page, err := request.BuildPageInfo(query, &campaignEventLogs, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate campaignEventLogs: %w", err)
+	}
+
+	return campaignEventLogs, page, nil
 }
@@ -1,180 +1,46 @@
 package serviceimpl
 
 import (
-	"errors"
 	"fmt"
+	"github.com/PayRam/go-referral/errors"
 	"github.com/PayRam/go-referral/models"
 	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
-	"time"
 )
 
 type campaignService struct {
-	DB *gorm.DB
+	*Config
 }
 
 //var _ service.campaignService = &campaignService{}
 
-func NewCampaignService(db *gorm.DB) *campaignService {
-	return &campaignService{DB: db}
+func NewCampaignService(cfg *Config) *campaignService {
+	return &campaignService{Config: cfg}
 }
 
 // CreateCampaign creates a new campaign
 func (s *campaignService) CreateCampaign(project string, req request.CreateCampaignRequest) (*models.Campaign, error) {
-
-	if req.Name == "" {
-		return nil, errors.New("name is required")
-	}
-
-	if req.CurrencyCode == "" {
-		return nil, errors.New("currencyCode is required")
-	}
-
-	// Validate required fields
-	if req.RewardType != nil || req.RewardValue != nil {
-		if req.RewardType == nil || req.RewardValue == nil {
-			return nil, errors.New("both rewardType and rewardValue must be provided or omitted")
-		}
-		if *req.RewardType != "flat_fee" && *req.RewardType != "percentage" {
-			return nil, errors.New("rewardType must be either 'flat_fee' or 'percentage'")
-		}
-		if req.RewardValue.Cmp(decimal.NewFromInt(0)) <= 0 {
-			return nil, errors.New("rewardValue must be greater than zero")
-		}
-		if *req.RewardType == "percentage" {
-			if req.RewardValue.Cmp(decimal.NewFromInt(100)) > 0 {
-				return nil, errors.New("percentage rewardValue must be between 0 and 100")
-			}
-			if req.RewardCap != nil && req.RewardCap.Cmp(decimal.NewFromInt(0)) <= 0 {
-				return nil, errors.New("rewardCap must be greater than zero")
-			}
-			if req.RewardCap != nil && req.RewardCapPerCustomer != nil && req.RewardCap.Cmp(*req.RewardCapPerCustomer) > 0 {
-				return nil, errors.New("reward cap must be less than or equal to reward cap per customer")
-			}
-			if req.RewardCapPerCustomer != nil && req.Budget != nil && req.RewardCapPerCustomer.Cmp(*req.Budget) > 0 {
-				return nil, errors.New("reward cap per customer must be less than or equal to budget")
-			}
-			// RewardCap can be nil or set
-		} else if *req.RewardType == "flat_fee" {
-			if req.RewardCap != nil {
-				return nil, errors.New("rewardCap must be nil for flat_fee rewardType")
-			}
-		}
-	}
-
-	// Validate InviteeRewardType and InviteeRewardValue
-	if req.InviteeRewardType != nil || req.InviteeRewardValue != nil {
-		if req.InviteeRewardType == nil || req.InviteeRewardValue == nil {
-			return nil, errors.New("both inviteeRewardType and inviteeRewardValue must be provided or omitted")
-		}
-		if *req.InviteeRewardType != "flat_fee" && *req.InviteeRewardType != "percentage" {
-			return nil, errors.New("inviteeRewardType must be either 'flat_fee' or 'percentage'")
-		}
-		if req.InviteeRewardValue.Cmp(decimal.NewFromInt(0)) <= 0 {
-			return nil, errors.New("inviteeRewardValue must be greater than zero")
-		}
-		if *req.InviteeRewardType == "percentage" {
-			//req.Budget.Cmp(decimal.NewFromInt(0)) <= 0
-			if req.InviteeRewardValue.Cmp(decimal.NewFromInt(100)) > 0 {
-				return nil, errors.New("percentage inviteeRewardValue must be between 0 and 100")
-			}
-			if req.InviteeRewardCap != nil && req.InviteeRewardCap.Cmp(decimal.NewFromInt(0)) <= 0 {
-				return nil, errors.New("inviteeRewardCap must be greater than zero")
-			}
-			if req.InviteeRewardCap != nil && req.RewardCapPerCustomer != nil && req.InviteeRewardCap.Cmp(*req.RewardCapPerCustomer) > 0 {
-				return nil, errors.New("invitee reward cap must be less than or equal to reward cap per customer")
-			}
-			// InviteeRewardCap can be nil or set
-		} else if *req.InviteeRewardType == "flat_fee" {
-			if req.InviteeRewardCap != nil {
-				return nil, errors.New("inviteeRewardCap must be nil for flat_fee inviteeRewardType")
-			}
-		}
-	}
-
-	// Validate CampaignTypePerCustomer
-	switch req.CampaignTypePerCustomer {
-	case "one_time", "forever":
-		if req.ValidityMonthsPerCustomer != nil || req.MaxOccurrencesPerCustomer != nil {
-			return nil, errors.New("for 'one_time' or 'forever' CampaignTypePerCustomer, ValidityMonthsPerCustomer and MaxOccurrencesPerCustomer must be nil")
-		}
-	case "months_per_customer":
-		if req.ValidityMonthsPerCustomer == nil {
-			return nil, errors.New("ValidityMonthsPerCustomer is required for 'months_per_customer' CampaignTypePerCustomer")
-		}
-		if req.MaxOccurrencesPerCustomer != nil {
-			return nil, errors.New("for 'months_per_customer' MaxOccurrencesPerCustomer must be nil")
-		}
-	case "count_per_customer":
-		if req.MaxOccurrencesPerCustomer == nil {
-			return nil, errors.New("MaxOccurrencesPerCustomer is required for 'count_per_customer' CampaignTypePerCustomer")
-		}
-		if req.ValidityMonthsPerCustomer != nil {
-			return nil, errors.New("for 'count_per_customer' ValidityMonthsPerCustomer must be nil")
-		}
-	default:
-		return nil, errors.New("invalid CampaignTypePerCustomer; must be 'one_time', 'forever', 'months_per_customer', or 'count_per_customer'")
-	}
-
-	if req.Budget != nil && req.Budget.Cmp(decimal.NewFromInt(0)) <= 0 {
-		return nil, errors.New("budget must be greater than zero")
-	}
-
-	if req.StartDate != nil && req.EndDate == nil {
-		return nil, errors.New("end date is required if start date is provided")
-	}
-
-	if req.EndDate != nil && req.StartDate == nil {
-		return nil, errors.New("start date is required if end date is provided")
-	}
-
-	if req.StartDate != nil && req.EndDate != nil {
-		if req.StartDate.After(*req.EndDate) {
-			return nil, errors.New("start date cannot be after end date")
-		}
-		if req.EndDate.Before(time.Now()) {
-			return nil, errors.New("end date cannot be in the past")
-		}
-	}
-
-	if req.EventKeys == nil || len(req.EventKeys) == 0 {
-		return nil, errors.New("eventKeys must be provided")
-	}
+	validation := validateCreateCampaignRequest(req, s.Clock.Now())
 
 	// fetch events using event keys
 	var events []models.Event
-
-	// Fetch the events by keys
-	if err := s.DB.Where("project = ? AND key IN ?", project, req.EventKeys).Find(&events).Error; err != nil {
-		return nil, fmt.Errorf("failed to fetch events for keys %v: %w", req.EventKeys, err)
-	}
-
-	if len(events) != len(req.EventKeys) {
-		return nil, errors.New("not all event keys were found")
-	}
-
-	paymentCount := 0
-	for _, event := range events {
-		if event.EventType == "payment" {
-			paymentCount++
-		}
-		if paymentCount > 1 {
-			return nil, errors.New("only one event with event type 'payment' is allowed")
+	if len(req.EventKeys) > 0 {
+		if err := s.DB.Where("project = ? AND key IN ?", project, req.EventKeys).Find(&events).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch events for keys %v: %w", req.EventKeys, err)
 		}
+		validateCampaignEvents(validation, req.EventKeys, events, req.RewardType, req.InviteeRewardType)
 	}
 
-	if req.RewardType == nil && req.InviteeRewardType == nil {
-		return nil, errors.New("either rewardType or inviteeRewardType must be provided")
-	}
-
-	if req.RewardType != nil && *req.RewardType == "percentage" && paymentCount != 1 {
-		return nil, errors.New("only one event with event type 'payment' is required for campaigns with 'percentage' reward type")
+	if err := validation.Err(); err != nil {
+		return nil, err
 	}
 
-	if req.InviteeRewardType != nil && *req.InviteeRewardType == "percentage" && paymentCount != 1 {
-		return nil, errors.New("only one event with event type 'payment' is required for campaigns with 'percentage' invitee reward type")
+	inactiveReferrerPolicy := models.InactiveReferrerHold
+	if req.InactiveReferrerPolicy != nil {
+		inactiveReferrerPolicy = *req.InactiveReferrerPolicy
 	}
 
 	// Create the campaign object
@@ -197,8 +63,10 @@ func (s *campaignService) CreateCampaign(project string, req request.CreateCampa
 		ValidityMonthsPerCustomer: req.ValidityMonthsPerCustomer,
 		MaxOccurrencesPerCustomer: req.MaxOccurrencesPerCustomer,
 		RewardCapPerCustomer:      req.RewardCapPerCustomer,
+		InactiveReferrerPolicy:    inactiveReferrerPolicy,
+		InactiveReferrerHoldDays:  req.InactiveReferrerHoldDays,
 		Status:                    "active",
-		ConsiderEventsFrom:        time.Now().UTC(),
+		ConsiderEventsFrom:        s.Clock.Now().UTC(),
 	}
 
 	// Wrap the operation in a transaction
@@ -234,7 +102,7 @@ func (s *campaignService) CreateCampaign(project string, req request.CreateCampa
 }
 
 // GetCampaigns retrieves campaigns based on dynamic conditions
-func (s *campaignService) GetCampaigns(req request.GetCampaignsRequest) ([]models.Campaign, int64, error) {
+func (s *campaignService) GetCampaigns(req request.GetCampaignsRequest) ([]models.Campaign, response.PageInfo, error) {
 	var campaigns []models.Campaign
 	var count int64
 
@@ -244,26 +112,31 @@ func (s *campaignService) GetCampaigns(req request.GetCampaignsRequest) ([]model
 	query = request.ApplyGetCampaignRequest(req, query)
 
 	// Apply Select Fields
-	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Calculate total count before applying pagination
 	countQuery := query
 	if err := countQuery.Count(&count).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count campaigns: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count campaigns: %w", err)
 	}
 
 	// Apply pagination conditions
-	query = request.ApplyPaginationConditions(query, req.PaginationConditions)
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
 
 	// Fetch records with pagination
 	if err := query.Preload("Events").Find(&campaigns).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch campaigns: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch campaigns: %w", err)
 	}
 
-	return campaigns, count, nil
+	page, err := request.BuildPageInfo(query, &campaigns, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate campaigns: %w", err)
+	}
+
+	return campaigns, page, nil
 }
 
 func (s *campaignService) GetTotalCampaigns(req request.GetCampaignsRequest) (int64, error) {
@@ -275,10 +148,10 @@ func (s *campaignService) GetTotalCampaigns(req request.GetCampaignsRequest) (in
 	query = request.ApplyGetCampaignRequest(req, query)
 
 	// Apply Select Fields
-	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Count the records
 	if err := query.Count(&count).Error; err != nil {
@@ -295,32 +168,32 @@ func (s *campaignService) UpdateCampaign(project string, id uint, req request.Up
 	// Fetch the campaign first
 	if err := s.DB.Where("id = ? AND project = ?", id, project).First(&campaign).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("campaign not found for project %s and id %d", project, id)
+			return nil, errors.NotFound("campaign", "project=%s and id=%d", project, id)
 		}
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch campaign: %w", err)
 	}
 
-	currentTime := time.Now()
+	currentTime := s.Clock.Now()
 
 	isOngoing := campaign.StartDate.Before(currentTime) && campaign.EndDate.After(currentTime)
 	isFuture := campaign.StartDate.After(currentTime)
 
 	if !isOngoing && !isFuture {
-		return nil, errors.New("cannot update a campaign that has ended")
+		return nil, errors.Conflict("campaign", "cannot update a campaign that has ended")
 	}
 
+	validation := validateUpdateCampaignRequest(req, currentTime)
+
 	// If the campaign is ongoing, restrict the fields that can be updated
-	if isOngoing {
-		if req.Name == nil && req.Budget == nil && req.Description == nil && req.EndDate == nil {
-			return nil, errors.New("only Name, Budget, Description, and EndDate can be updated for ongoing campaigns")
-		}
+	if isOngoing && req.Name == nil && req.Budget == nil && req.Description == nil && req.EndDate == nil {
+		validation.Add("", errors.CodeNotAllowed, "only Name, Budget, Description, and EndDate can be updated for ongoing campaigns")
 	}
 
 	// If updating the budget, ensure it is not less than the total rewards distributed
 	if req.Budget != nil {
 		var totalRewards decimal.Decimal
 		err := s.DB.Model(&models.Reward{}).
-			Where("project = ? AND campaign_id = ?", project, campaign.ID).
+			Where("project = ? AND campaign_id = ? AND status <> ?", project, campaign.ID, models.RewardStatusForfeited).
 			Select("COALESCE(SUM(amount), 0)").
 			Scan(&totalRewards).Error
 
@@ -329,152 +202,21 @@ func (s *campaignService) UpdateCampaign(project string, id uint, req request.Up
 		}
 
 		if req.Budget.Cmp(totalRewards) < 0 {
-			return nil, fmt.Errorf("budget cannot be less than the total rewards distributed (%.18s)", totalRewards.String())
-		}
-	}
-
-	if req.Name != nil && *req.Name == "" {
-		return nil, errors.New("name cannot be empty")
-	}
-
-	if req.CurrencyCode != nil && *req.CurrencyCode == "" {
-		return nil, errors.New("currencyCode cannot be empty")
-	}
-
-	if req.Status != nil && *req.Status != "active" && *req.Status != "paused" && *req.Status != "archived" {
-		return nil, errors.New("status must be either 'active', 'paused', or 'archived'")
-	}
-
-	if req.RewardType != nil && *req.RewardType != "flat_fee" && *req.RewardType != "percentage" {
-		return nil, errors.New("rewardType must be either 'flat_fee' or 'percentage'")
-	}
-
-	if req.RewardValue != nil && req.RewardValue.Cmp(decimal.NewFromInt(0)) <= 0 {
-		return nil, errors.New("rewardValue must be greater than zero")
-	}
-
-	if req.RewardType != nil && *req.RewardType == "percentage" {
-		if req.RewardValue != nil && req.RewardValue.Cmp(decimal.NewFromInt(100)) > 0 {
-			return nil, errors.New("percentage rewardValue must be between 0 and 100")
-		}
-		if req.RewardCap != nil && req.RewardCap.Cmp(decimal.NewFromInt(0)) <= 0 {
-			return nil, errors.New("rewardCap must be greater than zero")
-		}
-		if req.RewardCap != nil && req.RewardCapPerCustomer != nil && req.RewardCap.Cmp(*req.RewardCapPerCustomer) > 0 {
-			return nil, errors.New("reward cap must be less than or equal to reward cap per customer")
-		}
-		if req.RewardCapPerCustomer != nil && req.Budget != nil && req.RewardCapPerCustomer.Cmp(*req.Budget) > 0 {
-			return nil, errors.New("reward cap per customer must be less than or equal to budget")
-		}
-		// RewardCap can be nil or set
-	} else if req.RewardType != nil && *req.RewardType == "flat_fee" {
-		if req.RewardCap != nil {
-			return nil, errors.New("rewardCap must be nil for flat_fee rewardType")
-		}
-	}
-
-	// Validate InviteeRewardType and InviteeRewardValue
-	if req.InviteeRewardType != nil || req.InviteeRewardValue != nil {
-		if req.InviteeRewardType == nil || req.InviteeRewardValue == nil {
-			return nil, errors.New("both inviteeRewardType and inviteeRewardValue must be provided or omitted")
-		}
-		if *req.InviteeRewardType != "flat_fee" && *req.InviteeRewardType != "percentage" {
-			return nil, errors.New("inviteeRewardType must be either 'flat_fee' or 'percentage'")
-		}
-		if *req.InviteeRewardType == "percentage" {
-			if req.InviteeRewardValue.Cmp(decimal.NewFromInt(100)) > 0 || req.InviteeRewardValue.Cmp(decimal.NewFromInt(0)) < 0 {
-				return nil, errors.New("percentage inviteeRewardValue must be between 0 and 100")
-			}
-			if req.InviteeRewardCap != nil && req.InviteeRewardCap.Cmp(decimal.NewFromInt(0)) <= 0 {
-				return nil, errors.New("inviteeRewardCap must be greater than zero")
-			}
-			if req.InviteeRewardCap != nil && req.RewardCapPerCustomer != nil && req.InviteeRewardCap.Cmp(*req.RewardCapPerCustomer) > 0 {
-				return nil, errors.New("invitee reward cap must be less than or equal to reward cap per customer")
-			}
-		} else if *req.InviteeRewardType == "flat_fee" {
-			if req.InviteeRewardCap != nil {
-				return nil, errors.New("inviteeRewardCap must be nil for flat_fee inviteeRewardType")
-			}
-		}
-	}
-
-	// Validate CampaignTypePerCustomer
-	if req.CampaignTypePerCustomer != nil {
-		switch *req.CampaignTypePerCustomer {
-		case "one_time", "forever":
-			if req.ValidityMonthsPerCustomer != nil || req.MaxOccurrencesPerCustomer != nil {
-				return nil, errors.New("for 'one_time' or 'forever' CampaignTypePerCustomer, ValidityMonthsPerCustomer and MaxOccurrencesPerCustomer must be nil")
-			}
-		case "months_per_customer":
-			if req.ValidityMonthsPerCustomer == nil {
-				return nil, errors.New("ValidityMonthsPerCustomer is required for 'months_per_customer' CampaignTypePerCustomer")
-			}
-			if req.MaxOccurrencesPerCustomer != nil {
-				return nil, errors.New("for 'months_per_customer' MaxOccurrencesPerCustomer must be nil")
-			}
-		case "count_per_customer":
-			if req.MaxOccurrencesPerCustomer == nil {
-				return nil, errors.New("MaxOccurrencesPerCustomer is required for 'count_per_customer' CampaignTypePerCustomer")
-			}
-			if req.ValidityMonthsPerCustomer != nil {
-				return nil, errors.New("for 'count_per_customer' ValidityMonthsPerCustomer must be nil")
-			}
-		default:
-			return nil, errors.New("invalid CampaignTypePerCustomer; must be 'one_time', 'forever', 'months_per_customer', or 'count_per_customer'")
-		}
-	}
-
-	if req.Budget != nil && req.Budget.Cmp(decimal.NewFromInt(0)) <= 0 {
-		return nil, errors.New("budget must be greater than zero")
-	}
-
-	if req.StartDate != nil && req.EndDate == nil {
-		return nil, errors.New("end date is required if start date is provided")
-	}
-
-	if req.EndDate != nil && req.StartDate == nil {
-		return nil, errors.New("start date is required if end date is provided")
-	}
-
-	if req.StartDate != nil && req.EndDate != nil {
-		if req.StartDate.After(*req.EndDate) {
-			return nil, errors.New("start date cannot be after end date")
-		}
-		if req.EndDate.Before(time.Now()) {
-			return nil, errors.New("end date cannot be in the past")
+			validation.Add("budget", errors.CodeOutOfRange, fmt.Sprintf("budget cannot be less than the total rewards distributed (%.18s)", totalRewards.String()))
 		}
 	}
 
 	// fetch events using event keys
 	var events []models.Event
-	paymentCount := 0
-
-	if req.EventKeys != nil && len(req.EventKeys) > 0 {
-
-		// Fetch the events by keys
+	if len(req.EventKeys) > 0 {
 		if err := s.DB.Where("project = ? AND key IN ?", project, req.EventKeys).Find(&events).Error; err != nil {
 			return nil, fmt.Errorf("failed to fetch events for keys %v: %w", req.EventKeys, err)
 		}
-
-		if len(events) != len(req.EventKeys) {
-			return nil, errors.New("not all event keys were found")
-		}
-
-		for _, event := range events {
-			if event.EventType == "payment" {
-				paymentCount++
-			}
-			if paymentCount > 1 {
-				return nil, errors.New("only one event with event type 'payment' is allowed")
-			}
-		}
+		validateCampaignEvents(validation, req.EventKeys, events, campaign.RewardType, campaign.InviteeRewardType)
 	}
 
-	// Validate the date range
-	if req.StartDate != nil && req.EndDate != nil {
-		if req.StartDate.After(*req.EndDate) {
-			return nil, errors.New("start date cannot be after end date")
-		}
+	if err := validation.Err(); err != nil {
+		return nil, err
 	}
 
 	// Prepare the updates
@@ -495,24 +237,10 @@ func (s *campaignService) UpdateCampaign(project string, id uint, req request.Up
 			updates["description"] = req.Description
 		}
 		if req.EndDate != nil {
-			if req.EndDate.Before(currentTime) {
-				return nil, errors.New("end date cannot be in the past")
-			}
 			updates["end_date"] = req.EndDate
 		}
 	}
 
-	if req.EventKeys != nil && len(req.EventKeys) > 0 {
-
-		if campaign.RewardType != nil && *campaign.RewardType == "percentage" && paymentCount != 1 {
-			return nil, errors.New("at least one event with event type 'payment' is required for campaigns with 'percentage' reward type")
-		}
-
-		if campaign.InviteeRewardType != nil && *campaign.InviteeRewardType == "percentage" && paymentCount != 1 {
-			return nil, errors.New("at least one event with event type 'payment' is required for campaigns with 'percentage' invitee reward type")
-		}
-	}
-
 	// Wrap the operation in a transaction
 	err := s.DB.Transaction(func(tx *gorm.DB) error {
 
@@ -521,9 +249,9 @@ func (s *campaignService) UpdateCampaign(project string, id uint, req request.Up
 			Clauses(clause.Locking{Strength: "UPDATE"}). // Add record-level lock
 			First(&campaign).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return fmt.Errorf("campaign not found for project %s and id %d", project, id)
+				return errors.NotFound("campaign", "project=%s and id=%d", project, id)
 			}
-			return err
+			return fmt.Errorf("failed to fetch campaign with lock: %w", err)
 		}
 
 		if len(updates) > 0 {
@@ -579,7 +307,7 @@ func (s *campaignService) SetDefaultCampaign(project string, campaignID uint) (*
 			Where("project = ? AND id = ?", project, campaignID).
 			First(&campaign).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return fmt.Errorf("campaign not found for project %s and ID %d", project, campaignID)
+				return errors.NotFound("campaign", "project=%s and id=%d", project, campaignID)
 			}
 			return fmt.Errorf("failed to fetch campaign with lock: %w", err)
 		}
@@ -635,9 +363,10 @@ func (s *campaignService) RemoveDefaultCampaign(project string, campaignID uint)
 // UpdateCampaignStatus updates the status of an existing campaign
 func (s *campaignService) UpdateCampaignStatus(project string, campaignID uint, newStatus string) (*models.Campaign, error) {
 	var campaign models.Campaign
+	var from string
 
 	if newStatus != "active" && newStatus != "paused" && newStatus != "archived" {
-		return nil, errors.New("status must be either 'active', 'paused', or 'archived'")
+		return nil, errors.Invalid("status", errors.CodeInvalid, "status must be either 'active', 'paused', or 'archived'")
 	}
 
 	// Use a transaction to ensure atomicity
@@ -647,24 +376,26 @@ func (s *campaignService) UpdateCampaignStatus(project string, campaignID uint,
 			Where("project = ? AND id = ?", project, campaignID).
 			First(&campaign).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return fmt.Errorf("campaign not found for project %s and ID %d: %w", project, campaignID, err)
+				return errors.NotFound("campaign", "project=%s and id=%d", project, campaignID)
 			}
-			return err
+			return fmt.Errorf("failed to fetch campaign with lock: %w", err)
 		}
 
 		if campaign.Status == "archived" {
-			return fmt.Errorf("campaign is archived and cannot be updated")
+			return &errors.InvalidStateTransitionError{Resource: "campaign", From: campaign.Status, To: newStatus, Reason: "campaign is archived"}
 		}
 
-		if newStatus != "archived" && campaign.EndDate.Before(time.Now()) {
-			return fmt.Errorf("campaign has ended and cannot be set to '%s'", newStatus)
+		if newStatus != "archived" && campaign.EndDate.Before(s.Clock.Now()) {
+			return &errors.InvalidStateTransitionError{Resource: "campaign", From: campaign.Status, To: newStatus, Reason: "campaign has ended"}
 		}
 
 		// Check if the status is already the same as newStatus
 		if campaign.Status == newStatus {
-			return fmt.Errorf("campaign is already in status '%s'", newStatus)
+			return &errors.InvalidStateTransitionError{Resource: "campaign", From: campaign.Status, To: newStatus}
 		}
 
+		from = campaign.Status
+
 		// Prepare update fields
 		updateFields := map[string]interface{}{
 			"status": newStatus,
@@ -672,7 +403,7 @@ func (s *campaignService) UpdateCampaignStatus(project string, campaignID uint,
 
 		// If status is changing to active, update ConsiderEventsFrom timestamp
 		if newStatus == "active" {
-			now := time.Now().UTC()
+			now := s.Clock.Now().UTC()
 			updateFields["consider_events_from"] = now
 		}
 
@@ -692,6 +423,7 @@ func (s *campaignService) UpdateCampaignStatus(project string, campaignID uint,
 	if err := s.DB.Preload("Events").Where("project = ? AND id = ?", project, campaignID).First(&campaign).Error; err != nil {
 		return nil, fmt.Errorf("failed to reload updated campaign: %w", err)
 	}
+	s.campaignStatusChanged(campaign, from)
 
 	return &campaign, nil
 }
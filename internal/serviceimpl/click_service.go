@@ -0,0 +1,148 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"gorm.io/gorm"
+)
+
+// RecordClick records a visit of a referral link. Clicks of expired or used up codes are recorded too, but are not
+// attributed to signups.
+func (s *referralCodeService) RecordClick(project string, req request.CreateClickRequest) (*models.Click, error) {
+	now := s.Clock.Now()
+	validation := validateCreateClickRequest(req, now)
+
+	var code models.ReferralCode
+	if req.Code != "" {
+		if err := s.DB.Where("project = ? AND code = ?", project, req.Code).First(&code).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("failed to fetch referral code: %w", err)
+			}
+			validation.Add("code", errors.CodeNotFound, fmt.Sprintf("invalid referral code: %s", req.Code))
+		}
+	}
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	click := &models.Click{
+		Project:        project,
+		VisitorID:      req.VisitorID,
+		ReferralCodeID: code.ID,
+		Code:           code.Code,
+		Channel:        code.Channel,
+		ClickedAt:      now,
+	}
+	if req.Channel != nil {
+		click.Channel = req.Channel
+	}
+	if req.ClickedAt != nil {
+		click.ClickedAt = *req.ClickedAt
+	}
+	if err := s.DB.Create(click).Error; err != nil {
+		return nil, fmt.Errorf("failed to record click: %w", err)
+	}
+	return click, nil
+}
+
+func (s *referralCodeService) GetClicks(req request.GetClicksRequest) ([]models.Click, response.PageInfo, error) {
+	var clicks []models.Click
+	var count int64
+
+	query := s.DB.Model(&models.Click{})
+	query = request.ApplyGetClicksRequest(req, query)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
+
+	// Calculate total count before applying pagination
+	countQuery := query
+	if err := countQuery.Count(&count).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count clicks: %w", err)
+	}
+
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err := query.Find(&clicks).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch clicks: %w", err)
+	}
+
+	page, err := request.BuildPageInfo(query, &clicks, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate clicks: %w", err)
+	}
+
+	return clicks, page, nil
+}
+
+// GetCodeStats pages through the referral codes like GetReferralCodes, then counts the funnel of the codes of the page
+func (s *referralCodeService) GetCodeStats(req request.GetReferralCodesRequest) ([]response.CodeStats, response.PageInfo, error) {
+	req.PaginationConditions.SelectFields = nil
+	req.PaginationConditions.GroupBy = nil
+	codes, page, err := s.GetReferralCodes(req)
+	if err != nil {
+		return nil, response.PageInfo{}, err
+	}
+
+	stats := make([]response.CodeStats, len(codes))
+	index := map[uint]*response.CodeStats{}
+	ids := make([]uint, len(codes))
+	for i, code := range codes {
+		stats[i] = response.CodeStats{
+			ReferralCodeID:    code.ID,
+			Project:           code.Project,
+			Code:              code.Code,
+			MemberReferenceID: code.MemberReferenceID,
+			Channel:           code.Channel,
+		}
+		index[code.ID] = &stats[i]
+		ids[i] = code.ID
+	}
+	if len(ids) == 0 {
+		return stats, page, nil
+	}
+
+	var clicks []struct {
+		CodeID   uint
+		Clicks   int64
+		Visitors int64
+	}
+	if err := s.DB.Model(&models.Click{}).
+		Select("referral_code_id AS code_id, COUNT(*) AS clicks, COUNT(DISTINCT visitor_id) AS visitors").
+		Where("referral_code_id IN (?)", ids).
+		Group("referral_code_id").
+		Scan(&clicks).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count clicks: %w", err)
+	}
+	for _, c := range clicks {
+		index[c.CodeID].Clicks = c.Clicks
+		index[c.CodeID].Visitors = c.Visitors
+	}
+
+	members, rewards := s.Naming.Table("members"), s.Naming.Table("rewards")
+	var signups []struct {
+		CodeID      uint
+		Signups     int64
+		Conversions int64
+	}
+	if err := s.DB.Model(&models.Member{}).
+		Select(fmt.Sprintf(`referred_by_code_id AS code_id, COUNT(*) AS signups,
+			COUNT(CASE WHEN EXISTS (
+				SELECT 1 FROM %[2]s r
+				WHERE r.deleted_at IS NULL AND (
+					(r.related_member_id = %[1]s.id AND r.member_type = 'referrer') OR
+					(r.rewarded_member_id = %[1]s.id AND r.member_type = 'referee'))
+			) THEN 1 END) AS conversions`, members, rewards)).
+		Where("referred_by_code_id IN (?)", ids).
+		Group("referred_by_code_id").
+		Scan(&signups).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count signups: %w", err)
+	}
+	for _, c := range signups {
+		index[c.CodeID].Signups = c.Signups
+		index[c.CodeID].Conversions = c.Conversions
+	}
+
+	return stats, page, nil
+}
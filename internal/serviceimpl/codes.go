@@ -0,0 +1,206 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/service"
+	"github.com/PayRam/go-referral/utils"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+)
+
+// maxCodeLength is the size of the code column
+const maxCodeLength = 50
+
+var defaultVanityCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateCodePolicy reports the fields of policy that cannot produce valid codes, e.g. an alphabet with duplicate
+// characters, which would make some characters likelier than others
+func ValidateCodePolicy(policy service.CodePolicy) error {
+	v := &errors.ValidationError{}
+	policy = withCodePolicyDefaults(policy)
+
+	if policy.Length < 0 {
+		v.Add("length", errors.CodeInvalid, "length cannot be negative")
+	}
+	seen := map[rune]bool{}
+	for _, r := range policy.Alphabet {
+		if seen[r] {
+			v.Add("alphabet", errors.CodeInvalid, fmt.Sprintf("alphabet has the character %q more than once", r))
+			break
+		}
+		seen[r] = true
+	}
+	if policy.Generator == nil && len(policy.Prefix)+policy.Length+len(policy.Suffix) > maxCodeLength {
+		v.Add("length", errors.CodeInvalid, fmt.Sprintf("generated codes cannot be longer than %d characters", maxCodeLength))
+	}
+	if policy.MinLength < 1 || policy.MinLength > policy.MaxLength || policy.MaxLength > maxCodeLength {
+		v.Add("maxLength", errors.CodeInvalid, fmt.Sprintf("vanity code lengths must be between 1 and %d", maxCodeLength))
+	}
+	if policy.MaxAttempts < 1 {
+		v.Add("maxAttempts", errors.CodeInvalid, "maxAttempts must be positive")
+	}
+
+	return v.Err()
+}
+
+func withCodePolicyDefaults(policy service.CodePolicy) service.CodePolicy {
+	if policy.Length == 0 {
+		policy.Length = 7
+	}
+	if policy.Alphabet == "" {
+		policy.Alphabet = utils.ReferralCodeAlphabet
+	}
+	if policy.MinLength == 0 {
+		policy.MinLength = 4
+	}
+	if policy.MaxLength == 0 {
+		policy.MaxLength = maxCodeLength
+	}
+	if policy.Pattern == nil {
+		policy.Pattern = defaultVanityCodePattern
+	}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = 10
+	}
+	return policy
+}
+
+// codePolicy returns the code policy of project, falling back to the policy of every project
+func (c *Config) codePolicy(project string) service.CodePolicy {
+	policy, ok := c.CodePolicies[project]
+	if !ok {
+		policy = c.CodePolicies[""]
+	}
+	return withCodePolicyDefaults(policy)
+}
+
+// validateVanityCode adds to v, under field, the rules of policy that the vanity code breaks
+func validateVanityCode(v *errors.ValidationError, field string, policy service.CodePolicy, code string) {
+	switch {
+	case len(code) < policy.MinLength || len(code) > policy.MaxLength:
+		v.Add(field, errors.CodeInvalid,
+			fmt.Sprintf("code must be between %d and %d characters long", policy.MinLength, policy.MaxLength))
+	case !policy.Pattern.MatchString(code):
+		v.Add(field, errors.CodeInvalid, fmt.Sprintf("code must match %s", policy.Pattern))
+	case blockedCode(policy, code):
+		v.Add(field, errors.CodeInvalid, "code contains a blocked word")
+	}
+}
+
+func blockedCode(policy service.CodePolicy, code string) bool {
+	code = strings.ToLower(code)
+	for _, word := range policy.Blocklist {
+		if word != "" && strings.Contains(code, strings.ToLower(word)) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateCode returns a code of policy for member, or "" if the code is blocked. attempt counts the codes tried
+// before for member.
+func (c *Config) generateCode(policy service.CodePolicy, member models.Member, attempt int) (string, error) {
+	var code string
+	var err error
+	switch {
+	case policy.Generator != nil:
+		code, err = policy.Generator.GenerateCode(member, attempt)
+	case c.CodeGenerator != nil:
+		code, err = c.CodeGenerator(member.Project)
+	default:
+		code, err = utils.CreateCode(policy.Alphabet, policy.Length)
+		code = policy.Prefix + code + policy.Suffix
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to generate referral code: %w", err)
+	}
+	if code == "" || len(code) > maxCodeLength {
+		return "", fmt.Errorf("generated referral code %q is empty or longer than %d characters", code, maxCodeLength)
+	}
+	if blockedCode(policy, code) {
+		return "", nil
+	}
+	return code, nil
+}
+
+// uniqueCode generates a code of policy for member that no member of its project has, retrying on collisions
+func (c *Config) uniqueCode(db *gorm.DB, policy service.CodePolicy, member models.Member) (string, error) {
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		code, err := c.generateCode(policy, member, attempt)
+		if err != nil {
+			return "", err
+		}
+		if code == "" {
+			continue
+		}
+		taken, err := fetchTakenCodes(db, member.Project, []string{code})
+		if err != nil {
+			return "", err
+		}
+		if !taken[code] {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("failed to generate a free referral code in %d attempts", policy.MaxAttempts)
+}
+
+// createWithUniqueCode runs create with code, a code uniqueCode generated for member, in a savepoint. A concurrent
+// request may take the code between its generation and create, which then fails on the unique index of the codes:
+// create runs again with a new code, up to the attempts of policy.
+func (c *Config) createWithUniqueCode(db *gorm.DB, policy service.CodePolicy, member models.Member, code string,
+	create func(tx *gorm.DB, code string) error) error {
+	for attempt := 1; ; attempt++ {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return create(tx, code)
+		})
+		if err == nil || !isUniqueViolation(db, err) {
+			return err
+		}
+		// Another unique index, e.g. of the reference IDs, is not retried
+		taken, fetchErr := fetchTakenCodes(db, member.Project, []string{code})
+		if fetchErr != nil {
+			return fetchErr
+		}
+		if !taken[code] {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("failed to generate a free referral code in %d attempts", policy.MaxAttempts)
+		}
+		if code, err = c.uniqueCode(db, policy, member); err != nil {
+			return err
+		}
+	}
+}
+
+// isUniqueViolation reports whether err, or an error it wraps, is the violation of a unique index. The errors are
+// translated by the dialector of db, whether or not it was opened with TranslateError.
+func isUniqueViolation(db *gorm.DB, err error) bool {
+	translator, ok := db.Dialector.(gorm.ErrorTranslator)
+	for ; err != nil; err = errors.Unwrap(err) {
+		if errors.Is(err, gorm.ErrDuplicatedKey) || ok && errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchTakenCodes returns which of codes are referral codes of project, deleted ones included
+func fetchTakenCodes(db *gorm.DB, project string, codes []string) (map[string]bool, error) {
+	taken := map[string]bool{}
+	if len(codes) == 0 {
+		return taken, nil
+	}
+
+	var referralCodes []models.ReferralCode
+	if err := db.Unscoped().Select("code").Where("project = ? AND code IN (?)", project, codes).Find(&referralCodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to check existing codes: %w", err)
+	}
+	for _, referralCode := range referralCodes {
+		taken[referralCode.Code] = true
+	}
+	return taken, nil
+}
@@ -0,0 +1,74 @@
+package serviceimpl
+
+import (
+	"github.com/PayRam/go-referral/clock"
+	"github.com/PayRam/go-referral/encryption"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/internal/telemetry"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/service"
+	"gorm.io/gorm"
+	"log/slog"
+)
+
+// Config is the configuration shared by every service and the worker
+type Config struct {
+	DB            *gorm.DB
+	Logger        *slog.Logger
+	Clock         clock.Clock
+	Telemetry     *telemetry.Telemetry
+	CodeGenerator service.CodeGenerator                 // Nil for the random codes of the code policies
+	CodePolicies  map[string]service.CodePolicy         // By project, "" for the projects without their own
+	Attribution   map[string]service.AttributionPolicy  // By project, "" for the projects without their own
+	LateReferral  map[string]service.LateReferralPolicy // By project, "" for the projects without their own
+	Attributes    map[string]service.AttributeSchema    // By project, "" for the projects without their own
+	FraudChecks   []service.FraudCheck
+	Hooks         service.Hooks
+	CursorKey     []byte                 // Signs and verifies the pagination cursors
+	Naming        models.Naming          // Names the tables of the raw queries, like the NamingStrategy of DB names those of the models
+	KeyProvider   encryption.KeyProvider // Nil to store personal data in plaintext. DB encrypts the models with it too.
+}
+
+// checkReferral runs the fraud checks on a new referral
+func (c *Config) checkReferral(member models.Member, referrer models.Member) error {
+	for _, check := range c.FraudChecks {
+		if err := check.CheckReferral(member, referrer); err != nil {
+			return &errors.FraudSuspectedError{Err: err}
+		}
+	}
+	return nil
+}
+
+// checkReward runs the fraud checks on a new reward
+func (c *Config) checkReward(reward models.Reward) error {
+	for _, check := range c.FraudChecks {
+		if err := check.CheckReward(reward); err != nil {
+			return &errors.FraudSuspectedError{Err: err}
+		}
+	}
+	return nil
+}
+
+func (c *Config) memberCreated(member models.Member) {
+	if c.Hooks.OnMemberCreated != nil {
+		c.Hooks.OnMemberCreated(member)
+	}
+}
+
+func (c *Config) rewardCreated(reward models.Reward) {
+	if c.Hooks.OnRewardCreated != nil {
+		c.Hooks.OnRewardCreated(reward)
+	}
+}
+
+func (c *Config) memberStatusChanged(member models.Member, from string) {
+	if c.Hooks.OnMemberStatusChanged != nil {
+		c.Hooks.OnMemberStatusChanged(member, from)
+	}
+}
+
+func (c *Config) campaignStatusChanged(campaign models.Campaign, from string) {
+	if c.Hooks.OnCampaignStatusChanged != nil {
+		c.Hooks.OnCampaignStatusChanged(campaign, from)
+	}
+}
@@ -0,0 +1,101 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/encryption"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/response"
+	"gorm.io/gorm"
+)
+
+// reencryptionBatchSize is the number of records ReencryptPII re-encrypts per transaction
+const reencryptionBatchSize = 500
+
+// encryptedRow is a value of an encrypted column read as it is stored, without the serializer
+type encryptedRow struct {
+	ID         uint
+	Value      string
+	BlindIndex *string
+}
+
+// ReencryptPII encrypts the personal data not yet encrypted with the current key of p, and recomputes the blind
+// indexes of the emails. Soft deleted records are included.
+func ReencryptPII(db *gorm.DB, p encryption.KeyProvider) (*response.ReencryptionResult, error) {
+	current, err := p.CurrentKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the current key: %w", err)
+	}
+
+	result := &response.ReencryptionResult{}
+	if result.Members, err = reencryptColumn(db, p, current.ID, models.Table(db, "members"), "email", "email_index"); err != nil {
+		return nil, err
+	}
+	if result.EventLogs, err = reencryptColumn(db, p, current.ID, models.Table(db, "event_logs"), "data", ""); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// reencryptColumn re-encrypts the values of column in table, and recomputes their blind index in indexColumn unless
+// it is empty. It returns the number of rows updated.
+func reencryptColumn(db *gorm.DB, p encryption.KeyProvider, currentKeyID, table, column, indexColumn string) (int64, error) {
+	columns := []string{"id", column + " AS value"}
+	if indexColumn != "" {
+		columns = append(columns, indexColumn+" AS blind_index")
+	}
+
+	var updated int64
+	var lastID uint
+	for {
+		var rows []encryptedRow
+		if err := db.Table(table).Select(columns).
+			Where("id > ? AND "+column+" IS NOT NULL", lastID).
+			Order("id").
+			Limit(reencryptionBatchSize).
+			Scan(&rows).Error; err != nil {
+			return updated, fmt.Errorf("failed to fetch %s of %s: %w", column, table, err)
+		}
+		if len(rows) == 0 {
+			return updated, nil
+		}
+		lastID = rows[len(rows)-1].ID
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				plaintext, err := encryption.Decrypt(p, row.Value)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt %s of %s %d: %w", column, table, row.ID, err)
+				}
+
+				updates := map[string]interface{}{}
+				if keyID, encrypted := encryption.KeyID(row.Value); !encrypted || keyID != currentKeyID {
+					if updates[column], err = encryption.Encrypt(p, plaintext); err != nil {
+						return fmt.Errorf("failed to encrypt %s of %s %d: %w", column, table, row.ID, err)
+					}
+				}
+				if indexColumn != "" {
+					index, err := encryption.BlindIndex(p, plaintext)
+					if err != nil {
+						return fmt.Errorf("failed to index %s of %s %d: %w", column, table, row.ID, err)
+					}
+					if row.BlindIndex == nil || *row.BlindIndex != index {
+						updates[indexColumn] = index
+					}
+				}
+				if len(updates) == 0 {
+					continue
+				}
+
+				// Through the table rather than the model, so that the serializer does not encrypt the values again
+				if err := tx.Table(table).Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+					return fmt.Errorf("failed to re-encrypt %s of %s %d: %w", column, table, row.ID, err)
+				}
+				updated++
+			}
+			return nil
+		})
+		if err != nil {
+			return updated, err
+		}
+	}
+}
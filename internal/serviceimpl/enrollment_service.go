@@ -0,0 +1,265 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// enrollmentChunkSize is the number of members EnrollMembers enrolls per transaction
+const enrollmentChunkSize = 500
+
+// EnrollMember enrolls a member in a campaign, starting a new enrollment. Members already enrolled are a conflict.
+func (s *referrerService) EnrollMember(project, referenceID string, campaignID uint) (*models.Enrollment, error) {
+	member, err := s.findMemberByReferenceID(project, referenceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEnrollableCampaign(s.DB, project, campaignID); err != nil {
+		return nil, err
+	}
+
+	var enrollments []models.Enrollment
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		enrollments, err = enroll(tx, campaignID, []models.Member{*member}, s.Clock.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if len(enrollments) == 0 {
+			return errors.Conflict("enrollment", "member %s is already enrolled in campaign %d", referenceID, campaignID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &enrollments[0], nil
+}
+
+// UnenrollMember ends the enrollment of a member in a campaign
+func (s *referrerService) UnenrollMember(project, referenceID string, campaignID uint) (*models.Enrollment, error) {
+	member, err := s.findMemberByReferenceID(project, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var enrollment models.Enrollment
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		ended, err := unenroll(tx, []uint{member.ID}, campaignID, s.Clock.Now().UTC())
+		if err != nil {
+			return err
+		}
+		if ended == 0 {
+			return errors.NotFound("enrollment", "project=%s, member=%s, campaign=%d", project, referenceID, campaignID)
+		}
+		return tx.Where("member_id = ? AND campaign_id = ?", member.ID, campaignID).
+			Order("started_at DESC, id DESC").First(&enrollment).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+// EnrollMembers enrolls the members of project matching filter in a campaign, in chunks committed on their own.
+// Members already enrolled are counted and left as they are, so a failed call can be run again.
+func (s *referrerService) EnrollMembers(project string, campaignID uint, filter request.GetMemberRequest) (*response.EnrollmentResult, error) {
+	if err := checkEnrollableCampaign(s.DB, project, campaignID); err != nil {
+		return nil, err
+	}
+	filter.Projects = []string{project}
+
+	result := &response.EnrollmentResult{CampaignID: campaignID}
+	table := s.Naming.Table("members")
+	var lastID uint
+	for {
+		var members []models.Member
+		query := request.ApplyGetMemberRequest(filter, s.DB.Model(&models.Member{}))
+		if err := query.Select(table+".id", table+".project", table+".reference_id").
+			Where(table+".id > ?", lastID).
+			Order(table + ".id").
+			Limit(enrollmentChunkSize).
+			Find(&members).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch members to enroll: %w", err)
+		}
+		if len(members) == 0 {
+			return result, nil
+		}
+		lastID = members[len(members)-1].ID
+
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			enrollments, err := enroll(tx, campaignID, members, s.Clock.Now().UTC())
+			if err != nil {
+				return err
+			}
+			result.Enrolled += len(enrollments)
+			result.AlreadyEnrolled += len(members) - len(enrollments)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Matched += len(members)
+	}
+}
+
+func (s *referrerService) GetEnrollments(req request.GetEnrollmentsRequest) ([]models.Enrollment, response.PageInfo, error) {
+	var enrollments []models.Enrollment
+	var count int64
+
+	query := s.DB.Model(&models.Enrollment{})
+	query = request.ApplyGetEnrollmentsRequest(req, query)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
+
+	// Calculate total count before applying pagination
+	countQuery := query
+	if err := countQuery.Count(&count).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count enrollments: %w", err)
+	}
+
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err := query.Find(&enrollments).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch enrollments: %w", err)
+	}
+
+	page, err := request.BuildPageInfo(query, &enrollments, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate enrollments: %w", err)
+	}
+
+	return enrollments, page, nil
+}
+
+// checkEnrollableCampaign checks that members of project may be enrolled in the campaign, which must be a campaign of
+// project and not be archived
+func checkEnrollableCampaign(db *gorm.DB, project string, campaignID uint) error {
+	var campaign models.Campaign
+	if err := db.Select("id", "status").Where("project = ? AND id = ?", project, campaignID).First(&campaign).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.NotFound("campaign", "project=%s and id=%d", project, campaignID)
+		}
+		return fmt.Errorf("failed to fetch campaign: %w", err)
+	}
+	if campaign.Status == "archived" {
+		return errors.Conflict("enrollment", "campaign %d is archived", campaignID)
+	}
+	return nil
+}
+
+// replaceEnrollments enrolls member in exactly campaignIDs, ending the enrollments in other campaigns. The campaigns
+// the member is not enrolled in yet must be enrollable, while those it stays enrolled in may have been archived since.
+func (s *referrerService) replaceEnrollments(tx *gorm.DB, member models.Member, campaignIDs []uint) error {
+	var enrolledIDs []uint
+	if err := tx.Model(&models.MemberCampaign{}).Where("member_id = ?", member.ID).Pluck("campaign_id", &enrolledIDs).Error; err != nil {
+		return fmt.Errorf("failed to fetch enrollments of member %s: %w", member.ReferenceID, err)
+	}
+	enrolled := map[uint]bool{}
+	for _, campaignID := range enrolledIDs {
+		enrolled[campaignID] = true
+	}
+	wanted := map[uint]bool{}
+	for _, campaignID := range campaignIDs {
+		wanted[campaignID] = true
+		if enrolled[campaignID] {
+			continue
+		}
+		if err := checkEnrollableCampaign(tx, member.Project, campaignID); err != nil {
+			return err
+		}
+	}
+
+	now := s.Clock.Now().UTC()
+	for _, campaignID := range enrolledIDs {
+		if wanted[campaignID] {
+			continue
+		}
+		if _, err := unenroll(tx, []uint{member.ID}, campaignID, now); err != nil {
+			return err
+		}
+	}
+	for _, campaignID := range campaignIDs {
+		if _, err := enroll(tx, campaignID, []models.Member{member}, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enroll enrolls members in a campaign, skipping those already enrolled, and returns the enrollments it started. The
+// unique index of MemberCampaign keeps concurrent calls from enrolling a member twice.
+func enroll(tx *gorm.DB, campaignID uint, members []models.Member, now time.Time) ([]models.Enrollment, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+	memberIDs := make([]uint, len(members))
+	for i, member := range members {
+		memberIDs[i] = member.ID
+	}
+
+	var enrolledIDs []uint
+	if err := tx.Model(&models.MemberCampaign{}).
+		Where("campaign_id = ? AND member_id IN (?)", campaignID, memberIDs).
+		Pluck("member_id", &enrolledIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch enrolled members: %w", err)
+	}
+	enrolled := map[uint]bool{}
+	for _, id := range enrolledIDs {
+		enrolled[id] = true
+	}
+
+	var associations []models.MemberCampaign
+	var enrollments []models.Enrollment
+	for _, member := range members {
+		if enrolled[member.ID] {
+			continue
+		}
+		enrolled[member.ID] = true
+		associations = append(associations, models.MemberCampaign{Project: member.Project, MemberID: member.ID, CampaignID: campaignID})
+		enrollments = append(enrollments, models.Enrollment{
+			Project:           member.Project,
+			MemberID:          member.ID,
+			MemberReferenceID: member.ReferenceID,
+			CampaignID:        campaignID,
+			StartedAt:         now,
+		})
+	}
+	if len(associations) == 0 {
+		return nil, nil
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(associations, 100)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to enroll members in campaign %d: %w", campaignID, result.Error)
+	}
+	if result.RowsAffected != int64(len(associations)) {
+		return nil, errors.Conflict("enrollment", "members were enrolled in campaign %d concurrently", campaignID)
+	}
+	if err := tx.CreateInBatches(enrollments, 100).Error; err != nil {
+		return nil, fmt.Errorf("failed to record enrollments: %w", err)
+	}
+	return enrollments, nil
+}
+
+// unenroll ends the enrollments of members in a campaign, and returns how many were enrolled
+func unenroll(tx *gorm.DB, memberIDs []uint, campaignID uint, now time.Time) (int64, error) {
+	if len(memberIDs) == 0 {
+		return 0, nil
+	}
+	result := tx.Unscoped().Where("member_id IN (?) AND campaign_id = ?", memberIDs, campaignID).Delete(&models.MemberCampaign{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to unenroll members from campaign %d: %w", campaignID, result.Error)
+	}
+	if err := tx.Model(&models.Enrollment{}).
+		Where("member_id IN (?) AND campaign_id = ? AND ended_at IS NULL", memberIDs, campaignID).
+		Update("ended_at", now).Error; err != nil {
+		return 0, fmt.Errorf("failed to end enrollments: %w", err)
+	}
+	return result.RowsAffected, nil
+}
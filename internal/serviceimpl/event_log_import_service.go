@@ -0,0 +1,215 @@
+package serviceimpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/internal/telemetry"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"io"
+	"time"
+)
+
+// ImportEventLogs backfills event logs from a CSV or JSON-lines stream. Rows are decoded into
+// request.ImportEventLogRow; CSV headers use the same names as its JSON fields and triggeredAt is RFC 3339.
+func (s *eventLogService) ImportEventLogs(project string, r io.Reader, req request.ImportRequest) (*response.ImportResult, error) {
+	reader, err := newImportReader(r, req.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &response.ImportResult{DryRun: req.DryRun, Errors: []response.ImportRowError{}}
+	events := map[string]*models.Event{}
+
+	run := func(db *gorm.DB) error {
+		for {
+			rows, err := readImportChunk(reader, importChunkSize(req.ChunkSize), decodeEventLogImportRecord, result)
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			if err := s.importEventLogChunk(db, project, rows, events, result); err != nil {
+				return err
+			}
+		}
+	}
+
+	if req.DryRun {
+		err = s.DB.Transaction(func(tx *gorm.DB) error {
+			if err := run(tx); err != nil {
+				return err
+			}
+			return errImportDryRun
+		})
+		if errors.Is(err, errImportDryRun) {
+			err = nil
+		}
+	} else {
+		err = run(s.DB)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to import event logs: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *eventLogService) importEventLogChunk(db *gorm.DB, project string, rows []importRow[request.ImportEventLogRow], events map[string]*models.Event, result *response.ImportResult) error {
+	now := s.Clock.Now().UTC()
+
+	// 🔹 Step 1: Validate rows on their own
+	var valid []importRow[request.ImportEventLogRow]
+	var missingKeys, referenceIDs []string
+	for _, row := range rows {
+		if err := validateEventLogImportRow(row.Value, now); err != nil {
+			addImportError(result, row.Line, row.Value.ReferenceID, err)
+			continue
+		}
+		if _, ok := events[row.Value.EventKey]; !ok {
+			missingKeys = append(missingKeys, row.Value.EventKey)
+		}
+		referenceIDs = append(referenceIDs, row.Value.ReferenceID)
+		valid = append(valid, row)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	// 🔹 Step 2: Resolve events and members in batches
+	if len(missingKeys) > 0 {
+		var fetched []models.Event
+		if err := db.Where("project = ? AND key IN (?)", project, missingKeys).Find(&fetched).Error; err != nil {
+			return fmt.Errorf("failed to fetch events: %w", err)
+		}
+		for _, key := range missingKeys {
+			events[key] = nil
+		}
+		for i := range fetched {
+			events[fetched[i].Key] = &fetched[i]
+		}
+	}
+
+	var members []models.Member
+	if err := db.Select("id, reference_id").
+		Where("project = ? AND reference_id IN (?)", project, referenceIDs).
+		Find(&members).Error; err != nil {
+		return fmt.Errorf("failed to fetch members: %w", err)
+	}
+	memberIDs := map[string]uint{}
+	for _, member := range members {
+		memberIDs[member.ReferenceID] = member.ID
+	}
+
+	// 🔹 Step 3: Build the event logs
+	var eventLogs []models.EventLog
+	var eventLogRows []importRow[request.ImportEventLogRow]
+	for _, row := range valid {
+		req := row.Value
+
+		event := events[req.EventKey]
+		if event == nil {
+			addImportError(result, row.Line, req.ReferenceID, errors.NotFound("event", "key=%s", req.EventKey))
+			continue
+		}
+		memberID, ok := memberIDs[req.ReferenceID]
+		if !ok {
+			addImportError(result, row.Line, req.ReferenceID, errors.NotFound("member", "reference_id=%s", req.ReferenceID))
+			continue
+		}
+		if err := validateEventLogAmount(event, req.Amount); err != nil {
+			addImportError(result, row.Line, req.ReferenceID, err)
+			continue
+		}
+
+		triggeredAt := now
+		if req.TriggeredAt != nil {
+			triggeredAt = req.TriggeredAt.UTC()
+		}
+
+		eventLogs = append(eventLogs, models.EventLog{
+			Project:           project,
+			EventKey:          req.EventKey,
+			MemberID:          memberID,
+			MemberReferenceID: req.ReferenceID,
+			Amount:            req.Amount,
+			TriggeredAt:       triggeredAt,
+			Data:              req.Data,
+			Status:            "pending",
+		})
+		eventLogRows = append(eventLogRows, row)
+	}
+	if len(eventLogs) == 0 {
+		return nil
+	}
+
+	// 🔹 Step 4: Insert the chunk in its own transaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(&eventLogs, 100).Error; err != nil {
+			return fmt.Errorf("failed to create event logs: %w", err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		for _, row := range eventLogRows {
+			addImportError(result, row.Line, row.Value.ReferenceID, err)
+		}
+		return nil
+	}
+
+	result.Imported += len(eventLogs)
+	if !result.DryRun {
+		for _, eventLog := range eventLogs {
+			telemetry.Add(s.Telemetry.EventLogsIngested, 1, telemetry.Project(project), telemetry.EventKey(eventLog.EventKey))
+		}
+	}
+
+	return nil
+}
+
+func validateEventLogImportRow(req request.ImportEventLogRow, now time.Time) error {
+	validation := validateCreateEventLogRequest(req.CreateEventLogRequest)
+	if req.TriggeredAt != nil && req.TriggeredAt.After(now) {
+		validation.Add("triggeredAt", errors.CodeOutOfRange, "triggeredAt cannot be in the future")
+	}
+	return validation.Err()
+}
+
+func decodeEventLogImportRecord(record importRecord) (request.ImportEventLogRow, error) {
+	var row request.ImportEventLogRow
+
+	if record.Raw != nil {
+		if err := json.Unmarshal(record.Raw, &row); err != nil {
+			return row, errors.Invalid("", errors.CodeInvalid, fmt.Sprintf("invalid json: %v", err))
+		}
+		return row, nil
+	}
+
+	row.EventKey = record.Fields["eventkey"]
+	row.ReferenceID = record.Fields["referenceid"]
+	row.Data = optionalField(record.Fields, "data")
+
+	if value, ok := record.Fields["amount"]; ok {
+		amount, err := decimal.NewFromString(value)
+		if err != nil {
+			return row, errors.Invalid("amount", errors.CodeInvalid, fmt.Sprintf("invalid amount '%s'", value))
+		}
+		row.Amount = &amount
+	}
+	if value, ok := record.Fields["triggeredat"]; ok {
+		triggeredAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return row, errors.Invalid("triggeredAt", errors.CodeInvalid, fmt.Sprintf("invalid triggeredAt '%s': must be RFC 3339", value))
+		}
+		row.TriggeredAt = &triggeredAt
+	}
+
+	return row, nil
+}
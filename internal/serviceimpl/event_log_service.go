@@ -1,48 +1,54 @@
 package serviceimpl
 
 import (
-	"errors"
 	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/internal/telemetry"
 	"github.com/PayRam/go-referral/models"
 	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
 	"gorm.io/gorm"
-	"time"
+	"io"
 )
 
 type eventLogService struct {
-	DB *gorm.DB
+	*Config
 }
 
 //var _ service.EventLogService = &eventLogService{}
 
 // NewEventLogService initializes the EventLog service
-func NewEventLogService(db *gorm.DB) *eventLogService {
-	return &eventLogService{DB: db}
+func NewEventLogService(cfg *Config) *eventLogService {
+	return &eventLogService{Config: cfg}
 }
 
 // CreateEventLog creates a new event log entry
 func (s *eventLogService) CreateEventLog(project string, req request.CreateEventLogRequest) (*models.EventLog, error) {
+	if err := validateCreateEventLogRequest(req).Err(); err != nil {
+		return nil, err
+	}
+
 	// 🔹 Step 1: Fetch the event by project and eventKey
 	var event models.Event
 	if err := s.DB.Where("project = ? AND key = ?", project, req.EventKey).First(&event).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("event", "project=%s and key=%s", project, req.EventKey)
+		}
 		return nil, fmt.Errorf("failed to fetch event with key '%s' for project '%s': %w", req.EventKey, project, err)
 	}
 
 	// 🔹 Step 2: Fetch the Member using ReferenceID
 	var member models.Member
 	if err := s.DB.Where("project = ? AND reference_id = ?", project, req.ReferenceID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("member", "project=%s and reference_id=%s", project, req.ReferenceID)
+		}
 		return nil, fmt.Errorf("failed to fetch member with reference ID '%s' for project '%s': %w", req.ReferenceID, project, err)
 	}
 
 	// 🔹 Step 3: Validate Amount based on Event Type
-	if event.EventType == "payment" {
-		if req.Amount == nil || req.Amount.IsZero() {
-			return nil, errors.New("amount must be greater than 0 for payment events")
-		}
-	} else {
-		if req.Amount != nil {
-			return nil, errors.New("amount must be nil for non-payment events")
-		}
+	if err := validateEventLogAmount(&event, req.Amount); err != nil {
+		return nil, err
 	}
 
 	// 🔹 Step 4: Create the Event Log
@@ -52,7 +58,7 @@ func (s *eventLogService) CreateEventLog(project string, req request.CreateEvent
 		MemberID:          member.ID,       // ✅ Store the Member ID
 		MemberReferenceID: req.ReferenceID, // ✅ Keep Reference ID for consistency
 		Amount:            req.Amount,
-		TriggeredAt:       time.Now().UTC(),
+		TriggeredAt:       s.Clock.Now().UTC(),
 		Data:              req.Data,
 		Status:            "pending",
 	}
@@ -61,12 +67,13 @@ func (s *eventLogService) CreateEventLog(project string, req request.CreateEvent
 	if err := s.DB.Create(eventLog).Error; err != nil {
 		return nil, fmt.Errorf("failed to create event log: %w", err)
 	}
+	telemetry.Add(s.Telemetry.EventLogsIngested, 1, telemetry.Project(project), telemetry.EventKey(eventLog.EventKey))
 
 	return eventLog, nil
 }
 
 // GetEventLogs retrieves event logs based on dynamic conditions
-func (s *eventLogService) GetEventLogs(req request.GetEventLogRequest) ([]models.EventLog, int64, error) {
+func (s *eventLogService) GetEventLogs(req request.GetEventLogRequest) ([]models.EventLog, response.PageInfo, error) {
 	var eventLogs []models.EventLog
 	var count int64
 
@@ -76,24 +83,100 @@ func (s *eventLogService) GetEventLogs(req request.GetEventLogRequest) ([]models
 	query = request.ApplyGetEventLogRequest(req, query)
 
 	// Apply Select Fields
-	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Calculate total count before applying pagination
 	countQuery := query
 	if err := countQuery.Count(&count).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count eventLogs: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count eventLogs: %w", err)
 	}
 
 	// Apply pagination conditions
-	query = request.ApplyPaginationConditions(query, req.PaginationConditions)
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
 
 	// Fetch records with pagination
-	if err := query.Preload("Member").Preload("ReferredReward").Preload("RefereeReward").Find(&eventLogs).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch eventLogs: %w", err)
+	if err := query.Preload("Member").Find(&eventLogs).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch eventLogs: %w", err)
+	}
+
+	page, err := request.BuildPageInfo(query, &eventLogs, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate eventLogs: %w", err)
+	}
+
+	return eventLogs, page, nil
+}
+
+// ExportEventLogs streams every event log matching req, joined with its event and member, to w in batches
+// ordered by ID.
+func (s *eventLogService) ExportEventLogs(w io.Writer, exportReq request.ExportRequest, req request.GetEventLogRequest) (int64, error) {
+	writer, err := newExportWriter(w, exportReq.Format, eventLogExportHeader, eventLogExportRecord)
+	if err != nil {
+		return 0, err
+	}
+
+	batchSize := exportBatchSize(exportReq.BatchSize)
+	conditions := req.PaginationConditions
+	table := s.Naming.Table("event_logs")
+
+	var lastID uint
+	if conditions.GreaterThanID != nil {
+		lastID = *conditions.GreaterThanID
+	}
+
+	var written int64
+	for {
+		limit := batchSize
+		if conditions.Limit != nil && *conditions.Limit > 0 {
+			limit = min(limit, *conditions.Limit-int(written))
+			if limit <= 0 {
+				break
+			}
+		}
+
+		query := s.DB.Table(table).
+			Select(fmt.Sprintf(`
+				%[1]s.id, %[1]s.created_at, %[1]s.project, %[1]s.event_key,
+				COALESCE(e.name, '') AS event_name, COALESCE(e.event_type, '') AS event_type,
+				%[1]s.member_id, %[1]s.member_reference_id, m.email AS member_email,
+				%[1]s.amount, %[1]s.triggered_at, %[1]s.status,
+				%[1]s.failure_reason, %[1]s.data
+			`, table)).
+			Joins("LEFT JOIN "+s.Naming.Table("events")+" e ON e.project = "+table+".project AND e.key = "+table+".event_key").
+			Joins("LEFT JOIN "+s.Naming.Table("members")+" m ON m.id = "+table+".member_id").
+			Where(table+".deleted_at IS NULL").
+			Where(table+".id > ?", lastID)
+
+		query = request.ApplyGetEventLogRequest(req, query)
+		query = request.ApplyDateConditions(query, table, conditions)
+		if conditions.LessThanID != nil {
+			query = query.Where(table+".id < ?", *conditions.LessThanID)
+		}
+
+		var rows []response.EventLogExportRow
+		if err := query.Order(table + ".id ASC").Limit(limit).Scan(&rows).Error; err != nil {
+			return written, fmt.Errorf("failed to fetch event logs for export: %w", err)
+		}
+
+		for _, row := range rows {
+			if err := writer.Write(row); err != nil {
+				return written, fmt.Errorf("failed to write event log %d: %w", row.ID, err)
+			}
+			written++
+		}
+
+		if len(rows) < limit {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+
+	if err := writer.Close(); err != nil {
+		return written, fmt.Errorf("failed to flush event logs export: %w", err)
 	}
 
-	return eventLogs, count, nil
+	return written, nil
 }
@@ -1,45 +1,30 @@
 package serviceimpl
 
 import (
-	"errors"
 	"fmt"
+	"github.com/PayRam/go-referral/errors"
 	"github.com/PayRam/go-referral/models"
 	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
-	"regexp"
 )
 
 type eventService struct {
-	DB *gorm.DB
+	*Config
 }
 
 //var _ service.EventService = &eventService{}
 
-func NewEventService(db *gorm.DB) *eventService {
-	return &eventService{DB: db}
+func NewEventService(cfg *Config) *eventService {
+	return &eventService{Config: cfg}
 }
 
 // CreateEvent creates a new event associated with a campaign
 func (s *eventService) CreateEvent(project string, request request.CreateEventRequest) (*models.Event, error) {
 
-	var validKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
-
-	// Inside your method
-	if request.Key == "" {
-		return nil, errors.New("event key is required")
-	}
-
-	if !validKeyRegex.MatchString(request.Key) {
-		return nil, errors.New("event key must only contain letters, numbers, underscores (_), or hyphens (-)")
-	}
-
-	if request.Name == "" {
-		return nil, errors.New("event name is required")
-	}
-
-	if request.EventType != "simple" && request.EventType != "payment" {
-		return nil, errors.New("event type must be either 'simple' or 'payment'")
+	if err := validateCreateEventRequest(request).Err(); err != nil {
+		return nil, err
 	}
 
 	// Check if the event key already exists
@@ -49,7 +34,7 @@ func (s *eventService) CreateEvent(project string, request request.CreateEventRe
 	}
 
 	if count > 0 {
-		return nil, errors.New("event key already exists")
+		return nil, errors.Conflict("event", "event key %s already exists", request.Key)
 	}
 
 	event := &models.Event{
@@ -69,15 +54,15 @@ func (s *eventService) CreateEvent(project string, request request.CreateEventRe
 // UpdateEvent updates an existing event with row-level locking
 func (s *eventService) UpdateEvent(project, key string, req request.UpdateEventRequest) (*models.Event, error) {
 	if req.Name == nil && req.Description == nil {
-		return nil, errors.New("no update fields provided")
+		return nil, errors.Invalid("", errors.CodeRequired, "no update fields provided")
 	}
 
 	if req.Name != nil && *req.Name == "" {
-		return nil, errors.New("event name cannot be empty")
+		return nil, errors.Invalid("name", errors.CodeRequired, "event name cannot be empty")
 	}
 
 	if req.Description != nil && *req.Description == "" {
-		return nil, errors.New("event description cannot be empty")
+		return nil, errors.Invalid("description", errors.CodeRequired, "event description cannot be empty")
 	}
 
 	var event models.Event
@@ -88,9 +73,9 @@ func (s *eventService) UpdateEvent(project, key string, req request.UpdateEventR
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 			First(&event, "project = ? AND key = ?", project, key).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return fmt.Errorf("event not found with key: %s", key)
+				return errors.NotFound("event", "project=%s and key=%s", project, key)
 			}
-			return err
+			return fmt.Errorf("failed to fetch event: %w", err)
 		}
 
 		// Prepare updates dynamically based on non-nil fields in the request
@@ -120,7 +105,7 @@ func (s *eventService) UpdateEvent(project, key string, req request.UpdateEventR
 }
 
 // GetEvents retrieves events based on dynamic conditions
-func (s *eventService) GetEvents(req request.GetEventsRequest) ([]models.Event, int64, error) {
+func (s *eventService) GetEvents(req request.GetEventsRequest) ([]models.Event, response.PageInfo, error) {
 	var events []models.Event
 	var count int64
 
@@ -131,24 +116,29 @@ func (s *eventService) GetEvents(req request.GetEventsRequest) ([]models.Event,
 	query = request.ApplyGetEventRequest(req, query)
 
 	// Apply Select Fields
-	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Calculate total count before applying pagination
 	countQuery := query
 	if err := countQuery.Count(&count).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count events: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count events: %w", err)
 	}
 
 	// Apply pagination conditions
-	query = request.ApplyPaginationConditions(query, req.PaginationConditions)
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
 
 	// Fetch records with pagination
 	if err := query.Find(&events).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch events: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch events: %w", err)
+	}
+
+	page, err := request.BuildPageInfo(query, &events, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate events: %w", err)
 	}
 
-	return events, count, nil
+	return events, page, nil
 }
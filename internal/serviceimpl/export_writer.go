@@ -0,0 +1,123 @@
+package serviceimpl
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/response"
+	"github.com/shopspring/decimal"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultExportBatchSize = 1000
+
+// exportWriter streams rows of type T to an io.Writer in one of the supported export formats
+type exportWriter[T any] struct {
+	csv     *csv.Writer
+	json    *json.Encoder
+	header  []string
+	record  func(T) []string
+	started bool
+}
+
+func newExportWriter[T any](w io.Writer, format string, header []string, record func(T) []string) (*exportWriter[T], error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return &exportWriter[T]{csv: csv.NewWriter(w), header: header, record: record}, nil
+	case "jsonl", "ndjson":
+		return &exportWriter[T]{json: json.NewEncoder(w)}, nil
+	default:
+		return nil, errors.Invalid("format", errors.CodeInvalid, fmt.Sprintf("unsupported export format '%s': must be 'csv' or 'jsonl'", format))
+	}
+}
+
+func (w *exportWriter[T]) Write(row T) error {
+	if w.json != nil {
+		return w.json.Encode(row)
+	}
+
+	if !w.started {
+		w.started = true
+		if err := w.csv.Write(w.header); err != nil {
+			return err
+		}
+	}
+	return w.csv.Write(w.record(row))
+}
+
+// Close writes the CSV header for empty exports and flushes buffered output
+func (w *exportWriter[T]) Close() error {
+	if w.csv == nil {
+		return nil
+	}
+	if !w.started {
+		w.started = true
+		if err := w.csv.Write(w.header); err != nil {
+			return err
+		}
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func exportBatchSize(size int) int {
+	if size <= 0 {
+		return defaultExportBatchSize
+	}
+	return size
+}
+
+var rewardExportHeader = []string{
+	"id", "createdAt", "project", "campaignID", "campaignName", "currencyCode", "memberType", "amount", "status", "reason",
+	"rewardedMemberID", "rewardedMemberReferenceID", "rewardedMemberEmail",
+	"relatedMemberID", "relatedMemberReferenceID", "relatedMemberEmail",
+}
+
+func rewardExportRecord(row response.RewardExportRow) []string {
+	return []string{
+		formatUint(row.ID), formatTime(row.CreatedAt), row.Project, formatUint(row.CampaignID), row.CampaignName,
+		row.CurrencyCode, row.MemberType, row.Amount.String(), row.Status, formatOptional(row.Reason),
+		formatUint(row.RewardedMemberID), row.RewardedMemberReferenceID, formatOptional(row.RewardedMemberEmail),
+		formatUint(row.RelatedMemberID), row.RelatedMemberReferenceID, formatOptional(row.RelatedMemberEmail),
+	}
+}
+
+var eventLogExportHeader = []string{
+	"id", "createdAt", "project", "eventKey", "eventName", "eventType", "memberID", "memberReferenceID", "memberEmail",
+	"amount", "triggeredAt", "status", "failureReason", "data",
+}
+
+func eventLogExportRecord(row response.EventLogExportRow) []string {
+	return []string{
+		formatUint(row.ID), formatTime(row.CreatedAt), row.Project, row.EventKey, row.EventName, row.EventType,
+		formatUint(row.MemberID), row.MemberReferenceID, formatOptional(row.MemberEmail),
+		formatOptionalDecimal(row.Amount), formatTime(row.TriggeredAt), row.Status, formatOptional(row.FailureReason),
+		formatOptional(row.Data),
+	}
+}
+
+func formatUint(value uint) string {
+	return strconv.FormatUint(uint64(value), 10)
+}
+
+func formatTime(value time.Time) string {
+	return value.UTC().Format(time.RFC3339Nano)
+}
+
+func formatOptional(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func formatOptionalDecimal(value *decimal.Decimal) string {
+	if value == nil {
+		return ""
+	}
+	return value.String()
+}
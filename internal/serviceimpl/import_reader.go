@@ -0,0 +1,147 @@
+package serviceimpl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/response"
+	"io"
+	"strings"
+)
+
+const defaultImportChunkSize = 500
+
+// maxImportLineSize is the longest JSON line accepted by an import
+const maxImportLineSize = 1024 * 1024
+
+// errImportDryRun rolls back the transaction wrapping a dry-run import
+var errImportDryRun = errors.New("import dry run")
+
+// importRecord is a raw row read from an import stream, before it is decoded into a request
+type importRecord struct {
+	Line   int
+	Fields map[string]string // Set for CSV rows, keyed by lower-cased header
+	Raw    []byte            // Set for JSON lines
+}
+
+type importRow[T any] struct {
+	Line  int
+	Value T
+}
+
+type importReader struct {
+	csv    *csv.Reader
+	header []string
+	lines  *bufio.Scanner
+	line   int
+}
+
+func newImportReader(r io.Reader, format string) (*importReader, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		reader := csv.NewReader(r)
+		reader.TrimLeadingSpace = true
+		reader.FieldsPerRecord = -1
+
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv header: %w", err)
+		}
+		for i := range header {
+			header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		}
+		return &importReader{csv: reader, header: header}, nil
+	case "jsonl", "ndjson":
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+		return &importReader{lines: scanner}, nil
+	default:
+		return nil, errors.Invalid("format", errors.CodeInvalid, fmt.Sprintf("unsupported import format '%s': must be 'csv' or 'jsonl'", format))
+	}
+}
+
+// next returns the next record of the stream, or io.EOF once it is exhausted. Malformed rows are reported
+// through rowErr so the import can carry on with the following rows.
+func (r *importReader) next() (record importRecord, rowErr error, err error) {
+	if r.csv != nil {
+		values, err := r.csv.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return importRecord{Line: parseErr.StartLine}, parseErr.Err, nil
+			}
+			return importRecord{}, nil, err
+		}
+		line, _ := r.csv.FieldPos(0)
+		if len(values) > len(r.header) {
+			return importRecord{Line: line}, errors.Invalid("", errors.CodeInvalid, fmt.Sprintf("row has %d fields but the header has %d", len(values), len(r.header))), nil
+		}
+
+		fields := make(map[string]string, len(values))
+		for i, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				fields[r.header[i]] = value
+			}
+		}
+		return importRecord{Line: line, Fields: fields}, nil, nil
+	}
+
+	for r.lines.Scan() {
+		r.line++
+		raw := bytes.TrimSpace(r.lines.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		return importRecord{Line: r.line, Raw: append([]byte(nil), raw...)}, nil, nil
+	}
+	if err := r.lines.Err(); err != nil {
+		return importRecord{}, nil, fmt.Errorf("failed to read line %d: %w", r.line+1, err)
+	}
+	return importRecord{}, nil, io.EOF
+}
+
+// readImportChunk reads up to size rows from reader. Rows that cannot be decoded are recorded as failures on
+// result and do not count towards the chunk.
+func readImportChunk[T any](reader *importReader, size int, decode func(importRecord) (T, error), result *response.ImportResult) ([]importRow[T], error) {
+	var rows []importRow[T]
+
+	for len(rows) < size {
+		record, rowErr, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result.TotalRows++
+		if rowErr == nil {
+			var value T
+			if value, rowErr = decode(record); rowErr == nil {
+				rows = append(rows, importRow[T]{Line: record.Line, Value: value})
+				continue
+			}
+		}
+		addImportError(result, record.Line, "", rowErr)
+	}
+
+	return rows, nil
+}
+
+func addImportError(result *response.ImportResult, line int, referenceID string, err error) {
+	result.Failed++
+	result.Errors = append(result.Errors, response.ImportRowError{
+		Row:         line,
+		ReferenceID: referenceID,
+		Error:       err.Error(),
+	})
+}
+
+func importChunkSize(size int) int {
+	if size <= 0 {
+		return defaultImportChunkSize
+	}
+	return size
+}
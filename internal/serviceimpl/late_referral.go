@@ -0,0 +1,132 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/service"
+	"gorm.io/gorm"
+	"time"
+)
+
+const defaultReferrerGracePeriod = 7 * 24 * time.Hour
+
+// ValidateLateReferralPolicy reports the fields of policy that are not valid
+func ValidateLateReferralPolicy(policy service.LateReferralPolicy) error {
+	if policy.GracePeriod < 0 {
+		return errors.Invalid("gracePeriod", errors.CodeInvalid, "gracePeriod cannot be negative")
+	}
+	return nil
+}
+
+// lateReferralPolicy returns the late referral policy of project, falling back to the policy of every project
+func (c *Config) lateReferralPolicy(project string) service.LateReferralPolicy {
+	policy, ok := c.LateReferral[project]
+	if !ok {
+		policy = c.LateReferral[""]
+	}
+	if policy.GracePeriod == 0 {
+		policy.GracePeriod = defaultReferrerGracePeriod
+	}
+	return policy
+}
+
+// AttachReferrer makes the owner of req.ReferrerCode the referrer of a member who signed up without one, within the
+// grace period of the late referral policy. The referral goes through the same checks as at signup, and is recorded
+// in the audit log.
+func (s *referrerService) AttachReferrer(project, referenceID string, req request.AttachReferrerRequest) (*models.Member, error) {
+	policy := s.lateReferralPolicy(project)
+	now := s.Clock.Now()
+
+	member, err := s.findMemberByReferenceID(project, referenceID)
+	if err != nil {
+		return nil, err
+	}
+	if member.ReferredByMemberID != nil {
+		return nil, errors.Conflict("member", "member %s already has a referrer", referenceID)
+	}
+
+	validation := &errors.ValidationError{}
+	if req.ReferrerCode == "" {
+		validation.Add("referrerCode", errors.CodeRequired, "referrerCode is required")
+	}
+	if deadline := member.CreatedAt.Add(policy.GracePeriod); now.After(deadline) {
+		validation.Add("referrerCode", errors.CodeNotAllowed,
+			fmt.Sprintf("a referrer can only be attached within %s of signup", policy.GracePeriod))
+	}
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	code, err := resolveReferrerCode(s.DB, project, req.ReferrerCode, now, validation)
+	if err != nil {
+		return nil, err
+	}
+	if code != nil && code.MemberID == member.ID {
+		validation.Add("referrerCode", errors.CodeInvalid, "a member cannot refer itself")
+	}
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+	referrer := code.Member
+
+	// The member has no referrer, so the referrer would only close a cycle if the member is above it
+	upline, err := s.walkUpline(referrer)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range upline {
+		if node.ID == member.ID {
+			return nil, errors.Invalid("referrerCode", errors.CodeInvalid,
+				fmt.Sprintf("member %s is referred, directly or not, by %s", referrer.ReferenceID, referenceID))
+		}
+	}
+
+	if err := s.checkReferral(*member, *referrer); err != nil {
+		return nil, err
+	}
+
+	eventsAfterAttachment := policy.EventsAfterAttachment
+	if req.EventsAfterAttachment != nil {
+		eventsAfterAttachment = *req.EventsAfterAttachment
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"referred_by_member_id":           referrer.ID,
+			"referred_by_member_reference_id": referrer.ReferenceID,
+			"referred_by_code_id":             code.ID,
+			"referrer_attached_at":            now,
+		}
+		if eventsAfterAttachment {
+			updates["reward_events_from"] = now
+		}
+		// Concurrent attachments cannot both pass the check above: the update of the second one matches no row
+		result := tx.Model(&models.Member{}).Where("id = ? AND referred_by_member_id IS NULL", member.ID).Updates(updates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to attach referrer: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errors.Conflict("member", "member %s already has a referrer", referenceID)
+		}
+
+		if err := useReferralCode(tx, code); err != nil {
+			return err
+		}
+
+		return recordAudit(tx, member, models.AuditActionAttachReferrer, req.Actor, req.Reason, map[string]interface{}{
+			"referrerReferenceID":   referrer.ReferenceID,
+			"referrerCode":          code.Code,
+			"eventsAfterAttachment": eventsAfterAttachment,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Preload("Campaigns").Preload("ReferredByMember").Preload("ReferredByCode").First(member, member.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to preload member data: %w", err)
+	}
+	return member, nil
+}
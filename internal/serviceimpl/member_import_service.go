@@ -0,0 +1,445 @@
+package serviceimpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"github.com/PayRam/go-referral/service"
+	"gorm.io/gorm"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// importedMember is what later rows of an import need to know about a member created earlier in it
+type importedMember struct {
+	ID          uint
+	ReferenceID string
+	CodeID      uint // ID of the referral code
+}
+
+// memberImportState is shared by every chunk of a single member import
+type memberImportState struct {
+	referenceIDs map[string]bool            // Reference IDs seen so far, to reject duplicates inside the stream
+	codes        map[string]*importedMember // Primary codes of members created by earlier chunks
+	policy       service.CodePolicy         // Code policy of the project
+	attributes   service.AttributeSchema    // Attribute schema of the project
+}
+
+// ImportMembers bulk-creates members from a CSV or JSON-lines stream. Rows are decoded into
+// request.CreateMemberRequest (CSV headers use the same names as its JSON fields, campaignIDs separated by ';' and
+// attributes as a JSON object).
+// A referrer code may point to an existing member or to a member created by an earlier row of the same stream.
+// Imports bring in referrals that already happened, so they count them towards the usage of referral codes but do
+// not refuse them for expired codes or reached usage limits.
+func (s *referrerService) ImportMembers(project string, r io.Reader, req request.ImportRequest) (*response.ImportResult, error) {
+	reader, err := newImportReader(r, req.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &response.ImportResult{DryRun: req.DryRun, Errors: []response.ImportRowError{}}
+	state := &memberImportState{
+		referenceIDs: map[string]bool{},
+		codes:        map[string]*importedMember{},
+		policy:       s.codePolicy(project),
+		attributes:   s.attributeSchema(project),
+	}
+
+	run := func(db *gorm.DB) error {
+		for {
+			rows, err := readImportChunk(reader, importChunkSize(req.ChunkSize), decodeMemberImportRecord, result)
+			if err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			if err := s.importMemberChunk(db, project, rows, state, result); err != nil {
+				return err
+			}
+		}
+	}
+
+	if req.DryRun {
+		// Chunks run as savepoints of a single transaction, so later chunks can still see earlier ones
+		err = s.DB.Transaction(func(tx *gorm.DB) error {
+			if err := run(tx); err != nil {
+				return err
+			}
+			return errImportDryRun
+		})
+		if errors.Is(err, errImportDryRun) {
+			err = nil
+		}
+	} else {
+		err = run(s.DB)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to import members: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *referrerService) importMemberChunk(db *gorm.DB, project string, rows []importRow[request.CreateMemberRequest], state *memberImportState, result *response.ImportResult) error {
+	// 🔹 Step 1: Validate rows on their own
+	var valid []importRow[request.CreateMemberRequest]
+	for _, row := range rows {
+		if err := validateMemberImportRow(row.Value, state); err != nil {
+			addImportError(result, row.Line, row.Value.ReferenceID, err)
+			continue
+		}
+		state.referenceIDs[row.Value.ReferenceID] = true
+		valid = append(valid, row)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+
+	// 🔹 Step 2: Resolve everything the chunk refers to in batches
+	var referenceIDs, codes, referrerCodes []string
+	var campaignIDs []uint
+	for _, row := range valid {
+		referenceIDs = append(referenceIDs, row.Value.ReferenceID)
+		if row.Value.PreferredCode != nil {
+			codes = append(codes, *row.Value.PreferredCode)
+		}
+		if row.Value.ReferrerCode != nil {
+			referrerCodes = append(referrerCodes, *row.Value.ReferrerCode)
+		}
+		campaignIDs = append(campaignIDs, row.Value.CampaignIDs...)
+	}
+
+	var existingMembers []models.Member
+	if err := db.Select("reference_id").
+		Where("project = ? AND reference_id IN (?)", project, referenceIDs).
+		Find(&existingMembers).Error; err != nil {
+		return fmt.Errorf("failed to fetch existing members: %w", err)
+	}
+	existingReferenceIDs := map[string]bool{}
+	for _, member := range existingMembers {
+		existingReferenceIDs[member.ReferenceID] = true
+	}
+
+	takenCodes, err := fetchTakenCodes(db, project, codes)
+	if err != nil {
+		return err
+	}
+
+	referrers := map[string]*importedMember{}
+	if len(referrerCodes) > 0 {
+		var codes []models.ReferralCode
+		if err := db.Select("id, code, member_id, member_reference_id").
+			Where("project = ? AND code IN (?)", project, referrerCodes).
+			Find(&codes).Error; err != nil {
+			return fmt.Errorf("failed to resolve referrer codes: %w", err)
+		}
+		for _, code := range codes {
+			referrers[code.Code] = &importedMember{ID: code.MemberID, ReferenceID: code.MemberReferenceID, CodeID: code.ID}
+		}
+	}
+
+	knownCampaigns := map[uint]bool{}
+	if len(campaignIDs) > 0 {
+		var campaigns []models.Campaign
+		if err := db.Select("id").Where("project = ? AND id IN (?)", project, campaignIDs).Find(&campaigns).Error; err != nil {
+			return fmt.Errorf("failed to fetch campaigns: %w", err)
+		}
+		for _, campaign := range campaigns {
+			knownCampaigns[campaign.ID] = true
+		}
+	}
+
+	// 🔹 Step 3: Build the members, linking referrers created earlier in the same chunk once IDs are known
+	var members []*models.Member
+	var memberRows []importRow[request.CreateMemberRequest]
+	chunkCodes := map[string]int{} // Code -> index in members
+	pendingReferrer := map[int]int{}
+
+	for _, row := range valid {
+		req := row.Value
+
+		if existingReferenceIDs[req.ReferenceID] {
+			addImportError(result, row.Line, req.ReferenceID, errors.Conflict("member", "member already exists for reference_id=%s", req.ReferenceID))
+			continue
+		}
+
+		if req.PreferredCode != nil {
+			_, inChunk := chunkCodes[*req.PreferredCode]
+			if takenCodes[*req.PreferredCode] || state.codes[*req.PreferredCode] != nil || inChunk {
+				addImportError(result, row.Line, req.ReferenceID, errors.Conflict("member", "code %s is already in use", *req.PreferredCode))
+				continue
+			}
+		}
+
+		unknownCampaign := false
+		for _, campaignID := range req.CampaignIDs {
+			if !knownCampaigns[campaignID] {
+				addImportError(result, row.Line, req.ReferenceID, errors.Invalid("campaignIDs", errors.CodeNotFound, fmt.Sprintf("campaign %d not found", campaignID)))
+				unknownCampaign = true
+				break
+			}
+		}
+		if unknownCampaign {
+			continue
+		}
+
+		member := &models.Member{
+			Project:     project,
+			ReferenceID: req.ReferenceID,
+			Email:       req.Email,
+			Status:      "active",
+		}
+		if len(req.Attributes) > 0 {
+			member.Attributes = req.Attributes
+		}
+		if req.PreferredCode != nil {
+			member.Code = *req.PreferredCode
+		}
+
+		if req.ReferrerCode != nil {
+			referrer := referrers[*req.ReferrerCode]
+			if referrer == nil {
+				referrer = state.codes[*req.ReferrerCode]
+			}
+			if referrer != nil {
+				member.ReferredByMemberID = &referrer.ID
+				member.ReferredByMemberReferenceID = &referrer.ReferenceID
+				member.ReferredByCodeID = &referrer.CodeID
+			} else if index, ok := chunkCodes[*req.ReferrerCode]; ok {
+				pendingReferrer[len(members)] = index
+				member.ReferredByMemberReferenceID = &members[index].ReferenceID
+			} else {
+				addImportError(result, row.Line, req.ReferenceID, errors.Invalid("referrerCode", errors.CodeNotFound, fmt.Sprintf("invalid referrer code: %s", *req.ReferrerCode)))
+				continue
+			}
+		}
+
+		if member.Code != "" {
+			chunkCodes[member.Code] = len(members)
+		}
+		members = append(members, member)
+		memberRows = append(memberRows, row)
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	if err := s.assignImportCodes(db, members, state, chunkCodes); err != nil {
+		return err
+	}
+
+	// 🔹 Step 4: Insert the chunk in its own transaction
+	primaryCodes := make([]*models.ReferralCode, len(members))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(members, 100).Error; err != nil {
+			return fmt.Errorf("failed to create members: %w", err)
+		}
+
+		for i, member := range members {
+			primaryCodes[i] = primaryCode(member)
+		}
+		if err := tx.CreateInBatches(primaryCodes, 100).Error; err != nil {
+			return fmt.Errorf("failed to create referral codes: %w", err)
+		}
+
+		var attributes []models.MemberAttribute
+		for _, member := range members {
+			attributes = append(attributes, memberAttributeRows(member)...)
+		}
+		if len(attributes) > 0 {
+			if err := tx.CreateInBatches(attributes, 100).Error; err != nil {
+				return fmt.Errorf("failed to index member attributes: %w", err)
+			}
+		}
+
+		for index, referrerIndex := range pendingReferrer {
+			referrer := members[referrerIndex]
+			if err := tx.Model(members[index]).Updates(map[string]interface{}{
+				"referred_by_member_id": referrer.ID,
+				"referred_by_code_id":   primaryCodes[referrerIndex].ID,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to link member %s to referrer %s: %w", members[index].ReferenceID, referrer.ReferenceID, err)
+			}
+			members[index].ReferredByMemberID = &referrer.ID
+			members[index].ReferredByCodeID = &primaryCodes[referrerIndex].ID
+		}
+
+		usages := map[uint]int64{}
+		for _, member := range members {
+			if member.ReferredByCodeID != nil {
+				usages[*member.ReferredByCodeID]++
+			}
+		}
+		for codeID, usage := range usages {
+			if err := tx.Model(&models.ReferralCode{}).Where("id = ?", codeID).
+				Update("usage_count", gorm.Expr("usage_count + ?", usage)).Error; err != nil {
+				return fmt.Errorf("failed to count referral code usage: %w", err)
+			}
+		}
+
+		var associations []models.MemberCampaign
+		var enrollments []models.Enrollment
+		now := s.Clock.Now().UTC()
+		for i, member := range members {
+			for _, campaignID := range memberRows[i].Value.CampaignIDs {
+				associations = append(associations, models.MemberCampaign{
+					Project:    project,
+					MemberID:   member.ID,
+					CampaignID: campaignID,
+				})
+				enrollments = append(enrollments, models.Enrollment{
+					Project:           project,
+					MemberID:          member.ID,
+					MemberReferenceID: member.ReferenceID,
+					CampaignID:        campaignID,
+					StartedAt:         now,
+				})
+			}
+		}
+		if len(associations) > 0 {
+			if err := tx.CreateInBatches(associations, 100).Error; err != nil {
+				return fmt.Errorf("failed to associate campaigns: %w", err)
+			}
+			if err := tx.CreateInBatches(enrollments, 100).Error; err != nil {
+				return fmt.Errorf("failed to record enrollments: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		// The whole chunk was rolled back, so every row in it failed
+		for i, member := range members {
+			addImportError(result, memberRows[i].Line, member.ReferenceID, err)
+		}
+		return nil
+	}
+
+	for i, member := range members {
+		state.codes[member.Code] = &importedMember{ID: member.ID, ReferenceID: member.ReferenceID, CodeID: primaryCodes[i].ID}
+	}
+	result.Imported += len(members)
+
+	return nil
+}
+
+// assignImportCodes generates referral codes for members imported without one, following the code policy of the
+// project and avoiding codes already taken
+func (s *referrerService) assignImportCodes(db *gorm.DB, members []*models.Member, state *memberImportState, chunkCodes map[string]int) error {
+	for attempt := 0; attempt < state.policy.MaxAttempts; attempt++ {
+		generated := map[string]*models.Member{}
+		missing := false
+		for i, member := range members {
+			if member.Code != "" {
+				continue
+			}
+			missing = true
+			code, err := s.generateCode(state.policy, *member, attempt)
+			if err != nil {
+				return err
+			}
+			if code == "" {
+				continue
+			}
+			if _, inChunk := chunkCodes[code]; inChunk || state.codes[code] != nil || generated[code] != nil {
+				continue
+			}
+			member.Code = code
+			chunkCodes[code] = i
+			generated[code] = member
+		}
+		if !missing {
+			return nil
+		}
+		if len(generated) == 0 {
+			continue
+		}
+
+		codes := make([]string, 0, len(generated))
+		for code := range generated {
+			codes = append(codes, code)
+		}
+		taken, err := fetchTakenCodes(db, members[0].Project, codes)
+		if err != nil {
+			return err
+		}
+		for code := range taken {
+			generated[code].Code = ""
+			delete(chunkCodes, code)
+		}
+	}
+
+	for _, member := range members {
+		if member.Code == "" {
+			return errors.New("failed to generate unique referral codes")
+		}
+	}
+	return nil
+}
+
+func validateMemberImportRow(req request.CreateMemberRequest, state *memberImportState) error {
+	if err := validateCreateMemberRequest(req, state.policy, state.attributes).Err(); err != nil {
+		return err
+	}
+	if state.referenceIDs[req.ReferenceID] {
+		return errors.Conflict("member", "duplicate reference_id %s in import", req.ReferenceID)
+	}
+	return nil
+}
+
+func decodeMemberImportRecord(record importRecord) (request.CreateMemberRequest, error) {
+	var req request.CreateMemberRequest
+
+	if record.Raw != nil {
+		if err := json.Unmarshal(record.Raw, &req); err != nil {
+			return req, errors.Invalid("", errors.CodeInvalid, fmt.Sprintf("invalid json: %v", err))
+		}
+	} else {
+		req.ReferenceID = record.Fields["referenceid"]
+		req.ReferrerCode = optionalField(record.Fields, "referrercode")
+		req.PreferredCode = optionalField(record.Fields, "preferredcode")
+		req.Email = optionalField(record.Fields, "email")
+
+		if attributes := record.Fields["attributes"]; attributes != "" {
+			if err := json.Unmarshal([]byte(attributes), &req.Attributes); err != nil {
+				return req, errors.Invalid("attributes", errors.CodeInvalid, fmt.Sprintf("invalid attributes json: %v", err))
+			}
+		}
+		if campaignIDs, ok := record.Fields["campaignids"]; ok {
+			for _, value := range strings.Split(campaignIDs, ";") {
+				if value = strings.TrimSpace(value); value == "" {
+					continue
+				}
+				campaignID, err := strconv.ParseUint(value, 10, 64)
+				if err != nil {
+					return req, errors.Invalid("campaignIDs", errors.CodeInvalid, fmt.Sprintf("invalid campaign ID '%s'", value))
+				}
+				req.CampaignIDs = append(req.CampaignIDs, uint(campaignID))
+			}
+		}
+	}
+
+	// Treat empty optional values as absent, the same way CreateMember does
+	if req.ReferrerCode != nil && *req.ReferrerCode == "" {
+		req.ReferrerCode = nil
+	}
+	if req.PreferredCode != nil && *req.PreferredCode == "" {
+		req.PreferredCode = nil
+	}
+
+	return req, nil
+}
+
+func optionalField(fields map[string]string, key string) *string {
+	if value, ok := fields[key]; ok {
+		return &value
+	}
+	return nil
+}
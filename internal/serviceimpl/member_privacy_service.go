@@ -0,0 +1,192 @@
+package serviceimpl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"strings"
+)
+
+// forgottenPrefix starts the reference IDs of forgotten members
+const forgottenPrefix = "forgotten-"
+
+// forgottenReferenceID returns a pseudonym to replace the reference ID of a forgotten member with in every record of
+// the member, so that its rewards can still be accounted for together. It is random rather than derived from the
+// reference ID, which would be found back by trying the likely ones, e.g. the IDs of the users.
+func forgottenReferenceID() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate pseudonym: %w", err)
+	}
+	return forgottenPrefix + hex.EncodeToString(random), nil
+}
+
+// ForgetMember erases the personal data of a member: its email and custom attributes, the data of its event logs and
+// the visitor IDs of its clicks. Its reference ID is replaced with a random pseudonym in every record, while the
+// amounts of its event logs and rewards are kept for accounting. The reference ID is free to be used by a new member
+// afterwards.
+func (s *referrerService) ForgetMember(project, referenceID string, req request.ForgetMemberRequest) (*models.Member, error) {
+	if strings.HasPrefix(referenceID, forgottenPrefix) {
+		return nil, errors.Invalid("referenceID", errors.CodeNotAllowed, "member was already forgotten")
+	}
+	pseudonym, err := forgottenReferenceID()
+	if err != nil {
+		return nil, err
+	}
+
+	var member models.Member
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("project = ? AND reference_id = ?", project, referenceID).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.NotFound("member", "project=%s and reference_id=%s", project, referenceID)
+			}
+			return fmt.Errorf("failed to fetch member: %w", err)
+		}
+
+		if err := tx.Model(&member).Updates(map[string]interface{}{
+			"reference_id": pseudonym,
+			"email":        nil,
+			"email_index":  nil,
+			"attributes":   nil,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to anonymize member: %w", err)
+		}
+		if err := tx.Where("member_id = ?", member.ID).Delete(&models.MemberAttribute{}).Error; err != nil {
+			return fmt.Errorf("failed to remove attribute index: %w", err)
+		}
+
+		// The reference ID is copied into the records of the member, and into those of the members it referred
+		for _, rename := range []struct {
+			model          interface{}
+			idColumn       string
+			referenceIDCol string
+		}{
+			{&models.ReferralCode{}, "member_id", "member_reference_id"},
+			{&models.Enrollment{}, "member_id", "member_reference_id"},
+			{&models.AuditLog{}, "member_id", "member_reference_id"},
+			{&models.CampaignEventLog{}, "member_id", "member_reference_id"},
+			{&models.Click{}, "signup_member_id", "signup_member_reference_id"},
+			{&models.Reward{}, "rewarded_member_id", "rewarded_member_reference_id"},
+			{&models.Reward{}, "related_member_id", "related_member_reference_id"},
+			{&models.Member{}, "referred_by_member_id", "referred_by_member_reference_id"},
+		} {
+			if err := tx.Model(rename.model).Where(rename.idColumn+" = ?", member.ID).
+				Update(rename.referenceIDCol, pseudonym).Error; err != nil {
+				return fmt.Errorf("failed to pseudonymize %s: %w", rename.referenceIDCol, err)
+			}
+		}
+
+		// Event logs keep their amounts, but their data may hold anything about the member
+		events := tx.Model(&models.EventLog{}).Where("member_id = ?", member.ID).
+			Updates(map[string]interface{}{"member_reference_id": pseudonym, "data": nil})
+		if events.Error != nil {
+			return fmt.Errorf("failed to scrub event logs: %w", events.Error)
+		}
+
+		// Visitor IDs identify the browser of the member, including in the clicks before its signup
+		var visitorIDs []string
+		if err := tx.Model(&models.Click{}).Where("signup_member_id = ?", member.ID).Distinct().Pluck("visitor_id", &visitorIDs).Error; err != nil {
+			return fmt.Errorf("failed to fetch visitor IDs: %w", err)
+		}
+		if len(visitorIDs) > 0 {
+			if err := tx.Model(&models.Click{}).Where("project = ? AND visitor_id IN (?)", project, visitorIDs).
+				Update("visitor_id", pseudonym).Error; err != nil {
+				return fmt.Errorf("failed to scrub clicks: %w", err)
+			}
+		}
+
+		if err := s.forgetReferrerInAuditLogs(tx, &member, referenceID, pseudonym); err != nil {
+			return err
+		}
+
+		member.ReferenceID = pseudonym
+		if err := recordAudit(tx, &member, models.AuditActionForget, req.Actor, req.Reason, map[string]interface{}{
+			"eventLogsScrubbed": events.RowsAffected,
+		}); err != nil {
+			return err
+		}
+
+		return tx.Preload("Campaigns").First(&member, member.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// forgetReferrerInAuditLogs replaces the reference ID of a forgotten member in the audit logs of the referrers attached
+// to the members it referred
+func (s *referrerService) forgetReferrerInAuditLogs(tx *gorm.DB, member *models.Member, referenceID, pseudonym string) error {
+	var entries []models.AuditLog
+	if err := tx.Where("action = ? AND member_id IN (?)", models.AuditActionAttachReferrer,
+		tx.Model(&models.Member{}).Select("id").Where("referred_by_member_id = ?", member.ID)).
+		Find(&entries).Error; err != nil {
+		return fmt.Errorf("failed to fetch audit logs of referees: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Data == nil {
+			continue
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(*entry.Data), &data); err != nil {
+			return fmt.Errorf("failed to decode audit log %d: %w", entry.ID, err)
+		}
+		if data["referrerReferenceID"] != referenceID {
+			continue
+		}
+		data["referrerReferenceID"] = pseudonym
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit log %d: %w", entry.ID, err)
+		}
+		if err := tx.Model(&entry).Update("data", string(encoded)).Error; err != nil {
+			return fmt.Errorf("failed to pseudonymize audit log %d: %w", entry.ID, err)
+		}
+	}
+	return nil
+}
+
+// ExportMemberData writes every record tied to a member to w, as a JSON document of response.MemberData
+func (s *referrerService) ExportMemberData(w io.Writer, project, referenceID string) error {
+	member, err := s.findMemberByReferenceID(project, referenceID)
+	if err != nil {
+		return err
+	}
+
+	data := response.MemberData{ExportedAt: s.Clock.Now().UTC()}
+	if err := s.DB.Preload("Campaigns").First(&data.Member, member.ID).Error; err != nil {
+		return fmt.Errorf("failed to fetch member: %w", err)
+	}
+	for _, records := range []struct {
+		name  string
+		dest  interface{}
+		query *gorm.DB
+	}{
+		{"referral codes", &data.ReferralCodes, s.DB.Where("member_id = ?", member.ID)},
+		{"enrollments", &data.Enrollments, s.DB.Where("member_id = ?", member.ID)},
+		{"clicks", &data.Clicks, s.DB.Where("signup_member_id = ?", member.ID)},
+		{"event logs", &data.EventLogs, s.DB.Where("member_id = ?", member.ID)},
+		{"campaign event logs", &data.CampaignEventLogs, s.DB.Where("member_id = ?", member.ID)},
+		{"rewards", &data.Rewards, s.DB.Where("rewarded_member_id = ?", member.ID)},
+		{"audit logs", &data.AuditLogs, s.DB.Where("member_id = ?", member.ID)},
+	} {
+		if err := records.query.Order("id").Find(records.dest).Error; err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", records.name, err)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return fmt.Errorf("failed to write member data: %w", err)
+	}
+	return nil
+}
@@ -1,62 +1,99 @@
 package serviceimpl
 
 import (
-	"errors"
 	"fmt"
+	"github.com/PayRam/go-referral/errors"
 	"github.com/PayRam/go-referral/models"
 	"github.com/PayRam/go-referral/request"
-	"github.com/PayRam/go-referral/utils"
+	"github.com/PayRam/go-referral/response"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
-	"net/mail"
+	"time"
 )
 
 type referrerService struct {
-	DB *gorm.DB
+	*Config
 }
 
 //var _ service.ReferrerService = &referrerService{}
 
-func NewReferrerService(db *gorm.DB) *referrerService {
-	return &referrerService{DB: db}
+func NewReferrerService(cfg *Config) *referrerService {
+	return &referrerService{Config: cfg}
 }
 
 func (s *referrerService) CreateMember(project string, req request.CreateMemberRequest) (*models.Member, error) {
-	// Validate email if provided
-	if req.Email != nil {
-		if *req.Email == "" {
-			return nil, fmt.Errorf("email cannot be empty")
-		}
-		if _, err := mail.ParseAddress(*req.Email); err != nil {
-			return nil, fmt.Errorf("invalid email format: %w", err)
-		}
-	}
+	policy := s.codePolicy(project)
+	validation := validateCreateMemberRequest(req, policy, s.attributeSchema(project))
 
 	// Initialize `ReferredByMemberID`
 	var referredByMemberID *uint
 	var referredByMemberReferenceID *string
+	var referrer *models.Member
+	var referrerCode *models.ReferralCode
+	var click *models.Click
 
-	// 🔹 Step 1: Fetch the existing member by `ReferrerCode`
+	// 🔹 Step 1: Fetch the referral code `ReferrerCode` and its member
 	if req.ReferrerCode != nil && *req.ReferrerCode != "" {
-		var referrerMember models.Member
-		if err := s.DB.Where("project = ? AND code = ?", project, *req.ReferrerCode).
-			First(&referrerMember).Error; err != nil {
-			return nil, fmt.Errorf("invalid referrer code: %w", err)
+		code, err := resolveReferrerCode(s.DB, project, *req.ReferrerCode, s.Clock.Now(), validation)
+		if err != nil {
+			return nil, err
+		}
+		if code != nil {
+			referredByMemberID = &code.Member.ID
+			referredByMemberReferenceID = &code.Member.ReferenceID
+			referrer = code.Member
+			referrerCode = code
+		}
+	} else if req.VisitorID != nil && *req.VisitorID != "" {
+		// Without a referrer code, the member may still have clicked a referral link before signing up
+		attributed, code, err := s.attributedClick(s.DB, project, *req.VisitorID)
+		if err != nil {
+			return nil, err
+		}
+		if code != nil {
+			referredByMemberID = &code.Member.ID
+			referredByMemberReferenceID = &code.Member.ReferenceID
+			referrer = code.Member
+			referrerCode = code
+			click = attributed
+		}
+	}
+
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	// 🔹 Step 2: Reject duplicates up front, so that they are reported as conflicts rather than constraint errors
+	var existing int64
+	if err := s.DB.Model(&models.Member{}).
+		Where("project = ? AND reference_id = ?", project, req.ReferenceID).
+		Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check existing member: %w", err)
+	}
+	if existing > 0 {
+		return nil, errors.Conflict("member", "member already exists for reference_id=%s", req.ReferenceID)
+	}
+	if req.PreferredCode != nil && *req.PreferredCode != "" {
+		taken, err := fetchTakenCodes(s.DB, project, []string{*req.PreferredCode})
+		if err != nil {
+			return nil, err
+		}
+		if taken[*req.PreferredCode] {
+			return nil, errors.Conflict("member", "code %s is already in use", *req.PreferredCode)
 		}
-		referredByMemberID = &referrerMember.ID
-		referredByMemberReferenceID = &referrerMember.ReferenceID
 	}
 
-	// 🔹 Step 2: Generate a PreferredCode if not provided
-	if req.PreferredCode == nil || *req.PreferredCode == "" {
-		code, err := utils.CreateReferralCode(7)
+	// 🔹 Step 3: Generate a PreferredCode if not provided, following the code policy of the project
+	generated := req.PreferredCode == nil || *req.PreferredCode == ""
+	if generated {
+		code, err := s.uniqueCode(s.DB, policy, models.Member{Project: project, ReferenceID: req.ReferenceID, Email: req.Email})
 		if err != nil {
-			return nil, fmt.Errorf("CreateMember: failed to generate referral code: %w", err)
+			return nil, fmt.Errorf("CreateMember: %w", err)
 		}
 		req.PreferredCode = &code
 	}
 
-	// 🔹 Step 3: Create the new member with `ReferredByMemberID`
+	// 🔹 Step 4: Create the new member with `ReferredByMemberID`
 	member := &models.Member{
 		Project:                     project,
 		Code:                        *req.PreferredCode,
@@ -65,25 +102,63 @@ func (s *referrerService) CreateMember(project string, req request.CreateMemberR
 		ReferredByMemberID:          referredByMemberID, // Assign the referrer
 		ReferredByMemberReferenceID: referredByMemberReferenceID,
 	}
+	if len(req.Attributes) > 0 {
+		member.Attributes = req.Attributes
+	}
+	if referrerCode != nil {
+		member.ReferredByCodeID = &referrerCode.ID
+	}
 
-	// 🔹 Step 4: Use a transaction to save the member and associate campaigns
+	if referrer != nil {
+		if err := s.checkReferral(*member, *referrer); err != nil {
+			return nil, err
+		}
+	}
+
+	// 🔹 Step 5: Use a transaction to save the member and associate campaigns
 	err := s.DB.Transaction(func(tx *gorm.DB) error {
-		// Save the new member
-		if err := tx.Create(member).Error; err != nil {
+		// Save the new member, with a new code if another member took the generated one in the meantime
+		create := func(tx *gorm.DB, code string) error {
+			member.ID, member.Code = 0, code
+			if err := tx.Create(member).Error; err != nil {
+				return fmt.Errorf("failed to create member: %w", err)
+			}
+			if err := tx.Create(primaryCode(member)).Error; err != nil {
+				return fmt.Errorf("failed to create referral code: %w", err)
+			}
+			return nil
+		}
+		if generated {
+			if err := s.createWithUniqueCode(tx, policy, *member, member.Code, create); err != nil {
+				return err
+			}
+		} else if err := create(tx, member.Code); err != nil {
+			return err
+		}
+		if err := indexAttributes(tx, member); err != nil {
 			return err
 		}
+		if referrerCode != nil {
+			if err := useReferralCode(tx, referrerCode); err != nil {
+				return err
+			}
+		}
+		if click != nil {
+			if err := tx.Model(click).Updates(map[string]interface{}{
+				"signup_member_id":           member.ID,
+				"signup_member_reference_id": member.ReferenceID,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to attribute click: %w", err)
+			}
+		}
 
-		// Associate campaigns if provided
-		if len(req.CampaignIDs) > 0 {
-			for _, campaignID := range req.CampaignIDs {
-				association := &models.MemberCampaign{
-					Project:    project,
-					MemberID:   member.ID,
-					CampaignID: campaignID,
-				}
-				if err := tx.Create(association).Error; err != nil {
-					return err
-				}
+		// Enroll in the campaigns if provided
+		for _, campaignID := range req.CampaignIDs {
+			if err := checkEnrollableCampaign(tx, project, campaignID); err != nil {
+				return err
+			}
+			if _, err := enroll(tx, campaignID, []models.Member{*member}, s.Clock.Now().UTC()); err != nil {
+				return err
 			}
 		}
 
@@ -94,15 +169,16 @@ func (s *referrerService) CreateMember(project string, req request.CreateMemberR
 		return nil, err
 	}
 
-	// 🔹 Step 5: Reload the member with preloaded campaigns and referrer
-	if err := s.DB.Preload("Campaigns").Preload("ReferredByMember").First(member, member.ID).Error; err != nil {
+	// 🔹 Step 6: Reload the member with preloaded campaigns and referrer
+	if err := s.DB.Preload("Campaigns").Preload("ReferredByMember").Preload("ReferredByCode").First(member, member.ID).Error; err != nil {
 		return nil, fmt.Errorf("failed to preload member data: %w", err)
 	}
+	s.memberCreated(*member)
 
 	return member, nil
 }
 
-func (s *referrerService) GetMembers(req request.GetMemberRequest) ([]models.Member, int64, error) {
+func (s *referrerService) GetMembers(req request.GetMemberRequest) ([]models.Member, response.PageInfo, error) {
 	var referrers []models.Member
 	var count int64
 
@@ -112,26 +188,31 @@ func (s *referrerService) GetMembers(req request.GetMemberRequest) ([]models.Mem
 	query = request.ApplyGetMemberRequest(req, query)
 
 	// Apply Select Fields
-	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Calculate total count before applying pagination
 	countQuery := query
 	if err := countQuery.Count(&count).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count referrers: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count referrers: %w", err)
 	}
 
 	// Apply pagination conditions
-	query = request.ApplyPaginationConditions(query, req.PaginationConditions)
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
 
 	// Fetch records with pagination
 	if err := query.Preload("Campaigns").Preload("ReferredByMember").Find(&referrers).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch referrers: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch referrers: %w", err)
 	}
 
-	return referrers, count, nil
+	page, err := request.BuildPageInfo(query, &referrers, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate referrers: %w", err)
+	}
+
+	return referrers, page, nil
 }
 
 func (s *referrerService) UpdateMember(project, referenceID string, req request.UpdateMemberRequest) (*models.Member, error) {
@@ -146,36 +227,29 @@ func (s *referrerService) UpdateMember(project, referenceID string, req request.
 			Where("project = ? AND reference_id = ?", project, referenceID).
 			First(&referrer).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return fmt.Errorf("referrer not found for project=%s and reference_id=%s", project, referenceID)
+				return errors.NotFound("member", "project=%s and reference_id=%s", project, referenceID)
 			}
-			return err
+			return fmt.Errorf("failed to fetch member: %w", err)
 		}
 
-		// Validate email if provided
+		// Validate email and attributes if provided
+		validation := &errors.ValidationError{}
+		validateEmail(validation, req.Email)
+		validateAttributes(validation, req.Attributes, s.attributeSchema(project), true)
+		if err := validation.Err(); err != nil {
+			return err
+		}
 		if req.Email != nil {
-			if *req.Email == "" {
-				return fmt.Errorf("email cannot be empty")
-			}
-			if _, err := mail.ParseAddress(*req.Email); err != nil {
-				return fmt.Errorf("invalid email format: %w", err)
-			}
 			referrer.Email = req.Email // Update email
 		}
-
-		// Remove existing campaign associations
-		if err := tx.Unscoped().Where("member_id = ?", referrer.ID).Delete(&models.MemberCampaign{}).Error; err != nil {
-			return fmt.Errorf("failed to remove existing campaign associations: %w", err)
+		if req.Attributes != nil {
+			referrer.Attributes = mergeAttributes(referrer.Attributes, req.Attributes)
 		}
 
-		// Add new campaign associations
-		for _, campaignID := range req.CampaignIDs {
-			association := &models.MemberCampaign{
-				Project:    project,
-				MemberID:   referrer.ID,
-				CampaignID: campaignID,
-			}
-			if err := tx.Create(association).Error; err != nil {
-				return fmt.Errorf("failed to associate campaign %d: %w", campaignID, err)
+		// Replace the enrollments with the campaigns if provided, ending and starting only those that change
+		if req.CampaignIDs != nil {
+			if err := s.replaceEnrollments(tx, referrer, req.CampaignIDs); err != nil {
+				return err
 			}
 		}
 
@@ -183,6 +257,11 @@ func (s *referrerService) UpdateMember(project, referenceID string, req request.
 		if err := tx.Save(&referrer).Error; err != nil {
 			return fmt.Errorf("failed to save referrer updates: %w", err)
 		}
+		if req.Attributes != nil {
+			if err := indexAttributes(tx, &referrer); err != nil {
+				return err
+			}
+		}
 
 		// Preload campaigns for the updated referrer
 		if err := tx.Preload("Campaigns").Preload("ReferredByMember").First(&referrer, referrer.ID).Error; err != nil {
@@ -201,11 +280,22 @@ func (s *referrerService) UpdateMember(project, referenceID string, req request.
 }
 
 func (s *referrerService) UpdateMemberStatus(project, referenceID string, newStatus string) (*models.Member, error) {
+	return s.ChangeMemberStatus(project, referenceID, request.UpdateMemberStatusRequest{Status: newStatus})
+}
+
+// ChangeMemberStatus moves a member to req.Status, with the effects of the status on its rewards: banning forfeits its
+// pending and held rewards, activating releases its held rewards whose hold has not expired, and deactivating applies
+// the inactive referrer policy of their campaigns to the rewards held while it was suspended. Banned members stay
+// banned.
+func (s *referrerService) ChangeMemberStatus(project, referenceID string, req request.UpdateMemberStatusRequest) (*models.Member, error) {
 	var referrer models.Member
+	var from string
 
 	// Validate newStatus
-	if newStatus != "active" && newStatus != "inactive" {
-		return nil, fmt.Errorf("invalid new status: must be 'active' or 'inactive'")
+	switch req.Status {
+	case models.MemberStatusActive, models.MemberStatusInactive, models.MemberStatusSuspended, models.MemberStatusBanned:
+	default:
+		return nil, errors.Invalid("status", errors.CodeInvalid, "invalid new status: must be 'active', 'inactive', 'suspended' or 'banned'")
 	}
 
 	// Use transaction to lock the row
@@ -213,24 +303,61 @@ func (s *referrerService) UpdateMemberStatus(project, referenceID string, newSta
 		// Fetch the referrer with a row lock
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("project = ? AND reference_id = ?", project, referenceID).First(&referrer).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return fmt.Errorf("referrer not found")
+				return errors.NotFound("member", "project=%s and reference_id=%s", project, referenceID)
 			}
 			return fmt.Errorf("failed to fetch referrer: %w", err)
 		}
 
-		// Check if the status is already the desired status
-		if referrer.Status == newStatus {
-			return fmt.Errorf("referrer is already %s", newStatus)
+		// Check if the status is already the desired status, or can no longer change
+		if referrer.Status == req.Status || referrer.Status == models.MemberStatusBanned {
+			return &errors.InvalidStateTransitionError{Resource: "member", From: referrer.Status, To: req.Status}
 		}
+		from = referrer.Status
 
 		// Update status
-		referrer.Status = newStatus
+		referrer.Status = req.Status
 
 		// Save the updated referrer
 		if err := tx.Save(&referrer).Error; err != nil {
 			return fmt.Errorf("failed to update referrer status: %w", err)
 		}
 
+		var released, forfeited int64
+		switch req.Status {
+		case models.MemberStatusActive:
+			// Held rewards whose hold expired are left to the worker to forfeit
+			result := tx.Model(&models.Reward{}).
+				Where("rewarded_member_id = ? AND status = ? AND (hold_expires_at IS NULL OR hold_expires_at > ?)",
+					referrer.ID, models.RewardStatusOnHold, s.Clock.Now().UTC()).
+				Updates(map[string]interface{}{"status": models.RewardStatusPending, "reason": nil, "hold_expires_at": nil})
+			if result.Error != nil {
+				return fmt.Errorf("failed to release held rewards: %w", result.Error)
+			}
+			released = result.RowsAffected
+		case models.MemberStatusBanned:
+			result := tx.Model(&models.Reward{}).
+				Where("rewarded_member_id = ? AND status IN (?)", referrer.ID, []string{models.RewardStatusPending, models.RewardStatusOnHold}).
+				Updates(map[string]interface{}{"status": models.RewardStatusForfeited, "reason": "member banned"})
+			if result.Error != nil {
+				return fmt.Errorf("failed to forfeit rewards: %w", result.Error)
+			}
+			forfeited = result.RowsAffected
+		case models.MemberStatusInactive:
+			var err error
+			if forfeited, err = deferSuspendedRewards(tx, referrer, s.Clock.Now().UTC()); err != nil {
+				return err
+			}
+		}
+
+		if err := recordAudit(tx, &referrer, models.AuditActionStatusChange, req.Actor, req.Reason, map[string]interface{}{
+			"from":             from,
+			"to":               req.Status,
+			"rewardsReleased":  released,
+			"rewardsForfeited": forfeited,
+		}); err != nil {
+			return err
+		}
+
 		// Fetch the updated referrer with associated campaigns
 		if err := tx.Preload("Campaigns").Preload("ReferredByMember").First(&referrer, referrer.ID).Error; err != nil {
 			return fmt.Errorf("failed to preload campaigns for referrer: %w", err)
@@ -242,10 +369,47 @@ func (s *referrerService) UpdateMemberStatus(project, referenceID string, newSta
 	if err != nil {
 		return nil, err
 	}
+	s.memberStatusChanged(referrer, from)
 
 	return &referrer, nil
 }
 
+// deferSuspendedRewards applies the inactive referrer policy of their campaigns to the rewards held while member was
+// suspended, which have no hold expiry: they are forfeited, or held until the hold days of the campaign are over. It
+// returns how many were forfeited.
+func deferSuspendedRewards(tx *gorm.DB, member models.Member, now time.Time) (int64, error) {
+	held := func() *gorm.DB {
+		return tx.Model(&models.Reward{}).Where("rewarded_member_id = ? AND status = ? AND hold_expires_at IS NULL",
+			member.ID, models.RewardStatusOnHold)
+	}
+
+	var campaigns []models.Campaign
+	if err := tx.Unscoped().
+		Select("id", "inactive_referrer_policy", "inactive_referrer_hold_days").
+		Where("id IN (?)", held().Select("campaign_id")).
+		Find(&campaigns).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch campaigns of held rewards: %w", err)
+	}
+
+	var forfeited int64
+	for _, campaign := range campaigns {
+		updates := map[string]interface{}{"reason": "referrer inactive"}
+		if campaign.InactiveReferrerPolicy == models.InactiveReferrerForfeit {
+			updates["status"] = models.RewardStatusForfeited
+		} else {
+			updates["hold_expires_at"] = now.AddDate(0, 0, inactiveReferrerHoldDays(campaign))
+		}
+		result := held().Where("campaign_id = ?", campaign.ID).Updates(updates)
+		if result.Error != nil {
+			return 0, fmt.Errorf("failed to defer held rewards of campaign %d: %w", campaign.ID, result.Error)
+		}
+		if campaign.InactiveReferrerPolicy == models.InactiveReferrerForfeit {
+			forfeited += result.RowsAffected
+		}
+	}
+	return forfeited, nil
+}
+
 func (s *referrerService) GetTotalMembers(req request.GetMemberRequest) (int64, error) {
 	var count int64
 
@@ -255,10 +419,10 @@ func (s *referrerService) GetTotalMembers(req request.GetMemberRequest) (int64,
 	query = request.ApplyGetMemberRequest(req, query)
 
 	// Apply Select Fields
-	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Count the records
 	if err := query.Count(&count).Error; err != nil {
@@ -0,0 +1,287 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/response"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// maxReferralTreeDepth bounds every walk of the referral graph, so a corrupted
+// chain (e.g. a cycle introduced by hand) cannot make a query run forever.
+const maxReferralTreeDepth = 100
+
+// treeIDBatchSize limits the size of IN (...) lists built from subtree member IDs.
+const treeIDBatchSize = 1000
+
+// GetDownline returns every member referred directly or indirectly by the given member, up to maxDepth levels
+// below it, together with the number of members found on each level. A maxDepth <= 0 walks the whole tree.
+func (s *referrerService) GetDownline(project, referenceID string, maxDepth int) (*response.Downline, error) {
+	root, err := s.findMemberByReferenceID(project, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	maxDepth = normaliseTreeDepth(maxDepth)
+
+	members, err := s.walkDownline(root, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	downline := &response.Downline{
+		Root:          newReferralTreeNode(*root, 0),
+		MaxDepth:      maxDepth,
+		TotalReferees: int64(len(members)),
+		Levels:        []response.DownlineLevel{},
+		Members:       members,
+	}
+
+	// Members are ordered by depth, so levels can be counted in a single pass
+	for _, member := range members {
+		last := len(downline.Levels) - 1
+		if last < 0 || downline.Levels[last].Depth != member.Depth {
+			downline.Levels = append(downline.Levels, response.DownlineLevel{Depth: member.Depth})
+			last++
+		}
+		downline.Levels[last].Count++
+	}
+
+	return downline, nil
+}
+
+// GetUpline returns the referral chain above the given member, starting with its direct referrer and ending
+// with the member at the root of the tree.
+func (s *referrerService) GetUpline(project, referenceID string) ([]response.ReferralTreeNode, error) {
+	member, err := s.findMemberByReferenceID(project, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.walkUpline(member)
+}
+
+// GetSubtreeStats aggregates the tree below the given member: how many members it referred, directly and
+// indirectly, and how much the member and its whole downline were rewarded in each currency, the forfeited rewards
+// left out.
+func (s *referrerService) GetSubtreeStats(project, referenceID string, maxDepth int) (*response.SubtreeStats, error) {
+	root, err := s.findMemberByReferenceID(project, referenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.walkDownline(root, normaliseTreeDepth(maxDepth))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &response.SubtreeStats{
+		MemberID:               root.ID,
+		ReferenceID:            root.ReferenceID,
+		TotalReferees:          int64(len(members)),
+		TotalRewardsByCurrency: map[string]decimal.Decimal{},
+	}
+
+	memberIDs := []uint{root.ID}
+	for _, member := range members {
+		if member.Depth == 1 {
+			stats.DirectReferees++
+		}
+		if member.Depth > stats.Depth {
+			stats.Depth = member.Depth
+		}
+		memberIDs = append(memberIDs, member.ID)
+	}
+
+	for start := 0; start < len(memberIDs); start += treeIDBatchSize {
+		end := min(start+treeIDBatchSize, len(memberIDs))
+
+		var totals []struct {
+			CurrencyCode string
+			Total        string
+		}
+		if err := s.DB.Model(&models.Reward{}).
+			Select("currency_code, COALESCE(CAST(SUM(amount) AS TEXT), '0') AS total").
+			Where("project = ? AND rewarded_member_id IN (?) AND status <> ?", project, memberIDs[start:end], models.RewardStatusForfeited).
+			Group("currency_code").
+			Scan(&totals).Error; err != nil {
+			return nil, fmt.Errorf("failed to sum subtree rewards: %w", err)
+		}
+
+		for _, total := range totals {
+			amount, err := decimal.NewFromString(total.Total)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse subtree rewards for currency %s: %w", total.CurrencyCode, err)
+			}
+			stats.TotalRewardsByCurrency[total.CurrencyCode] = stats.TotalRewardsByCurrency[total.CurrencyCode].Add(amount)
+		}
+	}
+
+	return stats, nil
+}
+
+func (s *referrerService) findMemberByReferenceID(project, referenceID string) (*models.Member, error) {
+	var member models.Member
+	if err := s.DB.Where("project = ? AND reference_id = ?", project, referenceID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("member", "project=%s and reference_id=%s", project, referenceID)
+		}
+		return nil, fmt.Errorf("failed to fetch member: %w", err)
+	}
+	return &member, nil
+}
+
+// walkDownline lists the members below root ordered by depth, then by ID. A member reached again through a cycle is
+// listed once, at its nearest depth, as in the iterative walk.
+func (s *referrerService) walkDownline(root *models.Member, maxDepth int) ([]response.ReferralTreeNode, error) {
+	if !supportsRecursiveCTE(s.DB) {
+		return s.walkDownlineIteratively(root, maxDepth)
+	}
+
+	nodes := []response.ReferralTreeNode{}
+	if err := s.DB.Raw(fmt.Sprintf(`
+		WITH RECURSIVE downline (id, depth) AS (
+			SELECT id, 0 FROM %[1]s WHERE id = ?
+			UNION
+			SELECT m.id, d.depth + 1 FROM %[1]s m
+			JOIN downline d ON m.referred_by_member_id = d.id
+			WHERE m.project = ? AND m.deleted_at IS NULL AND d.depth < ?
+		),
+		nearest (id, depth) AS (
+			SELECT id, MIN(depth) FROM downline GROUP BY id
+		)
+		SELECT m.id, m.project, m.reference_id, m.email, m.code, m.status,
+			m.referred_by_member_id, m.referred_by_member_reference_id, m.created_at, d.depth
+		FROM nearest d
+		JOIN %[1]s m ON m.id = d.id
+		WHERE d.depth > 0
+		ORDER BY d.depth ASC, m.id ASC
+	`, s.Naming.Table("members")), root.ID, root.Project, maxDepth).Scan(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch downline: %w", err)
+	}
+
+	return nodes, nil
+}
+
+func (s *referrerService) walkDownlineIteratively(root *models.Member, maxDepth int) ([]response.ReferralTreeNode, error) {
+	nodes := []response.ReferralTreeNode{}
+	visited := map[uint]bool{root.ID: true}
+	frontier := []uint{root.ID}
+
+	for depth := 1; depth <= maxDepth && len(frontier) > 0; depth++ {
+		var next []uint
+		for start := 0; start < len(frontier); start += treeIDBatchSize {
+			end := min(start+treeIDBatchSize, len(frontier))
+
+			var members []models.Member
+			if err := s.DB.Where("project = ? AND referred_by_member_id IN (?)", root.Project, frontier[start:end]).
+				Order("id ASC").
+				Find(&members).Error; err != nil {
+				return nil, fmt.Errorf("failed to fetch downline: %w", err)
+			}
+
+			for _, member := range members {
+				if visited[member.ID] {
+					continue
+				}
+				visited[member.ID] = true
+				nodes = append(nodes, newReferralTreeNode(member, depth))
+				next = append(next, member.ID)
+			}
+		}
+		frontier = next
+	}
+
+	return nodes, nil
+}
+
+// walkUpline lists the referrers above member, nearest first, each once even when the chain loops.
+func (s *referrerService) walkUpline(member *models.Member) ([]response.ReferralTreeNode, error) {
+	if !supportsRecursiveCTE(s.DB) {
+		return s.walkUplineIteratively(member)
+	}
+
+	nodes := []response.ReferralTreeNode{}
+	if err := s.DB.Raw(fmt.Sprintf(`
+		WITH RECURSIVE upline (id, referred_by_member_id, depth) AS (
+			SELECT id, referred_by_member_id, 0 FROM %[1]s WHERE id = ?
+			UNION
+			SELECT m.id, m.referred_by_member_id, u.depth + 1 FROM %[1]s m
+			JOIN upline u ON m.id = u.referred_by_member_id
+			WHERE m.project = ? AND m.deleted_at IS NULL AND u.depth < ?
+		),
+		nearest (id, depth) AS (
+			SELECT id, MIN(depth) FROM upline GROUP BY id
+		)
+		SELECT m.id, m.project, m.reference_id, m.email, m.code, m.status,
+			m.referred_by_member_id, m.referred_by_member_reference_id, m.created_at, u.depth
+		FROM nearest u
+		JOIN %[1]s m ON m.id = u.id
+		WHERE u.depth > 0
+		ORDER BY u.depth ASC
+	`, s.Naming.Table("members")), member.ID, member.Project, maxReferralTreeDepth).Scan(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch upline: %w", err)
+	}
+
+	return nodes, nil
+}
+
+func (s *referrerService) walkUplineIteratively(member *models.Member) ([]response.ReferralTreeNode, error) {
+	nodes := []response.ReferralTreeNode{}
+	visited := map[uint]bool{member.ID: true}
+	current := member
+
+	for depth := 1; depth <= maxReferralTreeDepth && current.ReferredByMemberID != nil; depth++ {
+		if visited[*current.ReferredByMemberID] {
+			break
+		}
+
+		var referrer models.Member
+		if err := s.DB.Where("project = ? AND id = ?", member.Project, *current.ReferredByMemberID).First(&referrer).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				break
+			}
+			return nil, fmt.Errorf("failed to fetch upline: %w", err)
+		}
+
+		visited[referrer.ID] = true
+		nodes = append(nodes, newReferralTreeNode(referrer, depth))
+		current = &referrer
+	}
+
+	return nodes, nil
+}
+
+// supportsRecursiveCTE reports whether the connected database understands WITH RECURSIVE.
+func supportsRecursiveCTE(db *gorm.DB) bool {
+	switch db.Dialector.Name() {
+	case "postgres", "sqlite", "mysql":
+		return true
+	default:
+		return false
+	}
+}
+
+func normaliseTreeDepth(maxDepth int) int {
+	if maxDepth <= 0 || maxDepth > maxReferralTreeDepth {
+		return maxReferralTreeDepth
+	}
+	return maxDepth
+}
+
+func newReferralTreeNode(member models.Member, depth int) response.ReferralTreeNode {
+	return response.ReferralTreeNode{
+		ID:                          member.ID,
+		Project:                     member.Project,
+		ReferenceID:                 member.ReferenceID,
+		Email:                       member.Email,
+		Code:                        member.Code,
+		Status:                      member.Status,
+		ReferredByMemberID:          member.ReferredByMemberID,
+		ReferredByMemberReferenceID: member.ReferredByMemberReferenceID,
+		Depth:                       depth,
+		CreatedAt:                   member.CreatedAt,
+	}
+}
@@ -0,0 +1,164 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"gorm.io/gorm"
+	"time"
+)
+
+type referralCodeService struct {
+	*Config
+}
+
+func NewReferralCodeService(cfg *Config) *referralCodeService {
+	return &referralCodeService{Config: cfg}
+}
+
+// CreateReferralCode adds a referral code to the member with referenceID, besides its primary code
+func (s *referralCodeService) CreateReferralCode(project, referenceID string, req request.CreateReferralCodeRequest) (*models.ReferralCode, error) {
+	policy := s.codePolicy(project)
+	validation := validateCreateReferralCodeRequest(req, policy, s.Clock.Now())
+
+	var member models.Member
+	if err := s.DB.Where("project = ? AND reference_id = ?", project, referenceID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("member", "project=%s and reference_id=%s", project, referenceID)
+		}
+		return nil, fmt.Errorf("failed to fetch member: %w", err)
+	}
+
+	if req.CampaignID != nil {
+		var count int64
+		if err := s.DB.Model(&models.Campaign{}).Where("project = ? AND id = ?", project, *req.CampaignID).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch campaign: %w", err)
+		}
+		if count == 0 {
+			validation.Add("campaignID", errors.CodeNotFound, fmt.Sprintf("campaign %d not found", *req.CampaignID))
+		}
+	}
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	referralCode := &models.ReferralCode{
+		Project:           project,
+		MemberID:          member.ID,
+		MemberReferenceID: member.ReferenceID,
+		Channel:           req.Channel,
+		CampaignID:        req.CampaignID,
+		UsageLimit:        req.UsageLimit,
+		ExpiresAt:         req.ExpiresAt,
+	}
+	create := func(tx *gorm.DB, code string) error {
+		referralCode.ID, referralCode.Code = 0, code
+		if err := tx.Create(referralCode).Error; err != nil {
+			return fmt.Errorf("failed to create referral code: %w", err)
+		}
+		return nil
+	}
+
+	if req.Code != nil {
+		taken, err := fetchTakenCodes(s.DB, project, []string{*req.Code})
+		if err != nil {
+			return nil, err
+		}
+		if taken[*req.Code] {
+			return nil, errors.Conflict("referral code", "code %s is already in use", *req.Code)
+		}
+		if err := create(s.DB, *req.Code); err != nil {
+			return nil, err
+		}
+	} else {
+		generated, err := s.uniqueCode(s.DB, policy, member)
+		if err != nil {
+			return nil, fmt.Errorf("CreateReferralCode: %w", err)
+		}
+		if err := s.createWithUniqueCode(s.DB, policy, member, generated, create); err != nil {
+			return nil, err
+		}
+	}
+	return referralCode, nil
+}
+
+func (s *referralCodeService) GetReferralCodes(req request.GetReferralCodesRequest) ([]models.ReferralCode, response.PageInfo, error) {
+	var codes []models.ReferralCode
+	var count int64
+
+	query := s.DB.Model(&models.ReferralCode{})
+	query = request.ApplyGetReferralCodesRequest(req, query)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
+
+	// Calculate total count before applying pagination
+	countQuery := query
+	if err := countQuery.Count(&count).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count referral codes: %w", err)
+	}
+
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err := query.Find(&codes).Error; err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch referral codes: %w", err)
+	}
+
+	page, err := request.BuildPageInfo(query, &codes, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate referral codes: %w", err)
+	}
+
+	return codes, page, nil
+}
+
+// resolveReferrerCode returns the referral code a new member signs up with, with its member, and adds to validation
+// why the code cannot be used, if it cannot
+func resolveReferrerCode(db *gorm.DB, project, code string, now time.Time, validation *errors.ValidationError) (*models.ReferralCode, error) {
+	var referralCode models.ReferralCode
+	if err := db.Preload("Member").Where("project = ? AND code = ?", project, code).First(&referralCode).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to fetch referrer code: %w", err)
+		}
+		validation.Add("referrerCode", errors.CodeNotFound, fmt.Sprintf("invalid referrer code: %s", code))
+		return nil, nil
+	}
+
+	switch {
+	case referralCode.Member == nil:
+		validation.Add("referrerCode", errors.CodeNotFound, fmt.Sprintf("invalid referrer code: %s", code))
+		return nil, nil
+	case referralCode.ExpiresAt != nil && !now.Before(*referralCode.ExpiresAt):
+		validation.Add("referrerCode", errors.CodeInvalid, fmt.Sprintf("referrer code %s has expired", code))
+		return nil, nil
+	case referralCode.UsageLimit != nil && referralCode.UsageCount >= *referralCode.UsageLimit:
+		validation.Add("referrerCode", errors.CodeInvalid, fmt.Sprintf("referrer code %s has reached its usage limit", code))
+		return nil, nil
+	}
+	return &referralCode, nil
+}
+
+// useReferralCode counts a referral with the code, unless its usage limit was reached in the meantime
+func useReferralCode(tx *gorm.DB, code *models.ReferralCode) error {
+	result := tx.Model(&models.ReferralCode{}).
+		Where("id = ? AND (usage_limit IS NULL OR usage_count < usage_limit)", code.ID).
+		Update("usage_count", gorm.Expr("usage_count + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to count referral code usage: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Invalid("referrerCode", errors.CodeInvalid, fmt.Sprintf("referrer code %s has reached its usage limit", code.Code))
+	}
+	return nil
+}
+
+// primaryCode returns the referral code record of the code of member
+func primaryCode(member *models.Member) *models.ReferralCode {
+	return &models.ReferralCode{
+		Project:           member.Project,
+		Code:              member.Code,
+		MemberID:          member.ID,
+		MemberReferenceID: member.ReferenceID,
+		IsPrimary:         true,
+	}
+}
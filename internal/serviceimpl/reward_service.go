@@ -4,19 +4,20 @@ import (
 	"fmt"
 	"github.com/PayRam/go-referral/models"
 	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
 	"github.com/shopspring/decimal"
-	"gorm.io/gorm"
+	"io"
 	"time"
 )
 
 type rewardService struct {
-	DB *gorm.DB
+	*Config
 }
 
 //var _ service.rewardService = &rewardService{}
 
-func NewRewardService(db *gorm.DB) *rewardService {
-	return &rewardService{DB: db}
+func NewRewardService(cfg *Config) *rewardService {
+	return &rewardService{Config: cfg}
 }
 
 func (s *rewardService) GetTotalRewards(req request.GetRewardRequest) (decimal.Decimal, error) {
@@ -29,13 +30,13 @@ func (s *rewardService) GetTotalRewards(req request.GetRewardRequest) (decimal.D
 	query = request.ApplyGetRewardRequest(req, query)
 
 	// Apply Select Fields
-	//query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	//query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Apply pagination conditions
-	//query = request.ApplyPaginationConditions(query, req.PaginationConditions)
+	//query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields())
 
 	// Fetch the SUM as a string to avoid precision issues
 	if err := query.Scan(&totalAmountStr).Error; err != nil {
@@ -52,7 +53,7 @@ func (s *rewardService) GetTotalRewards(req request.GetRewardRequest) (decimal.D
 }
 
 // GetRewards fetches rewards based on the provided request
-func (s *rewardService) GetRewards(req request.GetRewardRequest) ([]models.Reward, int64, error) {
+func (s *rewardService) GetRewards(req request.GetRewardRequest) ([]models.Reward, response.PageInfo, error) {
 	var rewards []models.Reward
 	var count int64
 
@@ -63,26 +64,31 @@ func (s *rewardService) GetRewards(req request.GetRewardRequest) ([]models.Rewar
 	query = request.ApplyGetRewardRequest(req, query)
 
 	// Apply Select Fields
-	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields)
+	query = request.ApplySelectFields(query, req.PaginationConditions.SelectFields, req.AllowedFields())
 
 	// Apply Group By
-	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy)
+	query = request.ApplyGroupBy(query, req.PaginationConditions.GroupBy, req.AllowedFields())
 
 	// Calculate total count before applying pagination
 	countQuery := query
 	if err := countQuery.Count(&count).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count rewards: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to count rewards: %w", err)
 	}
 
 	// Apply pagination conditions
-	query = request.ApplyPaginationConditions(query, req.PaginationConditions)
+	query = request.ApplyPaginationConditions(query, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
 
 	// Fetch records with pagination
 	if err := query.Preload("RewardedMember").Preload("RelatedMember").Find(&rewards).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch rewards: %w", err)
+		return nil, response.PageInfo{}, fmt.Errorf("failed to fetch rewards: %w", err)
 	}
 
-	return rewards, count, nil
+	page, err := request.BuildPageInfo(query, &rewards, count, req.PaginationConditions, req.AllowedFields(), s.CursorKey)
+	if err != nil {
+		return nil, response.PageInfo{}, fmt.Errorf("failed to paginate rewards: %w", err)
+	}
+
+	return rewards, page, nil
 }
 
 func (s *rewardService) GetNewReferrerCount(req request.GetRewardRequest) (int64, error) {
@@ -93,10 +99,10 @@ func (s *rewardService) GetNewReferrerCount(req request.GetRewardRequest) (int64
 		var dateRangeStartStr, dateRangeEndStr string
 
 		// Fetch the earliest and latest created_at values from the database
-		if err := s.DB.Table("referral_rewards").Select("MIN(created_at)").Row().Scan(&dateRangeStartStr); err != nil {
+		if err := s.DB.Table(s.Naming.Table("rewards")).Select("MIN(created_at)").Row().Scan(&dateRangeStartStr); err != nil {
 			return 0, fmt.Errorf("failed to fetch earliest created_at date: %w", err)
 		}
-		if err := s.DB.Table("referral_rewards").Select("MAX(created_at)").Row().Scan(&dateRangeEndStr); err != nil {
+		if err := s.DB.Table(s.Naming.Table("rewards")).Select("MAX(created_at)").Row().Scan(&dateRangeEndStr); err != nil {
 			return 0, fmt.Errorf("failed to fetch latest created_at date: %w", err)
 		}
 
@@ -125,11 +131,11 @@ func (s *rewardService) GetNewReferrerCount(req request.GetRewardRequest) (int64
 	}
 
 	// Query to find unique ReferredByMemberReferenceID within the provided date range
-	subQuery := s.DB.Table("referral_rewards").
+	subQuery := s.DB.Table(s.Naming.Table("rewards")).
 		Select("referred_by_member_reference_id").
 		Where("created_at < ?", req.PaginationConditions.StartDate)
 
-	query := s.DB.Table("referral_rewards r").
+	query := s.DB.Table(s.Naming.Table("rewards")+" r").
 		Distinct("r.referred_by_member_reference_id").
 		Where("r.created_at BETWEEN ? AND ?", req.PaginationConditions.StartDate, req.PaginationConditions.EndDate).
 		Where("r.referred_by_member_reference_id NOT IN (?)", subQuery)
@@ -152,10 +158,10 @@ func (s *rewardService) GetNewRefereeCount(req request.GetRewardRequest) (int64,
 		var dateRangeStartStr, dateRangeEndStr string
 
 		// Fetch the earliest and latest created_at values from the database
-		if err := s.DB.Table("referral_rewards").Select("MIN(created_at)").Row().Scan(&dateRangeStartStr); err != nil {
+		if err := s.DB.Table(s.Naming.Table("rewards")).Select("MIN(created_at)").Row().Scan(&dateRangeStartStr); err != nil {
 			return 0, fmt.Errorf("failed to fetch earliest created_at date: %w", err)
 		}
-		if err := s.DB.Table("referral_rewards").Select("MAX(created_at)").Row().Scan(&dateRangeEndStr); err != nil {
+		if err := s.DB.Table(s.Naming.Table("rewards")).Select("MAX(created_at)").Row().Scan(&dateRangeEndStr); err != nil {
 			return 0, fmt.Errorf("failed to fetch latest created_at date: %w", err)
 		}
 
@@ -184,11 +190,11 @@ func (s *rewardService) GetNewRefereeCount(req request.GetRewardRequest) (int64,
 	}
 
 	// Query to find unique RefereeMemberReferenceID within the provided date range
-	subQuery := s.DB.Table("referral_rewards").
+	subQuery := s.DB.Table(s.Naming.Table("rewards")).
 		Select("referee_member_reference_id").
 		Where("created_at < ?", req.PaginationConditions.StartDate)
 
-	query := s.DB.Table("referral_rewards r").
+	query := s.DB.Table(s.Naming.Table("rewards")+" r").
 		Distinct("r.referee_member_reference_id").
 		Where("r.created_at BETWEEN ? AND ?", req.PaginationConditions.StartDate, req.PaginationConditions.EndDate).
 		Where("r.referee_member_reference_id NOT IN (?)", subQuery)
@@ -203,3 +209,75 @@ func (s *rewardService) GetNewRefereeCount(req request.GetRewardRequest) (int64,
 
 	return count, nil
 }
+
+// ExportRewards streams every reward matching req, joined with its campaign and members, to w. Rows are
+// fetched in batches ordered by ID, so exports stay consistent without loading the whole table.
+func (s *rewardService) ExportRewards(w io.Writer, exportReq request.ExportRequest, req request.GetRewardRequest) (int64, error) {
+	writer, err := newExportWriter(w, exportReq.Format, rewardExportHeader, rewardExportRecord)
+	if err != nil {
+		return 0, err
+	}
+
+	batchSize := exportBatchSize(exportReq.BatchSize)
+	conditions := req.PaginationConditions
+	table := s.Naming.Table("rewards")
+
+	var lastID uint
+	if conditions.GreaterThanID != nil {
+		lastID = *conditions.GreaterThanID
+	}
+
+	var written int64
+	for {
+		limit := batchSize
+		if conditions.Limit != nil && *conditions.Limit > 0 {
+			limit = min(limit, *conditions.Limit-int(written))
+			if limit <= 0 {
+				break
+			}
+		}
+
+		query := s.DB.Table(table).
+			Select(fmt.Sprintf(`
+				%[1]s.id, %[1]s.created_at, %[1]s.project, %[1]s.campaign_id,
+				COALESCE(c.name, '') AS campaign_name, %[1]s.currency_code, %[1]s.member_type,
+				%[1]s.amount, %[1]s.status, %[1]s.reason,
+				%[1]s.rewarded_member_id, %[1]s.rewarded_member_reference_id, rm.email AS rewarded_member_email,
+				%[1]s.related_member_id, %[1]s.related_member_reference_id, lm.email AS related_member_email
+			`, table)).
+			Joins("LEFT JOIN "+s.Naming.Table("campaigns")+" c ON c.id = "+table+".campaign_id").
+			Joins("LEFT JOIN "+s.Naming.Table("members")+" rm ON rm.id = "+table+".rewarded_member_id").
+			Joins("LEFT JOIN "+s.Naming.Table("members")+" lm ON lm.id = "+table+".related_member_id").
+			Where(table+".deleted_at IS NULL").
+			Where(table+".id > ?", lastID)
+
+		query = request.ApplyGetRewardRequest(req, query)
+		query = request.ApplyDateConditions(query, table, conditions)
+		if conditions.LessThanID != nil {
+			query = query.Where(table+".id < ?", *conditions.LessThanID)
+		}
+
+		var rows []response.RewardExportRow
+		if err := query.Order(table + ".id ASC").Limit(limit).Scan(&rows).Error; err != nil {
+			return written, fmt.Errorf("failed to fetch rewards for export: %w", err)
+		}
+
+		for _, row := range rows {
+			if err := writer.Write(row); err != nil {
+				return written, fmt.Errorf("failed to write reward %d: %w", row.ID, err)
+			}
+			written++
+		}
+
+		if len(rows) < limit {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+
+	if err := writer.Close(); err != nil {
+		return written, fmt.Errorf("failed to flush rewards export: %w", err)
+	}
+
+	return written, nil
+}
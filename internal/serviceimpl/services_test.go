@@ -1,17 +1,29 @@
 package serviceimpl_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	go_referral "github.com/PayRam/go-referral"
+	"github.com/PayRam/go-referral/clock/clocktest"
+	"github.com/PayRam/go-referral/encryption"
+	"github.com/PayRam/go-referral/errors"
 	"github.com/PayRam/go-referral/models"
 	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"github.com/PayRam/go-referral/service"
 	"github.com/PayRam/go-referral/utils"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -51,7 +63,10 @@ func TestMain(m *testing.M) {
 	}
 
 	// Initialize the referral service with the test DB
-	referralService = go_referral.NewReferralService(db)
+	referralService, err = go_referral.NewReferralService(db)
+	if err != nil {
+		panic(fmt.Sprintf("failed to initialise referral service: %v", err))
+	}
 
 	// Run tests
 	code := m.Run()
@@ -292,9 +307,9 @@ func TestOneTimeCampaign(t *testing.T) {
 		},
 	}
 
-	rewards, count, err := referralService.Reward.GetRewards(req)
+	rewards, page, err := referralService.Reward.GetRewards(req)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), page.Total)
 
 	referredMemberExpectedReward := decimal.NewFromFloat(10.05)
 	refereeMemberExpectedReward2 := decimal.NewFromFloat(5.025)
@@ -328,9 +343,9 @@ func TestOneTimeCampaign(t *testing.T) {
 		},
 	}
 	fmt.Print(refereeUser)
-	campaignEventLogs, count, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
+	campaignEventLogs, page, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), page.Total)
 	assert.Equal(t, rewards[0].ID, *campaignEventLogs[0].ReferredRewardID)
 	assert.Equal(t, rewards[1].ID, *campaignEventLogs[0].RefereeRewardID)
 	assert.Equal(t, rewards[0].ID, *campaignEventLogs[1].ReferredRewardID)
@@ -401,9 +416,9 @@ func TestRecurringCampaignWithRewardCapAndLimitedBudget(t *testing.T) {
 		},
 	}
 
-	rewards, count, err := referralService.Reward.GetRewards(req)
+	rewards, page, err := referralService.Reward.GetRewards(req)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), page.Total)
 
 	expectedReward := decimal.NewFromFloat(12.77745) //27.77745
 	expectedReward2 := decimal.NewFromFloat(15)      //27.77745
@@ -427,9 +442,9 @@ func TestRecurringCampaignWithRewardCapAndLimitedBudget(t *testing.T) {
 		},
 	}
 	fmt.Print(refereeUser)
-	campaignEventLogs, count, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
+	campaignEventLogs, page, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), page.Total)
 	assert.Equal(t, rewards[0].ID, *campaignEventLogs[0].ReferredRewardID)
 	assert.Equal(t, rewards[1].ID, *campaignEventLogs[1].ReferredRewardID)
 }
@@ -493,9 +508,9 @@ func TestRecurringCampaignWithMaxOccurrencesPerCustomer(t *testing.T) {
 		},
 	}
 
-	rewards, count, err := referralService.Reward.GetRewards(req)
+	rewards, page, err := referralService.Reward.GetRewards(req)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), page.Total)
 
 	expectedReward := decimal.NewFromFloat(30.9117)       //27.77745
 	expectedReward2 := decimal.NewFromFloat(186.42601321) //27.77745
@@ -519,9 +534,9 @@ func TestRecurringCampaignWithMaxOccurrencesPerCustomer(t *testing.T) {
 		},
 	}
 	fmt.Print(refereeUser)
-	campaignEventLogs, count, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
+	campaignEventLogs, page, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), page.Total)
 	assert.Equal(t, rewards[0].ID, *campaignEventLogs[0].ReferredRewardID)
 	assert.Equal(t, rewards[1].ID, *campaignEventLogs[1].ReferredRewardID)
 }
@@ -607,9 +622,9 @@ func TestEventsSharedByCampaigns(t *testing.T) {
 		},
 	}
 
-	rewards, count, err := referralService.Reward.GetRewards(req)
+	rewards, page, err := referralService.Reward.GetRewards(req)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(4), count)
+	assert.Equal(t, int64(4), page.Total)
 
 	expectedReward := decimal.NewFromFloat(27.3400104)
 	expectedReward2 := decimal.NewFromFloat(8.1311052)
@@ -648,9 +663,9 @@ func TestEventsSharedByCampaigns(t *testing.T) {
 		},
 	}
 	fmt.Print(refereeUser)
-	campaignEventLogs, count, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
+	campaignEventLogs, page, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), page.Total)
 	assert.Equal(t, rewards[0].ID, *campaignEventLogs[0].ReferredRewardID)
 	assert.Equal(t, rewards[1].ID, *campaignEventLogs[0].RefereeRewardID)
 	assert.Equal(t, rewards[2].ID, *campaignEventLogs[1].ReferredRewardID)
@@ -712,9 +727,9 @@ func TestFutureCampaign(t *testing.T) {
 		},
 	}
 
-	rewards, count, err := referralService.Reward.GetRewards(req)
+	rewards, page, err := referralService.Reward.GetRewards(req)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(0), count)
+	assert.Equal(t, int64(0), page.Total)
 	assert.Equal(t, 0, len(rewards))
 
 	elreg := request.GetCampaignEventLogRequest{
@@ -725,9 +740,9 @@ func TestFutureCampaign(t *testing.T) {
 		},
 	}
 	fmt.Print(refereeUser)
-	campaignEventLogs, count, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
+	campaignEventLogs, page, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(0), count)
+	assert.Equal(t, int64(0), page.Total)
 	assert.Equal(t, 0, len(campaignEventLogs))
 }
 
@@ -793,7 +808,7 @@ func TestPauseCampaignOnBudgetExceeds(t *testing.T) {
 
 	fmt.Print("**************** updated Campaign ID: ", campaign.ID)
 
-	campaigns, count, err := referralService.Campaigns.GetCampaigns(cReq)
+	campaigns, page, err := referralService.Campaigns.GetCampaigns(cReq)
 	assert.Equal(t, campaign.ID, campaigns[0].ID)
 	assert.Equal(t, "paused", campaigns[0].Status)
 
@@ -804,9 +819,9 @@ func TestPauseCampaignOnBudgetExceeds(t *testing.T) {
 			Order:  utils.StringPtr("asc"),
 		},
 	}
-	rewards, count, err := referralService.Reward.GetRewards(req)
+	rewards, page, err := referralService.Reward.GetRewards(req)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(4), count)
+	assert.Equal(t, int64(4), page.Total)
 
 	expectedReward := decimal.NewFromFloat(32.1)   //27.77745
 	expectedReward2 := decimal.NewFromFloat(48.15) //27.77745
@@ -829,9 +844,9 @@ func TestPauseCampaignOnBudgetExceeds(t *testing.T) {
 			Order:  utils.StringPtr("asc"),
 		},
 	}
-	campaignEventLogs, count, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
+	campaignEventLogs, page, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(2), count)
+	assert.Equal(t, int64(2), page.Total)
 	assert.Equal(t, rewards[0].ID, *campaignEventLogs[0].ReferredRewardID)
 	assert.Equal(t, rewards[1].ID, *campaignEventLogs[0].RefereeRewardID)
 	assert.Equal(t, rewards[2].ID, *campaignEventLogs[1].ReferredRewardID)
@@ -904,10 +919,10 @@ func TestUpdateCampaignToArchivedStateOnEndDatePassed(t *testing.T) {
 		Projects: []string{project},
 	}
 
-	campaigns, count, err := referralService.Campaigns.GetCampaigns(cReq)
+	campaigns, page, err := referralService.Campaigns.GetCampaigns(cReq)
 	assert.NoError(t, err)
 	assert.Equal(t, campaign.ID, campaigns[0].ID)
-	assert.Equal(t, int64(1), count)
+	assert.Equal(t, int64(1), page.Total)
 	assert.Equal(t, "archived", campaigns[0].Status)
 
 	req := request.GetRewardRequest{
@@ -917,9 +932,9 @@ func TestUpdateCampaignToArchivedStateOnEndDatePassed(t *testing.T) {
 			Order:  utils.StringPtr("asc"),
 		},
 	}
-	rewards, count, err := referralService.Reward.GetRewards(req)
+	rewards, page, err := referralService.Reward.GetRewards(req)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(0), count)
+	assert.Equal(t, int64(0), page.Total)
 	assert.Equal(t, 0, len(rewards))
 
 	elreg := request.GetCampaignEventLogRequest{
@@ -929,14 +944,14 @@ func TestUpdateCampaignToArchivedStateOnEndDatePassed(t *testing.T) {
 			Order:  utils.StringPtr("asc"),
 		},
 	}
-	campaignEventLogs, count, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
+	campaignEventLogs, page, err := referralService.CampaignEventLog.GetCampaignEventLogs(elreg)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(0), count)
+	assert.Equal(t, int64(0), page.Total)
 	assert.Equal(t, 0, len(campaignEventLogs))
 }
 
 func TestAggregator(t *testing.T) {
-	stats, count, err := referralService.AggregatorService.GetReferrerMembersStats(request.GetMemberRequest{
+	stats, page, err := referralService.AggregatorService.GetReferrerMembersStats(request.GetMemberRequest{
 		PaginationConditions: request.PaginationConditions{
 			SortBy: utils.StringPtr("id"),
 			Order:  utils.StringPtr("asc"),
@@ -944,7 +959,7 @@ func TestAggregator(t *testing.T) {
 	})
 
 	assert.NoError(t, err)
-	assert.Equal(t, int64(14), count)
+	assert.Equal(t, int64(14), page.Total)
 
 	assert.Equal(t, "onetimeproject", stats[0].Project)
 	assert.Equal(t, int64(1), stats[0].RefereeCount)
@@ -1000,3 +1015,1407 @@ func TestTotalRewardEarned(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "27.77745", totalRewards.String())
 }
+
+func TestReferralTree(t *testing.T) {
+	project := "treeproject"
+
+	root := createReferrer(t, project, "tree-root", nil, nil)
+	left := createReferee(t, project, root.Code, "tree-left", nil)
+	createReferee(t, project, root.Code, "tree-right", nil)
+	grandChild := createReferee(t, project, left.Code, "tree-grandchild", nil)
+	createReferee(t, project, grandChild.Code, "tree-great-grandchild", nil)
+
+	downline, err := referralService.Members.GetDownline(project, "tree-root", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), downline.TotalReferees)
+	assert.Equal(t, 2, len(downline.Levels))
+	assert.Equal(t, int64(2), downline.Levels[0].Count)
+	assert.Equal(t, int64(1), downline.Levels[1].Count)
+
+	upline, err := referralService.Members.GetUpline(project, "tree-great-grandchild")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(upline))
+	assert.Equal(t, "tree-grandchild", upline[0].ReferenceID)
+	assert.Equal(t, "tree-root", upline[2].ReferenceID)
+	assert.Equal(t, 3, upline[2].Depth)
+
+	stats, err := referralService.Members.GetSubtreeStats(project, "tree-root", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.DirectReferees)
+	assert.Equal(t, int64(4), stats.TotalReferees)
+	assert.Equal(t, 3, stats.Depth)
+	assert.Empty(t, stats.TotalRewardsByCurrency)
+
+	// The rewards of the whole subtree are summed per currency, the forfeited ones left out
+	for _, reward := range []struct {
+		member   *models.Member
+		currency string
+		amount   int64
+		status   string
+	}{
+		{root, "USD", 10, models.RewardStatusPending},
+		{left, "USD", 5, models.RewardStatusOnHold},
+		{left, "USD", 7, models.RewardStatusForfeited},
+		{grandChild, "EUR", 3, models.RewardStatusPending},
+	} {
+		assert.NoError(t, db.Create(&models.Reward{
+			Project: project, CampaignID: 1, CurrencyCode: reward.currency, RewardedMemberID: reward.member.ID,
+			RewardedMemberReferenceID: reward.member.ReferenceID, RelatedMemberID: reward.member.ID,
+			RelatedMemberReferenceID: reward.member.ReferenceID, MemberType: "referrer",
+			Amount: decimal.NewFromInt(reward.amount), Status: reward.status,
+		}).Error)
+	}
+	stats, err = referralService.Members.GetSubtreeStats(project, "tree-root", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(stats.TotalRewardsByCurrency))
+	assert.True(t, stats.TotalRewardsByCurrency["USD"].Equal(decimal.NewFromInt(15)))
+	assert.True(t, stats.TotalRewardsByCurrency["EUR"].Equal(decimal.NewFromInt(3)))
+
+	// A cycle introduced by hand lists every member once
+	assert.NoError(t, db.Model(&models.Member{}).Where("id = ?", root.ID).Update("referred_by_member_id", grandChild.ID).Error)
+	downline, err = referralService.Members.GetDownline(project, "tree-root", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), downline.TotalReferees)
+	assert.Equal(t, 4, len(downline.Members))
+	upline, err = referralService.Members.GetUpline(project, "tree-great-grandchild")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(upline))
+}
+
+func TestImportMembersAndEventLogs(t *testing.T) {
+	project := "importproject"
+
+	createEvent(t, project, request.CreateEventRequest{
+		Key:       "import-payment",
+		Name:      "Imported Payment",
+		EventType: "payment",
+	})
+
+	members := "referenceID,preferredCode,referrerCode,email\n" +
+		"import-1,IMPORT1,,import-1@gmail.com\n" +
+		"import-2,,IMPORT1,\n" +
+		"import-3,,MISSING,\n" +
+		"import-1,,,\n"
+
+	dryRun, err := referralService.Members.ImportMembers(project, strings.NewReader(members), request.ImportRequest{Format: "csv", DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dryRun.Imported)
+	count, err := referralService.Members.GetTotalMembers(request.GetMemberRequest{Projects: []string{project}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	result, err := referralService.Members.ImportMembers(project, strings.NewReader(members), request.ImportRequest{Format: "csv", ChunkSize: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.TotalRows)
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 2, result.Failed)
+
+	referee, _, err := referralService.Members.GetMembers(request.GetMemberRequest{Projects: []string{project}, ReferenceID: utils.StringPtr("import-2")})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(referee))
+	assert.Equal(t, "import-1", *referee[0].ReferredByMemberReferenceID)
+
+	eventLogs := `{"eventKey":"import-payment","referenceID":"import-2","amount":"12.5","triggeredAt":"2024-01-01T00:00:00Z"}
+{"eventKey":"import-payment","referenceID":"import-2"}
+`
+	result, err = referralService.EventLogs.ImportEventLogs(project, strings.NewReader(eventLogs), request.ImportRequest{Format: "jsonl"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Imported)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, 2, result.Errors[0].Row)
+}
+
+func TestExportRewards(t *testing.T) {
+	var buf bytes.Buffer
+	written, err := referralService.Reward.ExportRewards(&buf, request.ExportRequest{Format: "csv", BatchSize: 1}, request.GetRewardRequest{
+		Projects: []string{"onetimeproject"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), written)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "id,createdAt,project,campaignID,campaignName"))
+	assert.Contains(t, lines[1], "New User Campaign Updated")
+	assert.Contains(t, lines[1], "10.05")
+
+	buf.Reset()
+	written, err = referralService.EventLogs.ExportEventLogs(&buf, request.ExportRequest{Format: "jsonl"}, request.GetEventLogRequest{
+		Projects: []string{"onetimeproject"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), written)
+	assert.Equal(t, 4, strings.Count(buf.String(), "\n"))
+}
+
+func TestCursorPagination(t *testing.T) {
+	limit := 2
+	req := request.GetMemberRequest{
+		Projects: []string{"treeproject"},
+		PaginationConditions: request.PaginationConditions{
+			Limit:  &limit,
+			SortBy: utils.StringPtr("created_at"),
+			Order:  utils.StringPtr("desc"),
+		},
+	}
+
+	var referenceIDs []string
+	var page response.PageInfo
+	for {
+		members, p, err := referralService.Members.GetMembers(req)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), p.Total)
+		for _, member := range members {
+			referenceIDs = append(referenceIDs, member.ReferenceID)
+		}
+		page = p
+		if p.NextCursor == nil {
+			break
+		}
+		req.PaginationConditions.Cursor = p.NextCursor
+	}
+	assert.Equal(t, []string{"tree-great-grandchild", "tree-grandchild", "tree-right", "tree-left", "tree-root"}, referenceIDs)
+
+	// Walking back from the last page returns the page before it, in the same order
+	req.PaginationConditions.Cursor = page.PrevCursor
+	members, p, err := referralService.Members.GetMembers(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(members))
+	assert.Equal(t, "tree-right", members[0].ReferenceID)
+	assert.NotNil(t, p.NextCursor)
+	assert.NotNil(t, p.PrevCursor)
+
+	// Cursors are tied to the sort order they were issued for
+	req.PaginationConditions.Order = utils.StringPtr("asc")
+	_, _, err = referralService.Members.GetMembers(req)
+	assert.Error(t, err)
+
+	// Each service verifies the cursors with its own key, so services with different keys coexist
+	req.PaginationConditions.Order = utils.StringPtr("desc")
+	req.PaginationConditions.Cursor = nil
+	keyed, err := go_referral.NewReferralService(db, go_referral.WithCursorSigningKey([]byte("cursor-key")))
+	assert.NoError(t, err)
+	_, keyedPage, err := keyed.Members.GetMembers(req)
+	assert.NoError(t, err)
+	req.PaginationConditions.Cursor = keyedPage.NextCursor
+	_, _, err = keyed.Members.GetMembers(req)
+	assert.NoError(t, err)
+	_, _, err = referralService.Members.GetMembers(req)
+	assert.True(t, errors.Is(err, errors.ErrValidation))
+	req.PaginationConditions.Cursor = page.PrevCursor
+	_, _, err = referralService.Members.GetMembers(req)
+	assert.NoError(t, err)
+}
+
+func TestFieldWhitelist(t *testing.T) {
+	// Multi-column sorts are accepted
+	members, _, err := referralService.Members.GetMembers(request.GetMemberRequest{
+		Projects:             []string{"treeproject"},
+		PaginationConditions: request.PaginationConditions{SortBy: utils.StringPtr("status,-created_at")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(members))
+
+	// Anything outside the whitelist is rejected before reaching the database
+	var fieldErr *request.InvalidFieldError
+	_, _, err = referralService.Members.GetMembers(request.GetMemberRequest{
+		PaginationConditions: request.PaginationConditions{SortBy: utils.StringPtr("id; DROP TABLE referral_members")},
+	})
+	assert.True(t, errors.As(err, &fieldErr))
+	assert.Equal(t, "sortBy", fieldErr.Field)
+
+	_, _, err = referralService.Reward.GetRewards(request.GetRewardRequest{
+		PaginationConditions: request.PaginationConditions{SelectFields: []string{"amount", "password"}},
+	})
+	assert.True(t, errors.As(err, &fieldErr))
+	assert.Equal(t, "selectFields", fieldErr.Field)
+
+	_, _, err = referralService.Members.GetMembers(request.GetMemberRequest{
+		PaginationConditions: request.PaginationConditions{Order: utils.StringPtr("sideways")},
+	})
+	assert.True(t, errors.As(err, &fieldErr))
+	assert.Equal(t, "order", fieldErr.Field)
+
+	// Cursors cannot be issued past null values, so only non-null columns are sortable
+	assertSortableNotNull(t, &models.ReferralCode{}, request.GetReferralCodesRequest{}.AllowedFields())
+	assertSortableNotNull(t, &models.Click{}, request.GetClicksRequest{}.AllowedFields())
+	assertSortableNotNull(t, &models.AuditLog{}, request.GetAuditLogsRequest{}.AllowedFields())
+	assertSortableNotNull(t, &models.Reward{}, request.GetRewardRequest{}.AllowedFields())
+	assertSortableNotNull(t, &models.Enrollment{}, request.GetEnrollmentsRequest{}.AllowedFields())
+}
+
+func assertSortableNotNull(t *testing.T, model interface{}, rules request.FieldRules) {
+	stmt := &gorm.Statement{DB: db}
+	assert.NoError(t, stmt.Parse(model))
+	for _, name := range rules.Sortable {
+		field := stmt.Schema.LookUpField(name)
+		if assert.NotNil(t, field, "unknown sortable field %s", name) {
+			assert.NotEqual(t, reflect.Ptr, field.FieldType.Kind(), "%s is sortable but nullable", name)
+		}
+	}
+}
+
+func TestErrorTaxonomy(t *testing.T) {
+	_, err := referralService.Campaigns.UpdateCampaign("treeproject", 999999, request.UpdateCampaignRequest{})
+	var notFound *errors.NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	assert.Equal(t, "campaign", notFound.Resource)
+
+	_, err = referralService.Members.CreateMember("treeproject", request.CreateMemberRequest{ReferenceID: "tree-root"})
+	assert.True(t, errors.Is(err, errors.ErrConflict))
+
+	_, err = referralService.Events.CreateEvent("treeproject", request.CreateEventRequest{Key: "bad key", Name: "Bad", EventType: "simple"})
+	var validationErr *errors.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "key", validationErr.Fields[0].Field)
+	assert.Equal(t, errors.CodeInvalid, validationErr.Fields[0].Code)
+
+	_, err = referralService.Members.UpdateMemberStatus("treeproject", "tree-root", "active")
+	assert.True(t, errors.Is(err, errors.ErrInvalidStateTransition))
+
+	_, err = referralService.Members.GetDownline("treeproject", "missing", 0)
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+}
+
+func TestValidationReportsEveryField(t *testing.T) {
+	rewardType := "percentage"
+	rewardValue := decimal.NewFromInt(150)
+	months := 3
+	_, err := referralService.Campaigns.CreateCampaign("treeproject", request.CreateCampaignRequest{
+		RewardType:                &rewardType,
+		RewardValue:               &rewardValue,
+		CampaignTypePerCustomer:   "forever",
+		ValidityMonthsPerCustomer: &months,
+	})
+
+	var validationErr *errors.ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	for _, field := range []string{"name", "currencyCode", "rewardValue", "validityMonthsPerCustomer", "eventKeys"} {
+		assert.True(t, validationErr.Has(field), "expected a problem with %s", field)
+	}
+
+	_, err = referralService.Events.CreateEvent("treeproject", request.CreateEventRequest{EventType: "other"})
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, 3, len(validationErr.Fields))
+}
+
+func TestUpdateCampaignDates(t *testing.T) {
+	project := "updatecampaigndates"
+	event := createEvent(t, project, request.CreateEventRequest{Key: "dates-signup", Name: "Signup", EventType: "simple"})
+	startDate := time.Now().AddDate(0, 0, 10)
+	endDate := startDate.AddDate(0, 0, 10)
+	rewardValue := decimal.NewFromInt(5)
+	campaign := createCampaign(t, project, request.CreateCampaignRequest{
+		Name:                    "Dates",
+		RewardType:              utils.StringPtr("flat_fee"),
+		RewardValue:             &rewardValue,
+		CurrencyCode:            "USD",
+		StartDate:               &startDate,
+		EndDate:                 &endDate,
+		CampaignTypePerCustomer: "forever",
+		EventKeys:               []string{event.Key},
+	})
+
+	var validationErr *errors.ValidationError
+
+	// A start date alone could be after the stored end date
+	lateStart := endDate.AddDate(0, 0, 1)
+	_, err := referralService.Campaigns.UpdateCampaign(project, campaign.ID, request.UpdateCampaignRequest{StartDate: &lateStart})
+	assert.True(t, errors.As(err, &validationErr))
+	assert.True(t, validationErr.Has("endDate"))
+
+	// An end date alone could be before the stored start date
+	earlyEnd := startDate.AddDate(0, 0, -1)
+	_, err = referralService.Campaigns.UpdateCampaign(project, campaign.ID, request.UpdateCampaignRequest{EndDate: &earlyEnd})
+	assert.True(t, errors.As(err, &validationErr))
+	assert.True(t, validationErr.Has("startDate"))
+
+	_, err = referralService.Campaigns.UpdateCampaign(project, campaign.ID, request.UpdateCampaignRequest{StartDate: &lateStart, EndDate: &earlyEnd})
+	assert.True(t, errors.As(err, &validationErr))
+	assert.True(t, validationErr.Has("startDate"))
+
+	newEnd := endDate.AddDate(0, 0, 5)
+	campaign, err = referralService.Campaigns.UpdateCampaign(project, campaign.ID, request.UpdateCampaignRequest{StartDate: &startDate, EndDate: &newEnd})
+	assert.NoError(t, err)
+	assert.True(t, newEnd.Equal(*campaign.EndDate))
+}
+
+type blockSelfReferral struct{}
+
+func (blockSelfReferral) CheckReferral(member models.Member, referrer models.Member) error {
+	if member.Email != nil && referrer.Email != nil && *member.Email == *referrer.Email {
+		return fmt.Errorf("member %s shares the email of its referrer", member.ReferenceID)
+	}
+	return nil
+}
+
+func (blockSelfReferral) CheckReward(reward models.Reward) error {
+	return nil
+}
+
+func TestFunctionalOptions(t *testing.T) {
+	var created []string
+	optionsService, err := go_referral.NewReferralService(db,
+		go_referral.WithSkipMigrations(),
+		go_referral.WithCodeGenerator(func(project string) (string, error) {
+			return fmt.Sprintf("OPT%d", len(created)), nil
+		}),
+		go_referral.WithFraudChecks(blockSelfReferral{}),
+		go_referral.WithHooks(service.Hooks{
+			OnMemberCreated: func(member models.Member) {
+				created = append(created, member.ReferenceID)
+			},
+		}))
+	assert.NoError(t, err)
+
+	email := "same@example.com"
+	referrer, err := optionsService.Members.CreateMember("optionsproject", request.CreateMemberRequest{ReferenceID: "opt-referrer", Email: &email})
+	assert.NoError(t, err)
+	assert.Equal(t, "OPT0", referrer.Code)
+
+	_, err = optionsService.Members.CreateMember("optionsproject", request.CreateMemberRequest{ReferenceID: "opt-referee", Email: &email, ReferrerCode: &referrer.Code})
+	assert.True(t, errors.Is(err, errors.ErrFraudSuspected))
+	assert.Equal(t, []string{"opt-referrer"}, created)
+}
+
+func TestFutureCampaignWithFakeClock(t *testing.T) {
+	project := "fakeclock"
+	fake := clocktest.NewFake(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC))
+	clockedService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithClock(fake))
+	assert.NoError(t, err)
+
+	_, err = clockedService.Events.CreateEvent(project, request.CreateEventRequest{Key: "signup", Name: "Signup", EventType: "simple"})
+	assert.NoError(t, err)
+
+	startDate := fake.Now().AddDate(0, 0, 1)
+	endDate := startDate.AddDate(0, 1, 0)
+	rewardType := "flat_fee"
+	rewardValue := decimal.NewFromInt(10)
+	campaign, err := clockedService.Campaigns.CreateCampaign(project, request.CreateCampaignRequest{
+		Name:                    "Starts tomorrow",
+		RewardType:              &rewardType,
+		RewardValue:             &rewardValue,
+		CurrencyCode:            "USDC",
+		StartDate:               &startDate,
+		EndDate:                 &endDate,
+		IsDefault:               true,
+		CampaignTypePerCustomer: "one_time",
+		EventKeys:               []string{"signup"},
+	})
+	assert.NoError(t, err)
+
+	referrer, err := clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "clock-referrer"})
+	assert.NoError(t, err)
+	_, err = clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "clock-referee", ReferrerCode: &referrer.Code})
+	assert.NoError(t, err)
+
+	fake.Advance(time.Minute)
+	_, err = clockedService.EventLogs.CreateEventLog(project, request.CreateEventLogRequest{EventKey: "signup", ReferenceID: "clock-referee"})
+	assert.NoError(t, err)
+
+	// The campaign has not started yet
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	rewardReq := request.GetRewardRequest{Projects: []string{project}}
+	rewards, _, err := clockedService.Reward.GetRewards(rewardReq)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(rewards))
+
+	fake.AddDate(0, 0, 2)
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	rewards, _, err = clockedService.Reward.GetRewards(rewardReq)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(rewards))
+	assert.True(t, rewards[0].CreatedAt.Equal(fake.Now()))
+
+	// Once the campaign has ended, the worker archives it
+	fake.AddDate(0, 2, 0)
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	campaigns, _, err := clockedService.Campaigns.GetCampaigns(request.GetCampaignsRequest{IDs: []uint{campaign.ID}})
+	assert.NoError(t, err)
+	assert.Equal(t, "archived", campaigns[0].Status)
+}
+
+func TestTableSchemaAndPrefix(t *testing.T) {
+	// A new gorm.DB, since GORM caches the table names of the models per connection
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	schemaDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	assert.NoError(t, err)
+
+	schemaService, err := go_referral.NewReferralService(schemaDB, go_referral.WithSchema("referral"), go_referral.WithTablePrefix(""))
+	assert.NoError(t, err)
+	assert.True(t, schemaDB.Migrator().HasTable("referral.members"))
+	assert.True(t, schemaDB.Migrator().HasTable("referral.migrations"))
+
+	member, err := schemaService.Members.CreateMember("schemaproject", request.CreateMemberRequest{ReferenceID: "schema-member"})
+	assert.NoError(t, err)
+	stats, _, err := schemaService.AggregatorService.GetReferrerMembersStats(request.GetMemberRequest{Projects: []string{"schemaproject"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(stats))
+	assert.Equal(t, member.ReferenceID, stats[0].ReferenceID)
+
+	// The naming is that of schemaDB only: db keeps the default one, and refuses another
+	assert.Equal(t, "referral_members", models.NamingOf(db).Table("members"))
+	_, err = referralService.Members.CreateMember("schemaproject", request.CreateMemberRequest{ReferenceID: "schema-member"})
+	assert.NoError(t, err)
+	var count int64
+	assert.NoError(t, db.Table("referral_members").Where("project = ?", "schemaproject").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	_, err = go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithTablePrefix("other_"))
+	assert.Error(t, err)
+}
+
+func TestTablePrefixesShareDatabase(t *testing.T) {
+	// A new gorm.DB, since GORM caches the table names of the models per connection
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	prefixDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	assert.NoError(t, err)
+	prefixService, err := go_referral.NewReferralService(prefixDB, go_referral.WithTablePrefix("acme_"))
+	assert.NoError(t, err)
+
+	// Both prefixes have every index of the models, under names of their own
+	acmeDB, err := models.WithNaming(prefixDB, models.Naming{Prefix: "acme_"})
+	assert.NoError(t, err)
+	for _, named := range []*gorm.DB{db, acmeDB} {
+		for _, model := range []interface{}{&models.Event{}, &models.CampaignEvent{}, &models.Member{}, &models.MemberCampaign{},
+			&models.ReferralCode{}, &models.Click{}, &models.MemberAttribute{},
+			&models.Enrollment{}} {
+			stmt := &gorm.Statement{DB: named}
+			assert.NoError(t, stmt.Parse(model))
+			for _, index := range stmt.Schema.ParseIndexes() {
+				assert.True(t, named.Migrator().HasIndex(model, index.Name), index.Name)
+			}
+		}
+	}
+
+	for _, service := range []*go_referral.ReferralService{referralService, prefixService} {
+		_, err = service.Events.CreateEvent("prefixes", request.CreateEventRequest{Key: "signup", Name: "Signup", EventType: "simple"})
+		assert.NoError(t, err)
+	}
+}
+
+func TestMigrationStatusAndRollback(t *testing.T) {
+	// Rolling back drops columns and tables the other tests use, so it runs on its own schema, through a new gorm.DB
+	// as GORM caches the table names of the models per connection
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	rollbackDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	assert.NoError(t, err)
+	inSchema := go_referral.WithSchema("rollback")
+	assert.NoError(t, go_referral.Migrate(rollbackDB, inSchema))
+
+	status, err := go_referral.MigrationStatus(rollbackDB, inSchema)
+	assert.NoError(t, err)
+	for _, migration := range status {
+		assert.True(t, migration.Applied, migration.ID)
+		assert.False(t, migration.Unknown, migration.ID)
+	}
+
+	// Roll back the incremental migrations, then start with migrations skipped
+	assert.NoError(t, go_referral.Rollback(rollbackDB, status[0].ID, inSchema))
+	_, err = go_referral.NewReferralService(rollbackDB, go_referral.WithSkipMigrations(), inSchema)
+	var versionErr *errors.SchemaVersionError
+	assert.True(t, errors.As(err, &versionErr))
+	assert.Equal(t, len(status)-1, len(versionErr.Pending))
+
+	assert.NoError(t, go_referral.Migrate(rollbackDB, inSchema))
+	_, err = go_referral.NewReferralService(rollbackDB, go_referral.WithSkipMigrations(), inSchema)
+	assert.NoError(t, err)
+
+	// The schema of the other tests was left alone
+	_, err = go_referral.NewReferralService(db, go_referral.WithSkipMigrations())
+	assert.NoError(t, err)
+}
+
+func TestSimulateCampaign(t *testing.T) {
+	project := "simulate"
+	fake := clocktest.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	simulatingService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithClock(fake))
+	assert.NoError(t, err)
+
+	_, err = simulatingService.Events.CreateEvent(project, request.CreateEventRequest{Key: "purchase", Name: "Purchase", EventType: "payment"})
+	assert.NoError(t, err)
+	referrer, err := simulatingService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "sim-referrer"})
+	assert.NoError(t, err)
+
+	amount := decimal.NewFromInt(100)
+	from := fake.Now()
+	for _, referenceID := range []string{"sim-1", "sim-2", "sim-3"} {
+		_, err = simulatingService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: referenceID, ReferrerCode: &referrer.Code})
+		assert.NoError(t, err)
+		fake.Advance(time.Hour)
+		_, err = simulatingService.EventLogs.CreateEventLog(project, request.CreateEventLogRequest{EventKey: "purchase", ReferenceID: referenceID, Amount: &amount})
+		assert.NoError(t, err)
+	}
+	to := fake.Now().Add(time.Minute)
+	fake.Advance(time.Hour)
+	_, err = simulatingService.EventLogs.CreateEventLog(project, request.CreateEventLogRequest{EventKey: "purchase", ReferenceID: "sim-1", Amount: &amount})
+	assert.NoError(t, err)
+
+	startDate := fake.Now()
+	endDate := startDate.AddDate(0, 1, 0)
+	rewardType := "percentage"
+	rewardValue := decimal.NewFromInt(10)
+	budget := decimal.NewFromInt(25)
+	candidate := request.CreateCampaignRequest{
+		Name:                    "Candidate",
+		RewardType:              &rewardType,
+		RewardValue:             &rewardValue,
+		CurrencyCode:            "USD",
+		Budget:                  &budget,
+		StartDate:               &startDate,
+		EndDate:                 &endDate,
+		CampaignTypePerCustomer: "forever",
+		EventKeys:               []string{"purchase"},
+	}
+
+	simulation, err := simulatingService.Worker.Simulate(project, request.SimulateRequest{Campaign: &candidate, From: from, To: to})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), simulation.EventLogs)
+	assert.Equal(t, uint(0), simulation.CampaignID)
+	assert.Equal(t, 2, len(simulation.Rewards))
+	assert.Equal(t, "sim-referrer", simulation.Rewards[0].RewardedMemberReferenceID)
+	assert.Equal(t, uint(0), simulation.Rewards[0].ID)
+	assert.True(t, simulation.TotalRewards.Equal(decimal.NewFromInt(20)))
+	assert.True(t, simulation.RemainingBudget.Equal(decimal.NewFromInt(5)))
+	assert.True(t, simulation.BudgetExhausted)
+	assert.Equal(t, int64(1), simulation.Rejections["budget_exceeded"])
+
+	// Nothing was persisted
+	total, err := simulatingService.Campaigns.GetTotalCampaigns(request.GetCampaignsRequest{Projects: []string{project}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+	rewards, _, err := simulatingService.Reward.GetRewards(request.GetRewardRequest{Projects: []string{project}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(rewards))
+
+	// A saved campaign, without a budget, over the whole period
+	candidate.Budget = nil
+	campaign, err := simulatingService.Campaigns.CreateCampaign(project, candidate)
+	assert.NoError(t, err)
+	simulation, err = simulatingService.Worker.Simulate(project, request.SimulateRequest{CampaignID: &campaign.ID, From: from, To: fake.Now().Add(time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, campaign.ID, simulation.CampaignID)
+	assert.Equal(t, 4, len(simulation.Rewards))
+	assert.True(t, simulation.TotalRewards.Equal(decimal.NewFromInt(40)))
+	assert.Nil(t, simulation.RemainingBudget)
+	assert.False(t, simulation.BudgetExhausted)
+
+	_, err = simulatingService.Worker.Simulate(project, request.SimulateRequest{From: from, To: to})
+	assert.Error(t, err)
+}
+
+func TestCodePolicies(t *testing.T) {
+	fromReferenceID := service.MemberCodeGeneratorFunc(func(member models.Member, attempt int) (string, error) {
+		if attempt == 0 {
+			return strings.ToUpper(member.ReferenceID), nil
+		}
+		return fmt.Sprintf("%s%d", strings.ToUpper(member.ReferenceID), attempt), nil
+	})
+	policyService, err := go_referral.NewReferralService(db,
+		go_referral.WithSkipMigrations(),
+		go_referral.WithCodePolicy("", service.CodePolicy{Length: 5, Alphabet: "ABC", Prefix: "R-", Blocklist: []string{"bad"}}),
+		go_referral.WithCodePolicy("policyusernames", service.CodePolicy{Generator: fromReferenceID}))
+	assert.NoError(t, err)
+
+	member, err := policyService.Members.CreateMember("policyrandom", request.CreateMemberRequest{ReferenceID: "policy-random"})
+	assert.NoError(t, err)
+	assert.Regexp(t, `^R-[ABC]{5}$`, member.Code)
+
+	for _, code := range []string{"abc", "has space", "NOTBAD"} {
+		_, err = policyService.Members.CreateMember("policyrandom", request.CreateMemberRequest{ReferenceID: "policy-vanity", PreferredCode: &code})
+		assert.True(t, errors.Is(err, errors.ErrValidation), code)
+	}
+
+	// Codes are unique per project
+	shared := "SHARED1"
+	_, err = policyService.Members.CreateMember("policyrandom", request.CreateMemberRequest{ReferenceID: "policy-shared", PreferredCode: &shared})
+	assert.NoError(t, err)
+	_, err = policyService.Members.CreateMember("policyusernames", request.CreateMemberRequest{ReferenceID: "policy-shared", PreferredCode: &shared})
+	assert.NoError(t, err)
+	_, err = policyService.Members.CreateMember("policyusernames", request.CreateMemberRequest{ReferenceID: "policy-other", PreferredCode: &shared})
+	assert.True(t, errors.Is(err, errors.ErrConflict))
+
+	// Collisions are retried
+	dave := "DAVE"
+	_, err = policyService.Members.CreateMember("policyusernames", request.CreateMemberRequest{ReferenceID: "carol", PreferredCode: &dave})
+	assert.NoError(t, err)
+	member, err = policyService.Members.CreateMember("policyusernames", request.CreateMemberRequest{ReferenceID: "dave"})
+	assert.NoError(t, err)
+	assert.Equal(t, "DAVE1", member.Code)
+
+	_, err = go_referral.NewReferralService(db, go_referral.WithSkipMigrations(),
+		go_referral.WithCodePolicy("", service.CodePolicy{Alphabet: "ABCA"}))
+	assert.True(t, errors.Is(err, errors.ErrValidation))
+
+	// Alphabets may have multibyte characters
+	greekService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(),
+		go_referral.WithCodePolicy("", service.CodePolicy{Length: 6, Alphabet: "ΑΒΓΔ"}))
+	assert.NoError(t, err)
+	member, err = greekService.Members.CreateMember("policygreek", request.CreateMemberRequest{ReferenceID: "policy-greek"})
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[ΑΒΓΔ]{6}$`, member.Code)
+}
+
+// takeCode takes the code of the new members, as a concurrent request would between its generation and the insert
+type takeCode struct{ db *gorm.DB }
+
+func (c takeCode) CheckReferral(member models.Member, referrer models.Member) error {
+	return c.db.Create(&models.ReferralCode{Project: member.Project, Code: member.Code, MemberID: referrer.ID,
+		MemberReferenceID: referrer.ReferenceID}).Error
+}
+
+func (takeCode) CheckReward(reward models.Reward) error {
+	return nil
+}
+
+func TestCodesTakenConcurrentlyAreRetried(t *testing.T) {
+	project := "policyraces"
+	fromReferenceID := service.MemberCodeGeneratorFunc(func(member models.Member, attempt int) (string, error) {
+		if attempt == 0 {
+			return strings.ToUpper(member.ReferenceID), nil
+		}
+		return fmt.Sprintf("%s%d", strings.ToUpper(member.ReferenceID), attempt), nil
+	})
+	racingService, err := go_referral.NewReferralService(db,
+		go_referral.WithSkipMigrations(),
+		go_referral.WithCodePolicy(project, service.CodePolicy{Generator: fromReferenceID}),
+		go_referral.WithFraudChecks(takeCode{db: db}))
+	assert.NoError(t, err)
+
+	referrer, err := racingService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "racer"})
+	assert.NoError(t, err)
+	member, err := racingService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "chaser", ReferrerCode: &referrer.Code})
+	assert.NoError(t, err)
+	assert.Equal(t, "CHASER1", member.Code)
+
+	var codes []models.ReferralCode
+	assert.NoError(t, db.Where("project = ? AND code LIKE ?", project, "CHASER%").Order("code").Find(&codes).Error)
+	assert.Equal(t, 2, len(codes))
+	assert.Equal(t, referrer.ID, codes[0].MemberID)
+	assert.Equal(t, member.ID, codes[1].MemberID)
+}
+
+func TestReferralCodes(t *testing.T) {
+	project := "referralcodes"
+	referrer, err := referralService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "code-referrer"})
+	assert.NoError(t, err)
+
+	twitter, limit, vanity := "twitter", int64(1), "TWEET1"
+	code, err := referralService.Codes.CreateReferralCode(project, referrer.ReferenceID, request.CreateReferralCodeRequest{Code: &vanity, Channel: &twitter, UsageLimit: &limit})
+	assert.NoError(t, err)
+	assert.False(t, code.IsPrimary)
+
+	_, err = referralService.Codes.CreateReferralCode(project, referrer.ReferenceID, request.CreateReferralCodeRequest{Code: &referrer.Code})
+	assert.True(t, errors.Is(err, errors.ErrConflict))
+	past := time.Now().Add(-time.Hour)
+	_, err = referralService.Codes.CreateReferralCode(project, referrer.ReferenceID, request.CreateReferralCodeRequest{ExpiresAt: &past})
+	assert.True(t, errors.Is(err, errors.ErrValidation))
+
+	referee, err := referralService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "code-referee", ReferrerCode: &vanity})
+	assert.NoError(t, err)
+	assert.Equal(t, referrer.ID, *referee.ReferredByMemberID)
+	assert.Equal(t, code.ID, *referee.ReferredByCodeID)
+
+	// The usage limit is reached
+	_, err = referralService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "code-late", ReferrerCode: &vanity})
+	assert.True(t, errors.Is(err, errors.ErrValidation))
+
+	codes, _, err := referralService.Codes.GetReferralCodes(request.GetReferralCodesRequest{Projects: []string{project}, Channel: &twitter})
+	assert.NoError(t, err)
+	if assert.Len(t, codes, 1) {
+		assert.Equal(t, int64(1), codes[0].UsageCount)
+	}
+
+	members, _, err := referralService.Members.GetMembers(request.GetMemberRequest{Projects: []string{project}, ReferredByCodeID: &code.ID})
+	assert.NoError(t, err)
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, "code-referee", members[0].ReferenceID)
+	}
+}
+
+func TestClickAttribution(t *testing.T) {
+	clickService, err := go_referral.NewReferralService(db,
+		go_referral.WithSkipMigrations(),
+		go_referral.WithAttributionPolicy("clicksfirst", service.AttributionPolicy{Model: service.FirstTouch}))
+	assert.NoError(t, err)
+
+	visitor, stale := "click-visitor", "click-stale"
+	hourAgo, monthsAgo := time.Now().Add(-time.Hour), time.Now().AddDate(0, -2, 0)
+	for _, project := range []string{"clickslast", "clicksfirst"} {
+		first := createReferrer(t, project, "click-first", nil, nil)
+		second := createReferrer(t, project, "click-second", nil, nil)
+
+		_, err = clickService.Codes.RecordClick(project, request.CreateClickRequest{Code: first.Code, VisitorID: visitor, ClickedAt: &hourAgo})
+		assert.NoError(t, err)
+		_, err = clickService.Codes.RecordClick(project, request.CreateClickRequest{Code: second.Code, VisitorID: visitor})
+		assert.NoError(t, err)
+		_, err = clickService.Codes.RecordClick(project, request.CreateClickRequest{Code: first.Code, VisitorID: stale, ClickedAt: &monthsAgo})
+		assert.NoError(t, err)
+	}
+
+	member, err := clickService.Members.CreateMember("clickslast", request.CreateMemberRequest{ReferenceID: "click-referee", VisitorID: &visitor})
+	assert.NoError(t, err)
+	assert.Equal(t, "click-second", *member.ReferredByMemberReferenceID)
+	member, err = clickService.Members.CreateMember("clicksfirst", request.CreateMemberRequest{ReferenceID: "click-referee", VisitorID: &visitor})
+	assert.NoError(t, err)
+	assert.Equal(t, "click-first", *member.ReferredByMemberReferenceID)
+
+	// Clicks out of the attribution window refer nobody
+	member, err = clickService.Members.CreateMember("clickslast", request.CreateMemberRequest{ReferenceID: "click-stale", VisitorID: &stale})
+	assert.NoError(t, err)
+	assert.Nil(t, member.ReferredByMemberID)
+
+	referenceID := "click-first"
+	stats, _, err := clickService.Codes.GetCodeStats(request.GetReferralCodesRequest{Projects: []string{"clicksfirst"}, MemberReferenceID: &referenceID})
+	assert.NoError(t, err)
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, int64(2), stats[0].Clicks)
+		assert.Equal(t, int64(2), stats[0].Visitors)
+		assert.Equal(t, int64(1), stats[0].Signups)
+	}
+}
+
+func TestAttachReferrer(t *testing.T) {
+	project := "attachreferrer"
+	referrer := createReferrer(t, project, "attach-referrer", nil, nil)
+	late := createReferrer(t, project, "attach-late", nil, nil)
+
+	_, err := referralService.Members.AttachReferrer(project, late.ReferenceID, request.AttachReferrerRequest{ReferrerCode: late.Code})
+	assert.True(t, errors.Is(err, errors.ErrValidation))
+
+	actor, eventsAfter := "support", true
+	member, err := referralService.Members.AttachReferrer(project, late.ReferenceID, request.AttachReferrerRequest{
+		ReferrerCode: referrer.Code, Actor: &actor, EventsAfterAttachment: &eventsAfter,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, referrer.ID, *member.ReferredByMemberID)
+	assert.NotNil(t, member.ReferrerAttachedAt)
+	assert.NotNil(t, member.RewardEventsFrom)
+
+	_, err = referralService.Members.AttachReferrer(project, late.ReferenceID, request.AttachReferrerRequest{ReferrerCode: referrer.Code})
+	assert.True(t, errors.Is(err, errors.ErrConflict))
+	// Attaching the referee as referrer of its referrer would close a cycle
+	_, err = referralService.Members.AttachReferrer(project, referrer.ReferenceID, request.AttachReferrerRequest{ReferrerCode: late.Code})
+	assert.True(t, errors.Is(err, errors.ErrValidation))
+
+	entries, _, err := referralService.Members.GetAuditLogs(request.GetAuditLogsRequest{Projects: []string{project}, MemberReferenceID: &late.ReferenceID})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, models.AuditActionAttachReferrer, entries[0].Action)
+		assert.Equal(t, actor, *entries[0].Actor)
+	}
+}
+
+func TestMemberSuspendAndBan(t *testing.T) {
+	project := "memberstatus"
+	member := createReferrer(t, project, "status-member", nil, nil)
+
+	actor, reason := "support", "chargebacks"
+	suspended, err := referralService.Members.ChangeMemberStatus(project, member.ReferenceID,
+		request.UpdateMemberStatusRequest{Status: models.MemberStatusSuspended, Actor: &actor, Reason: &reason})
+	assert.NoError(t, err)
+	assert.Equal(t, models.MemberStatusSuspended, suspended.Status)
+
+	for _, status := range []string{models.RewardStatusPending, models.RewardStatusOnHold} {
+		assert.NoError(t, db.Create(&models.Reward{
+			Project: project, CampaignID: 1, CurrencyCode: "USD", RewardedMemberID: member.ID,
+			RewardedMemberReferenceID: member.ReferenceID, RelatedMemberID: member.ID, RelatedMemberReferenceID: member.ReferenceID,
+			MemberType: "referrer", Amount: decimal.NewFromInt(5), Status: status,
+		}).Error)
+	}
+
+	// Banning forfeits the pending and held rewards, and is final
+	_, err = referralService.Members.ChangeMemberStatus(project, member.ReferenceID,
+		request.UpdateMemberStatusRequest{Status: models.MemberStatusBanned, Actor: &actor, Reason: &reason})
+	assert.NoError(t, err)
+	var forfeited int64
+	assert.NoError(t, db.Model(&models.Reward{}).Where("rewarded_member_id = ? AND status = ?", member.ID, models.RewardStatusForfeited).Count(&forfeited).Error)
+	assert.Equal(t, int64(2), forfeited)
+	_, err = referralService.Members.ChangeMemberStatus(project, member.ReferenceID, request.UpdateMemberStatusRequest{Status: models.MemberStatusActive})
+	assert.True(t, errors.Is(err, errors.ErrInvalidStateTransition))
+
+	entries, _, err := referralService.Members.GetAuditLogs(request.GetAuditLogsRequest{
+		Projects: []string{project}, Actions: []string{models.AuditActionStatusChange},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+// rejectionCounts counts the rewards rejected by the worker, by project and reason
+type rejectionCounts struct {
+	metricnoop.MeterProvider
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *rejectionCounts) Meter(string, ...metric.MeterOption) metric.Meter {
+	return rejectionMeter{counts: c}
+}
+
+func (c *rejectionCounts) get(project, reason string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[project+"/"+reason]
+}
+
+func (c *rejectionCounts) total(project string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for key, count := range c.counts {
+		if strings.HasPrefix(key, project+"/") {
+			total += count
+		}
+	}
+	return total
+}
+
+type rejectionMeter struct {
+	metricnoop.Meter
+	counts *rejectionCounts
+}
+
+func (m rejectionMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	if name != "referral.rewards.rejected" {
+		return metricnoop.Int64Counter{}, nil
+	}
+	return rejectionCounter{counts: m.counts}, nil
+}
+
+type rejectionCounter struct {
+	metricnoop.Int64Counter
+	counts *rejectionCounts
+}
+
+func (c rejectionCounter) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	attrs := metric.NewAddConfig(opts).Attributes()
+	project, _ := attrs.Value("referral.project")
+	reason, _ := attrs.Value("referral.reason")
+	c.counts.mu.Lock()
+	defer c.counts.mu.Unlock()
+	if c.counts.counts == nil {
+		c.counts.counts = map[string]int64{}
+	}
+	c.counts.counts[project.AsString()+"/"+reason.AsString()] += incr
+}
+
+// createDefaultCampaign creates the default campaign of project, rewarding referrers 5 USD for a signup event
+func createDefaultCampaign(t *testing.T, project string) *models.Campaign {
+	event := createEvent(t, project, request.CreateEventRequest{Key: project + "-signup", Name: "Signup", EventType: "simple"})
+	startDate := time.Now().UTC()
+	endDate := startDate.AddDate(0, 1, 0)
+	rewardType, rewardValue := "flat_fee", decimal.NewFromInt(5)
+	return createCampaign(t, project, request.CreateCampaignRequest{
+		Name:                    "Signup",
+		RewardType:              &rewardType,
+		RewardValue:             &rewardValue,
+		CurrencyCode:            "USD",
+		StartDate:               &startDate,
+		EndDate:                 &endDate,
+		IsDefault:               true,
+		CampaignTypePerCustomer: "forever",
+		EventKeys:               []string{event.Key},
+	})
+}
+
+func TestWorkerSettlesBannedMembers(t *testing.T) {
+	project := "workerbanned"
+	counts := &rejectionCounts{}
+	counted, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithMeterProvider(counts))
+	assert.NoError(t, err)
+	createDefaultCampaign(t, project)
+	referrer := createReferrer(t, project, "banned-referrer", nil, nil)
+	createReferee(t, project, referrer.Code, "banned-referee", nil)
+	_, err = referralService.Members.ChangeMemberStatus(project, "banned-referee", request.UpdateMemberStatusRequest{Status: models.MemberStatusBanned})
+	assert.NoError(t, err)
+	eventLog, _ := triggerEvent(t, project, project+"-signup", "banned-referee", nil, nil)
+
+	// The logs are settled on the first pass, and counted once
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, counted.Worker.ProcessPendingEvents())
+	}
+	assert.Equal(t, int64(1), counts.get(project, "banned"))
+	var settled models.EventLog
+	assert.NoError(t, db.First(&settled, eventLog.ID).Error)
+	assert.Equal(t, models.EventLogStatusFailed, settled.Status)
+	assert.Equal(t, "member banned", *settled.FailureReason)
+}
+
+func TestWorkerKeepsLogsWithoutReferrer(t *testing.T) {
+	project := "workernoreferrer"
+	counts := &rejectionCounts{}
+	counted, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithMeterProvider(counts))
+	assert.NoError(t, err)
+	createDefaultCampaign(t, project)
+	referrer := createReferrer(t, project, "noreferrer-referrer", nil, nil)
+	createReferrer(t, project, "noreferrer-member", nil, nil)
+	eventLog, _ := triggerEvent(t, project, project+"-signup", "noreferrer-member", nil, nil)
+
+	// A referrer may still be attached, so the logs stay pending without being counted as rejected
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, counted.Worker.ProcessPendingEvents())
+	}
+	assert.Equal(t, int64(0), counts.total(project))
+	var pending models.EventLog
+	assert.NoError(t, db.First(&pending, eventLog.ID).Error)
+	assert.Equal(t, models.EventLogStatusPending, pending.Status)
+
+	_, err = referralService.Members.AttachReferrer(project, "noreferrer-member", request.AttachReferrerRequest{ReferrerCode: referrer.Code})
+	assert.NoError(t, err)
+	assert.NoError(t, counted.Worker.ProcessPendingEvents())
+	rewards, _, err := referralService.Reward.GetRewards(request.GetRewardRequest{Projects: []string{project}})
+	assert.NoError(t, err)
+	assert.Len(t, rewards, 1)
+}
+
+func TestWorkerSettlesLogsWithoutReferrerAfterGracePeriod(t *testing.T) {
+	project := "workernoreferrergrace"
+	fake := clocktest.NewFake(time.Now())
+	clockedService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithClock(fake),
+		go_referral.WithLateReferralPolicy(project, service.LateReferralPolicy{GracePeriod: time.Hour}))
+	assert.NoError(t, err)
+	createDefaultCampaign(t, project)
+	_, err = clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "noreferrergrace-member"})
+	assert.NoError(t, err)
+	fake.Advance(time.Minute)
+	eventLog, err := clockedService.EventLogs.CreateEventLog(project, request.CreateEventLogRequest{EventKey: project + "-signup", ReferenceID: "noreferrergrace-member"})
+	assert.NoError(t, err)
+
+	// Pending while a referrer may be attached, then settled without a reward
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	var settled models.EventLog
+	assert.NoError(t, db.First(&settled, eventLog.ID).Error)
+	assert.Equal(t, models.EventLogStatusPending, settled.Status)
+
+	fake.Advance(2 * time.Hour)
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	assert.NoError(t, db.First(&settled, eventLog.ID).Error)
+	assert.Equal(t, models.EventLogStatusFailed, settled.Status)
+	assert.Equal(t, "no referrer attached", *settled.FailureReason)
+}
+
+func TestWorkerSettlesCodesOfOtherCampaigns(t *testing.T) {
+	project := "workercodecampaign"
+	counts := &rejectionCounts{}
+	counted, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithMeterProvider(counts))
+	assert.NoError(t, err)
+	campaign := createDefaultCampaign(t, project)
+	other := createCampaign(t, project, request.CreateCampaignRequest{
+		Name:                    "Other",
+		RewardType:              campaign.RewardType,
+		RewardValue:             campaign.RewardValue,
+		CurrencyCode:            "USD",
+		StartDate:               campaign.StartDate,
+		EndDate:                 campaign.EndDate,
+		CampaignTypePerCustomer: "forever",
+		EventKeys:               []string{project + "-signup"},
+	})
+	referrer := createReferrer(t, project, "codecampaign-referrer", nil, nil)
+	code, err := referralService.Codes.CreateReferralCode(project, referrer.ReferenceID, request.CreateReferralCodeRequest{CampaignID: &other.ID})
+	assert.NoError(t, err)
+	_, err = referralService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "codecampaign-referee", ReferrerCode: &code.Code})
+	assert.NoError(t, err)
+	eventLog, _ := triggerEvent(t, project, project+"-signup", "codecampaign-referee", nil, nil)
+
+	// The default campaign settles the logs for itself on the first pass, and counts them once
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, counted.Worker.ProcessPendingEvents())
+	}
+	assert.Equal(t, int64(1), counts.get(project, "code_campaign"))
+	var settled []models.CampaignEventLog
+	assert.NoError(t, db.Where("event_log_id = ?", eventLog.ID).Find(&settled).Error)
+	if assert.Len(t, settled, 1) {
+		assert.Equal(t, campaign.ID, settled[0].CampaignID)
+		assert.Equal(t, models.CampaignEventLogStatusRejected, settled[0].Status)
+		assert.Nil(t, settled[0].ReferredRewardID)
+	}
+}
+
+func TestWorkerSettlesLogsBeforeAttachment(t *testing.T) {
+	project := "workerbeforeattachment"
+	createDefaultCampaign(t, project)
+	fake := clocktest.NewFake(time.Now())
+	clockedService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithClock(fake))
+	assert.NoError(t, err)
+	referrer := createReferrer(t, project, "beforeattachment-referrer", nil, nil)
+	createReferrer(t, project, "beforeattachment-member", nil, nil)
+	before, err := clockedService.EventLogs.CreateEventLog(project, request.CreateEventLogRequest{EventKey: project + "-signup", ReferenceID: "beforeattachment-member"})
+	assert.NoError(t, err)
+
+	fake.Advance(time.Minute)
+	eventsAfter := true
+	_, err = clockedService.Members.AttachReferrer(project, "beforeattachment-member", request.AttachReferrerRequest{
+		ReferrerCode: referrer.Code, EventsAfterAttachment: &eventsAfter,
+	})
+	assert.NoError(t, err)
+	fake.Advance(time.Minute)
+	after, err := clockedService.EventLogs.CreateEventLog(project, request.CreateEventLogRequest{EventKey: project + "-signup", ReferenceID: "beforeattachment-member"})
+	assert.NoError(t, err)
+
+	// The log triggered before the attachment is settled without a reward, and the next passes leave it alone
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	}
+	var settled models.EventLog
+	assert.NoError(t, db.First(&settled, before.ID).Error)
+	assert.Equal(t, models.EventLogStatusFailed, settled.Status)
+	assert.Equal(t, "triggered before the referrer was attached", *settled.FailureReason)
+
+	rewards, _, err := referralService.Reward.GetRewards(request.GetRewardRequest{Projects: []string{project}})
+	assert.NoError(t, err)
+	assert.Len(t, rewards, 1)
+	var processed []models.CampaignEventLog
+	assert.NoError(t, db.Where("event_log_id IN (?)", []uint{before.ID, after.ID}).Find(&processed).Error)
+	if assert.Len(t, processed, 1) {
+		assert.Equal(t, after.ID, processed[0].EventLogID)
+	}
+}
+
+func TestInactiveReferrerHold(t *testing.T) {
+	project := "inactivereferrer"
+	fake := clocktest.NewFake(time.Date(2025, 2, 20, 12, 0, 0, 0, time.UTC))
+	clockedService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithClock(fake))
+	assert.NoError(t, err)
+
+	_, err = clockedService.Events.CreateEvent(project, request.CreateEventRequest{Key: "signup", Name: "Signup", EventType: "simple"})
+	assert.NoError(t, err)
+
+	startDate := fake.Now()
+	endDate := startDate.AddDate(0, 1, 0)
+	rewardType := "flat_fee"
+	rewardValue := decimal.NewFromInt(10)
+	holdDays := 7
+	_, err = clockedService.Campaigns.CreateCampaign(project, request.CreateCampaignRequest{
+		Name:                     "Held for inactive referrers",
+		RewardType:               &rewardType,
+		RewardValue:              &rewardValue,
+		CurrencyCode:             "USDC",
+		StartDate:                &startDate,
+		EndDate:                  &endDate,
+		IsDefault:                true,
+		CampaignTypePerCustomer:  "forever",
+		InactiveReferrerHoldDays: &holdDays,
+		EventKeys:                []string{"signup"},
+	})
+	assert.NoError(t, err)
+
+	referrer, err := clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "inactive-referrer"})
+	assert.NoError(t, err)
+	_, err = clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "inactive-referee", ReferrerCode: &referrer.Code})
+	assert.NoError(t, err)
+	_, err = clockedService.Members.UpdateMemberStatus(project, referrer.ReferenceID, models.MemberStatusInactive)
+	assert.NoError(t, err)
+
+	fake.Advance(time.Minute)
+	_, err = clockedService.EventLogs.CreateEventLog(project, request.CreateEventLogRequest{EventKey: "signup", ReferenceID: "inactive-referee"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	rewardReq := request.GetRewardRequest{Projects: []string{project}}
+	rewards, _, err := clockedService.Reward.GetRewards(rewardReq)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(rewards)) {
+		assert.Equal(t, models.RewardStatusOnHold, rewards[0].Status)
+		assert.NotNil(t, rewards[0].HoldExpiresAt)
+	}
+
+	// The referrer was not reactivated within the hold days
+	fake.AddDate(0, 0, holdDays+1)
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	rewards, _, err = clockedService.Reward.GetRewards(rewardReq)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(rewards)) {
+		assert.Equal(t, models.RewardStatusForfeited, rewards[0].Status)
+	}
+}
+
+func TestSuspendedReferrerDeactivated(t *testing.T) {
+	project := "suspendedreferrer"
+	fake := clocktest.NewFake(time.Date(2025, 2, 20, 12, 0, 0, 0, time.UTC))
+	clockedService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithClock(fake))
+	assert.NoError(t, err)
+
+	_, err = clockedService.Events.CreateEvent(project, request.CreateEventRequest{Key: "signup", Name: "Signup", EventType: "simple"})
+	assert.NoError(t, err)
+
+	startDate := fake.Now()
+	endDate := startDate.AddDate(0, 1, 0)
+	rewardType := "flat_fee"
+	rewardValue := decimal.NewFromInt(10)
+	holdDays := 7
+	_, err = clockedService.Campaigns.CreateCampaign(project, request.CreateCampaignRequest{
+		Name:                     "Held for suspended referrers",
+		RewardType:               &rewardType,
+		RewardValue:              &rewardValue,
+		CurrencyCode:             "USDC",
+		StartDate:                &startDate,
+		EndDate:                  &endDate,
+		IsDefault:                true,
+		CampaignTypePerCustomer:  "forever",
+		InactiveReferrerHoldDays: &holdDays,
+		EventKeys:                []string{"signup"},
+	})
+	assert.NoError(t, err)
+
+	referrer, err := clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "suspended-referrer"})
+	assert.NoError(t, err)
+	_, err = clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "suspended-referee", ReferrerCode: &referrer.Code})
+	assert.NoError(t, err)
+	_, err = clockedService.Members.UpdateMemberStatus(project, referrer.ReferenceID, models.MemberStatusSuspended)
+	assert.NoError(t, err)
+
+	fake.Advance(time.Minute)
+	_, err = clockedService.EventLogs.CreateEventLog(project, request.CreateEventLogRequest{EventKey: "signup", ReferenceID: "suspended-referee"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	rewardReq := request.GetRewardRequest{Projects: []string{project}}
+	rewards, _, err := clockedService.Reward.GetRewards(rewardReq)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(rewards)) {
+		assert.Equal(t, models.RewardStatusOnHold, rewards[0].Status)
+		assert.Nil(t, rewards[0].HoldExpiresAt)
+	}
+
+	// Deactivating the referrer holds its rewards for the hold days of the campaign, as if it was inactive then
+	_, err = clockedService.Members.UpdateMemberStatus(project, referrer.ReferenceID, models.MemberStatusInactive)
+	assert.NoError(t, err)
+	rewards, _, err = clockedService.Reward.GetRewards(rewardReq)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(rewards)) && assert.NotNil(t, rewards[0].HoldExpiresAt) {
+		assert.True(t, fake.Now().AddDate(0, 0, holdDays).Equal(*rewards[0].HoldExpiresAt))
+	}
+
+	fake.AddDate(0, 0, holdDays+1)
+	assert.NoError(t, clockedService.Worker.ProcessPendingEvents())
+	rewards, _, err = clockedService.Reward.GetRewards(rewardReq)
+	assert.NoError(t, err)
+	if assert.Equal(t, 1, len(rewards)) {
+		assert.Equal(t, models.RewardStatusForfeited, rewards[0].Status)
+	}
+}
+
+func TestMemberAttributes(t *testing.T) {
+	project := "memberattributes"
+	member, err := referralService.Members.CreateMember(project, request.CreateMemberRequest{
+		ReferenceID: "attributes-member",
+		Attributes:  models.Attributes{"country": "FR", "kyc_level": 2, "vip": true},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "FR", member.Attributes["country"])
+	_, err = referralService.Members.CreateMember(project, request.CreateMemberRequest{
+		ReferenceID: "attributes-other",
+		Attributes:  models.Attributes{"country": "DE", "kyc_level": 1},
+	})
+	assert.NoError(t, err)
+	_, err = referralService.Members.CreateMember(project, request.CreateMemberRequest{
+		ReferenceID: "attributes-invalid",
+		Attributes:  models.Attributes{"tags": []string{"a"}},
+	})
+	assert.True(t, errors.Is(err, errors.ErrValidation))
+
+	members, _, err := referralService.Members.GetMembers(request.GetMemberRequest{
+		Projects:   []string{project},
+		Attributes: map[string]string{"kyc_level": "2", "vip": "true"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, member.ID, members[0].ID)
+	}
+
+	// Null removes an attribute, and the index follows
+	_, err = referralService.Members.UpdateMember(project, member.ReferenceID, request.UpdateMemberRequest{Attributes: models.Attributes{"vip": nil}})
+	assert.NoError(t, err)
+	members, _, err = referralService.Members.GetMembers(request.GetMemberRequest{
+		Projects:   []string{project},
+		Attributes: map[string]string{"vip": "true"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, members, 0)
+}
+
+func TestEnrollments(t *testing.T) {
+	project := "enrollments"
+	fake := clocktest.NewFake(time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC))
+	clockedService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithClock(fake))
+	assert.NoError(t, err)
+
+	_, err = clockedService.Events.CreateEvent(project, request.CreateEventRequest{Key: "signup", Name: "Signup", EventType: "simple"})
+	assert.NoError(t, err)
+
+	startDate := fake.Now()
+	endDate := startDate.AddDate(0, 1, 0)
+	rewardType := "flat_fee"
+	rewardValue := decimal.NewFromInt(10)
+	campaign, err := clockedService.Campaigns.CreateCampaign(project, request.CreateCampaignRequest{
+		Name:                    "Enrollment",
+		RewardType:              &rewardType,
+		RewardValue:             &rewardValue,
+		CurrencyCode:            "USDC",
+		StartDate:               &startDate,
+		EndDate:                 &endDate,
+		CampaignTypePerCustomer: "forever",
+		EventKeys:               []string{"signup"},
+	})
+	assert.NoError(t, err)
+
+	_, err = clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "enrolled-one", Attributes: models.Attributes{"tier": "gold"}})
+	assert.NoError(t, err)
+	_, err = clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "enrolled-two", Attributes: models.Attributes{"tier": "gold"}})
+	assert.NoError(t, err)
+
+	_, err = clockedService.Members.EnrollMember(project, "enrolled-one", campaign.ID)
+	assert.NoError(t, err)
+	_, err = clockedService.Members.EnrollMember(project, "enrolled-one", campaign.ID)
+	assert.True(t, errors.Is(err, errors.ErrConflict))
+
+	fake.Advance(time.Hour)
+	ended, err := clockedService.Members.UnenrollMember(project, "enrolled-one", campaign.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, ended.EndedAt)
+	_, err = clockedService.Members.UnenrollMember(project, "enrolled-one", campaign.ID)
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+	_, err = clockedService.Members.EnrollMember(project, "enrolled-one", campaign.ID)
+	assert.NoError(t, err)
+
+	result, err := clockedService.Members.EnrollMembers(project, campaign.ID, request.GetMemberRequest{Attributes: map[string]string{"tier": "gold"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Matched)
+	assert.Equal(t, 1, result.Enrolled)
+	assert.Equal(t, 1, result.AlreadyEnrolled)
+
+	member := "enrolled-one"
+	history, _, err := clockedService.Members.GetEnrollments(request.GetEnrollmentsRequest{Projects: []string{project}, MemberReferenceID: &member})
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	members, _, err := clockedService.Members.GetMembers(request.GetMemberRequest{Projects: []string{project}, CampaignIDs: []uint{campaign.ID}})
+	assert.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	// Members are created and updated only with the campaigns of their project that are not archived
+	archived, err := clockedService.Campaigns.CreateCampaign(project, request.CreateCampaignRequest{
+		Name:                    "Archived",
+		RewardType:              &rewardType,
+		RewardValue:             &rewardValue,
+		CurrencyCode:            "USDC",
+		StartDate:               &startDate,
+		EndDate:                 &endDate,
+		CampaignTypePerCustomer: "forever",
+		EventKeys:               []string{"signup"},
+	})
+	assert.NoError(t, err)
+	_, err = clockedService.Campaigns.UpdateCampaignStatus(project, archived.ID, "archived")
+	assert.NoError(t, err)
+
+	_, err = clockedService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "enrolled-archived", CampaignIDs: []uint{archived.ID}})
+	assert.True(t, errors.Is(err, errors.ErrConflict))
+	_, err = clockedService.Members.CreateMember("enrollmentsother", request.CreateMemberRequest{ReferenceID: "enrolled-other", CampaignIDs: []uint{campaign.ID}})
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+	_, err = clockedService.Members.UpdateMember(project, "enrolled-two", request.UpdateMemberRequest{CampaignIDs: []uint{campaign.ID, archived.ID}})
+	assert.True(t, errors.Is(err, errors.ErrConflict))
+	_, err = clockedService.Members.UpdateMember(project, "enrolled-two", request.UpdateMemberRequest{CampaignIDs: []uint{campaign.ID + archived.ID}})
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+
+	// The campaigns a member stays enrolled in may have been archived since
+	_, err = clockedService.Campaigns.UpdateCampaignStatus(project, campaign.ID, "archived")
+	assert.NoError(t, err)
+	_, err = clockedService.Members.UpdateMember(project, "enrolled-two", request.UpdateMemberRequest{CampaignIDs: []uint{campaign.ID}})
+	assert.NoError(t, err)
+}
+
+func TestForgetMember(t *testing.T) {
+	project := "forgetmember"
+	email := "forget@example.com"
+	referrer := createReferrer(t, project, "forget-referrer", nil, nil)
+	_, err := referralService.Members.CreateMember(project, request.CreateMemberRequest{
+		ReferenceID:  "forget-referee",
+		Email:        &email,
+		ReferrerCode: &referrer.Code,
+		Attributes:   models.Attributes{"plan": "pro"},
+	})
+	assert.NoError(t, err)
+
+	var export bytes.Buffer
+	assert.NoError(t, referralService.Members.ExportMemberData(&export, project, "forget-referee"))
+	assert.Contains(t, export.String(), email)
+
+	forgotten, err := referralService.Members.ForgetMember(project, "forget-referee", request.ForgetMemberRequest{})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(forgotten.ReferenceID, "forgotten-"))
+	assert.Nil(t, forgotten.Email)
+	assert.Nil(t, forgotten.Attributes)
+
+	_, err = referralService.Members.ForgetMember(project, "forget-referee", request.ForgetMemberRequest{})
+	assert.True(t, errors.Is(err, errors.ErrNotFound))
+
+	// The referrer now refers the pseudonym
+	downline, err := referralService.Members.GetDownline(project, "forget-referrer", 1)
+	assert.NoError(t, err)
+	assert.NotContains(t, fmt.Sprint(downline), "forget-referee")
+
+	// The pseudonym is random, not derived from the reference ID
+	_, err = referralService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "forget-referee"})
+	assert.NoError(t, err)
+	forgottenAgain, err := referralService.Members.ForgetMember(project, "forget-referee", request.ForgetMemberRequest{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, forgotten.ReferenceID, forgottenAgain.ReferenceID)
+}
+
+func TestEncryptedEmail(t *testing.T) {
+	project := "encryptedemail"
+	key := func(b byte) []byte { return bytes.Repeat([]byte{b}, encryption.KeySize) }
+	provider, err := encryption.NewStaticKeyProvider("test", map[string][]byte{"test": key(7)}, key(9))
+	assert.NoError(t, err)
+
+	// A member stored before encryption was enabled
+	plainEmail := "plain@example.com"
+	_, err = referralService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "plain-member", Email: &plainEmail})
+	assert.NoError(t, err)
+
+	encryptingService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithKeyProvider(provider))
+	assert.NoError(t, err)
+	email := "encrypted@example.com"
+	_, err = encryptingService.Members.CreateMember(project, request.CreateMemberRequest{ReferenceID: "encrypted-member", Email: &email})
+	assert.NoError(t, err)
+
+	storedEmail := func(referenceID string) string {
+		var stored string
+		assert.NoError(t, db.Table(models.Table(db, "members")).Select("email").
+			Where("project = ? AND reference_id = ?", project, referenceID).Scan(&stored).Error)
+		return stored
+	}
+	assert.True(t, strings.HasPrefix(storedEmail("encrypted-member"), "enc:v1:test:"))
+	// The provider is that of encryptingService only
+	assert.Equal(t, plainEmail, storedEmail("plain-member"))
+
+	// Members are looked up by email, whether stored before or after encryption was enabled
+	lookUp := func(service *go_referral.ReferralService, email, referenceID string) {
+		members, _, err := service.Members.GetMembers(request.GetMemberRequest{Projects: []string{project}, Email: &email})
+		assert.NoError(t, err)
+		if assert.Len(t, members, 1) {
+			assert.Equal(t, referenceID, members[0].ReferenceID)
+			assert.Equal(t, email, *members[0].Email)
+		}
+	}
+	lookUp(encryptingService, email, "encrypted-member")
+	lookUp(encryptingService, plainEmail, "plain-member")
+
+	// After a rotation, the values of the former key are read with it until they are re-encrypted
+	rotated, err := encryption.NewStaticKeyProvider("rotated", map[string][]byte{"test": key(7), "rotated": key(8)}, key(9))
+	assert.NoError(t, err)
+	rotatedService, err := go_referral.NewReferralService(db, go_referral.WithSkipMigrations(), go_referral.WithKeyProvider(rotated))
+	assert.NoError(t, err)
+	lookUp(rotatedService, email, "encrypted-member")
+	lookUp(rotatedService, plainEmail, "plain-member")
+
+	result, err := go_referral.ReencryptPII(db, go_referral.WithKeyProvider(rotated))
+	assert.NoError(t, err)
+	assert.NotZero(t, result.Members)
+	assert.True(t, strings.HasPrefix(storedEmail("encrypted-member"), "enc:v1:rotated:"))
+	assert.True(t, strings.HasPrefix(storedEmail("plain-member"), "enc:v1:rotated:"))
+	lookUp(rotatedService, email, "encrypted-member")
+	lookUp(rotatedService, plainEmail, "plain-member")
+}
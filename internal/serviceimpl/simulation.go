@@ -0,0 +1,112 @@
+package serviceimpl
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/internal/telemetry"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// errSimulationDone rolls back the transaction wrapping a simulation
+var errSimulationDone = errors.New("simulation done")
+
+// Simulate runs the worker over one campaign and the pending event logs triggered in [req.From, req.To), in a
+// transaction that is rolled back. An unsaved campaign is created in that transaction. The pass applies the fraud
+// checks, but does not call the hooks, record metrics or log its rejections.
+func (w *worker) Simulate(project string, req request.SimulateRequest) (*response.Simulation, error) {
+	if req.CampaignID == nil && req.Campaign == nil {
+		return nil, errors.Invalid("campaign", errors.CodeRequired, "either campaignID or campaign is required")
+	}
+	if req.CampaignID != nil && req.Campaign != nil {
+		return nil, errors.Invalid("campaign", errors.CodeInvalid, "campaignID and campaign are mutually exclusive")
+	}
+	if !req.To.After(req.From) {
+		return nil, errors.Invalid("to", errors.CodeInvalid, "to must be after from")
+	}
+
+	result := &response.Simulation{Rewards: []models.Reward{}, Rejections: map[string]int64{}}
+	err := w.DB.Transaction(func(tx *gorm.DB) error {
+		simulated := &worker{
+			Config: &Config{
+				DB:            tx,
+				Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+				Clock:         w.Clock,
+				Telemetry:     telemetry.Noop(),
+				CodeGenerator: w.CodeGenerator,
+				CodePolicies:  w.CodePolicies,
+				FraudChecks:   w.FraudChecks,
+				LateReferral:  w.LateReferral,
+				Naming:        w.Naming,
+			},
+			simulation: result,
+		}
+
+		campaign, err := simulated.simulatedCampaign(project, req)
+		if err != nil {
+			return err
+		}
+		simulated.processCampaign(*campaign, triggeredBetween(req.From, req.To))
+
+		if campaign.Budget != nil {
+			var spent decimal.Decimal
+			if err := tx.Model(&models.Reward{}).
+				Select("COALESCE(SUM(amount), 0)").
+				Where("campaign_id = ? AND status <> ?", campaign.ID, models.RewardStatusForfeited).
+				Scan(&spent).Error; err != nil {
+				return fmt.Errorf("failed to calculate total rewards: %w", err)
+			}
+			remaining := campaign.Budget.Sub(spent)
+			result.Budget = campaign.Budget
+			result.RemainingBudget = &remaining
+		}
+		if req.CampaignID != nil {
+			result.CampaignID = campaign.ID
+		}
+		return errSimulationDone
+	})
+	if !errors.Is(err, errSimulationDone) {
+		return nil, err
+	}
+
+	// The rewards were rolled back: drop their IDs, and the ID of an unsaved campaign
+	for i := range result.Rewards {
+		result.Rewards[i].ID = 0
+		result.Rewards[i].CampaignID = result.CampaignID
+	}
+	return result, nil
+}
+
+// simulatedCampaign fetches the saved campaign of req or creates its unsaved one, with the campaign's events
+func (w *worker) simulatedCampaign(project string, req request.SimulateRequest) (*models.Campaign, error) {
+	id := req.CampaignID
+	if id == nil {
+		created, err := NewCampaignService(w.Config).CreateCampaign(project, *req.Campaign)
+		if err != nil {
+			return nil, err
+		}
+		id = &created.ID
+	}
+
+	var campaign models.Campaign
+	if err := w.DB.Preload("Events").Where("project = ? AND id = ?", project, *id).First(&campaign).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.NotFound("campaign", "project=%s and id=%d", project, *id)
+		}
+		return nil, fmt.Errorf("failed to fetch campaign: %w", err)
+	}
+	return &campaign, nil
+}
+
+// triggeredBetween selects the event logs of a pass triggered in [from, to)
+func triggeredBetween(from, to time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("el.triggered_at >= ? AND el.triggered_at < ?", from, to)
+	}
+}
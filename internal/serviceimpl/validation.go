@@ -0,0 +1,350 @@
+package serviceimpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/service"
+	"github.com/shopspring/decimal"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var validEventKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// The validators below check a request on its own and record every problem they find. Checks that need the
+// database (e.g. whether event keys exist) are added by the service to the same *errors.ValidationError before
+// it is returned.
+
+func validateCreateCampaignRequest(req request.CreateCampaignRequest, now time.Time) *errors.ValidationError {
+	v := &errors.ValidationError{}
+
+	if req.Name == "" {
+		v.Add("name", errors.CodeRequired, "name is required")
+	}
+	if req.CurrencyCode == "" {
+		v.Add("currencyCode", errors.CodeRequired, "currencyCode is required")
+	}
+	if req.RewardType == nil && req.InviteeRewardType == nil {
+		v.Add("rewardType", errors.CodeRequired, "either rewardType or inviteeRewardType must be provided")
+	}
+
+	validateRewardTerms(v, "reward", req.RewardType, req.RewardValue, req.RewardCap, req.RewardCapPerCustomer, true)
+	validateRewardTerms(v, "inviteeReward", req.InviteeRewardType, req.InviteeRewardValue, req.InviteeRewardCap, req.RewardCapPerCustomer, true)
+	validateCustomerLimits(v, req.CampaignTypePerCustomer, req.ValidityMonthsPerCustomer, req.MaxOccurrencesPerCustomer)
+	validateBudget(v, req.Budget, req.RewardCapPerCustomer)
+	validateInactiveReferrerPolicy(v, req.InactiveReferrerPolicy, req.InactiveReferrerHoldDays)
+
+	validateCampaignDates(v, req.StartDate, req.EndDate, now)
+
+	if len(req.EventKeys) == 0 {
+		v.Add("eventKeys", errors.CodeRequired, "eventKeys must be provided")
+	}
+
+	return v
+}
+
+func validateUpdateCampaignRequest(req request.UpdateCampaignRequest, now time.Time) *errors.ValidationError {
+	v := &errors.ValidationError{}
+
+	if req.Name != nil && *req.Name == "" {
+		v.Add("name", errors.CodeRequired, "name cannot be empty")
+	}
+	if req.CurrencyCode != nil && *req.CurrencyCode == "" {
+		v.Add("currencyCode", errors.CodeRequired, "currencyCode cannot be empty")
+	}
+	if req.Status != nil && *req.Status != "active" && *req.Status != "paused" && *req.Status != "archived" {
+		v.Add("status", errors.CodeInvalid, "status must be either 'active', 'paused', or 'archived'")
+	}
+
+	// The reward type and value may be updated separately, the invitee reward ones only together
+	validateRewardTerms(v, "reward", req.RewardType, req.RewardValue, req.RewardCap, req.RewardCapPerCustomer, false)
+	validateRewardTerms(v, "inviteeReward", req.InviteeRewardType, req.InviteeRewardValue, req.InviteeRewardCap, req.RewardCapPerCustomer, true)
+	if req.CampaignTypePerCustomer != nil {
+		validateCustomerLimits(v, *req.CampaignTypePerCustomer, req.ValidityMonthsPerCustomer, req.MaxOccurrencesPerCustomer)
+	}
+	validateBudget(v, req.Budget, req.RewardCapPerCustomer)
+	validateInactiveReferrerPolicy(v, req.InactiveReferrerPolicy, req.InactiveReferrerHoldDays)
+	validateCampaignDates(v, req.StartDate, req.EndDate, now)
+
+	return v
+}
+
+// validateRewardTerms checks the type, value and cap of the reward (prefix "reward") or of the invitee reward
+// (prefix "inviteeReward"). With requirePair, the type and value must be provided together.
+func validateRewardTerms(v *errors.ValidationError, prefix string, rewardType *string, value, cap, capPerCustomer *decimal.Decimal, requirePair bool) {
+	typeField, valueField, capField := prefix+"Type", prefix+"Value", prefix+"Cap"
+
+	if requirePair && (rewardType == nil) != (value == nil) {
+		missing := valueField
+		if rewardType == nil {
+			missing = typeField
+		}
+		v.Add(missing, errors.CodeRequired, fmt.Sprintf("both %s and %s must be provided or omitted", typeField, valueField))
+	}
+
+	if rewardType != nil && *rewardType != "flat_fee" && *rewardType != "percentage" {
+		v.Add(typeField, errors.CodeInvalid, fmt.Sprintf("%s must be either 'flat_fee' or 'percentage'", typeField))
+	}
+
+	if value != nil && value.Cmp(decimal.Zero) <= 0 {
+		v.Add(valueField, errors.CodeOutOfRange, fmt.Sprintf("%s must be greater than zero", valueField))
+	}
+
+	if rewardType == nil {
+		return
+	}
+
+	switch *rewardType {
+	case "percentage":
+		if value != nil && value.Cmp(decimal.NewFromInt(100)) > 0 {
+			v.Add(valueField, errors.CodeOutOfRange, fmt.Sprintf("percentage %s must be between 0 and 100", valueField))
+		}
+		if cap != nil && cap.Cmp(decimal.Zero) <= 0 {
+			v.Add(capField, errors.CodeOutOfRange, fmt.Sprintf("%s must be greater than zero", capField))
+		} else if cap != nil && capPerCustomer != nil && cap.Cmp(*capPerCustomer) > 0 {
+			v.Add(capField, errors.CodeOutOfRange, fmt.Sprintf("%s must be less than or equal to rewardCapPerCustomer", capField))
+		}
+	case "flat_fee":
+		if cap != nil {
+			v.Add(capField, errors.CodeNotAllowed, fmt.Sprintf("%s must be nil for flat_fee %s", capField, typeField))
+		}
+	}
+}
+
+func validateCustomerLimits(v *errors.ValidationError, campaignType string, validityMonths *int, maxOccurrences *int64) {
+	switch campaignType {
+	case "one_time", "forever":
+		if validityMonths != nil {
+			v.Add("validityMonthsPerCustomer", errors.CodeNotAllowed, fmt.Sprintf("validityMonthsPerCustomer must be nil for '%s' campaignTypePerCustomer", campaignType))
+		}
+		if maxOccurrences != nil {
+			v.Add("maxOccurrencesPerCustomer", errors.CodeNotAllowed, fmt.Sprintf("maxOccurrencesPerCustomer must be nil for '%s' campaignTypePerCustomer", campaignType))
+		}
+	case "months_per_customer":
+		if validityMonths == nil {
+			v.Add("validityMonthsPerCustomer", errors.CodeRequired, "validityMonthsPerCustomer is required for 'months_per_customer' campaignTypePerCustomer")
+		}
+		if maxOccurrences != nil {
+			v.Add("maxOccurrencesPerCustomer", errors.CodeNotAllowed, "maxOccurrencesPerCustomer must be nil for 'months_per_customer' campaignTypePerCustomer")
+		}
+	case "count_per_customer":
+		if maxOccurrences == nil {
+			v.Add("maxOccurrencesPerCustomer", errors.CodeRequired, "maxOccurrencesPerCustomer is required for 'count_per_customer' campaignTypePerCustomer")
+		}
+		if validityMonths != nil {
+			v.Add("validityMonthsPerCustomer", errors.CodeNotAllowed, "validityMonthsPerCustomer must be nil for 'count_per_customer' campaignTypePerCustomer")
+		}
+	default:
+		v.Add("campaignTypePerCustomer", errors.CodeInvalid, "campaignTypePerCustomer must be 'one_time', 'forever', 'months_per_customer', or 'count_per_customer'")
+	}
+}
+
+func validateBudget(v *errors.ValidationError, budget, capPerCustomer *decimal.Decimal) {
+	if budget == nil {
+		return
+	}
+	if budget.Cmp(decimal.Zero) <= 0 {
+		v.Add("budget", errors.CodeOutOfRange, "budget must be greater than zero")
+	} else if capPerCustomer != nil && capPerCustomer.Cmp(*budget) > 0 {
+		v.Add("rewardCapPerCustomer", errors.CodeOutOfRange, "rewardCapPerCustomer must be less than or equal to budget")
+	}
+}
+
+// validateInactiveReferrerPolicy checks the policy of a campaign for the rewards of inactive referrers, whose hold days
+// only apply to held rewards
+func validateInactiveReferrerPolicy(v *errors.ValidationError, policy *string, holdDays *int) {
+	if policy != nil && *policy != models.InactiveReferrerForfeit && *policy != models.InactiveReferrerHold {
+		v.Add("inactiveReferrerPolicy", errors.CodeInvalid, "inactiveReferrerPolicy must be either 'forfeit' or 'hold'")
+	}
+	if holdDays == nil {
+		return
+	}
+	if *holdDays <= 0 {
+		v.Add("inactiveReferrerHoldDays", errors.CodeOutOfRange, "inactiveReferrerHoldDays must be greater than zero")
+	}
+	if policy != nil && *policy == models.InactiveReferrerForfeit {
+		v.Add("inactiveReferrerHoldDays", errors.CodeNotAllowed, "inactiveReferrerHoldDays must be nil for 'forfeit' inactiveReferrerPolicy")
+	}
+}
+
+// validateCampaignDates checks the dates of a campaign, which are provided together so that they are always compared
+// with each other
+func validateCampaignDates(v *errors.ValidationError, startDate, endDate *time.Time, now time.Time) {
+	if startDate != nil && endDate == nil {
+		v.Add("endDate", errors.CodeRequired, "end date is required if start date is provided")
+	}
+	if endDate != nil && startDate == nil {
+		v.Add("startDate", errors.CodeRequired, "start date is required if end date is provided")
+	}
+	if startDate != nil && endDate != nil && startDate.After(*endDate) {
+		v.Add("startDate", errors.CodeOutOfRange, "start date cannot be after end date")
+	}
+	if endDate != nil && endDate.Before(now) {
+		v.Add("endDate", errors.CodeOutOfRange, "end date cannot be in the past")
+	}
+}
+
+// validateCampaignEvents checks the events found for eventKeys against the reward types of a campaign
+func validateCampaignEvents(v *errors.ValidationError, eventKeys []string, events []models.Event, rewardType, inviteeRewardType *string) {
+	found := map[string]bool{}
+	paymentCount := 0
+	for _, event := range events {
+		found[event.Key] = true
+		if event.EventType == "payment" {
+			paymentCount++
+		}
+	}
+
+	var missing []string
+	for _, key := range eventKeys {
+		if !found[key] {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		v.Add("eventKeys", errors.CodeNotFound, fmt.Sprintf("events not found for keys: %s", strings.Join(missing, ", ")))
+	}
+
+	if paymentCount > 1 {
+		v.Add("eventKeys", errors.CodeInvalid, "only one event with event type 'payment' is allowed")
+	}
+	if paymentCount != 1 && rewardType != nil && *rewardType == "percentage" {
+		v.Add("eventKeys", errors.CodeInvalid, "exactly one event with event type 'payment' is required for campaigns with 'percentage' reward type")
+	}
+	if paymentCount != 1 && inviteeRewardType != nil && *inviteeRewardType == "percentage" {
+		v.Add("eventKeys", errors.CodeInvalid, "exactly one event with event type 'payment' is required for campaigns with 'percentage' invitee reward type")
+	}
+}
+
+func validateCreateMemberRequest(req request.CreateMemberRequest, policy service.CodePolicy, schema service.AttributeSchema) *errors.ValidationError {
+	v := &errors.ValidationError{}
+
+	if req.ReferenceID == "" {
+		v.Add("referenceID", errors.CodeRequired, "referenceID is required")
+	}
+	validateEmail(v, req.Email)
+	if req.PreferredCode != nil && *req.PreferredCode != "" {
+		validateVanityCode(v, "preferredCode", policy, *req.PreferredCode)
+	}
+	if req.PreferredCode != nil && req.ReferrerCode != nil && *req.PreferredCode != "" && *req.PreferredCode == *req.ReferrerCode {
+		v.Add("referrerCode", errors.CodeInvalid, "a member cannot refer itself")
+	}
+	if req.VisitorID != nil && *req.VisitorID != "" {
+		validateVisitorID(v, req.VisitorID)
+	}
+	validateAttributes(v, req.Attributes, schema, false)
+
+	return v
+}
+
+func validateCreateReferralCodeRequest(req request.CreateReferralCodeRequest, policy service.CodePolicy, now time.Time) *errors.ValidationError {
+	v := &errors.ValidationError{}
+
+	if req.Code != nil {
+		validateVanityCode(v, "code", policy, *req.Code)
+	}
+	if req.Channel != nil && (*req.Channel == "" || len(*req.Channel) > 100) {
+		v.Add("channel", errors.CodeInvalid, "channel must be between 1 and 100 characters long")
+	}
+	if req.UsageLimit != nil && *req.UsageLimit <= 0 {
+		v.Add("usageLimit", errors.CodeInvalid, "usageLimit must be positive")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		v.Add("expiresAt", errors.CodeInvalid, "expiresAt must be in the future")
+	}
+
+	return v
+}
+
+func validateCreateClickRequest(req request.CreateClickRequest, now time.Time) *errors.ValidationError {
+	v := &errors.ValidationError{}
+
+	if req.Code == "" {
+		v.Add("code", errors.CodeRequired, "code is required")
+	}
+	validateVisitorID(v, &req.VisitorID)
+	if req.Channel != nil && (*req.Channel == "" || len(*req.Channel) > 100) {
+		v.Add("channel", errors.CodeInvalid, "channel must be between 1 and 100 characters long")
+	}
+	if req.ClickedAt != nil && req.ClickedAt.After(now) {
+		v.Add("clickedAt", errors.CodeInvalid, "clickedAt cannot be in the future")
+	}
+
+	return v
+}
+
+func validateVisitorID(v *errors.ValidationError, visitorID *string) {
+	if visitorID == nil {
+		return
+	}
+	if *visitorID == "" {
+		v.Add("visitorID", errors.CodeRequired, "visitorID is required")
+	} else if len(*visitorID) > 100 {
+		v.Add("visitorID", errors.CodeInvalid, "visitorID cannot be longer than 100 characters")
+	}
+}
+
+func validateEmail(v *errors.ValidationError, email *string) {
+	if email == nil {
+		return
+	}
+	if *email == "" {
+		v.Add("email", errors.CodeRequired, "email cannot be empty")
+	} else if _, err := mail.ParseAddress(*email); err != nil {
+		v.Add("email", errors.CodeInvalid, fmt.Sprintf("invalid email format: %v", err))
+	}
+}
+
+func validateCreateEventRequest(req request.CreateEventRequest) *errors.ValidationError {
+	v := &errors.ValidationError{}
+
+	if req.Key == "" {
+		v.Add("key", errors.CodeRequired, "event key is required")
+	} else if !validEventKeyRegex.MatchString(req.Key) {
+		v.Add("key", errors.CodeInvalid, "event key must only contain letters, numbers, underscores (_), or hyphens (-)")
+	}
+	if req.Name == "" {
+		v.Add("name", errors.CodeRequired, "event name is required")
+	}
+	if req.EventType != "simple" && req.EventType != "payment" {
+		v.Add("eventType", errors.CodeInvalid, "event type must be either 'simple' or 'payment'")
+	}
+
+	return v
+}
+
+func validateCreateEventLogRequest(req request.CreateEventLogRequest) *errors.ValidationError {
+	v := &errors.ValidationError{}
+
+	if req.EventKey == "" {
+		v.Add("eventKey", errors.CodeRequired, "eventKey is required")
+	}
+	if req.ReferenceID == "" {
+		v.Add("referenceID", errors.CodeRequired, "referenceID is required")
+	}
+	if req.Amount != nil && req.Amount.IsNegative() {
+		v.Add("amount", errors.CodeOutOfRange, "amount cannot be negative")
+	}
+	if req.Data != nil && !json.Valid([]byte(*req.Data)) {
+		v.Add("data", errors.CodeInvalid, "data must be valid json")
+	}
+
+	return v
+}
+
+// validateEventLogAmount checks the amount against the event type, once the event is known
+func validateEventLogAmount(event *models.Event, amount *decimal.Decimal) error {
+	if event.EventType == "payment" {
+		if amount == nil || amount.IsZero() {
+			return errors.Invalid("amount", errors.CodeRequired, "amount must be greater than 0 for payment events")
+		}
+	} else if amount != nil {
+		return errors.Invalid("amount", errors.CodeNotAllowed, "amount must be nil for non-payment events")
+	}
+	return nil
+}
@@ -1,10 +1,11 @@
 package serviceimpl
 
 import (
-	"database/sql"
-	"errors"
 	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/internal/telemetry"
 	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/response"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -13,30 +14,35 @@ import (
 )
 
 type worker struct {
-	DB *gorm.DB
+	*Config
+	simulation *response.Simulation // Set by Simulate, to record what the pass would do
 }
 
-var ErrExceedsBudget = errors.New("exceeds budget")
-
 //var _ service.Worker = &worker{}
 
-func NewWorkerService(db *gorm.DB) *worker {
-	return &worker{
-		DB: db,
-	}
+func NewWorkerService(cfg *Config) *worker {
+	return &worker{Config: cfg}
 }
 
 func (w *worker) ProcessPendingEvents() error {
+	start := time.Now()
+	defer telemetry.Since(w.Telemetry.WorkerPassDuration, start)
+
 	// Fetch all active campaigns with preloaded events
 	var campaigns []models.Campaign
-	currentDate := time.Now().UTC()
+	currentDate := w.Clock.Now().UTC()
 
-	if err := w.DB.Model(&models.Campaign{}).
+	result := w.DB.Model(&models.Campaign{}).
 		Where("status = ? AND end_date < ?", "active", currentDate).
-		Update("status", "archived").Error; err != nil {
-		fmt.Printf("failed to archive expired campaigns: %v\n", err)
+		Update("status", "archived")
+	if result.Error != nil {
+		w.Logger.Error("failed to archive expired campaigns", "error", result.Error)
+	} else if result.RowsAffected > 0 {
+		telemetry.Add(w.Telemetry.CampaignsArchived, result.RowsAffected)
 	}
 
+	w.expireHeldRewards(currentDate)
+
 	if err := w.DB.
 		Preload("Events").
 		Where("status = ? AND is_default = ? AND start_date <= ? AND end_date >= ?", "active", true, currentDate, currentDate).
@@ -46,251 +52,422 @@ func (w *worker) ProcessPendingEvents() error {
 
 	// Traverse each campaign
 	for _, campaign := range campaigns {
-		// Fetch pending EventLogs for this campaign's events
-		eventKeys := getEventKeys(campaign.Events)
-		var eventLogs []models.EventLog
-
-		if err := w.DB.Table("referral_event_logs el").
-			Select("el.*").
-			Joins("LEFT JOIN referral_campaign_event_logs rces ON el.id = rces.event_log_id AND rces.campaign_id = ?", campaign.ID).
-			Where("el.project = ? AND el.status = ? AND el.event_key IN (?) AND rces.event_log_id IS NULL",
-				campaign.Project, "pending", eventKeys).
-			Where("el.triggered_at > ?", campaign.ConsiderEventsFrom).
-			Order("el.id ASC").
-			Find(&eventLogs).Error; err != nil {
-			fmt.Printf("failed to fetch pending EventLogs for campaign %d: %v\n", campaign.ID, err)
-			continue
-		}
+		campaignStart := time.Now()
+		w.processCampaign(campaign, triggeredAfter(campaign.ConsiderEventsFrom))
+		telemetry.Since(w.Telemetry.CampaignProcessingDuration, campaignStart,
+			telemetry.Project(campaign.Project), telemetry.CampaignID(campaign.ID))
+	}
 
-		// Group EventLogs by ReferredByMemberReferenceID and ReferenceType
-		eventLogGroups := groupEventLogs(eventLogs, eventKeys)
+	return nil
+}
 
-		if eventLogGroups == nil {
-			continue
-		}
+// processCampaign rewards the pending event logs of campaign selected by window. Failures are logged, so that one
+// campaign or member cannot block the others.
+func (w *worker) processCampaign(campaign models.Campaign, window func(*gorm.DB) *gorm.DB) {
+	// Fetch pending EventLogs for this campaign's events
+	eventKeys := getEventKeys(campaign.Events)
+	var eventLogs []models.EventLog
+
+	if err := w.DB.Table(w.Naming.Table("event_logs")+" el").
+		Select("el.*").
+		Joins("LEFT JOIN "+w.Naming.Table("campaign_event_logs")+" rces ON el.id = rces.event_log_id AND rces.campaign_id = ?", campaign.ID).
+		Where("el.project = ? AND el.status = ? AND el.event_key IN (?) AND rces.event_log_id IS NULL",
+			campaign.Project, "pending", eventKeys).
+		Scopes(window).
+		Order("el.id ASC").
+		Find(&eventLogs).Error; err != nil {
+		w.Logger.Error("failed to fetch pending event logs",
+			"project", campaign.Project, "campaign_id", campaign.ID, "error", err)
+		return
+	}
+	if w.simulation != nil {
+		w.simulation.EventLogs += int64(len(eventLogs))
+	}
 
-		// Traverse each group of EventLogs
-		for _, logs := range eventLogGroups {
-			// Lock each event log row individually
-			err := w.DB.Transaction(func(tx *gorm.DB) error {
-				eventLogIDs := getEventLogIDs(logs)
+	// Group EventLogs by ReferredByMemberReferenceID and ReferenceType
+	eventLogGroups := groupEventLogs(eventLogs, eventKeys)
 
-				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-					Where("id IN (?) AND status = ?", eventLogIDs, "pending").
-					Find(&eventLogs).Error; err != nil {
-					return fmt.Errorf("failed to lock event logs: %w", err)
-				}
+	if eventLogGroups == nil {
+		return
+	}
 
-				var event models.Event
-				if err := tx.Where("project = ? AND key = ?", campaign.Project, logs[0].EventKey).First(&event).Error; err != nil {
-					fmt.Printf("failed to fetch event for project %s and key %s: %v\n", campaign.Project, logs[0].EventKey, err)
-					return err
-				}
+	// Traverse each group of EventLogs
+	for _, logs := range eventLogGroups {
+		var created []*models.Reward
+		spent := false
+		rejection := "" // Reason the logs were settled without a reward, counted once committed
 
-				project := campaign.Project
-				refereeReferenceID := logs[0].MemberReferenceID
+		// Lock each event log row individually
+		err := w.DB.Transaction(func(tx *gorm.DB) error {
+			eventLogIDs := getEventLogIDs(logs)
 
-				var member models.Member
-				if err := tx.Preload("ReferredByMember").
-					Where("project = ? AND reference_id = ?", campaign.Project, refereeReferenceID).
-					First(&member).Error; err != nil {
-					fmt.Printf("failed to fetch referee for project %s and reference_id %s: %v\n", campaign.Project, refereeReferenceID, err)
-					return err
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id IN (?) AND status = ?", eventLogIDs, "pending").
+				Find(&eventLogs).Error; err != nil {
+				return fmt.Errorf("failed to lock event logs: %w", err)
+			}
+
+			var event models.Event
+			if err := tx.Where("project = ? AND key = ?", campaign.Project, logs[0].EventKey).First(&event).Error; err != nil {
+				return fmt.Errorf("failed to fetch event with key %s: %w", logs[0].EventKey, err)
+			}
+
+			project := campaign.Project
+			refereeReferenceID := logs[0].MemberReferenceID
+
+			var member models.Member
+			if err := tx.Preload("ReferredByMember").Preload("ReferredByCode").
+				Where("project = ? AND reference_id = ?", campaign.Project, refereeReferenceID).
+				First(&member).Error; err != nil {
+				return fmt.Errorf("failed to fetch referee: %w", err)
+			}
+
+			if member.Status == models.MemberStatusBanned ||
+				(member.ReferredByMember != nil && member.ReferredByMember.Status == models.MemberStatusBanned) {
+				w.Logger.Debug("rejecting event logs of a banned member or of a member referred by one",
+					"project", project, "campaign_id", campaign.ID, "member_reference_id", refereeReferenceID)
+				// Banning is final, so no campaign will reward the logs
+				reason := "referrer banned"
+				if member.Status == models.MemberStatusBanned {
+					reason = "member banned"
 				}
+				rejection = telemetry.ReasonBanned
+				return failEventLogs(tx, eventLogIDs, reason)
+			}
 
-				if member.ReferredByMember == nil || member.ReferredByMember.Status != "active" {
-					fmt.Printf("Member is either nil or inactive for reference_id %s\n", refereeReferenceID)
-					return nil
+			// The logs of a member without a referrer stay pending while one may still be attached, and are settled once
+			// the grace period of the late referral policy is over. Suspended and inactive referrers still earn rewards,
+			// which are held or forfeited.
+			if member.ReferredByMember == nil {
+				if deadline := member.CreatedAt.Add(w.lateReferralPolicy(project).GracePeriod); w.Clock.Now().After(deadline) {
+					w.Logger.Debug("settling event logs of a member left without a referrer",
+						"project", project, "campaign_id", campaign.ID, "member_reference_id", refereeReferenceID)
+					return failEventLogs(tx, eventLogIDs, "no referrer attached")
 				}
+				w.Logger.Debug("skipping event logs of a member without a referrer",
+					"project", project, "campaign_id", campaign.ID, "member_reference_id", refereeReferenceID)
+				return nil
+			}
+			forfeit := member.ReferredByMember.Status == models.MemberStatusInactive &&
+				campaign.InactiveReferrerPolicy == models.InactiveReferrerForfeit
+
+			if code := member.ReferredByCode; code != nil && code.CampaignID != nil && *code.CampaignID != campaign.ID {
+				w.Logger.Debug("rejecting event logs of a member referred with a code of another campaign",
+					"project", project, "campaign_id", campaign.ID, "member_reference_id", refereeReferenceID, "code", code.Code)
+				// The other campaign may still reward the logs, so they are settled for this campaign only
+				rejection = telemetry.ReasonCodeCampaign
+				return recordCampaignEventLogs(tx, campaign, event.ID, logs, models.CampaignEventLogStatusRejected, nil, nil)
+			}
 
-				// Check if all campaign events are satisfied
-				if !areAllCampaignEventsSatisfied(campaign.Events, logs) {
+			if member.RewardEventsFrom != nil {
+				// The referrer was attached late, and only the events since count. The former ones are settled, as no
+				// campaign will reward them.
+				var before []models.EventLog
+				before, logs = splitTriggeredAt(logs, *member.RewardEventsFrom)
+				if len(before) > 0 {
+					if err := failEventLogs(tx, getEventLogIDs(before), "triggered before the referrer was attached"); err != nil {
+						return err
+					}
+				}
+				if len(logs) == 0 {
+					w.Logger.Debug("skipping event logs triggered before the referrer was attached",
+						"project", project, "campaign_id", campaign.ID, "member_reference_id", refereeReferenceID)
 					return nil
 				}
+			}
 
-				if campaign.CampaignTypePerCustomer == "one_time" {
-					var existingReward models.Reward
-					if err := tx.Where("project = ? AND campaign_id = ? AND rewarded_member_reference_id = ?",
-						project, campaign.ID, member.ReferredByMember.ReferenceID).First(&existingReward).Error; err == nil {
-						return fmt.Errorf("reward already exists for campaign %d and referrer %s", campaign.ID, member.ReferredByMember.ReferenceID)
-					}
+			// Check if all campaign events are satisfied
+			if !areAllCampaignEventsSatisfied(campaign.Events, logs) {
+				return nil
+			}
+
+			if campaign.CampaignTypePerCustomer == "one_time" {
+				var existingReward models.Reward
+				if err := tx.Where("project = ? AND campaign_id = ? AND rewarded_member_reference_id = ?",
+					project, campaign.ID, member.ReferredByMember.ReferenceID).First(&existingReward).Error; err == nil {
+					return errors.Conflict("reward", "reward already exists for campaign %d and referrer %s", campaign.ID, member.ReferredByMember.ReferenceID)
 				}
+			}
 
-				// Calculate reward
-				referrerRewardAmount, refereeRewardAmount, err := calculateReward(tx, campaign, logs)
+			// Calculate reward
+			referrerRewardAmount, refereeRewardAmount, err := calculateReward(tx, campaign, logs)
+			if err != nil {
+				return fmt.Errorf("failed to calculate reward: %w", err)
+			}
+
+			if referrerRewardAmount != nil {
+				// Apply Reward Cap per Customer
+				if campaign.RewardCap != nil && referrerRewardAmount.GreaterThan(*campaign.RewardCap) {
+					referrerRewardAmount = campaign.RewardCap
+				}
+			}
+			if referrerRewardAmount != nil && !forfeit {
+				// Forfeited rewards count against neither caps nor budgets
+				err = w.validateReward(tx, err, project, campaign, member.ReferredByMember.ReferenceID, referrerRewardAmount)
 				if err != nil {
-					fmt.Printf("calculateReward: failed to calculate reward for campaign %d: %v\n", campaign.ID, err)
 					return err
 				}
-
-				if referrerRewardAmount != nil {
-					// Apply Reward Cap per Customer
-					if campaign.RewardCap != nil && referrerRewardAmount.GreaterThan(*campaign.RewardCap) {
-						referrerRewardAmount = campaign.RewardCap
-					}
-
-					err = w.validateReward(tx, err, project, campaign, member.ReferredByMember.ReferenceID, referrerRewardAmount)
-					if err != nil {
-						return err
-					}
+			}
+			if refereeRewardAmount != nil {
+				if campaign.InviteeRewardCap != nil && refereeRewardAmount.GreaterThan(*campaign.InviteeRewardCap) {
+					refereeRewardAmount = campaign.InviteeRewardCap
 				}
-				if refereeRewardAmount != nil {
-					if campaign.InviteeRewardCap != nil && refereeRewardAmount.GreaterThan(*campaign.InviteeRewardCap) {
-						refereeRewardAmount = campaign.InviteeRewardCap
-					}
 
-					err = w.validateReward(tx, err, project, campaign, member.ReferenceID, refereeRewardAmount)
-					if err != nil {
-						return err
-					}
+				err = w.validateReward(tx, err, project, campaign, member.ReferenceID, refereeRewardAmount)
+				if err != nil {
+					return err
 				}
+			}
 
-				// Budget Limit Check
-				if campaign.Budget != nil {
-					var totalRewards decimal.Decimal
-					err = tx.Model(&models.Reward{}).
-						Select("COALESCE(SUM(amount), 0)").
-						Where("campaign_id = ?", campaign.ID).
-						Scan(&totalRewards).Error
-					if err != nil {
-						fmt.Printf("failed to calculate total reward for campaign %d: %v\n", campaign.ID, err)
-						return err
-					}
-
-					calculatedTotalRewards := decimal.Zero
-					if referrerRewardAmount != nil {
-						calculatedTotalRewards = calculatedTotalRewards.Add(*referrerRewardAmount)
-					}
-					if refereeRewardAmount != nil {
-						calculatedTotalRewards = calculatedTotalRewards.Add(*refereeRewardAmount)
-					}
-
-					// Check if total rewards exceed budget
-					if totalRewards.Add(calculatedTotalRewards).GreaterThanOrEqual(*campaign.Budget) {
-						result := tx.Debug().Model(&models.Campaign{}).
-							Where("id = ?", campaign.ID).
-							Update("status", "paused")
-
-						if result.Error != nil {
-							return fmt.Errorf("failed to pause campaign due to budget overuse: %w", result.Error)
-						}
-
-						if err := tx.Commit().Error; err != nil {
-							return fmt.Errorf("failed to commit transaction after updating campaign: %w", err)
-						}
-						if totalRewards.Add(calculatedTotalRewards).GreaterThan(*campaign.Budget) {
-							return ErrExceedsBudget
-						}
-					}
+			// Budget Limit Check
+			if campaign.Budget != nil {
+				var totalRewards decimal.Decimal
+				err = tx.Model(&models.Reward{}).
+					Select("COALESCE(SUM(amount), 0)").
+					Where("campaign_id = ? AND status <> ?", campaign.ID, models.RewardStatusForfeited).
+					Scan(&totalRewards).Error
+				if err != nil {
+					return fmt.Errorf("failed to calculate total rewards: %w", err)
 				}
 
-				var referrerReward *models.Reward
-				var refereeReward *models.Reward
-				if referrerRewardAmount != nil && referrerRewardAmount.GreaterThan(decimal.NewFromInt(0)) {
-					// Create the reward
-					referrerReward = &models.Reward{
-						Project:                   project,
-						CampaignID:                campaign.ID,
-						CurrencyCode:              campaign.CurrencyCode,
-						RewardedMemberID:          member.ReferredByMember.ID,
-						RewardedMemberReferenceID: member.ReferredByMember.ReferenceID,
-						RelatedMemberID:           member.ID,
-						RelatedMemberReferenceID:  member.ReferenceID,
-						MemberType:                "referrer",
-						Amount:                    *referrerRewardAmount,
-						Status:                    "pending",
-					}
-					if err := tx.Create(referrerReward).Error; err != nil {
-						fmt.Printf("failed to create reward for campaign %d: %v\n", campaign.ID, err)
-						return err
-					}
+				calculatedTotalRewards := decimal.Zero
+				if referrerRewardAmount != nil && !forfeit {
+					calculatedTotalRewards = calculatedTotalRewards.Add(*referrerRewardAmount)
+				}
+				if refereeRewardAmount != nil {
+					calculatedTotalRewards = calculatedTotalRewards.Add(*refereeRewardAmount)
 				}
 
-				if refereeRewardAmount != nil && refereeRewardAmount.GreaterThan(decimal.NewFromInt(0)) {
-					refereeReward = &models.Reward{
-						Project:                   project,
-						CampaignID:                campaign.ID,
-						CurrencyCode:              campaign.CurrencyCode,
-						RewardedMemberID:          member.ID,
-						RewardedMemberReferenceID: member.ReferenceID,
-						RelatedMemberID:           member.ReferredByMember.ID,
-						RelatedMemberReferenceID:  member.ReferredByMember.ReferenceID,
-						MemberType:                "referee",
-						Amount:                    *refereeRewardAmount,
-						Status:                    "pending",
+				// Reject rewards exceeding the budget, the campaign is paused once the transaction is rolled back. Rewards
+				// spending exactly the budget are created and pause the campaign with them.
+				total := totalRewards.Add(calculatedTotalRewards)
+				if total.GreaterThan(*campaign.Budget) {
+					return &errors.BudgetExceededError{
+						CampaignID: campaign.ID,
+						Budget:     *campaign.Budget,
+						Total:      total,
 					}
-					if err := tx.Create(refereeReward).Error; err != nil {
-						fmt.Printf("failed to create referee reward for campaign %d: %v\n", campaign.ID, err)
+				}
+				if total.Equal(*campaign.Budget) {
+					if err := pauseCampaign(tx, campaign.ID); err != nil {
 						return err
 					}
+					spent = true
 				}
-				// Prepare bulk insert data for referral_campaign_event_logs
-				var campaignEventStatusEntries []models.CampaignEventLog
-
-				for i, eventLogID := range eventLogIDs {
-					entry := models.CampaignEventLog{
-						Project:           campaign.Project,
-						CampaignID:        campaign.ID,
-						EventID:           event.ID,                  // Assuming you have eventID from previous logic
-						MemberID:          logs[i].MemberID,          // Assuming you have memberID from previous logic
-						MemberReferenceID: logs[i].MemberReferenceID, // Assuming you have memberReferenceID from previous logic
-						Status:            "processed",
-						EventLogID:        eventLogID,
-					}
-
-					if referrerReward != nil {
-						entry.ReferredRewardID = &referrerReward.ID
-					}
-					if refereeReward != nil {
-						entry.RefereeRewardID = &refereeReward.ID
-					}
+			}
 
-					campaignEventStatusEntries = append(campaignEventStatusEntries, entry)
+			var referrerReward *models.Reward
+			var refereeReward *models.Reward
+			if referrerRewardAmount != nil && referrerRewardAmount.GreaterThan(decimal.NewFromInt(0)) {
+				// Create the reward
+				referrerReward = &models.Reward{
+					Project:                   project,
+					CampaignID:                campaign.ID,
+					CurrencyCode:              campaign.CurrencyCode,
+					RewardedMemberID:          member.ReferredByMember.ID,
+					RewardedMemberReferenceID: member.ReferredByMember.ReferenceID,
+					RelatedMemberID:           member.ID,
+					RelatedMemberReferenceID:  member.ReferenceID,
+					MemberType:                "referrer",
+					Amount:                    *referrerRewardAmount,
+					Status:                    models.RewardStatusPending,
 				}
-
-				// Perform bulk insert
-				if err := tx.Create(&campaignEventStatusEntries).Error; err != nil {
-					return fmt.Errorf("failed to bulk insert into referral_campaign_event_logs: %w", err)
+				w.deferReward(referrerReward, *member.ReferredByMember, campaign)
+				if err := w.checkReward(*referrerReward); err != nil {
+					return err
 				}
+				if err := tx.Create(referrerReward).Error; err != nil {
+					return fmt.Errorf("failed to create referrer reward: %w", err)
+				}
+				created = append(created, referrerReward)
+			}
 
-				return nil
-			})
-
-			if err != nil {
-				// Log the error and continue with other campaigns
-				fmt.Printf("Error processing campaign %d: %v\n", campaign.ID, err)
-				if errors.Is(err, ErrExceedsBudget) {
-					fmt.Printf("Break Campaign %d exceeds budget\n", campaign.ID)
-					break
+			if refereeRewardAmount != nil && refereeRewardAmount.GreaterThan(decimal.NewFromInt(0)) {
+				refereeReward = &models.Reward{
+					Project:                   project,
+					CampaignID:                campaign.ID,
+					CurrencyCode:              campaign.CurrencyCode,
+					RewardedMemberID:          member.ID,
+					RewardedMemberReferenceID: member.ReferenceID,
+					RelatedMemberID:           member.ReferredByMember.ID,
+					RelatedMemberReferenceID:  member.ReferredByMember.ReferenceID,
+					MemberType:                "referee",
+					Amount:                    *refereeRewardAmount,
+					Status:                    models.RewardStatusPending,
+				}
+				holdReward(refereeReward, member)
+				if err := w.checkReward(*refereeReward); err != nil {
+					return err
+				}
+				if err := tx.Create(refereeReward).Error; err != nil {
+					return fmt.Errorf("failed to create referee reward: %w", err)
+				}
+				created = append(created, refereeReward)
+			}
+			return recordCampaignEventLogs(tx, campaign, event.ID, logs, models.CampaignEventLogStatusProcessed, referrerReward, refereeReward)
+		})
+
+		paused := spent && err == nil
+		if errors.Is(err, errors.ErrBudgetExceeded) {
+			if pauseErr := pauseCampaign(w.DB, campaign.ID); pauseErr != nil {
+				w.Logger.Error("failed to pause campaign", "project", campaign.Project, "campaign_id", campaign.ID, "error", pauseErr)
+			} else {
+				paused = true
+			}
+		}
+		if paused {
+			if w.simulation != nil {
+				w.simulation.BudgetExhausted = true
+			}
+			telemetry.Add(w.Telemetry.CampaignsPaused, 1, telemetry.Project(campaign.Project), telemetry.CampaignID(campaign.ID))
+			pausedCampaign := campaign
+			pausedCampaign.Status = "paused"
+			w.campaignStatusChanged(pausedCampaign, campaign.Status)
+		}
+		if err == nil && rejection != "" {
+			w.rejected(campaign, rejection)
+		}
+		if err == nil {
+			for _, reward := range created {
+				telemetry.Add(w.Telemetry.RewardsCreated, 1, telemetry.Project(campaign.Project),
+					telemetry.CampaignID(campaign.ID), telemetry.MemberType(reward.MemberType))
+				w.rewardCreated(*reward)
+				if w.simulation != nil {
+					w.simulation.Rewards = append(w.simulation.Rewards, *reward)
+					w.simulation.TotalRewards = w.simulation.TotalRewards.Add(reward.Amount)
 				}
 			}
 		}
+
+		if err != nil {
+			// Log the error and continue with the next group, or the next campaign once the budget is spent
+			attrs := []any{
+				"project", campaign.Project,
+				"campaign_id", campaign.ID,
+				"member_reference_id", logs[0].MemberReferenceID,
+				"event_log_id", logs[0].ID,
+				"error", err,
+			}
+			reason := ""
+			switch {
+			case errors.Is(err, errors.ErrBudgetExceeded):
+				w.Logger.Warn("campaign paused: budget exceeded", attrs...)
+				reason = telemetry.ReasonBudgetExceeded
+			case errors.Is(err, errors.ErrCapExceeded):
+				w.Logger.Info("reward rejected", attrs...)
+				reason = telemetry.ReasonCapExceeded
+			case errors.Is(err, errors.ErrConflict):
+				w.Logger.Info("reward rejected", attrs...)
+				reason = telemetry.ReasonAlreadyRewarded
+			case errors.Is(err, errors.ErrFraudSuspected):
+				w.Logger.Warn("reward rejected", attrs...)
+				reason = telemetry.ReasonFraudSuspected
+			default:
+				w.Logger.Error("failed to process event logs", attrs...)
+			}
+			if reason != "" {
+				w.rejected(campaign, reason)
+			}
+			if errors.Is(err, errors.ErrBudgetExceeded) {
+				return
+			}
+		}
+	}
+}
+
+// rejected counts a reward of campaign the worker did not create, for reason
+func (w *worker) rejected(campaign models.Campaign, reason string) {
+	telemetry.Add(w.Telemetry.RewardsRejected, 1, telemetry.Project(campaign.Project),
+		telemetry.CampaignID(campaign.ID), telemetry.Reason(reason))
+	if w.simulation != nil {
+		w.simulation.Rejections[reason]++
+	}
+}
+
+// recordCampaignEventLogs records the outcome of campaign for logs, so that its next passes skip them
+func recordCampaignEventLogs(tx *gorm.DB, campaign models.Campaign, eventID uint, logs []models.EventLog, status string, referrerReward, refereeReward *models.Reward) error {
+	entries := make([]models.CampaignEventLog, len(logs))
+	for i, log := range logs {
+		entries[i] = models.CampaignEventLog{
+			Project:           campaign.Project,
+			CampaignID:        campaign.ID,
+			EventID:           eventID,
+			MemberID:          log.MemberID,
+			MemberReferenceID: log.MemberReferenceID,
+			Status:            status,
+			EventLogID:        log.ID,
+		}
+		if referrerReward != nil {
+			entries[i].ReferredRewardID = &referrerReward.ID
+		}
+		if refereeReward != nil {
+			entries[i].RefereeRewardID = &refereeReward.ID
+		}
 	}
 
+	if err := tx.Create(&entries).Error; err != nil {
+		return fmt.Errorf("failed to bulk insert campaign event logs: %w", err)
+	}
 	return nil
 }
 
+// failEventLogs settles event logs no campaign may reward, so that the next passes do not fetch them again
+func failEventLogs(tx *gorm.DB, eventLogIDs []uint, reason string) error {
+	if err := tx.Model(&models.EventLog{}).
+		Where("id IN (?) AND status = ?", eventLogIDs, models.EventLogStatusPending).
+		Updates(map[string]interface{}{"status": models.EventLogStatusFailed, "failure_reason": reason}).Error; err != nil {
+		return fmt.Errorf("failed to settle event logs: %w", err)
+	}
+	return nil
+}
+
+// pauseCampaign pauses a campaign whose budget is spent
+func pauseCampaign(db *gorm.DB, campaignID uint) error {
+	if err := db.Model(&models.Campaign{}).Where("id = ?", campaignID).Update("status", "paused").Error; err != nil {
+		return fmt.Errorf("failed to pause campaign due to budget overuse: %w", err)
+	}
+	return nil
+}
+
+// splitTriggeredAt splits logs into the event logs triggered before t, and those triggered at t or later
+func splitTriggeredAt(logs []models.EventLog, t time.Time) (before, since []models.EventLog) {
+	for _, log := range logs {
+		if log.TriggeredAt.Before(t) {
+			before = append(before, log)
+		} else {
+			since = append(since, log)
+		}
+	}
+	return before, since
+}
+
+// triggeredAfter selects the event logs of a pass triggered after t
+func triggeredAfter(t time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("el.triggered_at > ?", t)
+	}
+}
+
 func (w *worker) validateReward(tx *gorm.DB, err error, project string, campaign models.Campaign, referenceID string, rewardAmount *decimal.Decimal) error {
 	// Validate limits
 	referrerTotalReward, referrerMonthsPassed, referrerRewardsCount, err := w.GetTotalRewardByMember(tx, project, campaign.ID, referenceID)
 	if err != nil {
-		fmt.Printf("GetTotalRewardByMember: failed to calculate total reward for campaign %d: %v\n", campaign.ID, err)
-		return err
+		return fmt.Errorf("failed to calculate total reward of member: %w", err)
 	}
 
 	// Reward Cap Per Customer
 	if campaign.RewardCapPerCustomer != nil && referrerTotalReward.Add(*rewardAmount).GreaterThan(*campaign.RewardCapPerCustomer) {
-		return errors.New("exceeds reward cap per customer")
+		return &errors.CapExceededError{CampaignID: campaign.ID, MemberReferenceID: referenceID, Cap: errors.CapRewardPerCustomer}
 	}
 
 	// Check if the validity period is exceeded
 	if campaign.ValidityMonthsPerCustomer != nil && referrerMonthsPassed >= *campaign.ValidityMonthsPerCustomer {
-		return errors.New("exceeds validity period")
+		return &errors.CapExceededError{CampaignID: campaign.ID, MemberReferenceID: referenceID, Cap: errors.CapValidityPeriod}
 	}
 
 	// Check if max occurrences are exceeded
 	if campaign.MaxOccurrencesPerCustomer != nil && referrerRewardsCount >= *campaign.MaxOccurrencesPerCustomer {
-		return errors.New("exceeds max occurrences per customer")
+		return &errors.CapExceededError{CampaignID: campaign.ID, MemberReferenceID: referenceID, Cap: errors.CapMaxOccurrencesCustomer}
 	}
 	return nil
 }
@@ -302,31 +479,93 @@ func (w *worker) GetTotalRewardByMember(
 	referrerReferenceID string,
 ) (decimal.Decimal, int, int64, error) {
 	var totalReward decimal.Decimal
-	var firstRewardMonth sql.NullTime
 	var rewardsCount int64
 
-	err := tx.Model(&models.Reward{}).
-		Where("project = ? AND campaign_id = ? AND rewarded_member_reference_id = ?", project, campaignID, referrerReferenceID).
-		Select("COALESCE(SUM(amount), 0), MIN(created_at), COUNT(*)").
-		Row().Scan(&totalReward, &firstRewardMonth, &rewardsCount)
+	rewards := tx.Model(&models.Reward{}).
+		Where("project = ? AND campaign_id = ? AND rewarded_member_reference_id = ? AND status <> ?",
+			project, campaignID, referrerReferenceID, models.RewardStatusForfeited).
+		Session(&gorm.Session{})
+
+	err := rewards.
+		Select("COALESCE(SUM(amount), 0), COUNT(*)").
+		Row().Scan(&totalReward, &rewardsCount)
 
 	if err != nil {
 		return decimal.Zero, 0, 0, fmt.Errorf("failed to calculate total reward: %w", err)
 	}
 
-	if rewardsCount == 0 || !firstRewardMonth.Valid {
+	if rewardsCount == 0 {
+		return decimal.Zero, 0, 0, nil
+	}
+
+	// Read the first reward's created_at from the column rather than MIN(created_at), whose type drivers such as
+	// SQLite lose, so that it scans into a time.Time on every dialect
+	var firstRewardMonth []time.Time
+	if err := rewards.Order("created_at ASC").Limit(1).Pluck("created_at", &firstRewardMonth).Error; err != nil {
+		return decimal.Zero, 0, 0, fmt.Errorf("failed to fetch first reward: %w", err)
+	}
+	if len(firstRewardMonth) == 0 {
 		return decimal.Zero, 0, 0, nil
 	}
 
 	// Calculate months passed
-	currentTime := time.Now()
-	years := currentTime.Year() - firstRewardMonth.Time.Year()
-	months := int(currentTime.Month() - firstRewardMonth.Time.Month())
+	currentTime := w.Clock.Now()
+	years := currentTime.Year() - firstRewardMonth[0].Year()
+	months := int(currentTime.Month() - firstRewardMonth[0].Month())
 	monthsPassed := (years * 12) + months
 
 	return totalReward, monthsPassed, rewardsCount, nil
 }
 
+// holdReward puts the reward of a suspended member on hold, until the member is reactivated
+func holdReward(reward *models.Reward, member models.Member) {
+	if member.Status == models.MemberStatusSuspended {
+		reason := "member suspended"
+		reward.Status = models.RewardStatusOnHold
+		reward.Reason = &reason
+	}
+}
+
+// deferReward holds the reward of a suspended referrer, and holds or forfeits the reward of an inactive referrer
+// following the policy of campaign. Rewards held for inactive referrers expire after the hold days of campaign.
+func (w *worker) deferReward(reward *models.Reward, referrer models.Member, campaign models.Campaign) {
+	holdReward(reward, referrer)
+	if referrer.Status != models.MemberStatusInactive {
+		return
+	}
+
+	reason := "referrer inactive"
+	reward.Reason = &reason
+	if campaign.InactiveReferrerPolicy == models.InactiveReferrerForfeit {
+		reward.Status = models.RewardStatusForfeited
+		return
+	}
+	expiresAt := w.Clock.Now().UTC().AddDate(0, 0, inactiveReferrerHoldDays(campaign))
+	reward.Status = models.RewardStatusOnHold
+	reward.HoldExpiresAt = &expiresAt
+}
+
+// inactiveReferrerHoldDays returns the days campaign holds the rewards of inactive referrers for
+func inactiveReferrerHoldDays(campaign models.Campaign) int {
+	if campaign.InactiveReferrerHoldDays != nil {
+		return *campaign.InactiveReferrerHoldDays
+	}
+	return models.DefaultInactiveReferrerHoldDays
+}
+
+// expireHeldRewards forfeits the held rewards whose hold expired by now
+func (w *worker) expireHeldRewards(now time.Time) {
+	reason := "hold expired"
+	result := w.DB.Model(&models.Reward{}).
+		Where("status = ? AND hold_expires_at <= ?", models.RewardStatusOnHold, now).
+		Updates(map[string]interface{}{"status": models.RewardStatusForfeited, "reason": reason, "hold_expires_at": nil})
+	if result.Error != nil {
+		w.Logger.Error("failed to expire held rewards", "error", result.Error)
+	} else if result.RowsAffected > 0 {
+		telemetry.Add(w.Telemetry.RewardsExpired, result.RowsAffected)
+	}
+}
+
 func areAllCampaignEventsSatisfied(events []models.Event, logs []models.EventLog) bool {
 	eventKeys := make(map[string]bool)
 	for _, log := range logs {
@@ -0,0 +1,154 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"github.com/PayRam/go-referral/response"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"time"
+)
+
+// instrumentationName identifies the meter and tracer of the library
+const instrumentationName = "github.com/PayRam/go-referral"
+
+// Reasons of RewardsRejected
+const (
+	ReasonBudgetExceeded  = "budget_exceeded"
+	ReasonCapExceeded     = "cap_exceeded"
+	ReasonAlreadyRewarded = "already_rewarded"
+	ReasonFraudSuspected  = "fraud_suspected"
+	ReasonCodeCampaign    = "code_campaign" // The referral code is bound to another campaign
+	ReasonBanned          = "banned"        // The referee or its referrer is banned
+)
+
+// Telemetry holds the tracer and the instruments recorded by the services and the worker
+type Telemetry struct {
+	Tracer trace.Tracer
+
+	EventLogsIngested metric.Int64Counter // By project and event key
+	RewardsCreated    metric.Int64Counter // By project, campaign and member type
+	RewardsRejected   metric.Int64Counter // By project, campaign and reason
+	CampaignsPaused   metric.Int64Counter // Paused by the worker because their budget is spent
+	CampaignsArchived metric.Int64Counter // Archived by the worker because they ended
+	RewardsExpired    metric.Int64Counter // Held rewards forfeited by the worker because their hold expired
+
+	WorkerPassDuration         metric.Float64Histogram // One ProcessPendingEvents call
+	CampaignProcessingDuration metric.Float64Histogram // One campaign within a pass
+}
+
+// New creates the instruments on the given providers
+func New(meterProvider metric.MeterProvider, tracerProvider trace.TracerProvider) (*Telemetry, error) {
+	meter := meterProvider.Meter(instrumentationName)
+	t := &Telemetry{Tracer: tracerProvider.Tracer(instrumentationName)}
+
+	var err error
+	if t.EventLogsIngested, err = meter.Int64Counter("referral.event_logs.ingested",
+		metric.WithDescription("Event logs created or imported"), metric.WithUnit("{event_log}")); err != nil {
+		return nil, fmt.Errorf("failed to create event logs counter: %w", err)
+	}
+	if t.RewardsCreated, err = meter.Int64Counter("referral.rewards.created",
+		metric.WithDescription("Rewards created by the worker"), metric.WithUnit("{reward}")); err != nil {
+		return nil, fmt.Errorf("failed to create rewards counter: %w", err)
+	}
+	if t.RewardsRejected, err = meter.Int64Counter("referral.rewards.rejected",
+		metric.WithDescription("Rewards the worker did not create, by reason"), metric.WithUnit("{reward}")); err != nil {
+		return nil, fmt.Errorf("failed to create rejected rewards counter: %w", err)
+	}
+	if t.CampaignsPaused, err = meter.Int64Counter("referral.campaigns.paused",
+		metric.WithDescription("Campaigns paused automatically because their budget is spent"), metric.WithUnit("{campaign}")); err != nil {
+		return nil, fmt.Errorf("failed to create paused campaigns counter: %w", err)
+	}
+	if t.CampaignsArchived, err = meter.Int64Counter("referral.campaigns.archived",
+		metric.WithDescription("Campaigns archived automatically because they ended"), metric.WithUnit("{campaign}")); err != nil {
+		return nil, fmt.Errorf("failed to create archived campaigns counter: %w", err)
+	}
+	if t.RewardsExpired, err = meter.Int64Counter("referral.rewards.expired",
+		metric.WithDescription("Held rewards forfeited automatically because their hold expired"), metric.WithUnit("{reward}")); err != nil {
+		return nil, fmt.Errorf("failed to create expired rewards counter: %w", err)
+	}
+	if t.WorkerPassDuration, err = meter.Float64Histogram("referral.worker.pass.duration",
+		metric.WithDescription("Duration of a ProcessPendingEvents pass"), metric.WithUnit("s")); err != nil {
+		return nil, fmt.Errorf("failed to create worker pass histogram: %w", err)
+	}
+	if t.CampaignProcessingDuration, err = meter.Float64Histogram("referral.worker.campaign.duration",
+		metric.WithDescription("Duration of processing the pending event logs of one campaign"), metric.WithUnit("s")); err != nil {
+		return nil, fmt.Errorf("failed to create campaign processing histogram: %w", err)
+	}
+
+	return t, nil
+}
+
+// Noop returns instruments that record nothing, for work that must not show in the metrics, e.g. simulations
+func Noop() *Telemetry {
+	t, err := New(metricnoop.NewMeterProvider(), tracenoop.NewTracerProvider())
+	if err != nil {
+		panic(err) // The noop providers never fail
+	}
+	return t
+}
+
+// Since records the seconds elapsed since start on histogram
+func Since(histogram metric.Float64Histogram, start time.Time, attrs ...attribute.KeyValue) {
+	histogram.Record(context.Background(), time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+}
+
+// Add adds n to counter
+func Add(counter metric.Int64Counter, n int64, attrs ...attribute.KeyValue) {
+	counter.Add(context.Background(), n, metric.WithAttributes(attrs...))
+}
+
+// span runs fn in a span named name, recording its error
+func span[T any](t *Telemetry, name string, attrs []attribute.KeyValue, fn func() (T, error)) (T, error) {
+	_, s := t.Tracer.Start(context.Background(), name, trace.WithAttributes(attrs...))
+	defer s.End()
+
+	result, err := fn()
+	if err != nil {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, err.Error())
+	}
+	return result, err
+}
+
+// spanPage is span for list methods, which also return the page info
+func spanPage[T any](t *Telemetry, name string, attrs []attribute.KeyValue, fn func() (T, response.PageInfo, error)) (T, response.PageInfo, error) {
+	var info response.PageInfo
+	result, err := span(t, name, attrs, func() (T, error) {
+		var err error
+		var result T
+		result, info, err = fn()
+		return result, err
+	})
+	return result, info, err
+}
+
+// Attributes of the spans and instruments
+
+func Project(project string) attribute.KeyValue {
+	return attribute.String("referral.project", project)
+}
+
+func CampaignID(id uint) attribute.KeyValue {
+	return attribute.Int64("referral.campaign_id", int64(id))
+}
+
+func MemberReferenceID(referenceID string) attribute.KeyValue {
+	return attribute.String("referral.member_reference_id", referenceID)
+}
+
+func EventKey(key string) attribute.KeyValue {
+	return attribute.String("referral.event_key", key)
+}
+
+func MemberType(memberType string) attribute.KeyValue {
+	return attribute.String("referral.member_type", memberType)
+}
+
+func Reason(reason string) attribute.KeyValue {
+	return attribute.String("referral.reason", reason)
+}
@@ -0,0 +1,379 @@
+package telemetry
+
+import (
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/request"
+	"github.com/PayRam/go-referral/response"
+	"github.com/PayRam/go-referral/service"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+)
+
+// The wrappers below decorate each service with a span per method call, named after the interface and method.
+
+type tracedEventService struct {
+	next service.EventService
+	t    *Telemetry
+}
+
+func TraceEventService(next service.EventService, t *Telemetry) service.EventService {
+	return &tracedEventService{next: next, t: t}
+}
+
+func (s *tracedEventService) CreateEvent(p string, req request.CreateEventRequest) (*models.Event, error) {
+	return span(s.t, "EventService.CreateEvent", []attribute.KeyValue{Project(p)}, func() (*models.Event, error) {
+		return s.next.CreateEvent(p, req)
+	})
+}
+
+func (s *tracedEventService) GetEvents(req request.GetEventsRequest) ([]models.Event, response.PageInfo, error) {
+	return spanPage(s.t, "EventService.GetEvents", nil, func() ([]models.Event, response.PageInfo, error) {
+		return s.next.GetEvents(req)
+	})
+}
+
+func (s *tracedEventService) UpdateEvent(p, key string, req request.UpdateEventRequest) (*models.Event, error) {
+	return span(s.t, "EventService.UpdateEvent", []attribute.KeyValue{Project(p)}, func() (*models.Event, error) {
+		return s.next.UpdateEvent(p, key, req)
+	})
+}
+
+type tracedCampaignService struct {
+	next service.CampaignService
+	t    *Telemetry
+}
+
+func TraceCampaignService(next service.CampaignService, t *Telemetry) service.CampaignService {
+	return &tracedCampaignService{next: next, t: t}
+}
+
+func (s *tracedCampaignService) CreateCampaign(p string, req request.CreateCampaignRequest) (*models.Campaign, error) {
+	return span(s.t, "CampaignService.CreateCampaign", []attribute.KeyValue{Project(p)}, func() (*models.Campaign, error) {
+		return s.next.CreateCampaign(p, req)
+	})
+}
+
+func (s *tracedCampaignService) GetCampaigns(req request.GetCampaignsRequest) ([]models.Campaign, response.PageInfo, error) {
+	return spanPage(s.t, "CampaignService.GetCampaigns", nil, func() ([]models.Campaign, response.PageInfo, error) {
+		return s.next.GetCampaigns(req)
+	})
+}
+
+func (s *tracedCampaignService) GetTotalCampaigns(req request.GetCampaignsRequest) (int64, error) {
+	return span(s.t, "CampaignService.GetTotalCampaigns", nil, func() (int64, error) {
+		return s.next.GetTotalCampaigns(req)
+	})
+}
+
+func (s *tracedCampaignService) UpdateCampaign(p string, id uint, req request.UpdateCampaignRequest) (*models.Campaign, error) {
+	return span(s.t, "CampaignService.UpdateCampaign", []attribute.KeyValue{Project(p), CampaignID(id)}, func() (*models.Campaign, error) {
+		return s.next.UpdateCampaign(p, id, req)
+	})
+}
+
+func (s *tracedCampaignService) SetDefaultCampaign(p string, id uint) (*models.Campaign, error) {
+	return span(s.t, "CampaignService.SetDefaultCampaign", []attribute.KeyValue{Project(p), CampaignID(id)}, func() (*models.Campaign, error) {
+		return s.next.SetDefaultCampaign(p, id)
+	})
+}
+
+func (s *tracedCampaignService) RemoveDefaultCampaign(p string, id uint) (*models.Campaign, error) {
+	return span(s.t, "CampaignService.RemoveDefaultCampaign", []attribute.KeyValue{Project(p), CampaignID(id)}, func() (*models.Campaign, error) {
+		return s.next.RemoveDefaultCampaign(p, id)
+	})
+}
+
+func (s *tracedCampaignService) UpdateCampaignStatus(p string, id uint, newStatus string) (*models.Campaign, error) {
+	return span(s.t, "CampaignService.UpdateCampaignStatus", []attribute.KeyValue{Project(p), CampaignID(id)}, func() (*models.Campaign, error) {
+		return s.next.UpdateCampaignStatus(p, id, newStatus)
+	})
+}
+
+type tracedMemberService struct {
+	next service.MemberService
+	t    *Telemetry
+}
+
+func TraceMemberService(next service.MemberService, t *Telemetry) service.MemberService {
+	return &tracedMemberService{next: next, t: t}
+}
+
+func (s *tracedMemberService) CreateMember(p string, req request.CreateMemberRequest) (*models.Member, error) {
+	return span(s.t, "MemberService.CreateMember", []attribute.KeyValue{Project(p), MemberReferenceID(req.ReferenceID)}, func() (*models.Member, error) {
+		return s.next.CreateMember(p, req)
+	})
+}
+
+func (s *tracedMemberService) GetMembers(req request.GetMemberRequest) ([]models.Member, response.PageInfo, error) {
+	return spanPage(s.t, "MemberService.GetMembers", nil, func() ([]models.Member, response.PageInfo, error) {
+		return s.next.GetMembers(req)
+	})
+}
+
+func (s *tracedMemberService) GetTotalMembers(req request.GetMemberRequest) (int64, error) {
+	return span(s.t, "MemberService.GetTotalMembers", nil, func() (int64, error) {
+		return s.next.GetTotalMembers(req)
+	})
+}
+
+func (s *tracedMemberService) UpdateMember(p, referenceID string, req request.UpdateMemberRequest) (*models.Member, error) {
+	return span(s.t, "MemberService.UpdateMember", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() (*models.Member, error) {
+		return s.next.UpdateMember(p, referenceID, req)
+	})
+}
+
+func (s *tracedMemberService) UpdateMemberStatus(p, referenceID string, newStatus string) (*models.Member, error) {
+	return span(s.t, "MemberService.UpdateMemberStatus", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() (*models.Member, error) {
+		return s.next.UpdateMemberStatus(p, referenceID, newStatus)
+	})
+}
+
+func (s *tracedMemberService) ChangeMemberStatus(p, referenceID string, req request.UpdateMemberStatusRequest) (*models.Member, error) {
+	return span(s.t, "MemberService.ChangeMemberStatus", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() (*models.Member, error) {
+		return s.next.ChangeMemberStatus(p, referenceID, req)
+	})
+}
+
+func (s *tracedMemberService) GetDownline(p, referenceID string, maxDepth int) (*response.Downline, error) {
+	return span(s.t, "MemberService.GetDownline", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() (*response.Downline, error) {
+		return s.next.GetDownline(p, referenceID, maxDepth)
+	})
+}
+
+func (s *tracedMemberService) GetUpline(p, referenceID string) ([]response.ReferralTreeNode, error) {
+	return span(s.t, "MemberService.GetUpline", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() ([]response.ReferralTreeNode, error) {
+		return s.next.GetUpline(p, referenceID)
+	})
+}
+
+func (s *tracedMemberService) GetSubtreeStats(p, referenceID string, maxDepth int) (*response.SubtreeStats, error) {
+	return span(s.t, "MemberService.GetSubtreeStats", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() (*response.SubtreeStats, error) {
+		return s.next.GetSubtreeStats(p, referenceID, maxDepth)
+	})
+}
+
+func (s *tracedMemberService) ImportMembers(p string, r io.Reader, req request.ImportRequest) (*response.ImportResult, error) {
+	return span(s.t, "MemberService.ImportMembers", []attribute.KeyValue{Project(p)}, func() (*response.ImportResult, error) {
+		return s.next.ImportMembers(p, r, req)
+	})
+}
+
+func (s *tracedMemberService) AttachReferrer(p, referenceID string, req request.AttachReferrerRequest) (*models.Member, error) {
+	return span(s.t, "MemberService.AttachReferrer", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() (*models.Member, error) {
+		return s.next.AttachReferrer(p, referenceID, req)
+	})
+}
+
+func (s *tracedMemberService) GetAuditLogs(req request.GetAuditLogsRequest) ([]models.AuditLog, response.PageInfo, error) {
+	return spanPage(s.t, "MemberService.GetAuditLogs", nil, func() ([]models.AuditLog, response.PageInfo, error) {
+		return s.next.GetAuditLogs(req)
+	})
+}
+
+func (s *tracedMemberService) EnrollMember(p, referenceID string, campaignID uint) (*models.Enrollment, error) {
+	return span(s.t, "MemberService.EnrollMember", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID), CampaignID(campaignID)}, func() (*models.Enrollment, error) {
+		return s.next.EnrollMember(p, referenceID, campaignID)
+	})
+}
+
+func (s *tracedMemberService) UnenrollMember(p, referenceID string, campaignID uint) (*models.Enrollment, error) {
+	return span(s.t, "MemberService.UnenrollMember", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID), CampaignID(campaignID)}, func() (*models.Enrollment, error) {
+		return s.next.UnenrollMember(p, referenceID, campaignID)
+	})
+}
+
+func (s *tracedMemberService) EnrollMembers(p string, campaignID uint, filter request.GetMemberRequest) (*response.EnrollmentResult, error) {
+	return span(s.t, "MemberService.EnrollMembers", []attribute.KeyValue{Project(p), CampaignID(campaignID)}, func() (*response.EnrollmentResult, error) {
+		return s.next.EnrollMembers(p, campaignID, filter)
+	})
+}
+
+func (s *tracedMemberService) GetEnrollments(req request.GetEnrollmentsRequest) ([]models.Enrollment, response.PageInfo, error) {
+	return spanPage(s.t, "MemberService.GetEnrollments", nil, func() ([]models.Enrollment, response.PageInfo, error) {
+		return s.next.GetEnrollments(req)
+	})
+}
+
+func (s *tracedMemberService) ForgetMember(p, referenceID string, req request.ForgetMemberRequest) (*models.Member, error) {
+	return span(s.t, "MemberService.ForgetMember", []attribute.KeyValue{Project(p)}, func() (*models.Member, error) {
+		return s.next.ForgetMember(p, referenceID, req)
+	})
+}
+
+func (s *tracedMemberService) ExportMemberData(w io.Writer, p, referenceID string) error {
+	_, err := span(s.t, "MemberService.ExportMemberData", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() (struct{}, error) {
+		return struct{}{}, s.next.ExportMemberData(w, p, referenceID)
+	})
+	return err
+}
+
+type tracedReferralCodeService struct {
+	next service.ReferralCodeService
+	t    *Telemetry
+}
+
+func TraceReferralCodeService(next service.ReferralCodeService, t *Telemetry) service.ReferralCodeService {
+	return &tracedReferralCodeService{next: next, t: t}
+}
+
+func (s *tracedReferralCodeService) CreateReferralCode(p, referenceID string, req request.CreateReferralCodeRequest) (*models.ReferralCode, error) {
+	return span(s.t, "ReferralCodeService.CreateReferralCode", []attribute.KeyValue{Project(p), MemberReferenceID(referenceID)}, func() (*models.ReferralCode, error) {
+		return s.next.CreateReferralCode(p, referenceID, req)
+	})
+}
+
+func (s *tracedReferralCodeService) GetReferralCodes(req request.GetReferralCodesRequest) ([]models.ReferralCode, response.PageInfo, error) {
+	return spanPage(s.t, "ReferralCodeService.GetReferralCodes", nil, func() ([]models.ReferralCode, response.PageInfo, error) {
+		return s.next.GetReferralCodes(req)
+	})
+}
+
+func (s *tracedReferralCodeService) RecordClick(p string, req request.CreateClickRequest) (*models.Click, error) {
+	return span(s.t, "ReferralCodeService.RecordClick", []attribute.KeyValue{Project(p)}, func() (*models.Click, error) {
+		return s.next.RecordClick(p, req)
+	})
+}
+
+func (s *tracedReferralCodeService) GetClicks(req request.GetClicksRequest) ([]models.Click, response.PageInfo, error) {
+	return spanPage(s.t, "ReferralCodeService.GetClicks", nil, func() ([]models.Click, response.PageInfo, error) {
+		return s.next.GetClicks(req)
+	})
+}
+
+func (s *tracedReferralCodeService) GetCodeStats(req request.GetReferralCodesRequest) ([]response.CodeStats, response.PageInfo, error) {
+	return spanPage(s.t, "ReferralCodeService.GetCodeStats", nil, func() ([]response.CodeStats, response.PageInfo, error) {
+		return s.next.GetCodeStats(req)
+	})
+}
+
+type tracedEventLogService struct {
+	next service.EventLogService
+	t    *Telemetry
+}
+
+func TraceEventLogService(next service.EventLogService, t *Telemetry) service.EventLogService {
+	return &tracedEventLogService{next: next, t: t}
+}
+
+func (s *tracedEventLogService) CreateEventLog(p string, req request.CreateEventLogRequest) (*models.EventLog, error) {
+	attrs := []attribute.KeyValue{Project(p), MemberReferenceID(req.ReferenceID), EventKey(req.EventKey)}
+	return span(s.t, "EventLogService.CreateEventLog", attrs, func() (*models.EventLog, error) {
+		return s.next.CreateEventLog(p, req)
+	})
+}
+
+func (s *tracedEventLogService) GetEventLogs(req request.GetEventLogRequest) ([]models.EventLog, response.PageInfo, error) {
+	return spanPage(s.t, "EventLogService.GetEventLogs", nil, func() ([]models.EventLog, response.PageInfo, error) {
+		return s.next.GetEventLogs(req)
+	})
+}
+
+func (s *tracedEventLogService) ImportEventLogs(p string, r io.Reader, req request.ImportRequest) (*response.ImportResult, error) {
+	return span(s.t, "EventLogService.ImportEventLogs", []attribute.KeyValue{Project(p)}, func() (*response.ImportResult, error) {
+		return s.next.ImportEventLogs(p, r, req)
+	})
+}
+
+func (s *tracedEventLogService) ExportEventLogs(w io.Writer, exportReq request.ExportRequest, req request.GetEventLogRequest) (int64, error) {
+	return span(s.t, "EventLogService.ExportEventLogs", nil, func() (int64, error) {
+		return s.next.ExportEventLogs(w, exportReq, req)
+	})
+}
+
+type tracedCampaignEventLogService struct {
+	next service.CampaignEventLogService
+	t    *Telemetry
+}
+
+func TraceCampaignEventLogService(next service.CampaignEventLogService, t *Telemetry) service.CampaignEventLogService {
+	return &tracedCampaignEventLogService{next: next, t: t}
+}
+
+func (s *tracedCampaignEventLogService) GetCampaignEventLogs(req request.GetCampaignEventLogRequest) ([]models.CampaignEventLog, response.PageInfo, error) {
+	return spanPage(s.t, "CampaignEventLogService.GetCampaignEventLogs", nil, func() ([]models.CampaignEventLog, response.PageInfo, error) {
+		return s.next.GetCampaignEventLogs(req)
+	})
+}
+
+type tracedRewardService struct {
+	next service.RewardService
+	t    *Telemetry
+}
+
+func TraceRewardService(next service.RewardService, t *Telemetry) service.RewardService {
+	return &tracedRewardService{next: next, t: t}
+}
+
+func (s *tracedRewardService) GetTotalRewards(req request.GetRewardRequest) (decimal.Decimal, error) {
+	return span(s.t, "RewardService.GetTotalRewards", nil, func() (decimal.Decimal, error) {
+		return s.next.GetTotalRewards(req)
+	})
+}
+
+func (s *tracedRewardService) GetRewards(req request.GetRewardRequest) ([]models.Reward, response.PageInfo, error) {
+	return spanPage(s.t, "RewardService.GetRewards", nil, func() ([]models.Reward, response.PageInfo, error) {
+		return s.next.GetRewards(req)
+	})
+}
+
+func (s *tracedRewardService) GetNewReferrerCount(req request.GetRewardRequest) (int64, error) {
+	return span(s.t, "RewardService.GetNewReferrerCount", nil, func() (int64, error) {
+		return s.next.GetNewReferrerCount(req)
+	})
+}
+
+func (s *tracedRewardService) GetNewRefereeCount(req request.GetRewardRequest) (int64, error) {
+	return span(s.t, "RewardService.GetNewRefereeCount", nil, func() (int64, error) {
+		return s.next.GetNewRefereeCount(req)
+	})
+}
+
+func (s *tracedRewardService) ExportRewards(w io.Writer, exportReq request.ExportRequest, req request.GetRewardRequest) (int64, error) {
+	return span(s.t, "RewardService.ExportRewards", nil, func() (int64, error) {
+		return s.next.ExportRewards(w, exportReq, req)
+	})
+}
+
+type tracedAggregatorService struct {
+	next service.AggregatorService
+	t    *Telemetry
+}
+
+func TraceAggregatorService(next service.AggregatorService, t *Telemetry) service.AggregatorService {
+	return &tracedAggregatorService{next: next, t: t}
+}
+
+func (s *tracedAggregatorService) GetReferrerMembersStats(req request.GetMemberRequest) ([]response.ReferrerStats, response.PageInfo, error) {
+	return spanPage(s.t, "AggregatorService.GetReferrerMembersStats", nil, func() ([]response.ReferrerStats, response.PageInfo, error) {
+		return s.next.GetReferrerMembersStats(req)
+	})
+}
+
+func (s *tracedAggregatorService) GetRewardsStats(req request.GetRewardRequest) ([]response.RewardStats, error) {
+	return span(s.t, "AggregatorService.GetRewardsStats", nil, func() ([]response.RewardStats, error) {
+		return s.next.GetRewardsStats(req)
+	})
+}
+
+type tracedWorker struct {
+	next service.Worker
+	t    *Telemetry
+}
+
+func TraceWorker(next service.Worker, t *Telemetry) service.Worker {
+	return &tracedWorker{next: next, t: t}
+}
+
+func (w *tracedWorker) ProcessPendingEvents() error {
+	_, err := span(w.t, "Worker.ProcessPendingEvents", nil, func() (struct{}, error) {
+		return struct{}{}, w.next.ProcessPendingEvents()
+	})
+	return err
+}
+
+func (w *tracedWorker) Simulate(p string, req request.SimulateRequest) (*response.Simulation, error) {
+	return span(w.t, "Worker.Simulate", []attribute.KeyValue{Project(p)}, func() (*response.Simulation, error) {
+		return w.next.Simulate(p, req)
+	})
+}
@@ -0,0 +1,59 @@
+package go_referral
+
+import (
+	"fmt"
+	db2 "github.com/PayRam/go-referral/internal/db"
+	"github.com/PayRam/go-referral/internal/serviceimpl"
+	"github.com/PayRam/go-referral/response"
+	"gorm.io/gorm"
+)
+
+// Migrate applies the pending migrations, for applications that run them apart from NewReferralService (see
+// WithSkipMigrations). Only WithLogger, WithTablePrefix and WithSchema apply. It returns a SchemaVersionError if the
+// database has migrations this version does not know.
+func Migrate(db *gorm.DB, opts ...Option) error {
+	c := newConfig(opts)
+	db, err := c.namedDB(db)
+	if err != nil {
+		return err
+	}
+	return db2.Migrate(db, c.logger)
+}
+
+// Rollback rolls back, newest first, the migrations applied after the migration with id to. Rolling back to the
+// first migration keeps the initial tables; their data is lost with any column or table a rolled back migration
+// had added. Only WithLogger, WithTablePrefix and WithSchema apply.
+func Rollback(db *gorm.DB, to string, opts ...Option) error {
+	c := newConfig(opts)
+	db, err := c.namedDB(db)
+	if err != nil {
+		return err
+	}
+	return db2.Rollback(db, to, c.logger)
+}
+
+// MigrationStatus lists the migrations of this version in the order they run, with whether each was applied,
+// followed by any applied migration this version does not know. Only WithTablePrefix and WithSchema apply.
+func MigrationStatus(db *gorm.DB, opts ...Option) ([]response.MigrationStatus, error) {
+	db, err := newConfig(opts).namedDB(db)
+	if err != nil {
+		return nil, err
+	}
+	return db2.Status(db)
+}
+
+// ReencryptPII encrypts with the current key of the provider of WithKeyProvider the emails of members and the data of
+// event logs stored in plaintext or with another key, and indexes the emails. Run it after enabling encryption and
+// after rotating keys; it works in batches committed on their own, so it can be run again after a failure. Only
+// WithKeyProvider, WithTablePrefix and WithSchema apply.
+func ReencryptPII(db *gorm.DB, opts ...Option) (*response.ReencryptionResult, error) {
+	c := newConfig(opts)
+	if c.keyProvider == nil {
+		return nil, fmt.Errorf("no key provider: use WithKeyProvider")
+	}
+	db, err := c.namedDB(db)
+	if err != nil {
+		return nil, err
+	}
+	return serviceimpl.ReencryptPII(db, c.keyProvider)
+}
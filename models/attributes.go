@@ -0,0 +1,81 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Types of the custom attributes of members
+const (
+	AttributeTypeString = "string"
+	AttributeTypeNumber = "number"
+	AttributeTypeBool   = "bool"
+)
+
+// Attributes are the custom attributes of a member by key, e.g. its country or plan. Values are strings, numbers or
+// booleans. They are stored as JSON, numbers reading back as float64.
+type Attributes map[string]interface{}
+
+// GormDataType stores the attributes in a JSON column, including in the structs of the aggregates
+func (Attributes) GormDataType() string {
+	return "json"
+}
+
+// Value stores the attributes as JSON
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(map[string]interface{}(a))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attributes: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scan reads attributes stored as JSON
+func (a *Attributes) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into attributes", value)
+	}
+	return json.Unmarshal(data, (*map[string]interface{})(a))
+}
+
+// AttributeType returns the type of an attribute value, and false for values of no attribute type
+func AttributeType(value interface{}) (string, bool) {
+	switch value.(type) {
+	case string:
+		return AttributeTypeString, true
+	case bool:
+		return AttributeTypeBool, true
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, json.Number:
+		return AttributeTypeNumber, true
+	}
+	return "", false
+}
+
+// AttributeText formats an attribute value the way MemberAttribute indexes it, e.g. "3" for the number 3.0
+func AttributeText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(value)
+}
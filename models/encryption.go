@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"github.com/PayRam/go-referral/encryption"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"reflect"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+type keyProviderKey struct{}
+
+// WithKeyProvider returns a session of db encrypting the fields tagged serializer:encrypted, e.g. Member.Email, with
+// the keys of p. Without a provider, the default, they are stored in plaintext. Values are decrypted whatever their
+// key, and read as they are when stored in plaintext, so encryption can be enabled on an existing database. The
+// provider travels with the context of the session, so it applies to the sessions and transactions derived from it
+// only, as NewReferralService sets it.
+func WithKeyProvider(db *gorm.DB, p encryption.KeyProvider) *gorm.DB {
+	return db.WithContext(context.WithValue(db.Statement.Context, keyProviderKey{}, p))
+}
+
+// KeyProviderOf returns the provider of db set by WithKeyProvider, or nil
+func KeyProviderOf(db *gorm.DB) encryption.KeyProvider {
+	return keyProviderFrom(db.Statement.Context)
+}
+
+func keyProviderFrom(ctx context.Context) encryption.KeyProvider {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(keyProviderKey{}).(encryption.KeyProvider)
+	return p
+}
+
+// EncryptedSerializer encrypts string and *string fields with the key provider of the DB (see WithKeyProvider)
+type EncryptedSerializer struct{}
+
+// Scan decrypts the value read from the database
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	fieldValue := reflect.New(field.FieldType).Elem()
+	if dbValue != nil {
+		var value string
+		switch v := dbValue.(type) {
+		case []byte:
+			value = string(v)
+		case string:
+			value = v
+		default:
+			return fmt.Errorf("cannot scan %T into encrypted field %s", dbValue, field.Name)
+		}
+		plaintext, err := DecryptString(keyProviderFrom(ctx), value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", field.Name, err)
+		}
+		if fieldValue.Kind() == reflect.Ptr {
+			fieldValue.Set(reflect.ValueOf(&plaintext))
+		} else {
+			fieldValue.SetString(plaintext)
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue)
+	return nil
+}
+
+// Value encrypts the value written to the database
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, _ reflect.Value, fieldValue interface{}) (interface{}, error) {
+	var plaintext string
+	switch v := fieldValue.(type) {
+	case string:
+		plaintext = v
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		plaintext = *v
+	default:
+		return nil, fmt.Errorf("cannot encrypt %T field %s", fieldValue, field.Name)
+	}
+	p := keyProviderFrom(ctx)
+	if p == nil {
+		return plaintext, nil
+	}
+	return encryption.Encrypt(p, plaintext)
+}
+
+// DecryptString decrypts with p, which may be nil, a value read without the serializer, e.g. by a raw query. Plaintext
+// values are returned as they are.
+func DecryptString(p encryption.KeyProvider, value string) (string, error) {
+	if p == nil {
+		if _, encrypted := encryption.KeyID(value); encrypted {
+			return "", fmt.Errorf("value is encrypted but no key provider is set")
+		}
+		return value, nil
+	}
+	return encryption.Decrypt(p, value)
+}
+
+// EmailIndex returns the blind index of an email, or nil without a key provider or an email
+func EmailIndex(p encryption.KeyProvider, email *string) (*string, error) {
+	if p == nil || email == nil {
+		return nil, nil
+	}
+	index, err := encryption.BlindIndex(p, *email)
+	if err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// BeforeSave keeps the blind index of the email in step with the email
+func (m *Member) BeforeSave(tx *gorm.DB) error {
+	index, err := EmailIndex(KeyProviderOf(tx), m.Email)
+	if err != nil {
+		return fmt.Errorf("failed to index email: %w", err)
+	}
+	m.EmailIndex = index
+	return nil
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 	"time"
 )
 
@@ -36,71 +37,192 @@ type Campaign struct {
 	ValidityMonthsPerCustomer *int             `gorm:"" json:"validityMonthsPerCustomer"`                     // 0 for no time limit
 	RewardCapPerCustomer      *decimal.Decimal `gorm:"type:decimal(38,18)" json:"rewardCapPerCustomer"`       // Maximum reward for percentage type
 
+	InactiveReferrerPolicy   string `gorm:"size:50;default:'hold';not null" json:"inactiveReferrerPolicy"` // What happens to the rewards of inactive referrers: "forfeit" or "hold"
+	InactiveReferrerHoldDays *int   `gorm:"" json:"inactiveReferrerHoldDays"`                              // For "hold", the days inactive referrers have to be reactivated in
+
 	ConsiderEventsFrom time.Time `gorm:"not null;index" json:"considerEventsFrom"` // Timestamp for event consideration
 
 	Events []Event `gorm:"many2many:referral_campaign_events" json:"events"` // Associated events
 }
 
-func (Campaign) TableName() string {
-	return "referral_campaigns"
+func (Campaign) TableName(namer schema.Namer) string {
+	return TableName(namer, "campaigns")
 }
 
+// Policies of Campaign for the rewards of inactive referrers
+const (
+	InactiveReferrerForfeit = "forfeit" // The rewards are created forfeited
+	InactiveReferrerHold    = "hold"    // The rewards are held, and forfeited unless the referrer is reactivated in time
+
+	DefaultInactiveReferrerHoldDays = 30
+)
+
 // Event represents an action within a campaign that can trigger a reward
 type Event struct {
 	BaseModel
-	Project     string  `gorm:"size:100;not null;uniqueIndex:idx_event_project_key" seeder:"no-update" json:"project"`
-	Key         string  `gorm:"size:100;not null;uniqueIndex:idx_event_project_key" seeder:"no-update" json:"key"`
+	Project     string  `gorm:"size:100;not null;uniqueIndex:,composite:project_key" seeder:"no-update" json:"project"`
+	Key         string  `gorm:"size:100;not null;uniqueIndex:,composite:project_key" seeder:"no-update" json:"key"`
 	Name        string  `gorm:"size:255;not null;index" seeder:"no-update" json:"name"`
 	EventType   string  `gorm:"size:100;not null;index" seeder:"no-update" json:"eventType"`
 	Description *string `gorm:"type:text" seeder:"no-update" json:"description"`
 }
 
-func (Event) TableName() string {
-	return "referral_events"
+func (Event) TableName(namer schema.Namer) string {
+	return TableName(namer, "events")
 }
 
 type CampaignEvent struct {
 	Project    string   `gorm:"not null;size:100;index" json:"project"`
-	CampaignID uint     `gorm:"not null;uniqueIndex:idx_campaign_id_event_id" json:"campaignId"`
-	EventID    uint     `gorm:"not null;uniqueIndex:idx_campaign_id_event_id" json:"eventId"`
+	CampaignID uint     `gorm:"not null;uniqueIndex:,composite:campaign_event" json:"campaignId"`
+	EventID    uint     `gorm:"not null;uniqueIndex:,composite:campaign_event" json:"eventId"`
 	EventKey   string   `gorm:"not null;size:100;index" json:"eventKey"`
 	Campaign   Campaign `gorm:"foreignKey:CampaignID;references:ID" json:"campaign"`
 	Event      Event    `gorm:"foreignKey:EventID;references:ID" json:"event"`
 }
 
-func (CampaignEvent) TableName() string {
-	return "referral_campaign_events"
+func (CampaignEvent) TableName(namer schema.Namer) string {
+	return TableName(namer, "campaign_events")
 }
 
+// Statuses of Member
+const (
+	MemberStatusActive    = "active"
+	MemberStatusInactive  = "inactive"  // Its referrals earn no rewards
+	MemberStatusSuspended = "suspended" // Its new rewards are held until it is active again
+	MemberStatusBanned    = "banned"    // Its pending rewards are forfeited, and its referrals earn no more rewards. Final.
+)
+
 type Member struct {
 	BaseModel
-	Project     string  `gorm:"size:100;not null;uniqueIndex:idx_referrer_project_reference_id" json:"project"`
-	ReferenceID string  `gorm:"size:100;not null;uniqueIndex:idx_referrer_project_reference_id" json:"referenceId"`
-	Email       *string `gorm:"size:100;" json:"email"`
-	Code        string  `gorm:"size:50;uniqueIndex;not null" json:"code"`
+	Project     string  `gorm:"size:100;not null;uniqueIndex:,composite:project_reference_id" json:"project"`
+	ReferenceID string  `gorm:"size:100;not null;uniqueIndex:,composite:project_reference_id" json:"referenceId"`
+	Email       *string `gorm:"size:512;serializer:encrypted" json:"email"` // Encrypted with a key provider, see WithKeyProvider
+	EmailIndex  *string `gorm:"size:64;index" json:"-"`                     // Blind index of the email, with a key provider
+	Code        string  `gorm:"size:50;not null" json:"code"`               // Unique per project, by an index of the SQL migrations
 	Status      string  `gorm:"size:50;default:'active';index" json:"status"`
 
-	ReferredByMemberID          *uint   `gorm:"index" json:"referredByMemberID"`          // Nullable, points to another Member
-	ReferredByMemberReferenceID *string `gorm:"index" json:"referredByMemberReferenceID"` // Nullable, points to another Member
-	ReferredByMember            *Member `gorm:"foreignKey:ReferredByMemberID" json:"referredByMember,omitempty"`
+	Attributes Attributes `gorm:"type:json" json:"attributes,omitempty"` // Custom attributes, indexed by MemberAttribute
+
+	ReferredByMemberID          *uint         `gorm:"index" json:"referredByMemberID"`          // Nullable, points to another Member
+	ReferredByMemberReferenceID *string       `gorm:"index" json:"referredByMemberReferenceID"` // Nullable, points to another Member
+	ReferredByMember            *Member       `gorm:"foreignKey:ReferredByMemberID" json:"referredByMember,omitempty"`
+	ReferredByCodeID            *uint         `gorm:"index" json:"referredByCodeID"` // Referral code the member signed up with
+	ReferredByCode              *ReferralCode `gorm:"foreignKey:ReferredByCodeID;constraint:-" json:"referredByCode,omitempty"`
+	ReferrerAttachedAt          *time.Time    `json:"referrerAttachedAt"` // Set when the referrer was attached after signup
+	RewardEventsFrom            *time.Time    `json:"rewardEventsFrom"`   // Event logs triggered before do not earn referral rewards
 
 	Campaigns []Campaign `gorm:"many2many:referral_member_campaigns;joinForeignKey:MemberID;joinReferences:CampaignID" json:"campaigns"`
 }
 
-func (Member) TableName() string {
-	return "referral_members"
+func (Member) TableName(namer schema.Namer) string {
+	return TableName(namer, "members")
+}
+
+// Enrollment is a period during which a member was enrolled in a campaign. The enrollments in progress, those without
+// EndedAt, are also the MemberCampaign rows.
+type Enrollment struct {
+	BaseModel
+	Project           string     `gorm:"size:100;not null;index" json:"project"`
+	MemberID          uint       `gorm:"not null;index:,composite:member_campaign,priority:1" json:"memberID"`
+	MemberReferenceID string     `gorm:"size:100;not null;index" json:"memberReferenceID"`
+	CampaignID        uint       `gorm:"not null;index:,composite:member_campaign,priority:2;index" json:"campaignID"`
+	StartedAt         time.Time  `gorm:"not null;index" json:"startedAt"`
+	EndedAt           *time.Time `gorm:"index" json:"endedAt"` // Nil while the member is enrolled
+}
+
+func (Enrollment) TableName(namer schema.Namer) string {
+	return TableName(namer, "enrollments")
+}
+
+// MemberAttribute indexes one custom attribute of a member, so that members can be filtered by their attributes. The
+// rows follow Member.Attributes, which remains the source of the values.
+type MemberAttribute struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Project  string `gorm:"size:100;not null;index:,composite:lookup,priority:1" json:"project"`
+	MemberID uint   `gorm:"not null;uniqueIndex:,composite:member_key,priority:1" json:"memberID"`
+	Key      string `gorm:"size:100;not null;uniqueIndex:,composite:member_key,priority:2;index:,composite:lookup,priority:2" json:"key"`
+	Value    string `gorm:"size:255;not null;index:,composite:lookup,priority:3" json:"value"` // AttributeText of the value
+	Type     string `gorm:"size:20;not null" json:"type"`
+}
+
+func (MemberAttribute) TableName(namer schema.Namer) string {
+	return TableName(namer, "member_attributes")
 }
 
 type MemberCampaign struct {
 	Project    string   `gorm:"not null;size:100;" json:"project"`
-	MemberID   uint     `gorm:"not null;uniqueIndex:idx_referral_referrer_campaign" json:"memberID"`
-	CampaignID uint     `gorm:"not null;uniqueIndex:idx_referral_referrer_campaign" json:"campaignID"`
+	MemberID   uint     `gorm:"not null;uniqueIndex:,composite:member_campaign" json:"memberID"`
+	CampaignID uint     `gorm:"not null;uniqueIndex:,composite:member_campaign" json:"campaignID"`
 	Campaign   Campaign `gorm:"foreignKey:CampaignID;references:ID" json:"campaign"`
 	Member     Member   `gorm:"foreignKey:MemberID;references:ID" json:"member"`
 }
 
-func (MemberCampaign) TableName() string {
-	return "referral_member_campaigns"
+func (MemberCampaign) TableName(namer schema.Namer) string {
+	return TableName(namer, "member_campaigns")
+}
+
+// ReferralCode is a code a member refers others with. Every member has a primary code, the one in Member.Code, and
+// may have more, e.g. one per channel or one bound to a campaign. Codes are unique per project.
+type ReferralCode struct {
+	BaseModel
+	Project           string     `gorm:"size:100;not null;uniqueIndex:,composite:project_code" json:"project"`
+	Code              string     `gorm:"size:50;not null;uniqueIndex:,composite:project_code" json:"code"`
+	MemberID          uint       `gorm:"not null;index" json:"memberID"`
+	MemberReferenceID string     `gorm:"size:100;not null;index" json:"memberReferenceID"`
+	IsPrimary         bool       `gorm:"not null;default:false" json:"isPrimary"` // The code of Member.Code
+	Channel           *string    `gorm:"size:100;index" json:"channel"`           // e.g. "twitter", "newsletter"
+	CampaignID        *uint      `gorm:"index" json:"campaignID"`                 // Only this campaign rewards the referrals of the code
+	UsageLimit        *int64     `gorm:"" json:"usageLimit"`                      // Referrals the code accepts, nil for no limit
+	UsageCount        int64      `gorm:"not null;default:0" json:"usageCount"`    // Members who signed up with the code
+	ExpiresAt         *time.Time `gorm:"index" json:"expiresAt"`                  // The code is refused from then on
+
+	Member *Member `gorm:"foreignKey:MemberID;references:ID" json:"member,omitempty"`
+}
+
+func (ReferralCode) TableName(namer schema.Namer) string {
+	return TableName(namer, "codes")
+}
+
+// Actions of AuditLog
+const (
+	AuditActionAttachReferrer = "attach_referrer"
+	AuditActionStatusChange   = "status_change"
+	AuditActionForget         = "forget"
+)
+
+// AuditLog records a change made to a member by an operator rather than by its own lifecycle, e.g. a referrer
+// attached after signup
+type AuditLog struct {
+	BaseModel
+	Project           string  `gorm:"size:100;not null;index" json:"project"`
+	MemberID          uint    `gorm:"not null;index" json:"memberID"`
+	MemberReferenceID string  `gorm:"size:100;not null;index" json:"memberReferenceID"`
+	Action            string  `gorm:"size:50;not null;index" json:"action"`
+	Actor             *string `gorm:"size:100;index" json:"actor"` // Who made the change, e.g. a support agent
+	Reason            *string `gorm:"type:text" json:"reason"`
+	Data              *string `gorm:"type:json" json:"data"` // Details of the change, e.g. the referrer attached
+}
+
+func (AuditLog) TableName(namer schema.Namer) string {
+	return TableName(namer, "audit_logs")
+}
+
+// Click is a visit of a referral link of a code. A member signing up without a referrer code but with the visitor ID
+// of clicks is referred by the code of one of them, following the attribution policy of the project.
+type Click struct {
+	BaseModel
+	Project                 string    `gorm:"size:100;not null;index:,composite:project_visitor" json:"project"`
+	VisitorID               string    `gorm:"size:100;not null;index:,composite:project_visitor" json:"visitorID"` // Anonymous ID of the visitor, e.g. from a cookie
+	ReferralCodeID          uint      `gorm:"not null;index" json:"referralCodeID"`
+	Code                    string    `gorm:"size:50;not null" json:"code"`
+	Channel                 *string   `gorm:"size:100;index" json:"channel"`
+	ClickedAt               time.Time `gorm:"not null;index" json:"clickedAt"`
+	SignupMemberID          *uint     `gorm:"index" json:"signupMemberID"` // Member the click was attributed to
+	SignupMemberReferenceID *string   `gorm:"size:100;index" json:"signupMemberReferenceID"`
+}
+
+func (Click) TableName(namer schema.Namer) string {
+	return TableName(namer, "clicks")
 }
 
 type EventLog struct {
@@ -111,17 +233,23 @@ type EventLog struct {
 	MemberReferenceID string           `gorm:"size:100;not null;index" json:"memberReferenceID"`
 	Amount            *decimal.Decimal `gorm:"type:decimal(38,18);index" json:"amount"`
 	TriggeredAt       time.Time        `gorm:"not null;index" json:"triggeredAt"`
-	Data              *string          `gorm:"type:json;" json:"data"`
+	Data              *string          `gorm:"type:text;serializer:encrypted" json:"data"` // JSON, encrypted with a key provider
 	Status            string           `gorm:"size:50;default:'pending';not null;index" json:"status"`
 	FailureReason     *string          `gorm:"type:text" json:"failureReason"`
 
 	Member *Member `gorm:"foreignKey:MemberID;references:ID" json:"member"`
 }
 
-func (EventLog) TableName() string {
-	return "referral_event_logs"
+func (EventLog) TableName(namer schema.Namer) string {
+	return TableName(namer, "event_logs")
 }
 
+// Statuses of EventLog
+const (
+	EventLogStatusPending = "pending"
+	EventLogStatusFailed  = "failed" // Rewarded by no campaign, for its FailureReason, e.g. once the member is banned
+)
+
 type CampaignEventLog struct {
 	BaseModel
 	Project           string `gorm:"size:100;not null;index" json:"project"`
@@ -141,10 +269,23 @@ type CampaignEventLog struct {
 	RefereeReward  *Reward   `gorm:"foreignKey:RefereeRewardID" json:"refereeReward"`
 }
 
-func (CampaignEventLog) TableName() string {
-	return "referral_campaign_event_logs"
+func (CampaignEventLog) TableName(namer schema.Namer) string {
+	return TableName(namer, "campaign_event_logs")
 }
 
+// Statuses of CampaignEventLog
+const (
+	CampaignEventLogStatusProcessed = "processed"
+	CampaignEventLogStatusRejected  = "rejected" // Not rewarded by the campaign, e.g. referred with a code of another campaign
+)
+
+// Statuses of Reward
+const (
+	RewardStatusPending   = "pending"
+	RewardStatusOnHold    = "on_hold"   // Not payable until released, e.g. while the member is suspended
+	RewardStatusForfeited = "forfeited" // Never payable, e.g. once the member is banned. Not counted against budgets and caps.
+)
+
 type Reward struct {
 	BaseModel
 	Project                   string          `gorm:"size:100;not null;index" json:"project"`
@@ -158,11 +299,12 @@ type Reward struct {
 	Amount                    decimal.Decimal `gorm:"type:decimal(38,18);not null;index" json:"amount"`
 	Status                    string          `gorm:"size:50;default:'pending';not null;index" json:"status"`
 	Reason                    *string         `gorm:"type:text" json:"reason"`
+	HoldExpiresAt             *time.Time      `gorm:"index" json:"holdExpiresAt"` // Held rewards still held by then are forfeited by the worker
 
 	RewardedMember *Member `gorm:"foreignKey:RewardedMemberID;references:ID" json:"rewardedMember,omitempty"`
 	RelatedMember  *Member `gorm:"foreignKey:RelatedMemberID;references:ID" json:"relatedMember,omitempty"`
 }
 
-func (Reward) TableName() string {
-	return "referral_rewards"
+func (Reward) TableName(namer schema.Namer) string {
+	return TableName(namer, "rewards")
 }
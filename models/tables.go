@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultTablePrefix is prepended to the name of every table unless a Naming sets another prefix
+const DefaultTablePrefix = "referral_"
+
+// Naming names the tables of the models, e.g. schema "referral" and prefix "" for referral.campaigns. It is the
+// NamingStrategy of the *gorm.DB the models are used with (see WithNaming), so each DB follows its own naming. The
+// names of the columns, indexes and of any other model are left to Namer.
+type Naming struct {
+	schema.Namer
+	Schema string // Empty for the default schema of the connection
+	Prefix string
+}
+
+// DefaultNaming returns the naming of the DBs without one: the default schema and DefaultTablePrefix
+func DefaultNaming() Naming {
+	return Naming{Namer: schema.NamingStrategy{IdentifierMaxLength: 64}, Prefix: DefaultTablePrefix}
+}
+
+// Table returns the qualified name of the table called name, e.g. Table("members") is "referral_members" by default
+func (n Naming) Table(name string) string {
+	return n.Qualify(n.Prefix + name)
+}
+
+// Qualify prepends the schema to name, e.g. the name of an index
+func (n Naming) Qualify(name string) string {
+	if n.Schema != "" {
+		return n.Schema + "." + name
+	}
+	return name
+}
+
+// MigrationsTable returns the table recording the migrations that ran. It keeps its historical name "migrations"
+// unless a schema or a prefix other than the default is set.
+func (n Naming) MigrationsTable() string {
+	if n.Schema == "" && n.Prefix == DefaultTablePrefix {
+		return "migrations"
+	}
+	return n.Table("migrations")
+}
+
+// NamingOf returns the naming of db, set by WithNaming, or DefaultNaming
+func NamingOf(db *gorm.DB) Naming {
+	if n, ok := db.NamingStrategy.(Naming); ok {
+		return n
+	}
+	n := DefaultNaming()
+	if db.NamingStrategy != nil {
+		n.Namer = db.NamingStrategy
+	}
+	return n
+}
+
+// Table returns the qualified name of the table called name in db. Raw queries use it so that they follow the naming
+// of db like the models do.
+func Table(db *gorm.DB, name string) string {
+	return NamingOf(db).Table(name)
+}
+
+// WithNaming returns a session of db naming the tables of the models with naming. GORM caches the table names of the
+// models per DB opened, so it fails if db has already used them under another naming: each naming needs its own
+// gorm.Open, possibly sharing the connection pool.
+func WithNaming(db *gorm.DB, naming Naming) (*gorm.DB, error) {
+	naming.Namer = NamingOf(db).Namer
+	tx := db.Session(&gorm.Session{})
+	tx.Config.NamingStrategy = naming
+
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(&Member{}); err != nil {
+		return nil, fmt.Errorf("failed to parse the models: %w", err)
+	}
+	if want := naming.Table("members"); stmt.Schema.Table != want {
+		return nil, fmt.Errorf("db already names the members table %s rather than %s: open another gorm.DB for this naming",
+			stmt.Schema.Table, want)
+	}
+	return tx, nil
+}
+
+// TableName names the table of a model called name with namer, the NamingStrategy of the DB. The TableName methods of
+// the models use it, as do the snapshots of the models the migrations keep.
+func TableName(namer schema.Namer, name string) string {
+	if n, ok := namer.(Naming); ok {
+		return n.Table(name)
+	}
+	return DefaultTablePrefix + name
+}
@@ -0,0 +1,209 @@
+package go_referral
+
+import (
+	"github.com/PayRam/go-referral/clock"
+	"github.com/PayRam/go-referral/encryption"
+	"github.com/PayRam/go-referral/models"
+	"github.com/PayRam/go-referral/service"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"log/slog"
+)
+
+// Option configures the ReferralService returned by NewReferralService
+type Option func(*config)
+
+type config struct {
+	logger           *slog.Logger
+	clock            clock.Clock
+	meterProvider    metric.MeterProvider
+	tracerProvider   trace.TracerProvider
+	codeGenerator    service.CodeGenerator
+	codePolicies     map[string]service.CodePolicy
+	attribution      map[string]service.AttributionPolicy
+	lateReferral     map[string]service.LateReferralPolicy
+	attributes       map[string]service.AttributeSchema
+	fraudChecks      []service.FraudCheck
+	hooks            service.Hooks
+	skipMigrations   bool
+	tableSchema      *string
+	tablePrefix      *string
+	cursorSigningKey []byte
+	keyProvider      encryption.KeyProvider
+}
+
+// newConfig applies opts over the defaults
+func newConfig(opts []Option) *config {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.logger == nil {
+		c.logger = slog.Default()
+	}
+	return c
+}
+
+// namedDB returns a session of db naming the tables as WithTablePrefix and WithSchema set, or db itself without them
+func (c *config) namedDB(db *gorm.DB) (*gorm.DB, error) {
+	if c.tableSchema == nil && c.tablePrefix == nil {
+		return db, nil
+	}
+	naming := models.NamingOf(db)
+	if c.tableSchema != nil {
+		naming.Schema = *c.tableSchema
+	}
+	if c.tablePrefix != nil {
+		naming.Prefix = *c.tablePrefix
+	}
+	return models.WithNaming(db, naming)
+}
+
+// WithLogger sets the logger of the worker and of the migrations. Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithClock sets the clock the services and the worker read the current time from, e.g. a clocktest.Fake in tests.
+// It also sets the created and updated timestamps of the records. Defaults to clock.Real().
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// WithMeterProvider sets the provider receiving the metrics of the services and of the worker, e.g. rewards created
+// and rejected. Defaults to the global provider of otel, which discards them until the application registers one.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = provider
+	}
+}
+
+// WithTracerProvider sets the provider receiving a span per service method call. Defaults to the global provider of
+// otel.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithCodeGenerator replaces the generator of the referral codes of new members, for the projects whose code policy
+// has no Generator. Defaults to the random codes of the code policies.
+func WithCodeGenerator(generator service.CodeGenerator) Option {
+	return func(c *config) {
+		c.codeGenerator = generator
+	}
+}
+
+// WithCodePolicy sets the code policy of project: the format of generated codes and the rules of vanity codes. An
+// empty project sets the policy of the projects without their own. Defaults to random codes of 7 characters.
+func WithCodePolicy(project string, policy service.CodePolicy) Option {
+	return func(c *config) {
+		if c.codePolicies == nil {
+			c.codePolicies = map[string]service.CodePolicy{}
+		}
+		c.codePolicies[project] = policy
+	}
+}
+
+// WithAttributionPolicy sets how members signing up after clicking referral links of project are attributed to a
+// referrer. An empty project sets the policy of the projects without their own. Defaults to the last click of the past
+// 30 days.
+func WithAttributionPolicy(project string, policy service.AttributionPolicy) Option {
+	return func(c *config) {
+		if c.attribution == nil {
+			c.attribution = map[string]service.AttributionPolicy{}
+		}
+		c.attribution[project] = policy
+	}
+}
+
+// WithLateReferralPolicy sets how long after signup the members of project may get a referrer attached, and which of
+// their events then earn rewards. An empty project sets the policy of the projects without their own. Defaults to 7
+// days, rewarding every pending event.
+func WithLateReferralPolicy(project string, policy service.LateReferralPolicy) Option {
+	return func(c *config) {
+		if c.lateReferral == nil {
+			c.lateReferral = map[string]service.LateReferralPolicy{}
+		}
+		c.lateReferral[project] = policy
+	}
+}
+
+// WithAttributeSchema restricts the custom attributes of the members of project to those of schema, with their
+// types. An empty project sets the schema of the projects without their own. Without a schema, members may have any
+// attributes.
+func WithAttributeSchema(project string, schema service.AttributeSchema) Option {
+	return func(c *config) {
+		if c.attributes == nil {
+			c.attributes = map[string]service.AttributeSchema{}
+		}
+		c.attributes[project] = schema
+	}
+}
+
+// WithFraudChecks adds checks run before a referral or a reward takes effect. Checks run in the order they are
+// added, and the first error refuses the referral or reward.
+func WithFraudChecks(checks ...service.FraudCheck) Option {
+	return func(c *config) {
+		c.fraudChecks = append(c.fraudChecks, checks...)
+	}
+}
+
+// WithHooks sets the functions called after members, rewards and campaign status changes are committed
+func WithHooks(hooks service.Hooks) Option {
+	return func(c *config) {
+		c.hooks = hooks
+	}
+}
+
+// WithSkipMigrations skips the migrations, for applications that run them separately with Migrate (e.g. in a deploy
+// step) or whose database user cannot alter the schema
+func WithSkipMigrations() Option {
+	return func(c *config) {
+		c.skipMigrations = true
+	}
+}
+
+// WithTablePrefix replaces the "referral_" prefix of the table names, e.g. "acme_referral_" for acme_referral_members.
+// An empty prefix leaves the bare names, e.g. members, which is meant to be combined with WithSchema. The naming applies
+// to db only (see models.WithNaming), which must not have used the models under another naming, as GORM caches table
+// names per DB opened.
+func WithTablePrefix(prefix string) Option {
+	return func(c *config) {
+		c.tablePrefix = &prefix
+	}
+}
+
+// WithSchema places the tables in schema, e.g. WithSchema("referral") with WithTablePrefix("") for referral.members.
+// The migrations create the schema on Postgres; on SQLite it must be an attached database. Like WithTablePrefix,
+// the naming applies to db only.
+func WithSchema(schema string) Option {
+	return func(c *config) {
+		c.tableSchema = &schema
+	}
+}
+
+// WithCursorSigningKey sets the key used to sign and verify pagination cursors. Services sharing cursors, e.g. several
+// replicas behind a load balancer, must use the same key. Defaults to a random key per service, so cursors do not
+// survive restarts.
+func WithCursorSigningKey(key []byte) Option {
+	return func(c *config) {
+		c.cursorSigningKey = append([]byte(nil), key...)
+	}
+}
+
+// WithKeyProvider encrypts the emails of members and the data of event logs with the keys of provider, e.g. an
+// encryption.StaticKeyProvider. Members stay searchable by email through a blind index. Values stored before are read
+// as they are until ReencryptPII encrypts them, which also re-encrypts the values of former keys after a rotation.
+// The provider applies only to the services it configures (see models.WithKeyProvider).
+func WithKeyProvider(provider encryption.KeyProvider) Option {
+	return func(c *config) {
+		c.keyProvider = provider
+	}
+}
@@ -0,0 +1,41 @@
+package request
+
+import (
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+)
+
+type GetAuditLogsRequest struct {
+	Projects             []string             `form:"projects"`
+	MemberReferenceID    *string              `form:"memberReferenceID"`
+	Actions              []string             `form:"actions"`
+	Actor                *string              `form:"actor"`
+	PaginationConditions PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
+}
+
+// AllowedFields returns the fields PaginationConditions may sort, select and group audit logs by
+func (GetAuditLogsRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "audit_logs",
+		Sortable:   []string{"id", "project", "member_reference_id", "action", "created_at"},
+		Selectable: []string{"id", "project", "member_id", "member_reference_id", "action", "actor", "reason", "data", "created_at", "updated_at"},
+		Groupable:  []string{"project", "member_reference_id", "action", "actor"},
+	}
+}
+
+func ApplyGetAuditLogsRequest(req GetAuditLogsRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "audit_logs")
+	if len(req.Projects) > 0 {
+		query = query.Where(table+".project IN (?)", req.Projects)
+	}
+	if req.MemberReferenceID != nil {
+		query = query.Where(table+".member_reference_id = ?", *req.MemberReferenceID)
+	}
+	if len(req.Actions) > 0 {
+		query = query.Where(table+".action IN (?)", req.Actions)
+	}
+	if req.Actor != nil {
+		query = query.Where(table+".actor = ?", *req.Actor)
+	}
+	return query
+}
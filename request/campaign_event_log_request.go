@@ -1,6 +1,9 @@
 package request
 
-import "gorm.io/gorm"
+import (
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+)
 
 type GetCampaignEventLogRequest struct {
 	Projects             []string             `form:"projects"` // Filter by projects
@@ -16,37 +19,48 @@ type GetCampaignEventLogRequest struct {
 	PaginationConditions PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
 }
 
+// AllowedFields returns the fields PaginationConditions may sort, select and group campaign event logs by
+func (GetCampaignEventLogRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "campaign_event_logs",
+		Sortable:   []string{"id", "project", "campaign_id", "event_id", "member_id", "member_reference_id", "status", "event_log_id", "created_at", "updated_at"},
+		Selectable: []string{"id", "project", "campaign_id", "event_id", "member_id", "member_reference_id", "status", "event_log_id", "referred_reward_id", "referee_reward_id", "created_at", "updated_at"},
+		Groupable:  []string{"project", "campaign_id", "event_id", "member_id", "member_reference_id", "status"},
+	}
+}
+
 func ApplyGetCampaignEventLogRequest(req GetCampaignEventLogRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "campaign_event_logs")
 	// Apply filters with table name prepended
 	if len(req.Projects) > 0 {
-		query = query.Where("referral_campaign_event_logs.project IN (?)", req.Projects)
+		query = query.Where(table+".project IN (?)", req.Projects)
 	}
 	if len(req.IDs) > 0 {
-		query = query.Where("referral_campaign_event_logs.id IN (?)", req.IDs)
+		query = query.Where(table+".id IN (?)", req.IDs)
 	}
 	if len(req.CampaignIDs) > 0 {
-		query = query.Where("referral_campaign_event_logs.campaign_id IN (?)", req.CampaignIDs)
+		query = query.Where(table+".campaign_id IN (?)", req.CampaignIDs)
 	}
 	if len(req.EventIDs) > 0 {
-		query = query.Where("referral_campaign_event_logs.event_id IN (?)", req.EventIDs)
+		query = query.Where(table+".event_id IN (?)", req.EventIDs)
 	}
 	if len(req.MemberIDs) > 0 {
-		query = query.Where("referral_campaign_event_logs.member_id IN (?)", req.MemberIDs)
+		query = query.Where(table+".member_id IN (?)", req.MemberIDs)
 	}
 	if len(req.MemberReferenceIDs) > 0 {
-		query = query.Where("referral_campaign_event_logs.member_reference_id IN (?)", req.MemberReferenceIDs)
+		query = query.Where(table+".member_reference_id IN (?)", req.MemberReferenceIDs)
 	}
 	if len(req.Status) > 0 {
-		query = query.Where("referral_campaign_event_logs.status IN (?)", req.Status)
+		query = query.Where(table+".status IN (?)", req.Status)
 	}
 	if len(req.EventLogIDs) > 0 {
-		query = query.Where("referral_campaign_event_logs.event_log_id IN (?)", req.EventLogIDs)
+		query = query.Where(table+".event_log_id IN (?)", req.EventLogIDs)
 	}
 	if len(req.ReferredRewardIDs) > 0 {
-		query = query.Where("referral_campaign_event_logs.referred_reward_id IN (?)", req.ReferredRewardIDs)
+		query = query.Where(table+".referred_reward_id IN (?)", req.ReferredRewardIDs)
 	}
 	if len(req.RefereeRewardIDs) > 0 {
-		query = query.Where("referral_campaign_event_logs.referee_reward_id IN (?)", req.RefereeRewardIDs)
+		query = query.Where(table+".referee_reward_id IN (?)", req.RefereeRewardIDs)
 	}
 
 	return query
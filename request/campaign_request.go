@@ -1,6 +1,7 @@
 package request
 
 import (
+	"github.com/PayRam/go-referral/models"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"time"
@@ -26,6 +27,9 @@ type CreateCampaignRequest struct {
 	MaxOccurrencesPerCustomer *int64           `json:"maxOccurrencesPerCustomer"`                  // For "count_per_customer"
 	RewardCapPerCustomer      *decimal.Decimal `json:"rewardCapPerCustomer"`                       // Maximum reward for percentage type
 
+	InactiveReferrerPolicy   *string `json:"inactiveReferrerPolicy"`   // "forfeit" or "hold", defaults to "hold"
+	InactiveReferrerHoldDays *int    `json:"inactiveReferrerHoldDays"` // For "hold", defaults to models.DefaultInactiveReferrerHoldDays
+
 	EventKeys []string `json:"eventKeys"`
 }
 
@@ -50,6 +54,9 @@ type UpdateCampaignRequest struct {
 	MaxOccurrencesPerCustomer *int64           `json:"maxOccurrencesPerCustomer"` // For "count_per_customer"
 	RewardCapPerCustomer      *decimal.Decimal `json:"rewardCapPerCustomer"`      // Maximum reward for percentage type
 
+	InactiveReferrerPolicy   *string `json:"inactiveReferrerPolicy"` // "forfeit" or "hold"
+	InactiveReferrerHoldDays *int    `json:"inactiveReferrerHoldDays"`
+
 	EventKeys []string `json:"eventKeys"`
 }
 
@@ -67,37 +74,48 @@ type GetCampaignsRequest struct {
 	PaginationConditions PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
 }
 
+// AllowedFields returns the fields PaginationConditions may sort, select and group campaigns by
+func (GetCampaignsRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "campaigns",
+		Sortable:   []string{"id", "project", "name", "currency_code", "status", "is_default", "campaign_type_per_customer", "start_date", "end_date", "consider_events_from", "created_at", "updated_at"},
+		Selectable: []string{"id", "project", "name", "reward_type", "reward_value", "currency_code", "reward_cap", "invitee_reward_type", "invitee_reward_value", "invitee_reward_cap", "budget", "description", "start_date", "end_date", "status", "is_default", "campaign_type_per_customer", "max_occurrences_per_customer", "validity_months_per_customer", "reward_cap_per_customer", "inactive_referrer_policy", "inactive_referrer_hold_days", "consider_events_from", "created_at", "updated_at"},
+		Groupable:  []string{"project", "currency_code", "status", "is_default", "reward_type", "campaign_type_per_customer", "inactive_referrer_policy"},
+	}
+}
+
 func ApplyGetCampaignRequest(req GetCampaignsRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "campaigns")
 	// Apply filters with table name prepended
 	if req.Projects != nil && len(req.Projects) > 0 {
-		query = query.Where("referral_campaigns.project IN (?)", req.Projects)
+		query = query.Where(table+".project IN (?)", req.Projects)
 	}
 	if req.IDs != nil && len(req.IDs) > 0 {
-		query = query.Where("referral_campaigns.id IN (?)", req.IDs)
+		query = query.Where(table+".id IN (?)", req.IDs)
 	}
 	if req.Name != nil {
-		query = query.Where("referral_campaigns.name LIKE ?", "%"+*req.Name+"%")
+		query = query.Where(table+".name LIKE ?", "%"+*req.Name+"%")
 	}
 	if req.CurrencyCode != nil {
-		query = query.Where("referral_campaigns.currency_code LIKE ?", "%"+*req.CurrencyCode+"%")
+		query = query.Where(table+".currency_code LIKE ?", "%"+*req.CurrencyCode+"%")
 	}
 	if req.Status != nil {
-		query = query.Where("referral_campaigns.status = ?", *req.Status)
+		query = query.Where(table+".status = ?", *req.Status)
 	}
 	if req.IsDefault != nil {
-		query = query.Where("referral_campaigns.is_default = ?", *req.IsDefault)
+		query = query.Where(table+".is_default = ?", *req.IsDefault)
 	}
 	if req.StartDateMin != nil {
-		query = query.Where("referral_campaigns.start_date >= ?", *req.StartDateMin)
+		query = query.Where(table+".start_date >= ?", *req.StartDateMin)
 	}
 	if req.StartDateMax != nil {
-		query = query.Where("referral_campaigns.start_date <= ?", *req.StartDateMax)
+		query = query.Where(table+".start_date <= ?", *req.StartDateMax)
 	}
 	if req.EndDateMin != nil {
-		query = query.Where("referral_campaigns.end_date >= ?", *req.EndDateMin)
+		query = query.Where(table+".end_date >= ?", *req.EndDateMin)
 	}
 	if req.EndDateMax != nil {
-		query = query.Where("referral_campaigns.end_date <= ?", *req.EndDateMax)
+		query = query.Where(table+".end_date <= ?", *req.EndDateMax)
 	}
 	return query
 }
@@ -121,6 +139,12 @@ func UpdateCampaignFields(req UpdateCampaignRequest, updates map[string]interfac
 	if req.RewardCapPerCustomer != nil {
 		updates["reward_cap_per_customer"] = *req.RewardCapPerCustomer
 	}
+	if req.InactiveReferrerPolicy != nil {
+		updates["inactive_referrer_policy"] = *req.InactiveReferrerPolicy
+	}
+	if req.InactiveReferrerHoldDays != nil {
+		updates["inactive_referrer_hold_days"] = *req.InactiveReferrerHoldDays
+	}
 	if req.RewardType != nil {
 		updates["reward_type"] = *req.RewardType
 	}
@@ -0,0 +1,69 @@
+package request
+
+import (
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type CreateClickRequest struct {
+	Code      string     `json:"code" binding:"required"`
+	VisitorID string     `json:"visitorID" binding:"required"` // Anonymous ID of the visitor, e.g. from a cookie
+	Channel   *string    `json:"channel"`                      // Defaults to the channel of the code
+	ClickedAt *time.Time `json:"clickedAt"`                    // Defaults to now
+}
+
+type GetClicksRequest struct {
+	Projects             []string             `form:"projects"`
+	Code                 *string              `form:"code"`
+	ReferralCodeID       *uint                `form:"referralCodeID"`
+	VisitorID            *string              `form:"visitorID"`
+	Channel              *string              `form:"channel"`
+	IsAttributed         *bool                `form:"isAttributed"` // Whether the click is attributed to a signup
+	ClickedFrom          *time.Time           `form:"clickedFrom"`
+	ClickedTo            *time.Time           `form:"clickedTo"`
+	PaginationConditions PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
+}
+
+// AllowedFields returns the fields PaginationConditions may sort, select and group clicks by
+func (GetClicksRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "clicks",
+		Sortable:   []string{"id", "project", "code", "visitor_id", "clicked_at", "created_at"},
+		Selectable: []string{"id", "project", "visitor_id", "referral_code_id", "code", "channel", "clicked_at", "signup_member_id", "signup_member_reference_id", "created_at", "updated_at"},
+		Groupable:  []string{"project", "referral_code_id", "code", "channel", "visitor_id"},
+	}
+}
+
+func ApplyGetClicksRequest(req GetClicksRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "clicks")
+	if len(req.Projects) > 0 {
+		query = query.Where(table+".project IN (?)", req.Projects)
+	}
+	if req.Code != nil {
+		query = query.Where(table+".code = ?", *req.Code)
+	}
+	if req.ReferralCodeID != nil {
+		query = query.Where(table+".referral_code_id = ?", *req.ReferralCodeID)
+	}
+	if req.VisitorID != nil {
+		query = query.Where(table+".visitor_id = ?", *req.VisitorID)
+	}
+	if req.Channel != nil {
+		query = query.Where(table+".channel = ?", *req.Channel)
+	}
+	if req.IsAttributed != nil {
+		if *req.IsAttributed {
+			query = query.Where(table + ".signup_member_id IS NOT NULL")
+		} else {
+			query = query.Where(table + ".signup_member_id IS NULL")
+		}
+	}
+	if req.ClickedFrom != nil {
+		query = query.Where(table+".clicked_at >= ?", *req.ClickedFrom)
+	}
+	if req.ClickedTo != nil {
+		query = query.Where(table+".clicked_at < ?", *req.ClickedTo)
+	}
+	return query
+}
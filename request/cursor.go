@@ -0,0 +1,335 @@
+package request
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/response"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewCursorKey returns a random key to sign pagination cursors with, for services that are not given one. Cursors
+// signed with it do not survive restarts, nor verify on other replicas.
+func NewCursorKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate cursor signing key: %w", err)
+	}
+	return key, nil
+}
+
+const (
+	cursorNext = "n"
+	cursorPrev = "p"
+)
+
+// sortKey is one column of the ORDER BY of a list request
+type sortKey struct {
+	Field  string // Name accepted from callers
+	Column string // Qualified column
+	Desc   bool
+}
+
+func (k sortKey) String() string {
+	if k.Desc {
+		return k.Field + ":desc"
+	}
+	return k.Field + ":asc"
+}
+
+// cursorValue is a typed sort key value, so it can be bound back into a query with its original type
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v"`
+}
+
+type cursor struct {
+	Sort      string        `json:"s"` // Sort keys the cursor was produced for
+	Direction string        `json:"d"`
+	Values    []cursorValue `json:"v"`
+}
+
+// usesKeyset reports whether cursors can be produced for conditions: the page must be limited and the rows
+// must be whole records, not groups or partial selections.
+func usesKeyset(conditions PaginationConditions) bool {
+	if conditions.GroupBy != nil && *conditions.GroupBy != "" {
+		return false
+	}
+	if len(conditions.SelectFields) > 0 {
+		return false
+	}
+	return conditions.Cursor != nil || (conditions.Limit != nil && *conditions.Limit > 0)
+}
+
+func sortSignature(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// applyCursor restricts query to the rows after (or before) the cursor and orders it accordingly
+func applyCursor(query *gorm.DB, conditions PaginationConditions, rules FieldRules, key []byte) *gorm.DB {
+	keys, err := conditions.sortKeys(rules, true)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+
+	var c *cursor
+	if conditions.Cursor != nil {
+		decoded, err := decodeCursor(key, *conditions.Cursor)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+		if decoded.Sort != sortSignature(keys) || len(decoded.Values) != len(keys) {
+			query.AddError(errors.Invalid("cursor", errors.CodeInvalid, "invalid cursor: it was issued for a different sort order"))
+			return query
+		}
+		c = decoded
+	}
+
+	backward := c != nil && c.Direction == cursorPrev
+
+	if c != nil {
+		values := make([]interface{}, len(c.Values))
+		for i, value := range c.Values {
+			decoded, err := value.decode()
+			if err != nil {
+				query.AddError(err)
+				return query
+			}
+			values[i] = decoded
+		}
+
+		// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...
+		var clauses []string
+		var args []interface{}
+		for i, key := range keys {
+			var parts []string
+			for j := 0; j < i; j++ {
+				parts = append(parts, keys[j].Column+" = ?")
+				args = append(args, values[j])
+			}
+			operator := ">"
+			if key.Desc != backward {
+				operator = "<"
+			}
+			parts = append(parts, fmt.Sprintf("%s %s ?", key.Column, operator))
+			args = append(args, values[i])
+			clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+		}
+		query = query.Where("("+strings.Join(clauses, " OR ")+")", args...)
+	}
+
+	for _, key := range keys {
+		order := "ASC"
+		if key.Desc != backward {
+			order = "DESC"
+		}
+		query = query.Order(fmt.Sprintf("%s %s", key.Column, order))
+	}
+
+	// Fetch one extra row to find out whether another page follows
+	if conditions.Limit != nil && *conditions.Limit > 0 {
+		query = query.Limit(*conditions.Limit + 1)
+	}
+
+	return query
+}
+
+// BuildPageInfo completes a page fetched with ApplyPaginationConditions: it trims the extra row fetched to
+// detect further pages, restores the requested order when paging backwards, and issues the cursors of the
+// neighbouring pages, signed with key.
+func BuildPageInfo[T any](db *gorm.DB, items *[]T, total int64, conditions PaginationConditions, rules FieldRules, key []byte) (response.PageInfo, error) {
+	page := response.PageInfo{Total: total}
+	if !usesKeyset(conditions) {
+		return page, nil
+	}
+
+	var c *cursor
+	if conditions.Cursor != nil {
+		decoded, err := decodeCursor(key, *conditions.Cursor)
+		if err != nil {
+			return page, err
+		}
+		c = decoded
+	}
+	backward := c != nil && c.Direction == cursorPrev
+
+	hasMore := false
+	if conditions.Limit != nil && *conditions.Limit > 0 && len(*items) > *conditions.Limit {
+		hasMore = true
+		*items = (*items)[:*conditions.Limit]
+	}
+
+	if backward {
+		for i, j := 0, len(*items)-1; i < j; i, j = i+1, j-1 {
+			(*items)[i], (*items)[j] = (*items)[j], (*items)[i]
+		}
+	}
+
+	if len(*items) == 0 {
+		return page, nil
+	}
+
+	keys, err := conditions.sortKeys(rules.in(db), true)
+	if err != nil {
+		return page, err
+	}
+
+	if hasMore || backward {
+		next, err := encodeCursor(db, key, keys, &(*items)[len(*items)-1], cursorNext)
+		if err != nil {
+			return page, err
+		}
+		page.NextCursor = &next
+	}
+
+	hasOffset := conditions.Offset != nil && *conditions.Offset > 0
+	if (backward && hasMore) || (!backward && (c != nil || hasOffset)) {
+		prev, err := encodeCursor(db, key, keys, &(*items)[0], cursorPrev)
+		if err != nil {
+			return page, err
+		}
+		page.PrevCursor = &prev
+	}
+
+	return page, nil
+}
+
+func encodeCursor(db *gorm.DB, signingKey []byte, keys []sortKey, item interface{}, direction string) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(item); err != nil {
+		return "", fmt.Errorf("failed to build cursor: %w", err)
+	}
+
+	c := cursor{Sort: sortSignature(keys), Direction: direction}
+	for _, key := range keys {
+		field := stmt.Schema.LookUpField(key.Field)
+		if field == nil {
+			return "", fmt.Errorf("failed to build cursor: unknown sort field %s", key.Column)
+		}
+		value, _ := field.ValueOf(context.Background(), reflect.ValueOf(item))
+		encoded, err := newCursorValue(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to build cursor for sort field %s: %w", key.Column, err)
+		}
+		c.Values = append(c.Values, encoded)
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to build cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(signingKey, payload)), nil
+}
+
+func decodeCursor(key []byte, value string) (*cursor, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(value, ".")
+	if !found {
+		return nil, errors.Invalid("cursor", errors.CodeInvalid, "invalid cursor")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errors.Invalid("cursor", errors.CodeInvalid, "invalid cursor")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, signCursor(key, payload)) {
+		return nil, errors.Invalid("cursor", errors.CodeInvalid, "invalid cursor: signature mismatch")
+	}
+
+	var c cursor
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, errors.Invalid("cursor", errors.CodeInvalid, "invalid cursor")
+	}
+	if c.Direction != cursorNext && c.Direction != cursorPrev {
+		return nil, errors.Invalid("cursor", errors.CodeInvalid, "invalid cursor direction")
+	}
+
+	return &c, nil
+}
+
+func signCursor(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func newCursorValue(value interface{}) (cursorValue, error) {
+	rv := reflect.ValueOf(value)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return cursorValue{}, errors.New("cannot page past a null sort value, sort by a non-null field")
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return cursorValue{}, errors.New("cannot page past a null sort value, sort by a non-null field")
+	}
+
+	switch v := rv.Interface().(type) {
+	case time.Time:
+		return cursorValue{Type: "time", Value: v.Format(time.RFC3339Nano)}, nil
+	case decimal.Decimal:
+		return cursorValue{Type: "decimal", Value: v.String()}, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return cursorValue{Type: "string", Value: rv.String()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorValue{Type: "int", Value: strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorValue{Type: "uint", Value: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return cursorValue{Type: "float", Value: strconv.FormatFloat(rv.Float(), 'g', -1, 64)}, nil
+	case reflect.Bool:
+		return cursorValue{Type: "bool", Value: strconv.FormatBool(rv.Bool())}, nil
+	default:
+		return cursorValue{}, fmt.Errorf("unsupported sort value type %s", rv.Type())
+	}
+}
+
+func (v cursorValue) decode() (interface{}, error) {
+	var value interface{}
+	var err error
+
+	switch v.Type {
+	case "time":
+		value, err = time.Parse(time.RFC3339Nano, v.Value)
+	case "decimal":
+		value, err = decimal.NewFromString(v.Value)
+	case "string":
+		value = v.Value
+	case "int":
+		value, err = strconv.ParseInt(v.Value, 10, 64)
+	case "uint":
+		value, err = strconv.ParseUint(v.Value, 10, 64)
+	case "float":
+		value, err = strconv.ParseFloat(v.Value, 64)
+	case "bool":
+		value, err = strconv.ParseBool(v.Value)
+	default:
+		err = fmt.Errorf("unknown type %s", v.Type)
+	}
+
+	if err != nil {
+		return nil, errors.Invalid("cursor", errors.CodeInvalid, fmt.Sprintf("invalid cursor value: %v", err))
+	}
+	return value, nil
+}
@@ -0,0 +1,50 @@
+package request
+
+import (
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type GetEnrollmentsRequest struct {
+	Projects             []string             `form:"projects"`
+	MemberReferenceID    *string              `form:"memberReferenceID"`
+	CampaignIDs          []uint               `form:"campaignIDs"`
+	IsActive             *bool                `form:"isActive"`             // Enrollments in progress, or ended
+	ActiveAt             *time.Time           `form:"activeAt"`             // Enrollments in progress at this time
+	PaginationConditions PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
+}
+
+// AllowedFields returns the fields PaginationConditions may sort, select and group enrollments by
+func (GetEnrollmentsRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "enrollments",
+		Sortable:   []string{"id", "project", "member_reference_id", "campaign_id", "started_at", "created_at"},
+		Selectable: []string{"id", "project", "member_id", "member_reference_id", "campaign_id", "started_at", "ended_at", "created_at", "updated_at"},
+		Groupable:  []string{"project", "member_reference_id", "campaign_id"},
+	}
+}
+
+func ApplyGetEnrollmentsRequest(req GetEnrollmentsRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "enrollments")
+	if len(req.Projects) > 0 {
+		query = query.Where(table+".project IN (?)", req.Projects)
+	}
+	if req.MemberReferenceID != nil {
+		query = query.Where(table+".member_reference_id = ?", *req.MemberReferenceID)
+	}
+	if len(req.CampaignIDs) > 0 {
+		query = query.Where(table+".campaign_id IN (?)", req.CampaignIDs)
+	}
+	if req.IsActive != nil {
+		if *req.IsActive {
+			query = query.Where(table + ".ended_at IS NULL")
+		} else {
+			query = query.Where(table + ".ended_at IS NOT NULL")
+		}
+	}
+	if req.ActiveAt != nil {
+		query = query.Where(table+".started_at <= ? AND ("+table+".ended_at IS NULL OR "+table+".ended_at > ?)", *req.ActiveAt, *req.ActiveAt)
+	}
+	return query
+}
@@ -1,8 +1,10 @@
 package request
 
 import (
+	"github.com/PayRam/go-referral/models"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"time"
 )
 
 type CreateEventLogRequest struct {
@@ -12,6 +14,12 @@ type CreateEventLogRequest struct {
 	Data        *string          `json:"data"`
 }
 
+// ImportEventLogRow is a single row of a bulk event log import
+type ImportEventLogRow struct {
+	CreateEventLogRequest
+	TriggeredAt *time.Time `json:"triggeredAt"` // Defaults to the time of the import
+}
+
 type GetEventLogRequest struct {
 	Projects             []string             `form:"projects"` // Filter by name
 	ID                   *uint                `form:"id"`       // Filter by ID
@@ -22,25 +30,36 @@ type GetEventLogRequest struct {
 	PaginationConditions PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
 }
 
+// AllowedFields returns the fields PaginationConditions may sort, select and group event logs by
+func (GetEventLogRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "event_logs",
+		Sortable:   []string{"id", "project", "event_key", "member_id", "member_reference_id", "triggered_at", "status", "created_at", "updated_at"},
+		Selectable: []string{"id", "project", "event_key", "member_id", "member_reference_id", "amount", "triggered_at", "data", "status", "failure_reason", "created_at", "updated_at"},
+		Groupable:  []string{"project", "event_key", "member_id", "member_reference_id", "status"},
+	}
+}
+
 func ApplyGetEventLogRequest(req GetEventLogRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "event_logs")
 	// Apply filters with table name prepended
 	if req.Projects != nil && len(req.Projects) > 0 {
-		query = query.Where("referral_event_logs.project IN (?)", req.Projects)
+		query = query.Where(table+".project IN (?)", req.Projects)
 	}
 	if req.ID != nil {
-		query = query.Where("referral_event_logs.id = ?", *req.ID)
+		query = query.Where(table+".id = ?", *req.ID)
 	}
 	if req.EventKey != nil {
-		query = query.Where("referral_event_logs.event_key = ?", *req.EventKey)
+		query = query.Where(table+".event_key = ?", *req.EventKey)
 	}
 	if req.MemberReferenceID != nil {
-		query = query.Where("referral_event_logs.member_reference_id = ?", *req.MemberReferenceID)
+		query = query.Where(table+".member_reference_id = ?", *req.MemberReferenceID)
 	}
 	if req.Status != nil {
-		query = query.Where("referral_event_logs.status = ?", *req.Status)
+		query = query.Where(table+".status = ?", *req.Status)
 	}
 	if req.RewardID != nil {
-		query = query.Where("referral_event_logs.reward_id = ?", *req.RewardID)
+		query = query.Where(table+".reward_id = ?", *req.RewardID)
 	}
 	return query
 }
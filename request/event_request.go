@@ -1,6 +1,9 @@
 package request
 
-import "gorm.io/gorm"
+import (
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+)
 
 type CreateEventRequest struct {
 	Key         string  `json:"key" binding:"required"`
@@ -23,21 +26,32 @@ type GetEventsRequest struct {
 	PaginationConditions PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
 }
 
+// AllowedFields returns the fields PaginationConditions may sort, select and group events by
+func (GetEventsRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "events",
+		Sortable:   []string{"id", "project", "key", "name", "event_type", "created_at", "updated_at"},
+		Selectable: []string{"id", "project", "key", "name", "event_type", "description", "created_at", "updated_at"},
+		Groupable:  []string{"project", "key", "event_type"},
+	}
+}
+
 func ApplyGetEventRequest(req GetEventsRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "events")
 	if req.Projects != nil && len(req.Projects) > 0 {
-		query = query.Where("referral_events.project IN (?)", req.Projects)
+		query = query.Where(table+".project IN (?)", req.Projects)
 	}
 	if req.ID != nil {
-		query = query.Where("referral_events.id = ?", *req.ID)
+		query = query.Where(table+".id = ?", *req.ID)
 	}
 	if req.Key != nil {
-		query = query.Where("referral_events.key = ?", *req.Key)
+		query = query.Where(table+".key = ?", *req.Key)
 	}
 	if req.Name != nil {
-		query = query.Where("referral_events.name LIKE ?", "%"+*req.Name+"%")
+		query = query.Where(table+".name LIKE ?", "%"+*req.Name+"%")
 	}
 	if req.EventType != nil {
-		query = query.Where("referral_events.event_type = ?", *req.EventType)
+		query = query.Where(table+".event_type = ?", *req.EventType)
 	}
 	return query
 }
@@ -0,0 +1,6 @@
+package request
+
+type ExportRequest struct {
+	Format    string `json:"format" binding:"required"` // "csv" or "jsonl"
+	BatchSize int    `json:"batchSize"`                 // Rows fetched per query, defaults to 1000
+}
@@ -0,0 +1,155 @@
+package request
+
+import (
+	"fmt"
+	"github.com/PayRam/go-referral/errors"
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// FieldRules declares which columns of a list request may be used for sorting, selecting and grouping.
+// Anything else is rejected with an *InvalidFieldError instead of reaching the SQL.
+type FieldRules struct {
+	Table      string   // Table the columns are qualified with, e.g. "rewards", named after the naming of the DB
+	Alias      string   // Alias the columns are qualified with instead of Table, e.g. of a derived table
+	Sortable   []string // Only non-null columns, so that cursors can always be issued
+	Selectable []string
+	Groupable  []string
+
+	qualifier string // Table or Alias as written in the queries, set by in
+}
+
+// InvalidFieldError is returned when a request sorts, selects or groups by a field it does not allow
+type InvalidFieldError struct {
+	Field   string // Request field holding the value, e.g. "sortBy"
+	Value   string
+	Allowed []string
+}
+
+func (e *InvalidFieldError) Error() string {
+	if len(e.Allowed) == 0 {
+		return fmt.Sprintf("invalid %s '%s'", e.Field, e.Value)
+	}
+	return fmt.Sprintf("invalid %s '%s': must be one of %s", e.Field, e.Value, strings.Join(e.Allowed, ", "))
+}
+
+// Is makes InvalidFieldError match errors.ErrValidation, like the validation errors of the services
+func (e *InvalidFieldError) Is(target error) bool {
+	return target == errors.ErrValidation
+}
+
+// in returns the rules qualifying the columns as the queries of db do, i.e. with the table named after the naming of db
+func (r FieldRules) in(db *gorm.DB) FieldRules {
+	r.qualifier = r.Alias
+	if r.qualifier == "" && r.Table != "" {
+		r.qualifier = models.Table(db, r.Table)
+	}
+	return r
+}
+
+func (r FieldRules) column(field string) string {
+	if r.qualifier == "" {
+		return field
+	}
+	return r.qualifier + "." + field
+}
+
+func contains(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// sortKeys parses SortBy, a comma-separated list of fields each optionally suffixed with ":asc"/":desc" or
+// prefixed with "-" for descending order. Fields without a direction use Order. When the keys are used for
+// keyset pagination, id is appended as a tie-breaker so that the order is total.
+func (c PaginationConditions) sortKeys(rules FieldRules, withTieBreaker bool) ([]sortKey, error) {
+	defaultDesc := false
+	if c.Order != nil && *c.Order != "" {
+		switch strings.ToLower(*c.Order) {
+		case "asc":
+		case "desc":
+			defaultDesc = true
+		default:
+			return nil, &InvalidFieldError{Field: "order", Value: *c.Order, Allowed: []string{"asc", "desc"}}
+		}
+	}
+
+	var keys []sortKey
+	if c.SortBy != nil && *c.SortBy != "" {
+		for _, part := range strings.Split(*c.SortBy, ",") {
+			part = strings.TrimSpace(part)
+			desc := defaultDesc
+
+			if strings.HasPrefix(part, "-") {
+				part, desc = part[1:], true
+			} else if field, direction, found := strings.Cut(part, ":"); found {
+				switch strings.ToLower(direction) {
+				case "asc":
+					desc = false
+				case "desc":
+					desc = true
+				default:
+					return nil, &InvalidFieldError{Field: "sortBy", Value: part, Allowed: []string{field + ":asc", field + ":desc"}}
+				}
+				part = field
+			}
+
+			if !contains(rules.Sortable, part) {
+				return nil, &InvalidFieldError{Field: "sortBy", Value: part, Allowed: rules.Sortable}
+			}
+			keys = append(keys, sortKey{Field: part, Column: rules.column(part), Desc: desc})
+		}
+	}
+
+	if withTieBreaker {
+		hasID := false
+		for _, key := range keys {
+			hasID = hasID || key.Field == "id"
+		}
+		if !hasID {
+			desc := defaultDesc
+			if len(keys) > 0 {
+				desc = keys[len(keys)-1].Desc
+			}
+			keys = append(keys, sortKey{Field: "id", Column: rules.column("id"), Desc: desc})
+		}
+	}
+
+	return keys, nil
+}
+
+func (r FieldRules) selectColumns(selectFields []string) ([]string, error) {
+	columns := make([]string, len(selectFields))
+	for i, field := range selectFields {
+		field = strings.TrimSpace(field)
+		if !contains(r.Selectable, field) {
+			return nil, &InvalidFieldError{Field: "selectFields", Value: field, Allowed: r.Selectable}
+		}
+		columns[i] = r.column(field)
+	}
+	return columns, nil
+}
+
+func (r FieldRules) groupColumns(groupBy string) ([]string, error) {
+	var columns []string
+	for _, field := range strings.Split(groupBy, ",") {
+		field = strings.TrimSpace(field)
+		if !contains(r.Groupable, field) {
+			return nil, &InvalidFieldError{Field: "groupBy", Value: field, Allowed: r.Groupable}
+		}
+		columns = append(columns, r.column(field))
+	}
+	return columns, nil
+}
+
+// ReferrerStatsFields are the fields GetReferrerMembersStats can sort by. The stats are paginated as a
+// derived table, so the aggregated columns are sortable too.
+var ReferrerStatsFields = FieldRules{
+	Alias:    "stats",
+	Sortable: []string{"id", "project", "reference_id", "code", "referee_count", "total_rewards", "is_referred", "created_at", "updated_at"},
+}
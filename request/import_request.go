@@ -0,0 +1,7 @@
+package request
+
+type ImportRequest struct {
+	Format    string `json:"format" binding:"required"` // "csv" or "jsonl"
+	ChunkSize int    `json:"chunkSize"`                 // Rows committed per transaction, defaults to 500
+	DryRun    bool   `json:"dryRun"`                    // Validate and insert everything, then roll back
+}
@@ -1,6 +1,10 @@
 package request
 
-import "gorm.io/gorm"
+import (
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+	"sort"
+)
 
 type CreateMemberRequest struct {
 	ReferenceID   string  `json:"referenceID" binding:"required"`
@@ -8,11 +12,36 @@ type CreateMemberRequest struct {
 	PreferredCode *string `json:"preferredCode"`
 	CampaignIDs   []uint  `json:"campaignIDs"`
 	Email         *string `json:"email"`
+	VisitorID     *string `json:"visitorID"` // Visitor ID of the clicks of the member, attributing them when ReferrerCode is empty
+
+	Attributes models.Attributes `json:"attributes"` // Custom attributes, following the attribute schema of the project
 }
 
 type UpdateMemberRequest struct {
-	CampaignIDs []uint  `json:"campaignIDs"`
-	Email       *string `json:"email"`
+	CampaignIDs []uint            `json:"campaignIDs"`
+	Email       *string           `json:"email"`
+	Attributes  models.Attributes `json:"attributes"` // Merged into the attributes of the member, null values removing them
+}
+
+// UpdateMemberStatusRequest changes the status of a member, e.g. to suspend it
+type UpdateMemberStatusRequest struct {
+	Status string  `json:"status" binding:"required"` // One of the statuses of models.Member
+	Actor  *string `json:"actor"`                     // Who changes the status, recorded in the audit log
+	Reason *string `json:"reason"`
+}
+
+// ForgetMemberRequest erases the personal data of a member, e.g. for a deletion request
+type ForgetMemberRequest struct {
+	Actor  *string `json:"actor"` // Who erases the member, recorded in the audit log
+	Reason *string `json:"reason"`
+}
+
+// AttachReferrerRequest attaches a referrer to a member who signed up without one
+type AttachReferrerRequest struct {
+	ReferrerCode          string  `json:"referrerCode" binding:"required"`
+	EventsAfterAttachment *bool   `json:"eventsAfterAttachment"` // Only later event logs earn rewards. Defaults to the late referral policy.
+	Actor                 *string `json:"actor"`                 // Who attaches the referrer, recorded in the audit log
+	Reason                *string `json:"reason"`
 }
 
 type GetMemberRequest struct {
@@ -25,44 +54,79 @@ type GetMemberRequest struct {
 	IsReferred                  *bool                `form:"isReferrer"`
 	ReferredByMemberID          *uint                `form:"referredByMemberID"`
 	ReferredByMemberReferenceID *string              `form:"referredByMemberReferenceID"`
+	ReferredByCodeID            *uint                `form:"referredByCodeID"`     // Members who signed up with this referral code
+	Attributes                  map[string]string    `form:"attributes"`           // Members with all these attributes, numbers and booleans formatted as by models.AttributeText
 	PaginationConditions        PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
 }
 
+// AllowedFields returns the fields PaginationConditions may sort, select and group members by
+func (GetMemberRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "members",
+		Sortable:   []string{"id", "project", "reference_id", "code", "status", "created_at", "updated_at"},
+		Selectable: []string{"id", "project", "reference_id", "email", "code", "status", "referred_by_member_id", "referred_by_member_reference_id", "referred_by_code_id", "attributes", "created_at", "updated_at"},
+		Groupable:  []string{"project", "status", "referred_by_member_id", "referred_by_member_reference_id", "referred_by_code_id"},
+	}
+}
+
 func ApplyGetMemberRequest(req GetMemberRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "members")
 	// Apply filters with explicit table name
 	if req.Projects != nil && len(req.Projects) > 0 {
-		query = query.Where("referral_members.project IN (?)", req.Projects)
+		query = query.Where(table+".project IN (?)", req.Projects)
 	}
 	if req.ID != nil {
-		query = query.Where("referral_members.id = ?", *req.ID)
+		query = query.Where(table+".id = ?", *req.ID)
 	}
 	if req.ReferenceID != nil {
-		query = query.Where("referral_members.reference_id = ?", *req.ReferenceID)
+		query = query.Where(table+".reference_id = ?", *req.ReferenceID)
 	}
 	if req.Email != nil {
-		query = query.Where("referral_members.email = ?", *req.Email)
+		// Encrypted emails are looked up by their blind index, and those stored before encryption was enabled, not
+		// indexed until go_referral.ReencryptPII runs, as they are
+		if index, err := models.EmailIndex(models.KeyProviderOf(query), req.Email); err != nil {
+			query.AddError(err)
+		} else if index != nil {
+			query = query.Where("("+table+".email_index = ? OR ("+table+".email_index IS NULL AND "+table+".email = ?))",
+				*index, *req.Email)
+		} else {
+			query = query.Where(table+".email = ?", *req.Email)
+		}
 	}
 	if req.Code != nil {
-		query = query.Where("referral_members.code = ?", *req.Code)
+		query = query.Where(table+".code = ?", *req.Code)
 	}
 	if req.IsReferred != nil {
 		if *req.IsReferred {
-			query = query.Where("referral_members.referred_by_member_id IS NOT NULL")
+			query = query.Where(table + ".referred_by_member_id IS NOT NULL")
 		} else {
-			query = query.Where("referral_members.referred_by_member_id IS NULL")
+			query = query.Where(table + ".referred_by_member_id IS NULL")
 		}
 	}
 	if req.ReferredByMemberID != nil {
-		query = query.Where("referral_members.referred_by_member_id = ?", *req.ReferredByMemberID)
+		query = query.Where(table+".referred_by_member_id = ?", *req.ReferredByMemberID)
 	}
 	if req.ReferredByMemberReferenceID != nil {
-		query = query.Where("referral_members.referred_by_member_reference_id = ?", *req.ReferredByMemberReferenceID)
+		query = query.Where(table+".referred_by_member_reference_id = ?", *req.ReferredByMemberReferenceID)
+	}
+	if req.ReferredByCodeID != nil {
+		query = query.Where(table+".referred_by_code_id = ?", *req.ReferredByCodeID)
+	}
+	if len(req.Attributes) > 0 {
+		keys := make([]string, 0, len(req.Attributes))
+		for key := range req.Attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			query = query.Where("EXISTS (SELECT 1 FROM "+models.Table(query, "member_attributes")+" ma WHERE ma.member_id = "+table+".id AND ma.key = ? AND ma.value = ?)",
+				key, req.Attributes[key])
+		}
 	}
 	if req.CampaignIDs != nil && len(req.CampaignIDs) > 0 {
-		// Join with referral_members_campaigns table to filter by CampaignIDs
-		query = query.Joins("JOIN referral_members_campaigns rc ON rc.referrer_id = referral_members.id").
-			Where("rc.campaign_id IN (?)", req.CampaignIDs).
-			Group("referral_members.id") // Avoid duplicates due to the JOIN
+		// A subquery rather than a join, which would duplicate the members enrolled in several of the campaigns
+		query = query.Where("EXISTS (SELECT 1 FROM "+models.Table(query, "member_campaigns")+" mc WHERE mc.member_id = "+table+".id AND mc.campaign_id IN (?))",
+			req.CampaignIDs)
 	}
 	return query
 }
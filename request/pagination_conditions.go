@@ -3,6 +3,7 @@ package request
 import (
 	"fmt"
 	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
@@ -21,64 +22,73 @@ type PaginationConditions struct {
 	EndDate       *time.Time `form:"endDate"`       // Filter records created after this date
 	GroupBy       *string    `form:"groupBy"`
 	SelectFields  []string   `form:"selectFields"`
+	Cursor        *string    `form:"cursor"` // Opaque cursor from a previous page's nextCursor/prevCursor
 }
 
-func ApplySelectFields(query *gorm.DB, selectFields []string) *gorm.DB {
+// ApplySelectFields restricts the selected columns to selectFields, which must all be selectable
+func ApplySelectFields(query *gorm.DB, selectFields []string, rules FieldRules) *gorm.DB {
 	if len(selectFields) > 0 {
-		query = query.Select(selectFields)
+		columns, err := rules.in(query).selectColumns(selectFields)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+		query = query.Select(columns)
 	}
 	return query
 }
 
-func ApplyGroupBy(query *gorm.DB, groupBy *string) *gorm.DB {
+// ApplyGroupBy groups by groupBy, a comma-separated list of groupable fields
+func ApplyGroupBy(query *gorm.DB, groupBy *string, rules FieldRules) *gorm.DB {
 	if groupBy != nil && *groupBy != "" {
-		query = query.Group(*groupBy)
+		columns, err := rules.in(query).groupColumns(*groupBy)
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+		query = query.Group(strings.Join(columns, ", "))
 	}
 	return query
 }
 
-func ApplyPaginationConditions(query *gorm.DB, conditions PaginationConditions) *gorm.DB {
+// ApplyPaginationConditions applies the filters, order and limit of conditions to query. Cursors are verified with
+// cursorKey, the key BuildPageInfo signed them with.
+func ApplyPaginationConditions(query *gorm.DB, conditions PaginationConditions, rules FieldRules, cursorKey []byte) *gorm.DB {
+	rules = rules.in(query)
+
 	// Count total records (optional based on use case)
-	if conditions.Offset != nil && *conditions.Offset > 0 {
+	if conditions.Offset != nil && *conditions.Offset > 0 && conditions.Cursor == nil {
 		query = query.Offset(*conditions.Offset)
 	}
 
 	// Apply ID-based pagination
 	if conditions.GreaterThanID != nil {
-		query = query.Where("id > ?", *conditions.GreaterThanID)
+		query = query.Where(rules.column("id")+" > ?", *conditions.GreaterThanID)
 	}
 	if conditions.LessThanID != nil {
-		query = query.Where("id < ?", *conditions.LessThanID)
+		query = query.Where(rules.column("id")+" < ?", *conditions.LessThanID)
 	}
 
 	// Apply date filters
-	if conditions.CreatedAfter != nil {
-		query = query.Where("created_at > ?", *conditions.CreatedAfter)
-	}
-	if conditions.CreatedBefore != nil {
-		query = query.Where("created_at < ?", *conditions.CreatedBefore)
-	}
-	if conditions.UpdatedAfter != nil {
-		query = query.Where("updated_at > ?", *conditions.UpdatedAfter)
-	}
-	if conditions.UpdatedBefore != nil {
-		query = query.Where("updated_at < ?", *conditions.UpdatedBefore)
-	}
+	query = ApplyDateConditions(query, rules.qualifier, conditions)
 
-	if conditions.StartDate != nil {
-		query = query.Where("created_at >= ?", *conditions.StartDate)
-	}
-	if conditions.EndDate != nil {
-		query = query.Where("created_at <= ?", *conditions.EndDate)
+	// Keyset pagination: sorting and limit are derived from the cursor
+	if usesKeyset(conditions) {
+		return applyCursor(query, conditions, rules, cursorKey)
 	}
 
 	// ✅ Sorting logic
-	if conditions.SortBy != nil {
+	keys, err := conditions.sortKeys(rules, false)
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+	for _, key := range keys {
 		order := "ASC"
-		if conditions.Order != nil {
-			order = *conditions.Order
+		if key.Desc {
+			order = "DESC"
 		}
-		query = query.Order(fmt.Sprintf("%s %s", *conditions.SortBy, order))
+		query = query.Order(fmt.Sprintf("%s %s", key.Column, order))
 	}
 
 	// Apply limit
@@ -88,3 +98,30 @@ func ApplyPaginationConditions(query *gorm.DB, conditions PaginationConditions)
 
 	return query
 }
+
+// ApplyDateConditions applies only the date filters of conditions, qualified with table so that created_at is
+// not ambiguous in queries joining several tables.
+func ApplyDateConditions(query *gorm.DB, table string, conditions PaginationConditions) *gorm.DB {
+	if table != "" {
+		table += "."
+	}
+	if conditions.CreatedAfter != nil {
+		query = query.Where(table+"created_at > ?", *conditions.CreatedAfter)
+	}
+	if conditions.CreatedBefore != nil {
+		query = query.Where(table+"created_at < ?", *conditions.CreatedBefore)
+	}
+	if conditions.UpdatedAfter != nil {
+		query = query.Where(table+"updated_at > ?", *conditions.UpdatedAfter)
+	}
+	if conditions.UpdatedBefore != nil {
+		query = query.Where(table+"updated_at < ?", *conditions.UpdatedBefore)
+	}
+	if conditions.StartDate != nil {
+		query = query.Where(table+"created_at >= ?", *conditions.StartDate)
+	}
+	if conditions.EndDate != nil {
+		query = query.Where(table+"created_at <= ?", *conditions.EndDate)
+	}
+	return query
+}
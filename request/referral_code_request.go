@@ -0,0 +1,62 @@
+package request
+
+import (
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+type CreateReferralCodeRequest struct {
+	Code       *string    `json:"code"`       // Vanity code, generated following the code policy if nil
+	Channel    *string    `json:"channel"`    // e.g. "twitter", "newsletter"
+	CampaignID *uint      `json:"campaignID"` // Campaign the code is bound to
+	UsageLimit *int64     `json:"usageLimit"` // Referrals the code accepts
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+type GetReferralCodesRequest struct {
+	Projects             []string             `form:"projects"`
+	IDs                  []uint               `form:"ids"`
+	Code                 *string              `form:"code"`
+	MemberReferenceID    *string              `form:"memberReferenceID"`
+	Channel              *string              `form:"channel"`
+	CampaignID           *uint                `form:"campaignID"`
+	IsPrimary            *bool                `form:"isPrimary"`
+	PaginationConditions PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
+}
+
+// AllowedFields returns the fields PaginationConditions may sort, select and group referral codes by
+func (GetReferralCodesRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "codes",
+		Sortable:   []string{"id", "project", "code", "member_reference_id", "usage_count", "created_at", "updated_at"},
+		Selectable: []string{"id", "project", "code", "member_id", "member_reference_id", "is_primary", "channel", "campaign_id", "usage_limit", "usage_count", "expires_at", "created_at", "updated_at"},
+		Groupable:  []string{"project", "member_reference_id", "channel", "campaign_id"},
+	}
+}
+
+func ApplyGetReferralCodesRequest(req GetReferralCodesRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "codes")
+	if len(req.Projects) > 0 {
+		query = query.Where(table+".project IN (?)", req.Projects)
+	}
+	if len(req.IDs) > 0 {
+		query = query.Where(table+".id IN (?)", req.IDs)
+	}
+	if req.Code != nil {
+		query = query.Where(table+".code = ?", *req.Code)
+	}
+	if req.MemberReferenceID != nil {
+		query = query.Where(table+".member_reference_id = ?", *req.MemberReferenceID)
+	}
+	if req.Channel != nil {
+		query = query.Where(table+".channel = ?", *req.Channel)
+	}
+	if req.CampaignID != nil {
+		query = query.Where(table+".campaign_id = ?", *req.CampaignID)
+	}
+	if req.IsPrimary != nil {
+		query = query.Where(table+".is_primary = ?", *req.IsPrimary)
+	}
+	return query
+}
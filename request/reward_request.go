@@ -1,6 +1,9 @@
 package request
 
-import "gorm.io/gorm"
+import (
+	"github.com/PayRam/go-referral/models"
+	"gorm.io/gorm"
+)
 
 type GetRewardRequest struct {
 	Projects                  []string             `form:"projects"`                  // Filter by name
@@ -15,33 +18,44 @@ type GetRewardRequest struct {
 	PaginationConditions      PaginationConditions `form:"paginationConditions"` // Embedded pagination and sorting struct
 }
 
+// AllowedFields returns the fields PaginationConditions may sort, select and group rewards by
+func (GetRewardRequest) AllowedFields() FieldRules {
+	return FieldRules{
+		Table:      "rewards",
+		Sortable:   []string{"id", "project", "campaign_id", "currency_code", "rewarded_member_id", "rewarded_member_reference_id", "related_member_id", "related_member_reference_id", "member_type", "amount", "status", "created_at", "updated_at"},
+		Selectable: []string{"id", "project", "campaign_id", "currency_code", "rewarded_member_id", "rewarded_member_reference_id", "related_member_id", "related_member_reference_id", "member_type", "amount", "status", "reason", "hold_expires_at", "created_at", "updated_at"},
+		Groupable:  []string{"project", "campaign_id", "currency_code", "rewarded_member_id", "rewarded_member_reference_id", "related_member_id", "related_member_reference_id", "member_type", "status"},
+	}
+}
+
 func ApplyGetRewardRequest(req GetRewardRequest, query *gorm.DB) *gorm.DB {
+	table := models.Table(query, "rewards")
 	if req.Projects != nil && len(req.Projects) > 0 {
-		query = query.Where("referral_rewards.project IN (?)", req.Projects)
+		query = query.Where(table+".project IN (?)", req.Projects)
 	}
 	if req.IDs != nil && len(req.IDs) > 0 {
-		query = query.Where("referral_rewards.id IN (?)", req.IDs)
+		query = query.Where(table+".id IN (?)", req.IDs)
 	}
 	if req.CampaignIDs != nil && len(req.CampaignIDs) > 0 {
-		query = query.Where("referral_rewards.campaign_id IN (?)", req.CampaignIDs)
+		query = query.Where(table+".campaign_id IN (?)", req.CampaignIDs)
 	}
 	if req.RelatedMemberID != nil {
-		query = query.Where("referral_rewards.related_member_id = ?", *req.RelatedMemberID)
+		query = query.Where(table+".related_member_id = ?", *req.RelatedMemberID)
 	}
 	if req.RelatedMemberReferenceID != nil {
-		query = query.Where("referral_rewards.related_member_reference_id = ?", *req.RelatedMemberReferenceID)
+		query = query.Where(table+".related_member_reference_id = ?", *req.RelatedMemberReferenceID)
 	}
 	if req.RewardedMemberID != nil {
-		query = query.Where("referral_rewards.rewarded_member_id = ?", *req.RewardedMemberID)
+		query = query.Where(table+".rewarded_member_id = ?", *req.RewardedMemberID)
 	}
 	if req.RewardedMemberReferenceID != nil {
-		query = query.Where("referral_rewards.rewarded_member_reference_id = ?", *req.RewardedMemberReferenceID)
+		query = query.Where(table+".rewarded_member_reference_id = ?", *req.RewardedMemberReferenceID)
 	}
 	if req.CurrencyCode != nil {
-		query = query.Where("referral_rewards.currency_code = ?", *req.CurrencyCode)
+		query = query.Where(table+".currency_code = ?", *req.CurrencyCode)
 	}
 	if req.Status != nil {
-		query = query.Where("referral_rewards.status = ?", *req.Status)
+		query = query.Where(table+".status = ?", *req.Status)
 	}
 	return query
 }
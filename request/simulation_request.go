@@ -0,0 +1,12 @@
+package request
+
+import "time"
+
+// SimulateRequest selects the campaign and the event logs of a simulated worker pass. The campaign is either a saved
+// one, by CampaignID, or an unsaved configuration.
+type SimulateRequest struct {
+	CampaignID *uint                  `json:"campaignID"`              // Saved campaign to simulate
+	Campaign   *CreateCampaignRequest `json:"campaign"`                // Unsaved campaign to simulate
+	From       time.Time              `json:"from" binding:"required"` // Event logs triggered at or after From
+	To         time.Time              `json:"to" binding:"required"`   // and before To
+}
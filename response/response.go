@@ -1,21 +1,23 @@
 package response
 
 import (
+	"github.com/PayRam/go-referral/models"
 	"github.com/shopspring/decimal"
 	"time"
 )
 
 type ReferrerStats struct {
-	ID           uint            `json:"id"`
-	Project      string          `json:"project"`
-	Email        *string         `json:"email"`
-	ReferenceID  string          `json:"referenceID"`
-	Code         string          `json:"code"`
-	RefereeCount int64           `json:"refereeCount"`
-	TotalRewards decimal.Decimal `json:"totalRewards"`
-	CreatedAt    time.Time       `json:"createdAt"`
-	UpdatedAt    time.Time       `json:"updatedAt"`
-	IsReferred   bool            `json:"isReferred"`
+	ID           uint              `json:"id"`
+	Project      string            `json:"project"`
+	Email        *string           `json:"email"`
+	ReferenceID  string            `json:"referenceID"`
+	Code         string            `json:"code"`
+	Attributes   models.Attributes `json:"attributes,omitempty"` // Custom attributes of the referrer, to split the stats by
+	RefereeCount int64             `json:"refereeCount"`
+	TotalRewards decimal.Decimal   `json:"totalRewards"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+	IsReferred   bool              `json:"isReferred"`
 }
 
 type RewardStats struct {
@@ -23,3 +25,160 @@ type RewardStats struct {
 	TotalRewards    decimal.Decimal `json:"totalRewards"`
 	UniqueReferrers int64           `json:"uniqueReferrers"`
 }
+
+// ReferralTreeNode is a member positioned in a referral tree relative to the queried member.
+type ReferralTreeNode struct {
+	ID                          uint      `json:"id"`
+	Project                     string    `json:"project"`
+	ReferenceID                 string    `json:"referenceID"`
+	Email                       *string   `gorm:"serializer:encrypted" json:"email"`
+	Code                        string    `json:"code"`
+	Status                      string    `json:"status"`
+	ReferredByMemberID          *uint     `json:"referredByMemberID"`
+	ReferredByMemberReferenceID *string   `json:"referredByMemberReferenceID"`
+	Depth                       int       `json:"depth"` // 0 for the queried member, 1 for direct referees / direct referrer, ...
+	CreatedAt                   time.Time `json:"createdAt"`
+}
+
+// DownlineLevel counts the members found at one depth below the queried member
+type DownlineLevel struct {
+	Depth int   `json:"depth"`
+	Count int64 `json:"count"`
+}
+
+// Downline is the referral tree below a member, as returned by MemberService.GetDownline
+type Downline struct {
+	Root          ReferralTreeNode   `json:"root"`
+	MaxDepth      int                `json:"maxDepth"`
+	TotalReferees int64              `json:"totalReferees"`
+	Levels        []DownlineLevel    `json:"levels"`
+	Members       []ReferralTreeNode `json:"members"` // Ordered by depth, then by ID
+}
+
+// SubtreeStats aggregates the referral tree below a member, as returned by MemberService.GetSubtreeStats
+type SubtreeStats struct {
+	MemberID               uint                       `json:"memberID"`
+	ReferenceID            string                     `json:"referenceID"`
+	DirectReferees         int64                      `json:"directReferees"`
+	TotalReferees          int64                      `json:"totalReferees"`
+	Depth                  int                        `json:"depth"`                  // Deepest level reached below the member
+	TotalRewardsByCurrency map[string]decimal.Decimal `json:"totalRewardsByCurrency"` // Rewards earned by the member and everyone below, forfeited ones excluded
+}
+
+type ImportRowError struct {
+	Row         int    `json:"row"` // Line number in the imported stream (CSV line numbers include the header)
+	ReferenceID string `json:"referenceID,omitempty"`
+	Error       string `json:"error"`
+}
+
+type ImportResult struct {
+	DryRun    bool             `json:"dryRun"`
+	TotalRows int              `json:"totalRows"`
+	Imported  int              `json:"imported"`
+	Failed    int              `json:"failed"`
+	Errors    []ImportRowError `json:"errors"`
+}
+
+// EnrollmentResult is the outcome of enrolling the members matching a filter in a campaign
+type EnrollmentResult struct {
+	CampaignID      uint `json:"campaignID"`
+	Matched         int  `json:"matched"`         // Members matching the filter
+	Enrolled        int  `json:"enrolled"`        // Members enrolled by the call
+	AlreadyEnrolled int  `json:"alreadyEnrolled"` // Members enrolled before the call
+}
+
+// RewardExportRow is a reward flattened together with its campaign and members for accounting exports
+type RewardExportRow struct {
+	ID                        uint            `json:"id"`
+	CreatedAt                 time.Time       `json:"createdAt"`
+	Project                   string          `json:"project"`
+	CampaignID                uint            `json:"campaignID"`
+	CampaignName              string          `json:"campaignName"`
+	CurrencyCode              string          `json:"currencyCode"`
+	MemberType                string          `json:"memberType"`
+	Amount                    decimal.Decimal `json:"amount"`
+	Status                    string          `json:"status"`
+	Reason                    *string         `json:"reason"`
+	RewardedMemberID          uint            `json:"rewardedMemberID"`
+	RewardedMemberReferenceID string          `json:"rewardedMemberReferenceID"`
+	RewardedMemberEmail       *string         `gorm:"serializer:encrypted" json:"rewardedMemberEmail"`
+	RelatedMemberID           uint            `json:"relatedMemberID"`
+	RelatedMemberReferenceID  string          `json:"relatedMemberReferenceID"`
+	RelatedMemberEmail        *string         `gorm:"serializer:encrypted" json:"relatedMemberEmail"`
+}
+
+// EventLogExportRow is an event log flattened together with its event and member
+type EventLogExportRow struct {
+	ID                uint             `json:"id"`
+	CreatedAt         time.Time        `json:"createdAt"`
+	Project           string           `json:"project"`
+	EventKey          string           `json:"eventKey"`
+	EventName         string           `json:"eventName"`
+	EventType         string           `json:"eventType"`
+	MemberID          uint             `json:"memberID"`
+	MemberReferenceID string           `json:"memberReferenceID"`
+	MemberEmail       *string          `gorm:"serializer:encrypted" json:"memberEmail"`
+	Amount            *decimal.Decimal `json:"amount"`
+	TriggeredAt       time.Time        `json:"triggeredAt"`
+	Status            string           `json:"status"`
+	FailureReason     *string          `json:"failureReason"`
+	Data              *string          `gorm:"serializer:encrypted" json:"data"`
+}
+
+type PageInfo struct {
+	Total      int64   `json:"total"`
+	NextCursor *string `json:"nextCursor"` // Nil when there is no next page
+	PrevCursor *string `json:"prevCursor"` // Nil when there is no previous page
+}
+
+// MigrationStatus is the state of one migration of the database schema
+type MigrationStatus struct {
+	ID      string `json:"id"`
+	Applied bool   `json:"applied"`
+	Unknown bool   `json:"unknown"` // Applied to the database but not part of this version of the library
+}
+
+// Simulation is what a worker pass over a campaign would do, as computed by Worker.Simulate
+type Simulation struct {
+	CampaignID      uint             `json:"campaignID"` // 0 for an unsaved campaign
+	EventLogs       int64            `json:"eventLogs"`  // Pending event logs the pass considered
+	Rewards         []models.Reward  `json:"rewards"`    // Rewards that would be created, without IDs
+	TotalRewards    decimal.Decimal  `json:"totalRewards"`
+	Budget          *decimal.Decimal `json:"budget"`
+	RemainingBudget *decimal.Decimal `json:"remainingBudget"` // Budget left after the existing and the simulated rewards
+	BudgetExhausted bool             `json:"budgetExhausted"` // The pass would pause the campaign
+	Rejections      map[string]int64 `json:"rejections"`      // Rewards not created, by reason, e.g. cap_exceeded
+}
+
+// CodeStats is the funnel of a referral code: clicks on its links, members who signed up with it, and those of them
+// who converted, i.e. earned a reward of a campaign
+type CodeStats struct {
+	ReferralCodeID    uint    `json:"referralCodeID"`
+	Project           string  `json:"project"`
+	Code              string  `json:"code"`
+	MemberReferenceID string  `json:"memberReferenceID"`
+	Channel           *string `json:"channel"`
+	Clicks            int64   `json:"clicks"`
+	Visitors          int64   `json:"visitors"` // Distinct visitor IDs of the clicks
+	Signups           int64   `json:"signups"`
+	Conversions       int64   `json:"conversions"`
+}
+
+// MemberData is every record tied to a member, as exported by ExportMemberData for an access request
+type MemberData struct {
+	ExportedAt        time.Time                 `json:"exportedAt"`
+	Member            models.Member             `json:"member"`
+	ReferralCodes     []models.ReferralCode     `json:"referralCodes"`
+	Enrollments       []models.Enrollment       `json:"enrollments"`
+	Clicks            []models.Click            `json:"clicks"` // Clicks attributed to the signup of the member
+	EventLogs         []models.EventLog         `json:"eventLogs"`
+	CampaignEventLogs []models.CampaignEventLog `json:"campaignEventLogs"`
+	Rewards           []models.Reward           `json:"rewards"` // Rewards of the member, not those its events earned its referrer
+	AuditLogs         []models.AuditLog         `json:"auditLogs"`
+}
+
+// ReencryptionResult counts the records whose personal data ReencryptPII encrypted or re-encrypted
+type ReencryptionResult struct {
+	Members   int64 `json:"members"`
+	EventLogs int64 `json:"eventLogs"`
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"github.com/PayRam/go-referral/models"
+	"regexp"
+	"time"
+)
+
+// CodeGenerator returns a new referral code for a member of project. CreateMember and ImportMembers call it when
+// the request has no preferred code and the code policy of the project has no Generator.
+type CodeGenerator func(project string) (string, error)
+
+// MemberCodeGenerator generates the referral code of a new member from the member itself, e.g. from their reference
+// ID. attempt is 0, then counts the codes already found taken, so that the generator can vary the code, e.g. with a
+// number.
+type MemberCodeGenerator interface {
+	GenerateCode(member models.Member, attempt int) (string, error)
+}
+
+// MemberCodeGeneratorFunc adapts a function to MemberCodeGenerator
+type MemberCodeGeneratorFunc func(member models.Member, attempt int) (string, error)
+
+func (f MemberCodeGeneratorFunc) GenerateCode(member models.Member, attempt int) (string, error) {
+	return f(member, attempt)
+}
+
+// CodePolicy defines the referral codes of the members of a project. Codes are unique per project. Zero fields take
+// their default.
+type CodePolicy struct {
+	// Generated codes: Prefix, then Length random characters of Alphabet, then Suffix, unless Generator is set
+	Length    int                 // Defaults to 7
+	Alphabet  string              // Defaults to utils.ReferralCodeAlphabet, without duplicate characters
+	Prefix    string              // Prepended to the random characters
+	Suffix    string              // Appended to the random characters
+	Generator MemberCodeGenerator // Generates complete codes instead
+
+	// Vanity codes, given as the preferred code of a member
+	MinLength int            // Defaults to 4
+	MaxLength int            // Defaults to 50, the size of the column
+	Pattern   *regexp.Regexp // Defaults to letters, digits, '-' and '_'
+	Blocklist []string       // Words codes must not contain, compared case insensitively. Applies to generated codes too.
+
+	MaxAttempts int // Codes generated before giving up when they are taken or blocked. Defaults to 10.
+}
+
+// Attribution models of AttributionPolicy
+const (
+	FirstTouch = "first_touch" // The earliest click of the window refers the member
+	LastTouch  = "last_touch"  // The latest click of the window refers the member
+)
+
+// AttributionPolicy decides which click, if any, refers a member who signs up with the visitor ID of clicks but
+// without a referrer code. Zero fields take their default.
+type AttributionPolicy struct {
+	Model  string        // FirstTouch or LastTouch. Defaults to LastTouch.
+	Window time.Duration // How long before the signup clicks count. Defaults to 30 days.
+}
+
+// LateReferralPolicy governs referrers attached to members after their signup, with MemberService.AttachReferrer.
+// Zero fields take their default.
+type LateReferralPolicy struct {
+	GracePeriod           time.Duration // How long after signup a referrer may be attached. Defaults to 7 days.
+	EventsAfterAttachment bool          // Only event logs triggered after the attachment earn rewards, unless the request says otherwise
+}
+
+// AttributeSchema declares the custom attributes the members of a project may have, by key, with the type of each:
+// models.AttributeTypeString, models.AttributeTypeNumber or models.AttributeTypeBool
+type AttributeSchema map[string]string
+
+// FraudCheck vets referrals and rewards before they take effect. Returning an error refuses them: CreateMember fails
+// with a FraudSuspectedError wrapping it, and the worker skips the reward and logs it as rejected.
+type FraudCheck interface {
+	// CheckReferral is called before member is created with referrer as its referrer
+	CheckReferral(member models.Member, referrer models.Member) error
+	// CheckReward is called before the worker creates reward
+	CheckReward(reward models.Reward) error
+}
+
+// Hooks are called after the corresponding change is committed. They run synchronously on the goroutine of the
+// caller, so slow work (e.g. sending a notification) should be handed off. Nil hooks are skipped.
+type Hooks struct {
+	OnMemberCreated         func(member models.Member)
+	OnRewardCreated         func(reward models.Reward)
+	OnCampaignStatusChanged func(campaign models.Campaign, from string)
+	OnMemberStatusChanged   func(member models.Member, from string)
+}
@@ -5,19 +5,20 @@ import (
 	"github.com/PayRam/go-referral/request"
 	"github.com/PayRam/go-referral/response"
 	"github.com/shopspring/decimal"
+	"io"
 )
 
 // EventService handles operations related to events
 type EventService interface {
 	CreateEvent(project string, request request.CreateEventRequest) (*models.Event, error)
-	GetEvents(req request.GetEventsRequest) ([]models.Event, int64, error)
+	GetEvents(req request.GetEventsRequest) ([]models.Event, response.PageInfo, error)
 	UpdateEvent(project, key string, req request.UpdateEventRequest) (*models.Event, error)
 }
 
 // CampaignService handles operations related to campaigns
 type CampaignService interface {
 	CreateCampaign(project string, req request.CreateCampaignRequest) (*models.Campaign, error)
-	GetCampaigns(req request.GetCampaignsRequest) ([]models.Campaign, int64, error)
+	GetCampaigns(req request.GetCampaignsRequest) ([]models.Campaign, response.PageInfo, error)
 	GetTotalCampaigns(req request.GetCampaignsRequest) (int64, error)
 	UpdateCampaign(project string, id uint, req request.UpdateCampaignRequest) (*models.Campaign, error)
 	SetDefaultCampaign(project string, campaignID uint) (*models.Campaign, error)
@@ -28,33 +29,65 @@ type CampaignService interface {
 // MemberService handles operations related to referral codes
 type MemberService interface {
 	CreateMember(project string, req request.CreateMemberRequest) (*models.Member, error)
-	GetMembers(req request.GetMemberRequest) ([]models.Member, int64, error)
+	GetMembers(req request.GetMemberRequest) ([]models.Member, response.PageInfo, error)
 	GetTotalMembers(req request.GetMemberRequest) (int64, error)
 	UpdateMember(project, referenceID string, request request.UpdateMemberRequest) (*models.Member, error)
 	UpdateMemberStatus(project, referenceID string, newStatus string) (*models.Member, error)
+	// ChangeMemberStatus is UpdateMemberStatus with the actor and reason of the change, for the audit log
+	ChangeMemberStatus(project, referenceID string, req request.UpdateMemberStatusRequest) (*models.Member, error)
+	GetDownline(project, referenceID string, maxDepth int) (*response.Downline, error)
+	GetUpline(project, referenceID string) ([]response.ReferralTreeNode, error)
+	GetSubtreeStats(project, referenceID string, maxDepth int) (*response.SubtreeStats, error)
+	ImportMembers(project string, r io.Reader, req request.ImportRequest) (*response.ImportResult, error)
+	AttachReferrer(project, referenceID string, req request.AttachReferrerRequest) (*models.Member, error)
+	GetAuditLogs(req request.GetAuditLogsRequest) ([]models.AuditLog, response.PageInfo, error)
+	EnrollMember(project, referenceID string, campaignID uint) (*models.Enrollment, error)
+	UnenrollMember(project, referenceID string, campaignID uint) (*models.Enrollment, error)
+	// EnrollMembers enrolls every member of project matching filter in a campaign
+	EnrollMembers(project string, campaignID uint, filter request.GetMemberRequest) (*response.EnrollmentResult, error)
+	// GetEnrollments returns the enrollment history of members, ended enrollments included
+	GetEnrollments(req request.GetEnrollmentsRequest) ([]models.Enrollment, response.PageInfo, error)
+	// ForgetMember erases the personal data of a member, keeping its rewards under a pseudonym of its reference ID
+	ForgetMember(project, referenceID string, req request.ForgetMemberRequest) (*models.Member, error)
+	// ExportMemberData writes every record tied to a member to w as a JSON document
+	ExportMemberData(w io.Writer, project, referenceID string) error
+}
+
+type ReferralCodeService interface {
+	CreateReferralCode(project, referenceID string, req request.CreateReferralCodeRequest) (*models.ReferralCode, error)
+	GetReferralCodes(req request.GetReferralCodesRequest) ([]models.ReferralCode, response.PageInfo, error)
+	RecordClick(project string, req request.CreateClickRequest) (*models.Click, error)
+	GetClicks(req request.GetClicksRequest) ([]models.Click, response.PageInfo, error)
+	// GetCodeStats returns the clicks, signups and conversions of the referral codes req selects
+	GetCodeStats(req request.GetReferralCodesRequest) ([]response.CodeStats, response.PageInfo, error)
 }
 
 type EventLogService interface {
 	CreateEventLog(project string, req request.CreateEventLogRequest) (*models.EventLog, error)
-	GetEventLogs(req request.GetEventLogRequest) ([]models.EventLog, int64, error)
+	GetEventLogs(req request.GetEventLogRequest) ([]models.EventLog, response.PageInfo, error)
+	ImportEventLogs(project string, r io.Reader, req request.ImportRequest) (*response.ImportResult, error)
+	ExportEventLogs(w io.Writer, exportReq request.ExportRequest, req request.GetEventLogRequest) (int64, error)
 }
 
 type CampaignEventLogService interface {
-	GetCampaignEventLogs(req request.GetCampaignEventLogRequest) ([]models.CampaignEventLog, int64, error)
+	GetCampaignEventLogs(req request.GetCampaignEventLogRequest) ([]models.CampaignEventLog, response.PageInfo, error)
 }
 
 type RewardService interface {
 	GetTotalRewards(request request.GetRewardRequest) (decimal.Decimal, error)
-	GetRewards(req request.GetRewardRequest) ([]models.Reward, int64, error)
+	GetRewards(req request.GetRewardRequest) ([]models.Reward, response.PageInfo, error)
 	GetNewReferrerCount(req request.GetRewardRequest) (int64, error)
 	GetNewRefereeCount(req request.GetRewardRequest) (int64, error)
+	ExportRewards(w io.Writer, exportReq request.ExportRequest, req request.GetRewardRequest) (int64, error)
 }
 
 type AggregatorService interface {
-	GetReferrerMembersStats(req request.GetMemberRequest) ([]response.ReferrerStats, int64, error)
+	GetReferrerMembersStats(req request.GetMemberRequest) ([]response.ReferrerStats, response.PageInfo, error)
 	GetRewardsStats(req request.GetRewardRequest) ([]response.RewardStats, error)
 }
 
 type Worker interface {
 	ProcessPendingEvents() error
+	// Simulate runs a pass over a saved or unsaved campaign and the event logs of a past period, and rolls it back
+	Simulate(project string, req request.SimulateRequest) (*response.Simulation, error)
 }
@@ -8,21 +8,33 @@ import (
 	"testing"
 )
 
-const charset = "BF7CDXR0E3ZHPI1JK9L4N2OAQSFT5UVMW6Y8"
+// ReferralCodeAlphabet holds the characters of the random referral codes: upper case letters and digits, shuffled
+const ReferralCodeAlphabet = "BF7CDXR0E3ZHPI1JK9L4N2OAQSGT5UVMW6Y8"
 
 // CreateReferralCode generates a secure random referral code of the specified length.
 func CreateReferralCode(length int) (string, error) {
+	return CreateCode(ReferralCodeAlphabet, length)
+}
+
+// CreateCode generates a secure random code of length characters of alphabet, each equally likely if alphabet has
+// no duplicate.
+func CreateCode(alphabet string, length int) (string, error) {
 	if length <= 0 {
 		return "", fmt.Errorf("length must be greater than zero")
 	}
+	if alphabet == "" {
+		return "", fmt.Errorf("alphabet must not be empty")
+	}
 
-	code := make([]byte, length)
+	// Characters rather than bytes are picked, as the alphabet may have multibyte characters
+	characters := []rune(alphabet)
+	code := make([]rune, length)
 	for i := range code {
-		randomIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		randomIndex, err := rand.Int(rand.Reader, big.NewInt(int64(len(characters))))
 		if err != nil {
 			return "", fmt.Errorf("failed to generate referral code: %w", err)
 		}
-		code[i] = charset[randomIndex.Int64()]
+		code[i] = characters[randomIndex.Int64()]
 	}
 	return string(code), nil
 }